@@ -0,0 +1,370 @@
+// backend/cli.go
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"backend/repository"
+	"backend/usecase"
+)
+
+// cliPollInterval はコマンドからジョブの進捗を確認する間隔です
+const cliPollInterval = 2 * time.Second
+
+const cliUsage = `使い方:
+  backend                                      APIサーバーを起動します
+  backend sync [-workspace ID] [-channel ID] [-oldest 期間の始まり] [-latest 期間の終わり]
+                                               会話履歴を取り込みます（-channel を省略すると追跡対象のすべてのチャンネル）
+                                               期間は Slack ts、RFC3339、または YYYY-MM-DD で指定します
+                                               ワークスペースはIDか Slack のワークスペースIDで指定します（1 つだけの場合は省略可）
+  backend resume [-workspace ID] -job ID       失敗・中断したジョブを続きから再開します
+  backend workspace list                       インストールされているワークスペースの一覧を表示します
+  backend apikey create -name 名前 (-workspace ID | -global) [-role 権限] [-team チームID]
+                                               API キーを発行します（キーは発行時に一度だけ表示します）
+                                               権限は admin（既定）、lead、member。lead の場合は -team が必要です
+                                               キーで扱うワークスペースを -workspace で指定します
+                                               -global はすべてのワークスペースを扱う admin のキーです
+  backend apikey list                          発行した API キーの一覧を表示します
+  backend apikey revoke -id ID                 API キーを無効化します
+  backend role -user ユーザーID -role 権限     ユーザー（Slack ユーザーID）の権限を admin、lead、member に変更します
+  backend encryption rewrap                    保存済みのトークンとメッセージ本文を先頭の鍵で暗号化し直します
+                                               （暗号化を有効にしたときと、鍵をローテーションしたときに実行）
+  backend messages drop-text                   保存済みのメッセージ本文をすべて消去します（MESSAGE_TEXT_MODE=metadata に切り替えたとき）
+  backend retention purge                      保持期限（RETENTION_*_DAYS）を過ぎたデータを削除します
+  backend retention runs [-limit 件数]         保持期限を過ぎたデータの削除の実行結果を新しい順に表示します
+`
+
+// runCommand はサブコマンドを実行し、終了コードを返します
+// ジョブはAPIサーバーと同じ同期ジョブとして実行するので、進捗は GET /jobs/:id でも確認できます
+// コマンドはサーバーを操作できる管理者が実行するものとして、admin 権限（usecase.SystemPrincipal）で実行します
+func runCommand(jobUsecase *usecase.JobUsecase, slackUsecase *usecase.SlackUsecase, authUsecase *usecase.AuthUsecase, workspaceUsecase *usecase.WorkspaceUsecase, storageUsecase *usecase.StorageUsecase, retentionUsecase *usecase.RetentionUsecase, args []string) int {
+	switch args[0] {
+	case "sync":
+		return runSyncCommand(jobUsecase, workspaceUsecase, args[1:])
+	case "resume":
+		return runResumeCommand(jobUsecase, workspaceUsecase, args[1:])
+	case "workspace":
+		return runWorkspaceCommand(workspaceUsecase, args[1:])
+	case "apikey":
+		return runAPIKeyCommand(authUsecase, workspaceUsecase, args[1:])
+	case "role":
+		return runRoleCommand(slackUsecase, args[1:])
+	case "encryption":
+		return runEncryptionCommand(storageUsecase, args[1:])
+	case "messages":
+		return runMessagesCommand(storageUsecase, args[1:])
+	case "retention":
+		return runRetentionCommand(jobUsecase, retentionUsecase, args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "不明なコマンドです: %s\n\n%s", args[0], cliUsage)
+		return 2
+	}
+}
+
+// runSyncCommand は会話履歴の取り込みジョブを開始し、終了するまで待ちます
+func runSyncCommand(jobUsecase *usecase.JobUsecase, workspaceUsecase *usecase.WorkspaceUsecase, args []string) int {
+	flags := flag.NewFlagSet("sync", flag.ContinueOnError)
+	workspaceFlag := flags.String("workspace", "", "取り込むワークスペース（IDか Slack のワークスペースID）")
+	teamID := flags.Int("channel", 0, "取り込むチャンネル（チーム）のID。省略すると追跡対象のすべてのチャンネル")
+	oldest := flags.String("oldest", "", "取り込む期間の始まり")
+	latest := flags.String("latest", "", "取り込む期間の終わり")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	window, err := usecase.ParseSyncWindow(*oldest, *latest)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "期間の指定が不正です: %v\n", err)
+		return 2
+	}
+
+	workspace, err := workspaceUsecase.ResolveWorkspace(usecase.SystemPrincipal, *workspaceFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ワークスペースの指定が不正です: %v\n", err)
+		return 2
+	}
+
+	var job repository.SyncJob
+	if *teamID != 0 {
+		job, err = jobUsecase.StartChannelSync(usecase.SystemPrincipal, workspace.ID, *teamID, window)
+	} else {
+		job, err = jobUsecase.StartSyncAllChannels(usecase.SystemPrincipal, workspace.ID, window)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "取り込みを開始できませんでした: %v\n", err)
+		return 1
+	}
+
+	return waitForJob(jobUsecase, job)
+}
+
+// runResumeCommand は失敗したジョブを再開し、終了するまで待ちます
+func runResumeCommand(jobUsecase *usecase.JobUsecase, workspaceUsecase *usecase.WorkspaceUsecase, args []string) int {
+	flags := flag.NewFlagSet("resume", flag.ContinueOnError)
+	workspaceFlag := flags.String("workspace", "", "ジョブのワークスペース（IDか Slack のワークスペースID）")
+	jobID := flags.Int64("job", 0, "再開するジョブのID")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *jobID == 0 {
+		fmt.Fprint(os.Stderr, "-job を指定してください\n\n"+cliUsage)
+		return 2
+	}
+
+	workspace, err := workspaceUsecase.ResolveWorkspace(usecase.SystemPrincipal, *workspaceFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ワークスペースの指定が不正です: %v\n", err)
+		return 2
+	}
+
+	job, err := jobUsecase.ResumeJob(usecase.SystemPrincipal, workspace.ID, *jobID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ジョブを再開できませんでした: %v\n", err)
+		return 1
+	}
+
+	return waitForJob(jobUsecase, job)
+}
+
+// runWorkspaceCommand はインストールされているワークスペースの一覧を表示します
+func runWorkspaceCommand(workspaceUsecase *usecase.WorkspaceUsecase, args []string) int {
+	if len(args) == 0 || args[0] != "list" {
+		fmt.Fprint(os.Stderr, cliUsage)
+		return 2
+	}
+
+	workspaces, err := workspaceUsecase.ListWorkspaces(usecase.SystemPrincipal)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ワークスペースの一覧を取得できませんでした: %v\n", err)
+		return 1
+	}
+	for _, w := range workspaces {
+		fmt.Printf("%d\t%s\t%s\t%s\tインストール: %s\n", w.ID, w.SlackTeamID, w.Name, w.URL, w.InstalledAt.Format(time.RFC3339))
+	}
+	return 0
+}
+
+// runAPIKeyCommand は API キーの発行・一覧・無効化を行います
+func runAPIKeyCommand(authUsecase *usecase.AuthUsecase, workspaceUsecase *usecase.WorkspaceUsecase, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, cliUsage)
+		return 2
+	}
+
+	switch args[0] {
+	case "create":
+		flags := flag.NewFlagSet("apikey create", flag.ContinueOnError)
+		name := flags.String("name", "", "用途が分かる名前")
+		role := flags.String("role", usecase.RoleAdmin, "キーの権限（admin、lead、member）")
+		teamID := flags.Int("team", 0, "lead / member の場合に見られるチームのID")
+		workspaceFlag := flags.String("workspace", "", "キーで扱うワークスペース（IDか Slack のワークスペースID）")
+		global := flags.Bool("global", false, "すべてのワークスペースを扱う admin のキーにする")
+		if err := flags.Parse(args[1:]); err != nil {
+			return 2
+		}
+		if (*workspaceFlag != "") == *global {
+			fmt.Fprint(os.Stderr, "-workspace か -global のどちらか一方を指定してください\n\n"+cliUsage)
+			return 2
+		}
+		var teamKey *int
+		if *teamID != 0 {
+			teamKey = teamID
+		}
+		var workspaceID *int
+		if *workspaceFlag != "" {
+			workspace, err := workspaceUsecase.ResolveWorkspace(usecase.SystemPrincipal, *workspaceFlag)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "ワークスペースを選べませんでした: %v\n", err)
+				return 1
+			}
+			workspaceID = &workspace.ID
+		}
+		key, apiKey, err := authUsecase.CreateAPIKey(*name, *role, workspaceID, teamKey)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "API キーを発行できませんでした: %v\n", err)
+			return 1
+		}
+		fmt.Printf("API キー %d (%s, %s) を発行しました。このキーは再表示できないので控えてください:\n%s\n", apiKey.ID, apiKey.Name, apiKey.Role, key)
+		return 0
+	case "list":
+		keys, err := authUsecase.ListAPIKeys()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "API キーの一覧を取得できませんでした: %v\n", err)
+			return 1
+		}
+		for _, key := range keys {
+			status := "有効"
+			if key.RevokedAt != nil {
+				status = "無効"
+			}
+			lastUsed := "-"
+			if key.LastUsedAt != nil {
+				lastUsed = key.LastUsedAt.Format(time.RFC3339)
+			}
+			workspace := "global"
+			if key.WorkspaceID != nil {
+				workspace = fmt.Sprintf("workspace %d", *key.WorkspaceID)
+			}
+			fmt.Printf("%d\t%s...\t%s\t%s\t%s\t%s\t最終利用: %s\n", key.ID, key.Prefix, key.Name, key.Role, workspace, status, lastUsed)
+		}
+		return 0
+	case "revoke":
+		flags := flag.NewFlagSet("apikey revoke", flag.ContinueOnError)
+		id := flags.Int("id", 0, "無効化する API キーのID")
+		if err := flags.Parse(args[1:]); err != nil {
+			return 2
+		}
+		if *id == 0 {
+			fmt.Fprint(os.Stderr, "-id を指定してください\n\n"+cliUsage)
+			return 2
+		}
+		if err := authUsecase.RevokeAPIKey(*id); err != nil {
+			fmt.Fprintf(os.Stderr, "API キーを無効化できませんでした: %v\n", err)
+			return 1
+		}
+		fmt.Printf("API キー %d を無効化しました\n", *id)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "不明なコマンドです: apikey %s\n\n%s", args[0], cliUsage)
+		return 2
+	}
+}
+
+// runRoleCommand はユーザーの権限を変更します。最初の admin を決めるときに使います
+func runRoleCommand(slackUsecase *usecase.SlackUsecase, args []string) int {
+	flags := flag.NewFlagSet("role", flag.ContinueOnError)
+	userKey := flags.String("user", "", "Slack ユーザーID（users.user_key）")
+	role := flags.String("role", "", "権限（admin、lead、member）")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *userKey == "" || *role == "" {
+		fmt.Fprint(os.Stderr, "-user と -role を指定してください\n\n"+cliUsage)
+		return 2
+	}
+
+	user, err := slackUsecase.SetUserRole(usecase.SystemPrincipal, 0, *userKey, *role)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "権限を変更できませんでした: %v\n", err)
+		return 1
+	}
+	fmt.Printf("%s (%s) の権限を %s に変更しました\n", user.UserName, user.UserKey, user.Role)
+	return 0
+}
+
+// runEncryptionCommand は保存済みの値を先頭の鍵で暗号化し直します
+func runEncryptionCommand(storageUsecase *usecase.StorageUsecase, args []string) int {
+	if len(args) == 0 || args[0] != "rewrap" {
+		fmt.Fprint(os.Stderr, cliUsage)
+		return 2
+	}
+
+	report, err := storageUsecase.RewrapStoredValues(usecase.SystemPrincipal)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "暗号化し直せませんでした（ワークスペース %d 件、メッセージ %d 件まで完了）: %v\n", report.Workspaces, report.Messages, err)
+		return 1
+	}
+	fmt.Printf("鍵 %s で暗号化し直しました（ワークスペース %d 件、メッセージ %d 件）\n", report.KeyID, report.Workspaces, report.Messages)
+	return 0
+}
+
+// runMessagesCommand は保存済みのメッセージ本文を消去します
+func runMessagesCommand(storageUsecase *usecase.StorageUsecase, args []string) int {
+	if len(args) == 0 || args[0] != "drop-text" {
+		fmt.Fprint(os.Stderr, cliUsage)
+		return 2
+	}
+
+	dropped, err := storageUsecase.DropMessageText(usecase.SystemPrincipal)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "メッセージ本文を消去できませんでした: %v\n", err)
+		return 1
+	}
+	fmt.Printf("%d 件のメッセージ本文を消去しました\n", dropped)
+	return 0
+}
+
+// runRetentionCommand は保持期限を過ぎたデータの削除と、その実行結果の表示を行います
+func runRetentionCommand(jobUsecase *usecase.JobUsecase, retentionUsecase *usecase.RetentionUsecase, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, cliUsage)
+		return 2
+	}
+
+	switch args[0] {
+	case "purge":
+		job, err := retentionUsecase.StartPurge(usecase.SystemPrincipal)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "削除を開始できませんでした: %v\n", err)
+			return 1
+		}
+		if code := waitForJob(jobUsecase, job); code != 0 {
+			return code
+		}
+		runs, err := retentionUsecase.ListRuns(usecase.SystemPrincipal, 1)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "実行結果を取得できませんでした: %v\n", err)
+			return 1
+		}
+		if len(runs) > 0 {
+			printRetentionRun(runs[0])
+		}
+		return 0
+	case "runs":
+		flags := flag.NewFlagSet("retention runs", flag.ContinueOnError)
+		limit := flags.Int("limit", usecase.DefaultRetentionRunsLimit, "表示する件数")
+		if err := flags.Parse(args[1:]); err != nil {
+			return 2
+		}
+		runs, err := retentionUsecase.ListRuns(usecase.SystemPrincipal, *limit)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "実行結果を取得できませんでした: %v\n", err)
+			return 1
+		}
+		for _, run := range runs {
+			printRetentionRun(run)
+		}
+		return 0
+	default:
+		fmt.Fprint(os.Stderr, cliUsage)
+		return 2
+	}
+}
+
+// printRetentionRun は削除の実行結果を 1 行で表示します
+func printRetentionRun(run repository.RetentionRun) {
+	fmt.Printf("%s  本文の消去 %d 件、メッセージ %d 件、在席状況 %d 件",
+		run.StartedAt.Local().Format(time.RFC3339), run.TextsCleared, run.MessagesDeleted, run.PresenceDeleted)
+	if run.Error != "" {
+		fmt.Printf("（失敗: %s）", run.Error)
+	}
+	fmt.Println()
+}
+
+// waitForJob はジョブが終了するまで進捗を表示し、成功なら 0、失敗なら 1 を返します
+func waitForJob(jobUsecase *usecase.JobUsecase, job repository.SyncJob) int {
+	fmt.Printf("ジョブ %d を開始しました (%s, %s)\n", job.ID, job.Kind, job.Resource)
+
+	for !job.Finished() {
+		time.Sleep(cliPollInterval)
+
+		var err error
+		if job, err = jobUsecase.GetJob(usecase.SystemPrincipal, 0, job.ID); err != nil {
+			fmt.Fprintf(os.Stderr, "ジョブの状態を取得できませんでした: %v\n", err)
+			return 1
+		}
+		fmt.Printf("ジョブ %d: %s (%d/%d)\n", job.ID, job.Status, job.Processed, job.Total)
+	}
+
+	if job.Status == repository.JobStatusFailed {
+		fmt.Fprintf(os.Stderr, "ジョブ %d が失敗しました: %s\n", job.ID, job.Error)
+		fmt.Fprintf(os.Stderr, "続きから再開するには: backend resume -job %d\n", job.ID)
+		return 1
+	}
+
+	fmt.Printf("ジョブ %d が完了しました\n", job.ID)
+	return 0
+}
@@ -0,0 +1,190 @@
+// backend/handler/analytics_handler.go
+package handler
+
+import (
+	"log"
+	"net/http"
+
+	"backend/usecase"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AnalyticsHandler struct {
+	analyticsUsecase *usecase.AnalyticsUsecase
+}
+
+func NewAnalyticsHandler(analyticsUsecase *usecase.AnalyticsUsecase) *AnalyticsHandler {
+	return &AnalyticsHandler{
+		analyticsUsecase: analyticsUsecase,
+	}
+}
+
+// GetActivityHandler は投稿・編集・削除・リアクションの件数の集計APIのハンドラー
+// クエリパラメータ:
+//   - interval: hour, day, week, month（既定 day、期間の区切りは UTC）
+//   - oldest, latest: 期間（Slack ts、RFC3339、または YYYY-MM-DD）
+//   - team_key: その時点でこのチームに所属していたユーザーのみ
+//   - user: Slack ユーザーID（仮名にしている場合は仮名でも指定できる）
+func (h *AnalyticsHandler) GetActivityHandler(c *gin.Context) {
+	query := usecase.ActivityQuery{
+		Interval: c.Query("interval"),
+		UserKey:  c.Query("user"),
+		Oldest:   c.Query("oldest"),
+		Latest:   c.Query("latest"),
+	}
+	if query.Interval == "" {
+		query.Interval = usecase.DefaultActivityInterval
+	}
+	var err error
+	if query.TeamKey, err = parseOptionalIntQuery(c, "team_key"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	activity, err := h.analyticsUsecase.GetActivity(actorFrom(c), workspaceIDFrom(c), query)
+	if err != nil {
+		log.Printf("Error in GetActivityHandler: %v", err)
+		c.JSON(statusFromError(err), gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"interval": query.Interval,
+		"activity": activity,
+	})
+}
+
+// parseAnalyticsQuery はリアクションや共有されたファイル・リンクの集計APIのクエリパラメータを読み取ります
+// 不正な値の場合は 400 を返して false を返します
+func parseAnalyticsQuery(c *gin.Context) (usecase.AnalyticsQuery, bool) {
+	query := usecase.AnalyticsQuery{
+		UserKey: c.Query("user"),
+		Oldest:  c.Query("oldest"),
+		Latest:  c.Query("latest"),
+	}
+	var err error
+	if query.TeamKey, err = parseOptionalIntQuery(c, "team_key"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return query, false
+	}
+	limit, err := parseOptionalIntQuery(c, "limit")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return query, false
+	}
+	if limit != nil {
+		query.Limit = *limit
+	}
+	return query, true
+}
+
+// GetTopEmojiHandler はリアクションに使われた絵文字のランキングAPIのハンドラー
+// クエリパラメータ:
+//   - oldest, latest: 期間（Slack ts、RFC3339、または YYYY-MM-DD）
+//   - team_key: リアクションの時点でこのチームに所属していたユーザーのリアクションのみ
+//   - user: リアクションしたユーザーの Slack ユーザーID（仮名でも指定できる）
+//   - limit: 件数（既定 10、最大 100）
+func (h *AnalyticsHandler) GetTopEmojiHandler(c *gin.Context) {
+	query, ok := parseAnalyticsQuery(c)
+	if !ok {
+		return
+	}
+
+	emoji, err := h.analyticsUsecase.GetTopEmoji(actorFrom(c), workspaceIDFrom(c), query)
+	if err != nil {
+		log.Printf("Error in GetTopEmojiHandler: %v", err)
+		c.JSON(statusFromError(err), gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"emoji": emoji,
+	})
+}
+
+// GetReactionBalancesHandler はユーザーごとのリアクションした数とされた数の集計APIのハンドラー
+// クエリパラメータ:
+//   - oldest, latest: 期間（Slack ts、RFC3339、または YYYY-MM-DD）
+//   - team_key: リアクションの時点でこのチームに所属していたユーザーのみ
+//   - user: Slack ユーザーID（仮名にしている場合は仮名でも指定できる）
+func (h *AnalyticsHandler) GetReactionBalancesHandler(c *gin.Context) {
+	query, ok := parseAnalyticsQuery(c)
+	if !ok {
+		return
+	}
+
+	balances, err := h.analyticsUsecase.GetReactionBalances(actorFrom(c), workspaceIDFrom(c), query)
+	if err != nil {
+		log.Printf("Error in GetReactionBalancesHandler: %v", err)
+		c.JSON(statusFromError(err), gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"reactions": balances,
+	})
+}
+
+// GetTopDomainsHandler はメッセージに含まれるリンクのドメインのランキングAPIのハンドラー
+// クエリパラメータ:
+//   - oldest, latest: 期間（Slack ts、RFC3339、または YYYY-MM-DD）
+//   - team_key: 投稿の時点でこのチームに所属していたユーザーの投稿のみ
+//   - user: 投稿者の Slack ユーザーID（仮名でも指定できる）
+//   - limit: 件数（既定 10、最大 100）
+func (h *AnalyticsHandler) GetTopDomainsHandler(c *gin.Context) {
+	query, ok := parseAnalyticsQuery(c)
+	if !ok {
+		return
+	}
+
+	domains, err := h.analyticsUsecase.GetTopDomains(actorFrom(c), workspaceIDFrom(c), query)
+	if err != nil {
+		log.Printf("Error in GetTopDomainsHandler: %v", err)
+		c.JSON(statusFromError(err), gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"domains": domains,
+	})
+}
+
+// GetFileSharesHandler は共有されたファイルのチームと分類ごとの集計APIのハンドラー
+// クエリパラメータは GetTopDomainsHandler と同じです（limit は使いません）
+func (h *AnalyticsHandler) GetFileSharesHandler(c *gin.Context) {
+	query, ok := parseAnalyticsQuery(c)
+	if !ok {
+		return
+	}
+
+	files, err := h.analyticsUsecase.GetFileShares(actorFrom(c), workspaceIDFrom(c), query)
+	if err != nil {
+		log.Printf("Error in GetFileSharesHandler: %v", err)
+		c.JSON(statusFromError(err), gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"files": files,
+	})
+}
+
+// GetPolicyHandler は集計で人の活動とみなすメッセージの方針と、プライバシーの設定を返すAPIのハンドラー
+// subtypes の "" は通常の投稿を表します
+func (h *AnalyticsHandler) GetPolicyHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"policy":  h.analyticsUsecase.GetPolicy(),
+		"privacy": h.analyticsUsecase.GetPrivacy(),
+	})
+}
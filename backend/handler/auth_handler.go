@@ -0,0 +1,328 @@
+// backend/handler/auth_handler.go
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"backend/repository"
+	"backend/usecase"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Authenticator はリクエストから認証情報を読み取り、主体を返します
+// リクエストにこの方式の認証情報が含まれない場合は ok = false を返し、次の方式を試します
+// 認証情報が含まれているが不正な場合はエラー（repository.ErrUnauthorized）を返します
+type Authenticator interface {
+	Authenticate(c *gin.Context) (principal usecase.Principal, ok bool, err error)
+}
+
+// principalKey は認証された主体を gin.Context に保存するキーです
+const principalKey = "principal"
+
+// AuthMiddleware は authenticators を順に試し、いずれかで認証できたリクエストだけを通すミドルウェアです
+// 認証できなかった場合は 401 と {"error": ...} を返します
+func AuthMiddleware(authenticators ...Authenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, authenticator := range authenticators {
+			principal, ok, err := authenticator.Authenticate(c)
+			if err != nil {
+				if !errors.Is(err, repository.ErrUnauthorized) {
+					log.Printf("Error in AuthMiddleware: %v", err)
+				}
+				c.AbortWithStatusJSON(statusFromError(err), gin.H{
+					"error": err.Error(),
+				})
+				return
+			}
+			if ok {
+				c.Set(principalKey, principal)
+				c.Next()
+				return
+			}
+		}
+
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "Authentication required",
+		})
+	}
+}
+
+// PrincipalFrom は AuthMiddleware で認証された主体を返します
+func PrincipalFrom(c *gin.Context) (usecase.Principal, bool) {
+	value, ok := c.Get(principalKey)
+	if !ok {
+		return usecase.Principal{}, false
+	}
+	principal, ok := value.(usecase.Principal)
+	return principal, ok
+}
+
+// actorFrom は Usecase に渡す、リクエストの主体を返します
+// AuthMiddleware を通っていない場合は権限のない主体を返すので、Usecase の権限チェックで拒否されます
+func actorFrom(c *gin.Context) usecase.Principal {
+	principal, _ := PrincipalFrom(c)
+	return principal
+}
+
+// RequireRole は主体の権限が roles のいずれかであるリクエストだけを通すミドルウェアです
+// AuthMiddleware の後に使います。権限がない場合は 403 と {"error": ...} を返します
+// 権限は Usecase でも確認するので、これは早めに拒否するためのものです
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal := actorFrom(c)
+		for _, role := range roles {
+			if principal.Role == role {
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": "Insufficient role",
+		})
+	}
+}
+
+// APIKeyAuthenticator は "Authorization: Bearer <API キー>" または "X-API-Key: <API キー>" ヘッダーで認証します
+type APIKeyAuthenticator struct {
+	authUsecase *usecase.AuthUsecase
+}
+
+func NewAPIKeyAuthenticator(authUsecase *usecase.AuthUsecase) *APIKeyAuthenticator {
+	return &APIKeyAuthenticator{authUsecase: authUsecase}
+}
+
+func (a *APIKeyAuthenticator) Authenticate(c *gin.Context) (usecase.Principal, bool, error) {
+	key := c.GetHeader("X-API-Key")
+	if authorization := c.GetHeader("Authorization"); key == "" && authorization != "" {
+		scheme, token, _ := strings.Cut(authorization, " ")
+		if !strings.EqualFold(scheme, "Bearer") {
+			return usecase.Principal{}, false, nil
+		}
+		key = strings.TrimSpace(token)
+	}
+	if key == "" {
+		return usecase.Principal{}, false, nil
+	}
+
+	principal, err := a.authUsecase.AuthenticateAPIKey(key)
+	if err != nil {
+		return usecase.Principal{}, false, err
+	}
+	return principal, true, nil
+}
+
+// SessionCookieName はセッショントークンを入れるクッキーの名前です
+const SessionCookieName = "session"
+
+// SessionAuthenticator は署名付きのセッションクッキーで認証します
+// クッキーは別サイトからのリクエストにも付くため（CSRF）、GET と HEAD 以外のリクエストは
+// Origin（ない場合は Referer）が allowedOrigins のいずれかである場合だけ受け付けます
+type SessionAuthenticator struct {
+	authUsecase    *usecase.AuthUsecase
+	allowedOrigins map[string]bool
+}
+
+func NewSessionAuthenticator(authUsecase *usecase.AuthUsecase, allowedOrigins []string) *SessionAuthenticator {
+	origins := map[string]bool{}
+	for _, origin := range allowedOrigins {
+		if o := originOf(origin); o != "" {
+			origins[o] = true
+		}
+	}
+	return &SessionAuthenticator{authUsecase: authUsecase, allowedOrigins: origins}
+}
+
+func (a *SessionAuthenticator) Authenticate(c *gin.Context) (usecase.Principal, bool, error) {
+	token, err := c.Cookie(SessionCookieName)
+	if err != nil || token == "" {
+		return usecase.Principal{}, false, nil
+	}
+	if err := a.checkOrigin(c); err != nil {
+		return usecase.Principal{}, false, err
+	}
+
+	principal, err := a.authUsecase.AuthenticateSession(token)
+	if err != nil {
+		return usecase.Principal{}, false, err
+	}
+	return principal, true, nil
+}
+
+// checkOrigin は状態を変えるリクエストの送信元がフロントエンドであることを確認します
+func (a *SessionAuthenticator) checkOrigin(c *gin.Context) error {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return nil
+	}
+	origin := c.GetHeader("Origin")
+	if origin == "" {
+		origin = c.GetHeader("Referer")
+	}
+	if !a.allowedOrigins[originOf(origin)] {
+		return fmt.Errorf("%w: cross-site request with session cookie is not allowed", repository.ErrForbidden)
+	}
+	return nil
+}
+
+// originOf は URL のオリジン（scheme://host[:port]）を返します。URL でない場合は空文字を返します
+func originOf(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return ""
+	}
+	return strings.ToLower(u.Scheme + "://" + u.Host)
+}
+
+// CookiePolicy は認証用のクッキーの属性です
+type CookiePolicy struct {
+	Secure    bool // Secure を付ける（HTTPS の場合）
+	CrossSite bool // SameSite=None にする（フロントエンドが別サイトの場合のみ。Secure が必要）。false の場合は SameSite=Lax
+}
+
+// oidcLoginCookieName は Slack でのログイン中の state と nonce を入れるクッキーの名前です
+const oidcLoginCookieName = "oidc_login"
+
+// AuthHandler はログイン・ログアウトのハンドラーです
+// クッキーの属性は cookies に従います
+// frontendURL は Slack でのログイン後に戻るフロントエンドの URL です
+type AuthHandler struct {
+	authUsecase *usecase.AuthUsecase
+	cookies     CookiePolicy
+	frontendURL string
+}
+
+func NewAuthHandler(authUsecase *usecase.AuthUsecase, cookies CookiePolicy, frontendURL string) *AuthHandler {
+	return &AuthHandler{
+		authUsecase: authUsecase,
+		cookies:     cookies,
+		frontendURL: strings.TrimSuffix(frontendURL, "/"),
+	}
+}
+
+// setCookie は認証用のクッキーを設定します。maxAge が負の場合は削除します
+func (h *AuthHandler) setCookie(c *gin.Context, name string, value string, path string, maxAge int) {
+	setAuthCookie(c, h.cookies, name, value, path, maxAge)
+}
+
+// setAuthCookie は HttpOnly のクッキーを設定します。maxAge が負の場合は削除します
+func setAuthCookie(c *gin.Context, cookies CookiePolicy, name string, value string, path string, maxAge int) {
+	if cookies.CrossSite {
+		c.SetSameSite(http.SameSiteNoneMode)
+	} else {
+		c.SetSameSite(http.SameSiteLaxMode)
+	}
+	c.SetCookie(name, value, maxAge, path, "", cookies.Secure, true)
+}
+
+// startSession は主体のセッションを作り、セッションクッキーを設定して有効期限を返します
+func (h *AuthHandler) startSession(c *gin.Context, principal usecase.Principal) (time.Time, error) {
+	token, expiresAt, err := h.authUsecase.CreateSession(principal)
+	if err != nil {
+		return time.Time{}, err
+	}
+	h.setCookie(c, SessionCookieName, token, "/", int(h.authUsecase.SessionTTL().Seconds()))
+	return expiresAt, nil
+}
+
+// LoginHandler は API キーでログインし、セッションクッキーを発行するAPIのハンドラー
+// リクエストボディ: {"api_key": "..."}
+// ブラウザからはこのクッキーで API を呼び出します
+func (h *AuthHandler) LoginHandler(c *gin.Context) {
+	var req struct {
+		APIKey string `json:"api_key" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "api_key is required"})
+		return
+	}
+
+	principal, err := h.authUsecase.AuthenticateAPIKey(req.APIKey)
+	if err != nil {
+		log.Printf("Error in LoginHandler: %v", err)
+		c.JSON(statusFromError(err), gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	expiresAt, err := h.startSession(c, principal)
+	if err != nil {
+		log.Printf("Error in LoginHandler: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"principal":  principal,
+		"expires_at": expiresAt,
+	})
+}
+
+// SlackLoginHandler は Slack でのログイン（OpenID Connect）を開始するハンドラー
+// state と nonce を署名付きのクッキーに保存し、Slack の認可画面にリダイレクトします
+func (h *AuthHandler) SlackLoginHandler(c *gin.Context) {
+	authURL, loginState, err := h.authUsecase.BeginOIDCLogin()
+	if err != nil {
+		log.Printf("Error in SlackLoginHandler: %v", err)
+		c.JSON(statusFromError(err), gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	h.setCookie(c, oidcLoginCookieName, loginState, "/auth/slack", int(10*time.Minute/time.Second))
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// SlackCallbackHandler は Slack の認可画面から戻ってきたリクエストのハンドラー
+// state を照合し、認可コードを ID トークンと交換して検証したうえでセッションクッキーを発行し、フロントエンドに戻します
+// 失敗した場合はフロントエンドのログイン画面に error を付けて戻します
+func (h *AuthHandler) SlackCallbackHandler(c *gin.Context) {
+	loginState, _ := c.Cookie(oidcLoginCookieName)
+	h.setCookie(c, oidcLoginCookieName, "", "/auth/slack", -1)
+
+	if denied := c.Query("error"); denied != "" {
+		h.redirectLoginError(c, denied)
+		return
+	}
+
+	principal, err := h.authUsecase.CompleteOIDCLogin(loginState, c.Query("state"), c.Query("code"))
+	if err == nil {
+		_, err = h.startSession(c, principal)
+	}
+	if err != nil {
+		log.Printf("Error in SlackCallbackHandler: %v", err)
+		h.redirectLoginError(c, err.Error())
+		return
+	}
+
+	c.Redirect(http.StatusFound, h.frontendURL+"/dashboard")
+}
+
+// redirectLoginError はフロントエンドのログイン画面にエラーを付けてリダイレクトします
+func (h *AuthHandler) redirectLoginError(c *gin.Context, message string) {
+	c.Redirect(http.StatusFound, h.frontendURL+"/login?error="+url.QueryEscape(message))
+}
+
+// LogoutHandler はセッションクッキーを削除するAPIのハンドラー
+func (h *AuthHandler) LogoutHandler(c *gin.Context) {
+	h.setCookie(c, SessionCookieName, "", "/", -1)
+	c.Status(http.StatusNoContent)
+}
+
+// MeHandler は認証された主体を返すAPIのハンドラー
+func (h *AuthHandler) MeHandler(c *gin.Context) {
+	principal, _ := PrincipalFrom(c)
+	c.JSON(http.StatusOK, gin.H{
+		"principal": principal,
+	})
+}
@@ -1,10 +1,11 @@
-// backend/handler/slack_handler.go
+// backend/handler/conversation_handler.go
 package handler
 
 import (
 	"log"
 	"net/http"
 
+	"backend/repository"
 	"backend/usecase"
 
 	"github.com/gin-gonic/gin"
@@ -12,42 +13,116 @@ import (
 
 type ConversationHandler struct {
 	conversationUsecase *usecase.ConversationUsecase
+	jobUsecase          *usecase.JobUsecase
 }
 
-func NewConversationHandler(conversationUsecase *usecase.ConversationUsecase) *ConversationHandler {
+func NewConversationHandler(conversationUsecase *usecase.ConversationUsecase, jobUsecase *usecase.JobUsecase) *ConversationHandler {
 	return &ConversationHandler{
 		conversationUsecase: conversationUsecase,
+		jobUsecase:          jobUsecase,
 	}
 }
 
-func (h *ConversationHandler) InitializeChannelConversationsHandler(c *gin.Context) {
+// SyncChannelHandler はチャンネルの会話履歴を Slack から取り込むAPIのハンドラー
+// 取り込みはジョブとして非同期に実行し、すぐに 202 Accepted とジョブIDを返します
+// クエリパラメータ:
+//   - oldest, latest: 取り込む期間（Slack ts、RFC3339、または YYYY-MM-DD。latest は含まない）
+//     指定しない場合は前回の続きから差分を取り込みます。中断した場合は POST /jobs/:id/resume で続きから再開できます
+func (h *ConversationHandler) SyncChannelHandler(c *gin.Context) {
+	teamID, ok := parseIntParam(c, "id")
+	if !ok {
+		return
+	}
+	window, ok := parseSyncWindow(c)
+	if !ok {
+		return
+	}
+
+	job, err := h.jobUsecase.StartChannelSync(actorFrom(c), workspaceIDFrom(c), teamID, window)
+	if err != nil {
+		log.Printf("Failed to start channel sync: %v", err)
+		respondJobError(c, err, "Failed to start channel sync")
+		return
+	}
+
+	respondJobAccepted(c, job, "Channel sync started")
+}
+
+// SyncAllChannelsHandler は追跡対象のすべてのチャンネルの会話履歴を取り込むAPIのハンドラー
+// 取り込みはジョブとして非同期に実行し、チャンネルごとの進捗は GET /jobs/:id で確認できます
+// クエリパラメータ oldest, latest は SyncChannelHandler と同じです
+func (h *ConversationHandler) SyncAllChannelsHandler(c *gin.Context) {
+	window, ok := parseSyncWindow(c)
+	if !ok {
+		return
+	}
+
+	job, err := h.jobUsecase.StartSyncAllChannels(actorFrom(c), workspaceIDFrom(c), window)
+	if err != nil {
+		log.Printf("Failed to start sync of all channels: %v", err)
+		respondJobError(c, err, "Failed to start sync of all channels")
+		return
+	}
 
-	// コンテキストからチャンネルIDを取得
-	channelID := c.Param("channel_id") // URLパラメータから取得
-	if channelID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "channel_id is required",
+	respondJobAccepted(c, job, "Sync of all tracked channels started")
+}
+
+// parseSyncWindow はクエリパラメータ oldest, latest から取り込む期間を取得します
+// 不正な場合は 422 Unprocessable Entity を返し、ok = false を返します
+func parseSyncWindow(c *gin.Context) (repository.SyncWindow, bool) {
+	window, err := usecase.ParseSyncWindow(c.Query("oldest"), c.Query("latest"))
+	if err != nil {
+		c.JSON(statusFromError(err), gin.H{
+			"error": err.Error(),
 		})
+		return repository.SyncWindow{}, false
+	}
+	return window, true
+}
+
+// GetChannelMessagesHandler は保存済みメッセージ取得APIのハンドラー
+// Slack へのアクセスは行いません
+// クエリパラメータ:
+//   - oldest, latest: 期間（Slack ts、RFC3339、または YYYY-MM-DD。latest は含まない）
+//   - user: 投稿者の Slack ユーザーID（仮名でも指定できる）
+//   - include_deleted: true で Slack で削除されたメッセージも含める
+//   - human_only: true で人の活動とみなすメッセージのみ（参加通知やボットの投稿などを除く。集計と同じ方針）
+//   - cursor: 前のレスポンスの next_cursor
+//   - limit (既定 100, 最大 1000)
+func (h *ConversationHandler) GetChannelMessagesHandler(c *gin.Context) {
+	teamID, ok := parseIntParam(c, "id")
+	if !ok {
+		return
+	}
+
+	query := usecase.MessageQuery{
+		UserKey:        c.Query("user"),
+		Oldest:         c.Query("oldest"),
+		Latest:         c.Query("latest"),
+		Cursor:         c.Query("cursor"),
+		IncludeDeleted: c.Query("include_deleted") == "true",
+		HumanOnly:      c.Query("human_only") == "true",
+	}
+	// limit の範囲は Usecase で検証し、範囲外の場合は 422 を返す
+	if limit, err := parseOptionalIntQuery(c, "limit"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
+	} else if limit != nil {
+		query.Limit = *limit
 	}
-	// 動作確認用
-	log.Printf("channelID: %s", channelID)
 
-	// チャンネルの会話履歴を取得
-	allMessages, err := h.conversationUsecase.InitializeChannelConversations(channelID)
+	messages, nextCursor, err := h.conversationUsecase.GetChannelMessages(actorFrom(c), workspaceIDFrom(c), teamID, query)
 	if err != nil {
-		log.Printf("Failed to initialize channel conversations: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
+		log.Printf("Failed to get channel messages: %v", err)
+		c.JSON(statusFromError(err), gin.H{
 			"error": err.Error(),
 		})
 		return
 	}
 
-	// 成功した場合のレスポンス
 	c.JSON(http.StatusOK, gin.H{
-		"message":    "Users initialized successfully",
-		"channel_id": channelID,
-		"status":     "success",
-		"messages":   allMessages,
+		"team_id":     teamID,
+		"messages":    messages,
+		"next_cursor": nextCursor,
 	})
 }
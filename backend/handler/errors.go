@@ -0,0 +1,29 @@
+// backend/handler/errors.go
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"backend/repository"
+)
+
+// statusFromError は Usecase/Repository から返ったエラーを HTTP ステータスコードに対応付けます
+func statusFromError(err error) int {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, repository.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, repository.ErrInvalid):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, repository.ErrUnauthorized):
+		return http.StatusUnauthorized
+	case errors.Is(err, repository.ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, repository.ErrUnavailable):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
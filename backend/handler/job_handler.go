@@ -0,0 +1,172 @@
+// backend/handler/job_handler.go
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"backend/repository"
+	"backend/usecase"
+
+	"github.com/gin-gonic/gin"
+)
+
+// jobEventsPollInterval は SSE で進捗を送る際にジョブの状態を確認する間隔です
+const jobEventsPollInterval = time.Second
+
+type JobHandler struct {
+	jobUsecase *usecase.JobUsecase
+}
+
+func NewJobHandler(jobUsecase *usecase.JobUsecase) *JobHandler {
+	return &JobHandler{
+		jobUsecase: jobUsecase,
+	}
+}
+
+// respondJobAccepted はジョブを受け付けたことを 202 Accepted で返します
+func respondJobAccepted(c *gin.Context, job repository.SyncJob, message string) {
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":    message,
+		"job_id":     job.ID,
+		"job":        job,
+		"status_url": fmt.Sprintf("/jobs/%d", job.ID),
+		"events_url": fmt.Sprintf("/jobs/%d/events", job.ID),
+	})
+}
+
+// respondJobError はジョブの開始に失敗したことを返します
+// 同じリソースの同期が実行中の場合は 409 Conflict と実行中のジョブを返し、クライアントがそのジョブを追えるようにします
+func respondJobError(c *gin.Context, err error, message string) {
+	body := gin.H{
+		"error": fmt.Sprintf("%s: %v", message, err),
+	}
+
+	var conflict *usecase.JobConflictError
+	if errors.As(err, &conflict) && conflict.Job != nil {
+		body["job_id"] = conflict.Job.ID
+		body["job"] = conflict.Job
+		body["status_url"] = fmt.Sprintf("/jobs/%d", conflict.Job.ID)
+		body["events_url"] = fmt.Sprintf("/jobs/%d/events", conflict.Job.ID)
+	}
+
+	c.JSON(statusFromError(err), body)
+}
+
+// GetJobHandler は同期ジョブの状態取得APIのハンドラー
+func (h *JobHandler) GetJobHandler(c *gin.Context) {
+	id, ok := parseIntParam(c, "id")
+	if !ok {
+		return
+	}
+
+	job, err := h.jobUsecase.GetJob(actorFrom(c), workspaceIDFrom(c), int64(id))
+	if err != nil {
+		log.Printf("Error in GetJobHandler: %v", err)
+		c.JSON(statusFromError(err), gin.H{
+			"error": fmt.Sprintf("Failed to get job: %v", err),
+		})
+		return
+	}
+
+	channels, err := h.jobUsecase.GetJobChannels(actorFrom(c), workspaceIDFrom(c), job.ID)
+	if err != nil {
+		log.Printf("Error in GetJobHandler: %v", err)
+		c.JSON(statusFromError(err), gin.H{
+			"error": fmt.Sprintf("Failed to get job channels: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"job":      job,
+		"channels": channels, // 全チャンネル同期のときのみ、チャンネルごとの進捗
+	})
+}
+
+// ResumeJobHandler は failed で終了したジョブを再開するAPIのハンドラー
+// 全チャンネル同期の場合、成功済みのチャンネルは同期し直しません
+func (h *JobHandler) ResumeJobHandler(c *gin.Context) {
+	id, ok := parseIntParam(c, "id")
+	if !ok {
+		return
+	}
+
+	job, err := h.jobUsecase.ResumeJob(actorFrom(c), workspaceIDFrom(c), int64(id))
+	if err != nil {
+		log.Printf("Error in ResumeJobHandler: %v", err)
+		respondJobError(c, err, "Failed to resume job")
+		return
+	}
+
+	respondJobAccepted(c, job, fmt.Sprintf("Job %d resumed", job.ID))
+}
+
+// JobEventsHandler は同期ジョブの進捗を Server-Sent Events で送るAPIのハンドラー
+// 状態が変わるたびに "progress" イベントを送り、ジョブが終了したら "done" イベントを送って閉じます
+// 全チャンネル同期の場合は、チャンネルの状態が変わるたびに "channel" イベントも送ります
+func (h *JobHandler) JobEventsHandler(c *gin.Context) {
+	id, ok := parseIntParam(c, "id")
+	if !ok {
+		return
+	}
+
+	// 存在しないジョブは SSE を始める前に 404 を返す
+	job, err := h.jobUsecase.GetJob(actorFrom(c), workspaceIDFrom(c), int64(id))
+	if err != nil {
+		log.Printf("Error in JobEventsHandler: %v", err)
+		c.JSON(statusFromError(err), gin.H{
+			"error": fmt.Sprintf("Failed to get job: %v", err),
+		})
+		return
+	}
+
+	ticker := time.NewTicker(jobEventsPollInterval)
+	defer ticker.Stop()
+
+	var last *repository.SyncJob
+	lastChannels := map[int]repository.SyncJobChannel{}
+	c.Stream(func(w io.Writer) bool {
+		channels, err := h.jobUsecase.GetJobChannels(actorFrom(c), workspaceIDFrom(c), job.ID)
+		if err != nil {
+			log.Printf("Error polling channels of job %d: %v", id, err)
+			c.SSEvent("error", gin.H{"error": err.Error()})
+			return false
+		}
+		for _, ch := range channels {
+			if prev, ok := lastChannels[ch.TeamID]; !ok || prev.Status != ch.Status || prev.Synced != ch.Synced {
+				c.SSEvent("channel", ch)
+				lastChannels[ch.TeamID] = ch
+			}
+		}
+
+		if last == nil || job.Status != last.Status || job.Processed != last.Processed || job.Total != last.Total {
+			c.SSEvent("progress", job)
+			sent := job
+			last = &sent
+		}
+		if job.Finished() {
+			c.SSEvent("done", job)
+			return false
+		}
+
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-ticker.C:
+		}
+
+		next, err := h.jobUsecase.GetJob(actorFrom(c), workspaceIDFrom(c), int64(id))
+		if err != nil {
+			log.Printf("Error polling job %d: %v", id, err)
+			c.SSEvent("error", gin.H{"error": err.Error()})
+			return false
+		}
+		job = next
+		return true
+	})
+}
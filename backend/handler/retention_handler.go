@@ -0,0 +1,63 @@
+// backend/handler/retention_handler.go
+package handler
+
+import (
+	"log"
+	"net/http"
+
+	"backend/usecase"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RetentionHandler struct {
+	retentionUsecase *usecase.RetentionUsecase
+}
+
+func NewRetentionHandler(retentionUsecase *usecase.RetentionUsecase) *RetentionHandler {
+	return &RetentionHandler{
+		retentionUsecase: retentionUsecase,
+	}
+}
+
+// GetRetentionHandler は保持期間の設定と、保持期限を過ぎたデータの削除の実行結果を返すAPIのハンドラー
+// クエリパラメータ:
+//   - limit: 実行結果の件数（既定 20、最大 100）
+func (h *RetentionHandler) GetRetentionHandler(c *gin.Context) {
+	limit, err := parseOptionalIntQuery(c, "limit")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var n int
+	if limit != nil {
+		n = *limit
+	}
+
+	runs, err := h.retentionUsecase.ListRuns(actorFrom(c), n)
+	if err != nil {
+		log.Printf("Error in GetRetentionHandler: %v", err)
+		c.JSON(statusFromError(err), gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"policy": h.retentionUsecase.GetPolicy(),
+		"runs":   runs,
+	})
+}
+
+// PurgeHandler は保持期限を過ぎたデータの削除を開始するAPIのハンドラー
+// 削除はジョブとして非同期に実行し、すぐに 202 Accepted とジョブIDを返します。結果は GET /retention で確認できます
+func (h *RetentionHandler) PurgeHandler(c *gin.Context) {
+	job, err := h.retentionUsecase.StartPurge(actorFrom(c))
+	if err != nil {
+		log.Printf("Failed to start retention purge: %v", err)
+		respondJobError(c, err, "Failed to start retention purge")
+		return
+	}
+
+	respondJobAccepted(c, job, "Retention purge started")
+}
@@ -0,0 +1,131 @@
+// backend/handler/slack_events_handler.go
+package handler
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"backend/usecase"
+
+	"github.com/gin-gonic/gin"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+)
+
+// SlackEventsHandler は Slack の Events API からの通知を受け取ります
+type SlackEventsHandler struct {
+	conversationUsecase *usecase.ConversationUsecase
+	signingSecret       string
+}
+
+func NewSlackEventsHandler(conversationUsecase *usecase.ConversationUsecase, signingSecret string) *SlackEventsHandler {
+	return &SlackEventsHandler{
+		conversationUsecase: conversationUsecase,
+		signingSecret:       signingSecret,
+	}
+}
+
+// EventsHandler は Events API のリクエストURLのハンドラー
+// Signing Secret で署名を検証してから、url_verification に応答し、
+// message_changed / message_deleted とリアクションの追加・削除を保存済みのメッセージに反映します
+func (h *SlackEventsHandler) EventsHandler(c *gin.Context) {
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return
+	}
+
+	verifier, err := slack.NewSecretsVerifier(c.Request.Header, h.signingSecret)
+	if err == nil {
+		_, err = verifier.Write(body)
+	}
+	if err == nil {
+		err = verifier.Ensure()
+	}
+	if err != nil {
+		log.Printf("Invalid Slack request signature: %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid request signature"})
+		return
+	}
+
+	event, err := slackevents.ParseEvent(json.RawMessage(body), slackevents.OptionNoVerifyToken())
+	if err != nil {
+		log.Printf("Failed to parse Slack event: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event payload"})
+		return
+	}
+
+	switch event.Type {
+	case slackevents.URLVerification:
+		var challenge slackevents.ChallengeResponse
+		if err := json.Unmarshal(body, &challenge); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid challenge payload"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"challenge": challenge.Challenge})
+		return
+	case slackevents.CallbackEvent:
+		var err error
+		switch ev := event.InnerEvent.Data.(type) {
+		case *slackevents.MessageEvent:
+			err = h.handleMessageEvent(ev)
+		case *slackevents.ReactionAddedEvent:
+			if ev.Item.Type == "message" {
+				err = h.conversationUsecase.ApplyReactionAdded(ev.Item.Channel, ev.Item.Timestamp, ev.Reaction, ev.User, ev.EventTimestamp)
+			}
+		case *slackevents.ReactionRemovedEvent:
+			if ev.Item.Type == "message" {
+				err = h.conversationUsecase.ApplyReactionRemoved(ev.Item.Channel, ev.Item.Timestamp, ev.Reaction, ev.User)
+			}
+		}
+		if err != nil {
+			// 2xx 以外を返すと Slack が再送する
+			log.Printf("Failed to handle Slack event (%s): %v", event.InnerEvent.Type, err)
+			c.JSON(statusFromError(err), gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// handleMessageEvent はメッセージの編集・削除を反映します。それ以外のメッセージイベントは無視します
+func (h *SlackEventsHandler) handleMessageEvent(ev *slackevents.MessageEvent) error {
+	switch ev.SubType {
+	case slack.MsgSubTypeMessageChanged:
+		// リンクの展開なども message_changed で届くので、edited があるものだけを編集として扱う
+		if ev.Message == nil || ev.Message.Edited == nil {
+			return nil
+		}
+		edited := slack.Message{Msg: slack.Msg{
+			Timestamp:   ev.Message.TimeStamp,
+			Text:        ev.Message.Text,
+			Blocks:      ev.Message.Blocks,
+			Attachments: ev.Message.Attachments,
+			Files:       toSlackFiles(ev.Message.Files),
+		}}
+		return h.conversationUsecase.ApplyMessageEdit(ev.Channel, edited, ev.Message.Edited.TimeStamp)
+	case slack.MsgSubTypeMessageDeleted:
+		return h.conversationUsecase.ApplyMessageDeletion(ev.Channel, ev.DeletedTimeStamp, ev.EventTimeStamp)
+	}
+	return nil
+}
+
+// toSlackFiles はイベントのファイルを、会話履歴の取り込みと同じ slack.File に変換します（メタデータとして保存する項目のみ）
+func toSlackFiles(files []slackevents.File) []slack.File {
+	result := make([]slack.File, 0, len(files))
+	for _, f := range files {
+		result = append(result, slack.File{
+			ID:           f.ID,
+			User:         f.User,
+			Mode:         f.Mode,
+			Filetype:     f.Filetype,
+			Mimetype:     f.Mimetype,
+			Size:         f.Size,
+			IsExternal:   f.IsExternal,
+			ExternalType: f.ExternalType,
+		})
+	}
+	return result
+}
@@ -7,74 +7,116 @@ import (
 	"log"
 	"net/http"
 	"strconv" // 文字列を数値に変換するためにインポート
+	"strings"
 
-	"backend/repository" // repository.User を使うためにインポート
+	"backend/repository" // repository.UserFilter を使うためにインポート
 	"github.com/gin-gonic/gin"
 )
 
 type SlackHandler struct {
 	slackUsecase *usecase.SlackUsecase
+	jobUsecase   *usecase.JobUsecase
 }
 
-func NewSlackHandler(slackUsecase *usecase.SlackUsecase) *SlackHandler {
+func NewSlackHandler(slackUsecase *usecase.SlackUsecase, jobUsecase *usecase.JobUsecase) *SlackHandler {
 	return &SlackHandler{
 		slackUsecase: slackUsecase,
+		jobUsecase:   jobUsecase,
 	}
 }
 
 // InitializeUsersHandler はユーザー初期化APIのハンドラー
+// 初期化はジョブとして非同期に実行し、すぐに 202 Accepted とジョブIDを返します
 func (h *SlackHandler) InitializeUsersHandler(c *gin.Context) {
-	err := h.slackUsecase.InitializeUsers()
+	job, err := h.jobUsecase.StartInitializeUsers(actorFrom(c), workspaceIDFrom(c))
 	if err != nil {
 		// エラーメッセージにエンドポイント情報を加えるなどしても良い
 		log.Printf("Error in InitializeUsersHandler: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			// エラーラップされている場合、元のエラーも含めて返すことができる
-			"error": fmt.Sprintf("Failed to initialize users: %v", err),
-		})
+		// 既に実行中の場合は 409 Conflict と実行中のジョブを返す
+		respondJobError(c, err, "Failed to initialize users")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Users initialized successfully",
-	})
+	respondJobAccepted(c, job, "Users initialization started")
 }
 
 // InitializeChannelsHandler はチャンネル初期化APIのハンドラー (新規追加)
+// 初期化はジョブとして非同期に実行し、すぐに 202 Accepted とジョブIDを返します
 func (h *SlackHandler) InitializeChannelsHandler(c *gin.Context) {
-	err := h.slackUsecase.InitializeChannels()
+	job, err := h.jobUsecase.StartInitializeChannels(actorFrom(c), workspaceIDFrom(c))
 	if err != nil {
 		log.Printf("Error in InitializeChannelsHandler: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": fmt.Sprintf("Failed to initialize channels: %v", err),
-		})
+		respondJobError(c, err, "Failed to initialize channels")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Channels initialized successfully",
-	})
+	respondJobAccepted(c, job, "Channels initialization started")
 }
 
 // GetAllUsersHandler はユーザー情報取得APIのハンドラー
+// クエリパラメータ:
+//   - team_key, grade: 完全一致で絞り込み
+//   - q: user_name または user_key の部分一致
+//   - include_bots, include_deleted: true でボット / 削除済みユーザーも含める（既定は除外）
+//   - sort: id, user_key, user_name, grade, team_key（先頭に "-" で降順）
+//   - limit (既定 100, 最大 1000), offset
 func (h *SlackHandler) GetAllUsersHandler(c *gin.Context) {
-	users, err := h.slackUsecase.GetAllUsers()
+	filter := repository.UserFilter{
+		Query:          c.Query("q"),
+		IncludeBots:    c.Query("include_bots") == "true",
+		IncludeDeleted: c.Query("include_deleted") == "true",
+	}
+
+	var err error
+	if filter.TeamKey, err = parseOptionalIntQuery(c, "team_key"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if filter.Grade, err = parseOptionalIntQuery(c, "grade"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 値の範囲（ソートフィールド、limit、offset）は Usecase で検証し、不正な場合は 422 を返す
+	sort := c.DefaultQuery("sort", "id")
+	filter.SortDesc = strings.HasPrefix(sort, "-")
+	filter.SortField = strings.TrimPrefix(sort, "-")
+
+	if limit, err := parseOptionalIntQuery(c, "limit"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if limit != nil {
+		filter.Limit = *limit
+	}
+	if offset, err := parseOptionalIntQuery(c, "offset"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if offset != nil {
+		filter.Offset = *offset
+	}
+
+	users, total, err := h.slackUsecase.ListUsers(actorFrom(c), workspaceIDFrom(c), filter)
 	if err != nil {
 		log.Printf("Error in GetAllUsersHandler: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
+		c.JSON(statusFromError(err), gin.H{
 			"error": fmt.Sprintf("Failed to get users: %v", err),
 		})
 		return
 	}
 	// users が空スライスの場合もそのまま返す (JSONでは [] となる)
 	c.JSON(http.StatusOK, gin.H{
-		"users": users,
+		"users":  users,
+		"total":  total,
+		"limit":  filter.Limit,
+		"offset": filter.Offset,
 	})
 }
 
 // GetAllChannelsHandler はチャンネル情報取得APIのハンドラー (新規追加)
+// クエリパラメータ tracked=true を指定すると追跡対象のチャンネルのみ返します
 func (h *SlackHandler) GetAllChannelsHandler(c *gin.Context) {
-	channels, err := h.slackUsecase.GetAllChannels()
+	trackedOnly := c.Query("tracked") == "true"
+	channels, err := h.slackUsecase.GetAllChannels(workspaceIDFrom(c), trackedOnly)
 	if err != nil {
 		log.Printf("Error in GetAllChannelsHandler: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -89,52 +131,177 @@ func (h *SlackHandler) GetAllChannelsHandler(c *gin.Context) {
 	})
 }
 
-// UpdateUserHandler はユーザー情報更新APIのハンドラー (新規追加)
-func (h *SlackHandler) UpdateUserHandler(c *gin.Context) {
-	// 1. URL パラメータから ID を取得
-	idStr := c.Param("id")
-	// 文字列の ID を int 型に変換
-	id, err := strconv.Atoi(idStr)
+// parseIntParam は URL パラメータを int に変換します
+// 変換できない場合は 400 Bad Request を返し、ok = false を返します
+func parseIntParam(c *gin.Context, name string) (int, bool) {
+	str := c.Param(name)
+	value, err := strconv.Atoi(str)
 	if err != nil {
-		// ID が数値でない場合は 400 Bad Request を返す
-		log.Printf("Error converting id parameter '%s' to int: %v", idStr, err)
+		log.Printf("Error converting %s parameter '%s' to int: %v", name, str, err)
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error": fmt.Sprintf("Invalid user ID format: %s", idStr),
+			"error": fmt.Sprintf("Invalid %s format: %s", name, str),
 		})
+		return 0, false
+	}
+	return value, true
+}
+
+// parseOptionalIntQuery はクエリパラメータを int に変換します
+// 指定されていない場合は nil を返します
+func parseOptionalIntQuery(c *gin.Context, name string) (*int, error) {
+	str := c.Query(name)
+	if str == "" {
+		return nil, nil
+	}
+	value, err := strconv.Atoi(str)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid %s format: %s", name, str)
+	}
+	return &value, nil
+}
+
+// GetTeamMembersHandler はチームのメンバー一覧取得APIのハンドラー
+func (h *SlackHandler) GetTeamMembersHandler(c *gin.Context) {
+	teamID, ok := parseIntParam(c, "id")
+	if !ok {
 		return
 	}
 
-	// 2. リクエストボディの JSON を User 構造体にバインド
-	var user repository.User
-	// c.ShouldBindJSON はリクエストボディをパースし、バリデーションも行う（User構造体のタグに基づく）
-	if err := c.ShouldBindJSON(&user); err != nil {
-		// JSON の形式が不正、または必須フィールドが欠けている場合は 400 Bad Request を返す
-		log.Printf("Error binding JSON for update user (id: %d): %v", id, err)
+	members, err := h.slackUsecase.GetTeamMembers(actorFrom(c), workspaceIDFrom(c), teamID)
+	if err != nil {
+		log.Printf("Error in GetTeamMembersHandler: %v", err)
+		c.JSON(statusFromError(err), gin.H{
+			"error": fmt.Sprintf("Failed to get team members: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"team_id": teamID,
+		"members": members,
+	})
+}
+
+// SyncTeamMembersHandler はチームのメンバーシップを Slack から同期するAPIのハンドラー
+func (h *SlackHandler) SyncTeamMembersHandler(c *gin.Context) {
+	teamID, ok := parseIntParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.slackUsecase.SyncTeamMemberships(actorFrom(c), workspaceIDFrom(c), teamID); err != nil {
+		log.Printf("Error in SyncTeamMembersHandler: %v", err)
+		c.JSON(statusFromError(err), gin.H{
+			"error": fmt.Sprintf("Failed to sync team members: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": fmt.Sprintf("Members of team %d synced successfully", teamID),
+	})
+}
+
+// SetTeamMemberHandler はメンバーシップを手動で上書きするAPIのハンドラー
+// リクエストボディ: {"excluded": false} で所属、{"excluded": true} で除外
+func (h *SlackHandler) SetTeamMemberHandler(c *gin.Context) {
+	teamID, ok := parseIntParam(c, "id")
+	if !ok {
+		return
+	}
+	userID, ok := parseIntParam(c, "user_id")
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Excluded bool `json:"excluded"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		log.Printf("Error binding JSON for set team member (team: %d, user: %d): %v", teamID, userID, err)
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": fmt.Sprintf("Invalid request body: %v", err),
 		})
 		return
 	}
 
-	// 3. Usecase層の更新メソッドを呼び出す
-	err = h.slackUsecase.UpdateUser(id, user)
+	if err := h.slackUsecase.SetMembershipOverride(actorFrom(c), workspaceIDFrom(c), teamID, userID, body.Excluded); err != nil {
+		log.Printf("Error in SetTeamMemberHandler: %v", err)
+		c.JSON(statusFromError(err), gin.H{
+			"error": fmt.Sprintf("Failed to set team member: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": fmt.Sprintf("Membership of user %d in team %d overridden successfully", userID, teamID),
+	})
+}
+
+// ClearTeamMemberHandler は手動でのメンバーシップ上書きを取り消すAPIのハンドラー
+func (h *SlackHandler) ClearTeamMemberHandler(c *gin.Context) {
+	teamID, ok := parseIntParam(c, "id")
+	if !ok {
+		return
+	}
+	userID, ok := parseIntParam(c, "user_id")
+	if !ok {
+		return
+	}
+
+	if err := h.slackUsecase.ClearMembershipOverride(actorFrom(c), workspaceIDFrom(c), teamID, userID); err != nil {
+		log.Printf("Error in ClearTeamMemberHandler: %v", err)
+		c.JSON(statusFromError(err), gin.H{
+			"error": fmt.Sprintf("Failed to clear team member override: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": fmt.Sprintf("Membership override of user %d in team %d cleared successfully", userID, teamID),
+	})
+}
+
+// GetUserTeamsHandler はユーザーの所属チーム一覧取得APIのハンドラー
+func (h *SlackHandler) GetUserTeamsHandler(c *gin.Context) {
+	userID, ok := parseIntParam(c, "id")
+	if !ok {
+		return
+	}
+
+	teams, err := h.slackUsecase.GetUserTeams(actorFrom(c), workspaceIDFrom(c), userID)
 	if err != nil {
-		// Usecase/Repository でエラーが発生した場合
-		log.Printf("Error updating user (id: %d): %v", id, err)
+		log.Printf("Error in GetUserTeamsHandler: %v", err)
+		c.JSON(statusFromError(err), gin.H{
+			"error": fmt.Sprintf("Failed to get user teams: %v", err),
+		})
+		return
+	}
 
-		// Repository で "no user found" エラーを返した場合、404 Not Found を返すなどの分岐も可能
-		// 例: if errors.Is(err, ...) or strings.Contains(err.Error(), "no user found") { ... }
-		// ここでは単純に 500 Internal Server Error を返す
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": fmt.Sprintf("Failed to update user: %v", err),
+	c.JSON(http.StatusOK, gin.H{
+		"user_id": userID,
+		"teams":   teams,
+	})
+}
+
+// GetUserAssignmentsHandler はユーザーの所属履歴取得APIのハンドラー
+func (h *SlackHandler) GetUserAssignmentsHandler(c *gin.Context) {
+	userID, ok := parseIntParam(c, "id")
+	if !ok {
+		return
+	}
+
+	assignments, err := h.slackUsecase.GetUserAssignments(actorFrom(c), workspaceIDFrom(c), userID)
+	if err != nil {
+		log.Printf("Error in GetUserAssignmentsHandler: %v", err)
+		c.JSON(statusFromError(err), gin.H{
+			"error": fmt.Sprintf("Failed to get user assignments: %v", err),
 		})
 		return
 	}
 
-	// 4. 成功レスポンスを返す
 	c.JSON(http.StatusOK, gin.H{
-		"message": fmt.Sprintf("User with id %d updated successfully", id),
-		// 更新後のユーザー情報を返すこともできる (Usecaseが返すように変更が必要)
-		// "user": updatedUser,
+		"user_id":     userID,
+		"assignments": assignments,
 	})
-}
\ No newline at end of file
+}
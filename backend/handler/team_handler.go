@@ -0,0 +1,137 @@
+// backend/handler/team_handler.go
+package handler
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"backend/usecase"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetChannelHandler はチャンネル（チーム）情報取得APIのハンドラー
+func (h *SlackHandler) GetChannelHandler(c *gin.Context) {
+	id, ok := parseIntParam(c, "id")
+	if !ok {
+		return
+	}
+
+	channel, err := h.slackUsecase.GetChannel(workspaceIDFrom(c), id)
+	if err != nil {
+		log.Printf("Error in GetChannelHandler: %v", err)
+		c.JSON(statusFromError(err), gin.H{
+			"error": fmt.Sprintf("Failed to get channel: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"channel": channel,
+	})
+}
+
+// ReplaceChannelHandler はチャンネル（チーム）情報更新APIのハンドラー
+// channel_name と is_tracked の両方が必須です
+func (h *SlackHandler) ReplaceChannelHandler(c *gin.Context) {
+	id, ok := parseIntParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var body struct {
+		ChannelName string `json:"channel_name" binding:"required"`
+		IsTracked   *bool  `json:"is_tracked" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		log.Printf("Error binding JSON for replace channel (id: %d): %v", id, err)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Invalid request body: %v", err),
+		})
+		return
+	}
+
+	channel, err := h.slackUsecase.ReplaceChannel(actorFrom(c), workspaceIDFrom(c), id, body.ChannelName, *body.IsTracked)
+	if err != nil {
+		log.Printf("Error in ReplaceChannelHandler: %v", err)
+		c.JSON(statusFromError(err), gin.H{
+			"error": fmt.Sprintf("Failed to update channel: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": fmt.Sprintf("Channel with id %d updated successfully", id),
+		"channel": channel,
+	})
+}
+
+// PatchChannelHandler はチャンネル（チーム）情報の部分更新APIのハンドラー
+// 例: {"is_tracked": false} で同期・集計の対象から外します
+func (h *SlackHandler) PatchChannelHandler(c *gin.Context) {
+	id, ok := parseIntParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var patch usecase.TeamPatch
+	if err := c.ShouldBindJSON(&patch); err != nil {
+		log.Printf("Error binding JSON for patch channel (id: %d): %v", id, err)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Invalid request body: %v", err),
+		})
+		return
+	}
+
+	channel, err := h.slackUsecase.PatchChannel(actorFrom(c), workspaceIDFrom(c), id, patch)
+	if err != nil {
+		log.Printf("Error in PatchChannelHandler: %v", err)
+		c.JSON(statusFromError(err), gin.H{
+			"error": fmt.Sprintf("Failed to update channel: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": fmt.Sprintf("Channel with id %d updated successfully", id),
+		"channel": channel,
+	})
+}
+
+// DeleteChannelHandler はチャンネル（チーム）削除APIのハンドラー
+// team_key がこのチームを指すユーザーがいる場合は、クエリパラメータ reassign_to で移動先のチームIDを指定します
+// 指定しない場合は 409 Conflict を返します
+// なお /channels/init を再実行すると、名前が条件に合うチャンネルは再登録されます
+// 恒久的に除外したい場合は削除ではなく is_tracked を false にしてください
+func (h *SlackHandler) DeleteChannelHandler(c *gin.Context) {
+	id, ok := parseIntParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var reassignTo *int
+	if str := c.Query("reassign_to"); str != "" {
+		value, err := strconv.Atoi(str)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("Invalid reassign_to format: %s", str),
+			})
+			return
+		}
+		reassignTo = &value
+	}
+
+	if err := h.slackUsecase.DeleteChannel(actorFrom(c), workspaceIDFrom(c), id, reassignTo); err != nil {
+		log.Printf("Error in DeleteChannelHandler: %v", err)
+		c.JSON(statusFromError(err), gin.H{
+			"error": fmt.Sprintf("Failed to delete channel: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": fmt.Sprintf("Channel with id %d deleted successfully", id),
+	})
+}
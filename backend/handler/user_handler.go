@@ -0,0 +1,206 @@
+// backend/handler/user_handler.go
+package handler
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"backend/usecase"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetUserHandler はユーザー情報取得APIのハンドラー
+func (h *SlackHandler) GetUserHandler(c *gin.Context) {
+	id, ok := parseIntParam(c, "id")
+	if !ok {
+		return
+	}
+
+	user, err := h.slackUsecase.GetUser(actorFrom(c), workspaceIDFrom(c), id)
+	if err != nil {
+		log.Printf("Error in GetUserHandler: %v", err)
+		c.JSON(statusFromError(err), gin.H{
+			"error": fmt.Sprintf("Failed to get user: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user": user,
+	})
+}
+
+// UpdateUserHandler はユーザー情報更新APIのハンドラー (新規追加)
+// user_name, grade, team_key はすべて必須です。user_key は更新できません
+func (h *SlackHandler) UpdateUserHandler(c *gin.Context) {
+	// 1. URL パラメータから ID を取得
+	id, ok := parseIntParam(c, "id")
+	if !ok {
+		return
+	}
+
+	// 2. リクエストボディの JSON をバインド
+	var body struct {
+		UserName string `json:"user_name" binding:"required"`
+		Grade    *int   `json:"grade" binding:"required"`
+		TeamKey  *int   `json:"team_key" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		// JSON の形式が不正、または必須フィールドが欠けている場合は 400 Bad Request を返す
+		log.Printf("Error binding JSON for update user (id: %d): %v", id, err)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Invalid request body: %v", err),
+		})
+		return
+	}
+
+	// 3. Usecase層の更新メソッドを呼び出す
+	user, err := h.slackUsecase.UpdateUser(actorFrom(c), workspaceIDFrom(c), id, body.UserName, *body.Grade, *body.TeamKey)
+	if err != nil {
+		log.Printf("Error updating user (id: %d): %v", id, err)
+		c.JSON(statusFromError(err), gin.H{
+			"error": fmt.Sprintf("Failed to update user: %v", err),
+		})
+		return
+	}
+
+	// 4. 成功レスポンスを返す
+	c.JSON(http.StatusOK, gin.H{
+		"message": fmt.Sprintf("User with id %d updated successfully", id),
+		"user":    user,
+	})
+}
+
+// PatchUserHandler はユーザー情報の部分更新APIのハンドラー
+// 例: {"grade": 2} でグレードのみ更新します
+func (h *SlackHandler) PatchUserHandler(c *gin.Context) {
+	id, ok := parseIntParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var patch usecase.UserPatch
+	if err := c.ShouldBindJSON(&patch); err != nil {
+		log.Printf("Error binding JSON for patch user (id: %d): %v", id, err)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Invalid request body: %v", err),
+		})
+		return
+	}
+
+	user, err := h.slackUsecase.PatchUser(actorFrom(c), workspaceIDFrom(c), id, patch)
+	if err != nil {
+		log.Printf("Error patching user (id: %d): %v", id, err)
+		c.JSON(statusFromError(err), gin.H{
+			"error": fmt.Sprintf("Failed to update user: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": fmt.Sprintf("User with id %d updated successfully", id),
+		"user":    user,
+	})
+}
+
+// DeleteUserHandler はユーザー削除APIのハンドラー
+func (h *SlackHandler) DeleteUserHandler(c *gin.Context) {
+	id, ok := parseIntParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.slackUsecase.DeleteUser(actorFrom(c), workspaceIDFrom(c), id); err != nil {
+		log.Printf("Error deleting user (id: %d): %v", id, err)
+		c.JSON(statusFromError(err), gin.H{
+			"error": fmt.Sprintf("Failed to delete user: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": fmt.Sprintf("User with id %d deleted successfully", id),
+	})
+}
+
+// OptOutHandler はユーザーを追跡から除外するAPIのハンドラー（本人と admin のみ）
+// 保存済みのメッセージ・リアクション・在席状況を削除し、削除した件数を返します
+func (h *SlackHandler) OptOutHandler(c *gin.Context) {
+	h.setOptedOut(c, true)
+}
+
+// OptInHandler はユーザーの追跡からの除外を取り消すAPIのハンドラー（本人と admin のみ）
+func (h *SlackHandler) OptInHandler(c *gin.Context) {
+	h.setOptedOut(c, false)
+}
+
+func (h *SlackHandler) setOptedOut(c *gin.Context, optedOut bool) {
+	id, ok := parseIntParam(c, "id")
+	if !ok {
+		return
+	}
+
+	report, err := h.slackUsecase.SetOptedOut(actorFrom(c), workspaceIDFrom(c), id, optedOut)
+	if err != nil {
+		log.Printf("Error updating opt-out (id: %d): %v", id, err)
+		c.JSON(statusFromError(err), gin.H{
+			"error": fmt.Sprintf("Failed to update opt-out: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"opted_out": optedOut,
+		"purged":    report,
+	})
+}
+
+// ExportPersonalDataHandler はユーザーについて保存しているすべてのデータを ZIP で返すAPIのハンドラー（本人と admin のみ）
+// ZIP にはプロフィール・メンバーシップ・メッセージ・リアクション・編集履歴・ファイル・リンクのドメイン・在席状況の JSON ファイルが入ります
+func (h *SlackHandler) ExportPersonalDataHandler(c *gin.Context) {
+	id, ok := parseIntParam(c, "id")
+	if !ok {
+		return
+	}
+
+	export, err := h.slackUsecase.ExportPersonalData(actorFrom(c), workspaceIDFrom(c), id)
+	if err != nil {
+		log.Printf("Error exporting personal data (id: %d): %v", id, err)
+		c.JSON(statusFromError(err), gin.H{
+			"error": fmt.Sprintf("Failed to export personal data: %v", err),
+		})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="user-%d-export.zip"`, id))
+	c.Header("Content-Type", "application/zip")
+	c.Status(http.StatusOK)
+	// 書き始めた後はステータスを変えられないので、失敗した場合はログに残す（ZIP は壊れた状態で終わる）
+	if err := export.WriteZip(c.Writer); err != nil {
+		log.Printf("Error writing personal data export (id: %d): %v", id, err)
+	}
+}
+
+// ErasePersonalDataHandler はユーザーの個人データを消去するAPIのハンドラー（本人と admin のみ）
+// 消去した件数と消去の記録のIDを返します
+func (h *SlackHandler) ErasePersonalDataHandler(c *gin.Context) {
+	id, ok := parseIntParam(c, "id")
+	if !ok {
+		return
+	}
+
+	erasure, err := h.slackUsecase.ErasePersonalData(actorFrom(c), workspaceIDFrom(c), id)
+	if err != nil {
+		log.Printf("Error erasing personal data (id: %d): %v", id, err)
+		c.JSON(statusFromError(err), gin.H{
+			"error": fmt.Sprintf("Failed to erase personal data: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"erasure": erasure,
+	})
+}
@@ -0,0 +1,142 @@
+// backend/handler/workspace_handler.go
+package handler
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"backend/repository"
+	"backend/usecase"
+
+	"github.com/gin-gonic/gin"
+)
+
+// workspaceKey はリクエストで選ばれたワークスペースを gin.Context に保存するキーです
+const workspaceKey = "workspace"
+
+// WorkspaceHeader はリクエストで扱うワークスペースを選ぶヘッダーです（クエリパラメータ workspace でも指定できます）
+const WorkspaceHeader = "X-Workspace"
+
+// WorkspaceMiddleware はリクエストで扱うワークスペースを決めるミドルウェアです
+// X-Workspace ヘッダーまたは workspace クエリパラメータ（ワークスペースのIDか Slack のワークスペースID）で選びます
+// AuthMiddleware の後に使います。選べない場合は 422、主体が属していないワークスペースの場合は 403 を返します
+func WorkspaceMiddleware(workspaceUsecase *usecase.WorkspaceUsecase) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		selector := c.GetHeader(WorkspaceHeader)
+		if selector == "" {
+			selector = c.Query("workspace")
+		}
+
+		workspace, err := workspaceUsecase.ResolveWorkspace(actorFrom(c), selector)
+		if err != nil {
+			log.Printf("Error in WorkspaceMiddleware: %v", err)
+			c.AbortWithStatusJSON(statusFromError(err), gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Set(workspaceKey, workspace)
+		c.Next()
+	}
+}
+
+// WorkspaceFrom は WorkspaceMiddleware で選ばれたワークスペースを返します
+func WorkspaceFrom(c *gin.Context) (repository.Workspace, bool) {
+	value, ok := c.Get(workspaceKey)
+	if !ok {
+		return repository.Workspace{}, false
+	}
+	workspace, ok := value.(repository.Workspace)
+	return workspace, ok
+}
+
+// workspaceIDFrom は Usecase に渡す、リクエストで選ばれたワークスペースのIDを返します
+// ワークスペースがまだ登録されていない場合は 0（すべてのデータ）です
+func workspaceIDFrom(c *gin.Context) int {
+	workspace, _ := WorkspaceFrom(c)
+	return workspace.ID
+}
+
+// installCookieName は Slack アプリのインストール中の state を入れるクッキーの名前です
+const installCookieName = "slack_install"
+
+// installCookiePath は installCookieName のクッキーを送るパスです（GET /slack/oauth/callback）
+const installCookiePath = "/slack/oauth"
+
+// WorkspaceHandler はワークスペースの一覧と、Slack アプリのインストール（OAuth v2）のハンドラーです
+type WorkspaceHandler struct {
+	workspaceUsecase *usecase.WorkspaceUsecase
+	cookies          CookiePolicy
+	frontendURL      string
+}
+
+func NewWorkspaceHandler(workspaceUsecase *usecase.WorkspaceUsecase, cookies CookiePolicy, frontendURL string) *WorkspaceHandler {
+	return &WorkspaceHandler{
+		workspaceUsecase: workspaceUsecase,
+		cookies:          cookies,
+		frontendURL:      strings.TrimSuffix(frontendURL, "/"),
+	}
+}
+
+// ListWorkspacesHandler は選べるワークスペースの一覧を返すAPIのハンドラー
+// トークンは返しません
+func (h *WorkspaceHandler) ListWorkspacesHandler(c *gin.Context) {
+	workspaces, err := h.workspaceUsecase.ListWorkspaces(actorFrom(c))
+	if err != nil {
+		log.Printf("Error in ListWorkspacesHandler: %v", err)
+		c.JSON(statusFromError(err), gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"workspaces": workspaces,
+	})
+}
+
+// InstallHandler は Slack アプリのワークスペースへのインストールを開始するハンドラー（admin のみ）
+// state を署名付きのクッキーに保存し、Slack の認可画面にリダイレクトします
+func (h *WorkspaceHandler) InstallHandler(c *gin.Context) {
+	authURL, state, err := h.workspaceUsecase.BeginInstall(actorFrom(c))
+	if err != nil {
+		log.Printf("Error in InstallHandler: %v", err)
+		c.JSON(statusFromError(err), gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	setAuthCookie(c, h.cookies, installCookieName, state, installCookiePath, int(10*time.Minute/time.Second))
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// InstallCallbackHandler は Slack の認可画面から戻ってきたリクエストのハンドラー
+// state を照合し、認可コードをトークンと交換してワークスペースを保存したうえで、フロントエンドに戻します
+// 成功した場合は installed に Slack のワークスペースIDを、失敗した場合は install_error を付けます
+func (h *WorkspaceHandler) InstallCallbackHandler(c *gin.Context) {
+	state, _ := c.Cookie(installCookieName)
+	setAuthCookie(c, h.cookies, installCookieName, "", installCookiePath, -1)
+
+	if denied := c.Query("error"); denied != "" {
+		h.redirect(c, "install_error", denied)
+		return
+	}
+
+	workspace, err := h.workspaceUsecase.CompleteInstall(state, c.Query("state"), c.Query("code"))
+	if err != nil {
+		log.Printf("Error in InstallCallbackHandler: %v", err)
+		h.redirect(c, "install_error", err.Error())
+		return
+	}
+
+	h.redirect(c, "installed", workspace.SlackTeamID)
+}
+
+// redirect はフロントエンドのダッシュボードにクエリパラメータを付けてリダイレクトします
+func (h *WorkspaceHandler) redirect(c *gin.Context, key string, value string) {
+	c.Redirect(http.StatusFound, h.frontendURL+"/dashboard?"+key+"="+url.QueryEscape(value))
+}
@@ -22,6 +22,10 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -44,15 +48,10 @@ func main() {
 	dbConnectionString := fmt.Sprintf("postgres://%s:%s@%s:5432/%s?sslmode=disable",
 		dbUser, dbPassword, dbHost, dbName)
 
+	// ワークスペースのトークンは Slack アプリのインストール（GET /slack/install）で保存する
+	// 環境変数のトークンは 1 つのワークスペースで動かしていたときの設定で、起動時にそのワークスペースとして登録する
 	slackTokenBot := os.Getenv("SLACK_API_TOKEN_BOT")
 	slackTokenUser := os.Getenv("SLACK_API_TOKEN_USER")
-	if slackTokenUser == "" {
-		log.Fatal("SLACK_API_TOKEN_USER environment variable is required")
-	}
-
-	if slackTokenBot == "" || slackTokenUser == "" {
-		log.Fatal("SLACK_API_TOKEN environment variable is required")
-	}
 
 	// データベース接続
 	db, err := sql.Open("postgres", dbConnectionString)
@@ -61,32 +60,273 @@ func main() {
 	}
 	defer db.Close()
 
+	// Slack のトークンとメッセージ本文の暗号化の鍵（"鍵ID:鍵（base64、32バイト）" のカンマ区切り、先頭の鍵で暗号化する）
+	// 鍵ファイルを指定した場合は 1 行に 1 つ書く。どちらも未設定の場合は暗号化しない
+	cipher, err := repository.LoadCipher(os.Getenv("ENCRYPTION_KEYS"), os.Getenv("ENCRYPTION_KEY_FILE"))
+	if err != nil {
+		log.Fatalf("Failed to load encryption keys: %v", err)
+	}
+	if cipher == nil {
+		log.Printf("ENCRYPTION_KEYS and ENCRYPTION_KEY_FILE are not set; Slack tokens and message text are stored unencrypted")
+	}
+	// メッセージ本文の保存方法（full: 保存する、metadata: 本文を保存せずメタデータのみ）
+	messageTextMode := os.Getenv("MESSAGE_TEXT_MODE")
+	if messageTextMode != "" && messageTextMode != "full" && messageTextMode != "metadata" {
+		log.Fatalf("MESSAGE_TEXT_MODE must be full or metadata")
+	}
+
+	// 個人データを消去したユーザーの Slack ユーザーIDを置き換えるハッシュの鍵（32 バイト以上）
+	// 消去したユーザーを見分けるために固定の値が必要で、他の鍵とは別にする。未設定の場合は個人データの消去を受け付けない
+	erasureKey := os.Getenv("ERASURE_KEY")
+	if erasureKey != "" && len(erasureKey) < 32 {
+		log.Fatalf("ERASURE_KEY must be at least 32 bytes")
+	}
+	if erasureKey == "" {
+		log.Printf("ERASURE_KEY is not set; personal data erasure is disabled")
+	}
+
 	// 依存関係の初期化
-	repo := repository.NewRepository(db)
-	slackUsecase := usecase.NewSlackUsecase(repo, slackTokenUser, slackTokenBot)
-	slackHandler := handler.NewSlackHandler(slackUsecase)
-	conversationUsecase := usecase.NewConversationUsecase(repo, slackTokenBot)
-	conversationHandler := handler.NewConversationHandler(conversationUsecase)
+	repo := repository.NewRepository(db, repository.Config{
+		Cipher:       cipher,
+		MetadataOnly: messageTextMode == "metadata",
+		ErasureKey:   []byte(erasureKey),
+	})
+	// API のレスポンスでの個人の扱い（full / pseudonymized / aggregate）と、aggregate で返す集計の行の最小人数
+	// 仮名の鍵は PRIVACY_SALT（未設定の場合は SESSION_SECRET）。再起動しても同じ仮名になるように固定の値が必要
+	privacySalt := os.Getenv("PRIVACY_SALT")
+	if privacySalt == "" {
+		privacySalt = os.Getenv("SESSION_SECRET")
+	}
+	minGroupSize, _ := strconv.Atoi(os.Getenv("PRIVACY_MIN_GROUP_SIZE"))
+	privacy, err := usecase.NewPrivacyPolicy(os.Getenv("PRIVACY_LEVEL"), minGroupSize, []byte(privacySalt))
+	if err != nil {
+		log.Fatalf("Invalid privacy settings (PRIVACY_LEVEL, PRIVACY_SALT or SESSION_SECRET): %v", err)
+	}
+	// Slack API のレート制限はトークン（ワークスペース）単位なので、すべての処理で共有する
+	slackWorkspaces := usecase.NewSlackWorkspaces(repo)
+	// ユーザー一覧はメッセージへのユーザー名の付与などで頻繁に参照するため、メモリにキャッシュして共有する
+	userDirectory := usecase.NewUserDirectory(repo, privacy)
+	slackUsecase := usecase.NewSlackUsecase(repo, slackWorkspaces, userDirectory, privacy)
+	// 差分取り込みのたびに削除・編集を確認し直す直近の日数（0 で無効）
+	reconcileDays, err := strconv.Atoi(os.Getenv("MESSAGE_RECONCILE_DAYS"))
+	if err != nil || reconcileDays < 0 {
+		reconcileDays = 7
+	}
+	// データの種類ごとの保持日数（未設定または 0 で無期限）
+	var retentionPolicy usecase.RetentionPolicy
+	for _, setting := range []struct {
+		name string
+		days *int
+	}{
+		{"RETENTION_MESSAGE_TEXT_DAYS", &retentionPolicy.MessageTextDays},
+		{"RETENTION_MESSAGE_METADATA_DAYS", &retentionPolicy.MessageMetadataDays},
+		{"RETENTION_PRESENCE_DAYS", &retentionPolicy.PresenceDays},
+		{"RETENTION_AGGREGATE_DAYS", &retentionPolicy.AggregateDays},
+	} {
+		value := os.Getenv(setting.name)
+		if value == "" {
+			continue
+		}
+		if *setting.days, err = strconv.Atoi(value); err != nil || *setting.days < 0 {
+			log.Fatalf("%s must be a non-negative number of days", setting.name)
+		}
+	}
+	// 人の活動として集計するメッセージの subtype（カンマ区切り、通常の投稿は "message"）とボットの扱い
+	activityPolicy := usecase.ParseActivityPolicy(os.Getenv("HUMAN_ACTIVITY_SUBTYPES"), os.Getenv("ACTIVITY_EXCLUDE_BOTS"))
+	conversationUsecase := usecase.NewConversationUsecase(repo, slackWorkspaces, time.Duration(reconcileDays)*24*time.Hour, activityPolicy, userDirectory, privacy, retentionPolicy)
+	analyticsUsecase := usecase.NewAnalyticsUsecase(repo, activityPolicy, userDirectory, privacy, retentionPolicy)
+
+	// 同期ジョブのワーカーを起動
+	// 全チャンネル同期の実行中もチャンネル単位の同期などを待たせないよう、既定では複数のワーカーで実行する
+	jobWorkers, err := strconv.Atoi(os.Getenv("JOB_WORKERS"))
+	if err != nil || jobWorkers < 1 {
+		jobWorkers = 4
+	}
+	jobRunner := usecase.NewJobRunner(repo, 100)
+	jobRunner.Start(jobWorkers)
+	// 全チャンネル同期で並列に同期するチャンネル数
+	syncWorkers, err := strconv.Atoi(os.Getenv("SYNC_WORKERS"))
+	if err != nil || syncWorkers < 1 {
+		syncWorkers = 4
+	}
+	jobUsecase := usecase.NewJobUsecase(repo, jobRunner, slackUsecase, conversationUsecase, syncWorkers)
+	// 保持期限を過ぎたデータの削除で 1 回に処理する行数（未設定の場合は usecase.DefaultRetentionBatchSize）
+	retentionBatchSize, _ := strconv.Atoi(os.Getenv("RETENTION_BATCH_SIZE"))
+	retentionUsecase := usecase.NewRetentionUsecase(repo, jobRunner, retentionPolicy, retentionBatchSize)
+
+	// セッションクッキーの署名鍵。未設定の場合は起動ごとに作るので、再起動するとログインし直しになる
+	sessionSecret := []byte(os.Getenv("SESSION_SECRET"))
+	if len(sessionSecret) == 0 {
+		if sessionSecret, err = usecase.NewRandomSecret(); err != nil {
+			log.Fatalf("Failed to generate session secret: %v", err)
+		}
+	}
+	// Sign in with Slack（OpenID Connect）。クライアントIDが設定されている場合のみ有効にする
+	var oidcProvider *usecase.OIDCProvider
+	if clientID := os.Getenv("SLACK_CLIENT_ID"); clientID != "" {
+		oidcProvider = usecase.NewOIDCProvider(usecase.OIDCConfig{
+			Issuer:       os.Getenv("OIDC_ISSUER"), // 未設定の場合は https://slack.com
+			ClientID:     clientID,
+			ClientSecret: os.Getenv("SLACK_CLIENT_SECRET"),
+			RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+			TeamID:       os.Getenv("SLACK_TEAM_ID"),
+		})
+	}
+	authUsecase := usecase.NewAuthUsecase(repo, userDirectory, oidcProvider, sessionSecret, usecase.DefaultSessionTTL)
+	// Slack アプリのインストール（OAuth v2）。クライアントIDは Sign in with Slack と同じアプリのもの
+	workspaceUsecase := usecase.NewWorkspaceUsecase(repo, usecase.SlackOAuthConfig{
+		ClientID:     os.Getenv("SLACK_CLIENT_ID"),
+		ClientSecret: os.Getenv("SLACK_CLIENT_SECRET"),
+		RedirectURL:  os.Getenv("SLACK_INSTALL_REDIRECT_URL"),
+		BotScopes:    os.Getenv("SLACK_BOT_SCOPES"),  // 未設定の場合は usecase.DefaultSlackBotScopes
+		UserScopes:   os.Getenv("SLACK_USER_SCOPES"), // 未設定の場合はユーザートークンを発行しない
+	}, sessionSecret)
+	if slackTokenBot != "" {
+		if workspace, err := workspaceUsecase.RegisterTokens(slackTokenBot, slackTokenUser); err != nil {
+			log.Printf("Failed to register SLACK_API_TOKEN_BOT: %v", err)
+		} else {
+			log.Printf("Registered workspace %s (%s) from SLACK_API_TOKEN_BOT", workspace.Name, workspace.SlackTeamID)
+		}
+	}
+
+	// サブコマンドが指定された場合はサーバーを起動せずに実行して終了する（cli.go）
+	if len(os.Args) > 1 {
+		code := runCommand(jobUsecase, slackUsecase, authUsecase, workspaceUsecase, usecase.NewStorageUsecase(repo), retentionUsecase, os.Args[1:])
+		db.Close()
+		os.Exit(code)
+	}
+
+	slackHandler := handler.NewSlackHandler(slackUsecase, jobUsecase)
+	conversationHandler := handler.NewConversationHandler(conversationUsecase, jobUsecase)
+	jobHandler := handler.NewJobHandler(jobUsecase)
+	analyticsHandler := handler.NewAnalyticsHandler(analyticsUsecase)
+	retentionHandler := handler.NewRetentionHandler(retentionUsecase)
+	frontendURL := os.Getenv("FRONTEND_URL")
+	if frontendURL == "" {
+		frontendURL = "http://localhost:3000"
+	}
+	// HTTPS の場合は SESSION_COOKIE_SECURE=true、フロントエンドが別サイトの場合はさらに SESSION_COOKIE_CROSS_SITE=true にする
+	cookies := handler.CookiePolicy{
+		Secure:    os.Getenv("SESSION_COOKIE_SECURE") == "true",
+		CrossSite: os.Getenv("SESSION_COOKIE_CROSS_SITE") == "true",
+	}
+	if cookies.CrossSite && !cookies.Secure {
+		log.Fatalf("SESSION_COOKIE_CROSS_SITE=true requires SESSION_COOKIE_SECURE=true")
+	}
+	authHandler := handler.NewAuthHandler(authUsecase, cookies, frontendURL)
+	workspaceHandler := handler.NewWorkspaceHandler(workspaceUsecase, cookies, frontendURL)
+	// CORS とセッションクッキーでの状態を変えるリクエストを許可するフロントエンドのオリジン
+	allowedOrigins := []string{"http://localhost:3000", "https://seelack.onrender.com"}
+	if !slices.Contains(allowedOrigins, strings.TrimSuffix(frontendURL, "/")) {
+		allowedOrigins = append(allowedOrigins, strings.TrimSuffix(frontendURL, "/"))
+	}
+	if os.Getenv("SESSION_SECRET") == "" {
+		log.Printf("SESSION_SECRET is not set; sessions will be invalidated on restart")
+	}
 
 	// Ginルーターの設定
 	router := gin.Default()
 
 	// CORS設定
 	router.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"http://localhost:3000", "https://seelack.onrender.com"},
-		AllowMethods:     []string{"GET", "POST"},
-		AllowHeaders:     []string{"Origin", "Content-Type"},
+		AllowOrigins:     allowedOrigins,
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "X-API-Key", handler.WorkspaceHeader},
 		ExposeHeaders:    []string{"Content-Length"},
 		AllowCredentials: true,
 	}))
 
+	// ログイン・ログアウト（認証不要）
+	router.POST("/auth/login", authHandler.LoginHandler)   // POST /auth/login
+	router.POST("/auth/logout", authHandler.LogoutHandler) // POST /auth/logout
+	if authUsecase.OIDCEnabled() {
+		router.GET("/auth/slack/login", authHandler.SlackLoginHandler)       // GET /auth/slack/login
+		router.GET("/auth/slack/callback", authHandler.SlackCallbackHandler) // GET /auth/slack/callback
+	} else {
+		log.Printf("SLACK_CLIENT_ID is not set; Sign in with Slack is disabled")
+	}
+	if workspaceUsecase.InstallEnabled() {
+		router.GET("/slack/oauth/callback", workspaceHandler.InstallCallbackHandler) // GET /slack/oauth/callback
+	}
+
+	// それ以外の API は API キーまたはセッションクッキーで認証する
+	api := router.Group("/", handler.AuthMiddleware(
+		handler.NewAPIKeyAuthenticator(authUsecase),
+		handler.NewSessionAuthenticator(authUsecase, allowedOrigins),
+	))
+
+	api.GET("/auth/me", authHandler.MeHandler)                     // GET /auth/me
+	api.GET("/workspaces", workspaceHandler.ListWorkspacesHandler) // GET /workspaces
+	if workspaceUsecase.InstallEnabled() {
+		api.GET("/slack/install", handler.RequireRole(usecase.RoleAdmin), workspaceHandler.InstallHandler) // GET /slack/install
+	}
+	// 保持期間はすべてのワークスペースのデータに適用する
+	api.GET("/retention", handler.RequireRole(usecase.RoleAdmin), retentionHandler.GetRetentionHandler) // GET /retention
+	api.POST("/retention/purge", handler.RequireRole(usecase.RoleAdmin), retentionHandler.PurgeHandler) // POST /retention/purge
+
+	// それ以外の API はワークスペースを選んで（X-Workspace ヘッダーまたは workspace パラメータ）呼び出す
+	// ワークスペースが 1 つだけの場合や、ワークスペースに属する主体の場合は省略できる
+	scoped := api.Group("/", handler.WorkspaceMiddleware(workspaceUsecase))
+
 	// ルート定義
-	router.GET("/users", slackHandler.GetAllUsersHandler)           // GET /users
-	router.POST("/users/init", slackHandler.InitializeUsersHandler) // POST /users/init
-	router.GET("/channels", slackHandler.GetAllChannelsHandler)     // GET /channels
-	router.POST("/channels/init", slackHandler.InitializeChannelsHandler) // POST /channels/init
-	router.PUT("/users/:id", slackHandler.UpdateUserHandler) // PUT /users/:id
-	router.GET("/history/:channel_id", conversationHandler.InitializeChannelConversationsHandler)
+	// 閲覧できる範囲は権限（admin / lead / member）ごとに Usecase で確認する
+	scoped.GET("/users", slackHandler.GetAllUsersHandler)                               // GET /users
+	scoped.GET("/channels", slackHandler.GetAllChannelsHandler)                         // GET /channels
+	scoped.GET("/users/:id", slackHandler.GetUserHandler)                               // GET /users/:id
+	scoped.GET("/users/:id/teams", slackHandler.GetUserTeamsHandler)                    // GET /users/:id/teams
+	scoped.GET("/users/:id/assignments", slackHandler.GetUserAssignmentsHandler)        // GET /users/:id/assignments
+	scoped.GET("/channels/:id", slackHandler.GetChannelHandler)                         // GET /channels/:id
+	scoped.GET("/channels/:id/members", slackHandler.GetTeamMembersHandler)             // GET /channels/:id/members
+	scoped.GET("/channels/:id/messages", conversationHandler.GetChannelMessagesHandler) // GET /channels/:id/messages
+	scoped.GET("/analytics/activity", analyticsHandler.GetActivityHandler)              // GET /analytics/activity
+	scoped.GET("/analytics/policy", analyticsHandler.GetPolicyHandler)                  // GET /analytics/policy
+	scoped.GET("/analytics/emoji", analyticsHandler.GetTopEmojiHandler)                 // GET /analytics/emoji
+	scoped.GET("/analytics/reactions", analyticsHandler.GetReactionBalancesHandler)     // GET /analytics/reactions
+	scoped.GET("/analytics/domains", analyticsHandler.GetTopDomainsHandler)             // GET /analytics/domains
+	scoped.GET("/analytics/files", analyticsHandler.GetFileSharesHandler)               // GET /analytics/files
+	// 追跡からの除外は本人と admin が設定できる
+	scoped.PUT("/users/:id/opt-out", slackHandler.OptOutHandler)   // PUT /users/:id/opt-out
+	scoped.DELETE("/users/:id/opt-out", slackHandler.OptInHandler) // DELETE /users/:id/opt-out
+	// 個人データの開示と消去も本人と admin ができる
+	scoped.GET("/users/:id/export", slackHandler.ExportPersonalDataHandler) // GET /users/:id/export
+	scoped.DELETE("/users/:id/data", slackHandler.ErasePersonalDataHandler) // DELETE /users/:id/data
+
+	// 更新・同期・ジョブは admin のみ
+	admin := scoped.Group("/", handler.RequireRole(usecase.RoleAdmin))
+	admin.POST("/users/init", slackHandler.InitializeUsersHandler)                      // POST /users/init
+	admin.POST("/channels/init", slackHandler.InitializeChannelsHandler)                // POST /channels/init
+	admin.PUT("/users/:id", slackHandler.UpdateUserHandler)                             // PUT /users/:id
+	admin.PATCH("/users/:id", slackHandler.PatchUserHandler)                            // PATCH /users/:id
+	admin.DELETE("/users/:id", slackHandler.DeleteUserHandler)                          // DELETE /users/:id
+	admin.PUT("/channels/:id", slackHandler.ReplaceChannelHandler)                      // PUT /channels/:id
+	admin.PATCH("/channels/:id", slackHandler.PatchChannelHandler)                      // PATCH /channels/:id
+	admin.DELETE("/channels/:id", slackHandler.DeleteChannelHandler)                    // DELETE /channels/:id
+	admin.POST("/channels/:id/members/sync", slackHandler.SyncTeamMembersHandler)       // POST /channels/:id/members/sync
+	admin.PUT("/channels/:id/members/:user_id", slackHandler.SetTeamMemberHandler)      // PUT /channels/:id/members/:user_id
+	admin.DELETE("/channels/:id/members/:user_id", slackHandler.ClearTeamMemberHandler) // DELETE /channels/:id/members/:user_id
+	admin.POST("/channels/sync", conversationHandler.SyncAllChannelsHandler)            // POST /channels/sync
+	admin.POST("/channels/:id/sync", conversationHandler.SyncChannelHandler)            // POST /channels/:id/sync
+	admin.GET("/jobs/:id", jobHandler.GetJobHandler)                                    // GET /jobs/:id
+	admin.GET("/jobs/:id/events", jobHandler.JobEventsHandler)                          // GET /jobs/:id/events (SSE)
+	admin.POST("/jobs/:id/resume", jobHandler.ResumeJobHandler)                         // POST /jobs/:id/resume
+
+	// Slack の Events API（メッセージの編集・削除とリアクションの反映）は Signing Secret が設定されている場合のみ受け付ける
+	// Slack からのリクエストは Signing Secret の署名で検証するので、API キーやセッションでは認証しない
+	if signingSecret := os.Getenv("SLACK_SIGNING_SECRET"); signingSecret != "" {
+		slackEventsHandler := handler.NewSlackEventsHandler(conversationUsecase, signingSecret)
+		router.POST("/slack/events", slackEventsHandler.EventsHandler) // POST /slack/events
+	} else {
+		log.Printf("SLACK_SIGNING_SECRET is not set; Slack events endpoint is disabled")
+	}
+
+	// 保持期限を過ぎたデータを定期的に削除する（間隔は RETENTION_PURGE_INTERVAL、例: "24h"）
+	if retentionPolicy.Enabled() {
+		purgeInterval, err := time.ParseDuration(os.Getenv("RETENTION_PURGE_INTERVAL"))
+		if err != nil || purgeInterval <= 0 {
+			purgeInterval = usecase.DefaultRetentionPurgeInterval
+		}
+		retentionUsecase.StartSchedule(purgeInterval)
+	}
 
 	// サーバー起動
 	port := os.Getenv("PORT")
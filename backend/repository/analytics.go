@@ -0,0 +1,477 @@
+// backend/repository/analytics.go
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ActivityIntervals は集計の単位として指定できる値です（date_trunc の単位）
+var ActivityIntervals = map[string]bool{
+	"hour":  true,
+	"day":   true,
+	"week":  true,
+	"month": true,
+}
+
+// ActivityPolicy はどのメッセージを人の活動として数えるかの方針です
+// 集計ではすべてのクエリで同じ方針を condition で適用します
+type ActivityPolicy struct {
+	Subtypes    []string `json:"subtypes"`     // 人の活動とみなす subtype（通常の投稿は ""）
+	ExcludeBots bool     `json:"exclude_bots"` // ボット・アプリの投稿とボットユーザーの投稿を除くかどうか
+}
+
+// condition は方針に合うメッセージだけに絞り込む SQL の条件を返します
+// 追跡から除外されたユーザーの投稿は方針に関わらず含めません
+// msg はメッセージ（messages）、user は投稿者（users、LEFT JOIN）のテーブルの別名です
+// 条件の値は args に追加し、追加後の args を返します
+func (p ActivityPolicy) condition(msg string, user string, args []interface{}) (string, []interface{}) {
+	args = append(args, pq.Array(p.Subtypes))
+	condition := fmt.Sprintf("%s.subtype = ANY($%d) AND NOT COALESCE(%s.opted_out, FALSE)", msg, len(args), user)
+	if p.ExcludeBots {
+		condition += fmt.Sprintf(" AND %s.bot_id = '' AND NOT COALESCE(%s.is_bot, FALSE)", msg, user)
+	}
+	return "(" + condition + ")", args
+}
+
+// workspaceCondition はチャンネルのチーム（teams、別名 t）をワークスペースで絞り込む SQL の条件を返します
+// workspaceID が 0 の場合はすべてのワークスペースを対象にします
+func workspaceCondition(workspaceID int, args []interface{}) (string, []interface{}) {
+	if workspaceID == 0 {
+		return "TRUE", args
+	}
+	args = append(args, workspaceID)
+	return fmt.Sprintf("t.workspace_id = $%d", len(args)), args
+}
+
+// ActivityFilter は GetActivityCounts の集計条件です
+type ActivityFilter struct {
+	Policy      ActivityPolicy
+	WorkspaceID int        // このワークスペースのチャンネルのみ（0 の場合はすべて）
+	Interval    string     // ActivityIntervals のいずれか
+	TeamKey     *int       // 指定した場合は、その時点でこのチームに所属していたユーザーのみ
+	UserKey     string     // 指定した場合はこのユーザーのみ
+	Oldest      *time.Time // この日時以降（含む）
+	Latest      *time.Time // この日時より前
+}
+
+// reactorCondition はリアクションしたユーザー（users、LEFT JOIN の別名 user）を方針で絞り込む SQL の条件を返します
+// 追跡から除外されたユーザーのリアクションは方針に関わらず含めません
+func (p ActivityPolicy) reactorCondition(user string) string {
+	condition := fmt.Sprintf("NOT COALESCE(%s.opted_out, FALSE)", user)
+	if p.ExcludeBots {
+		condition += fmt.Sprintf(" AND NOT COALESCE(%s.is_bot, FALSE)", user)
+	}
+	return condition
+}
+
+// reactionsQuery は集計対象のリアクションを返す SELECT 文を返します
+// 追跡対象のチャンネルの削除されていないメッセージのうち、方針で人の活動とみなすメッセージへのリアクションが対象です
+// 方針でボットを除く場合は、ボットユーザーによるリアクションも除きます。追跡から除外されたユーザーのリアクションは常に除きます
+// scope はチャンネルのチーム（別名 t）の条件で、workspaceCondition の結果を渡します
+// 列は emoji, reactor（リアクションしたユーザー）, author（メッセージの投稿者）, at（リアクションした日時）です
+func (p ActivityPolicy) reactionsQuery(scope string, args []interface{}) (string, []interface{}) {
+	human, args := p.condition("m", "pu", args)
+	return `
+		SELECT r.emoji, r.user_key AS reactor, m.user_key AS author, r.reacted_at AS at
+		FROM message_reactions r
+		JOIN messages m ON m.id = r.message_id AND m.deleted_at IS NULL
+		JOIN teams t ON t.id = m.team_id AND t.is_tracked
+		LEFT JOIN users pu ON pu.user_key = m.user_key
+		LEFT JOIN users ru ON ru.user_key = r.user_key
+		WHERE ` + scope + ` AND ` + human + ` AND ` + p.reactorCondition("ru"), args
+}
+
+// ActivityCount は期間とチームごとの投稿・編集・削除・リアクションの件数です
+type ActivityCount struct {
+	Bucket    time.Time `json:"bucket"`   // 集計期間の始まり（UTC）
+	TeamKey   *int      `json:"team_key"` // 所属履歴がないユーザーの分は nil
+	Posts     int       `json:"posts"`
+	Edits     int       `json:"edits"`
+	Deletions int       `json:"deletions"`
+	Reactions int       `json:"reactions"` // リアクションした数
+	Users     int       `json:"users"`     // 期間内に投稿・編集・削除・リアクションのいずれかをしたユーザーの数
+	// 期間内に投稿も編集もせず、リアクションだけをしたユーザーの数（軽い参加として数える）
+	ReactionOnlyUsers int `json:"reaction_only_users"`
+}
+
+// GetActivityCounts は追跡対象のチャンネルの投稿・編集・削除・リアクションの件数を期間とチームごとに集計します
+// 投稿は投稿日時、編集は編集日時、削除は削除日時、リアクションはリアクションした日時の期間に数え、
+// チームはそれぞれの日時に有効だった所属（user_assignments）で判定します
+// 削除されたメッセージは投稿数に含めず、方針で人の活動とみなさないメッセージは編集・削除・リアクションも数えません
+func (r *Repository) GetActivityCounts(filter ActivityFilter) ([]ActivityCount, error) {
+	if !ActivityIntervals[filter.Interval] {
+		return nil, fmt.Errorf("%w: invalid interval %s", ErrInvalid, filter.Interval)
+	}
+
+	args := []interface{}{filter.Interval}
+	scope, args := workspaceCondition(filter.WorkspaceID, args)
+	human, args := filter.Policy.condition("m", "pu", args)
+	reactions, args := filter.Policy.reactionsQuery(scope, args)
+	conditions := []string{}
+	addCondition := func(format string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(format, len(args)))
+	}
+	if filter.TeamKey != nil {
+		addCondition("a.team_key = $%d", *filter.TeamKey)
+	}
+	if filter.UserKey != "" {
+		addCondition("e.user_key = $%d", filter.UserKey)
+	}
+	if filter.Oldest != nil {
+		addCondition("e.at >= $%d", filter.Oldest.UTC())
+	}
+	if filter.Latest != nil {
+		addCondition("e.at < $%d", filter.Latest.UTC())
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	// 投稿・編集・削除・リアクションを 1 つのイベント列にまとめ、イベントの日時に有効だった所属でユーザーごとに集計してから、
+	// リアクションだけのユーザーを数えるために期間とチームごとにまとめる
+	query := `
+		WITH events AS (
+			SELECT m.user_key, m.posted_at AS at, 1 AS posts, 0 AS edits, 0 AS deletions, 0 AS reactions
+			FROM messages m
+			JOIN teams t ON t.id = m.team_id AND t.is_tracked
+			LEFT JOIN users pu ON pu.user_key = m.user_key
+			WHERE m.deleted_at IS NULL AND ` + scope + ` AND ` + human + `
+			UNION ALL
+			SELECT me.user_key, me.edited_at, 0, 1, 0, 0
+			FROM message_edits me
+			JOIN messages m ON m.id = me.message_id
+			JOIN teams t ON t.id = m.team_id AND t.is_tracked
+			LEFT JOIN users pu ON pu.user_key = m.user_key
+			WHERE ` + scope + ` AND ` + human + `
+			UNION ALL
+			SELECT m.user_key, m.deleted_at, 0, 0, 1, 0
+			FROM messages m
+			JOIN teams t ON t.id = m.team_id AND t.is_tracked
+			LEFT JOIN users pu ON pu.user_key = m.user_key
+			WHERE m.deleted_at IS NOT NULL AND ` + scope + ` AND ` + human + `
+			UNION ALL
+			SELECT rx.reactor, rx.at, 0, 0, 0, 1
+			FROM (` + reactions + `) rx
+		), user_counts AS (
+			SELECT date_trunc($1, e.at) AS bucket, a.team_key, e.user_key,
+			       SUM(e.posts) AS posts, SUM(e.edits) AS edits, SUM(e.deletions) AS deletions, SUM(e.reactions) AS reactions
+			FROM events e
+			LEFT JOIN users u ON u.user_key = e.user_key
+			LEFT JOIN user_assignments a
+			       ON a.user_id = u.id
+			      AND e.at >= a.valid_from
+			      AND (a.valid_to IS NULL OR e.at < a.valid_to)
+			` + where + `
+			GROUP BY bucket, a.team_key, e.user_key
+		)
+		SELECT bucket, team_key, SUM(posts), SUM(edits), SUM(deletions), SUM(reactions), COUNT(*),
+		       COUNT(*) FILTER (WHERE posts = 0 AND edits = 0 AND reactions > 0)
+		FROM user_counts
+		GROUP BY bucket, team_key
+		ORDER BY bucket ASC, team_key ASC NULLS LAST`
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		log.Printf("Failed to get activity counts: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []ActivityCount{}
+	for rows.Next() {
+		var c ActivityCount
+		var teamKey sql.NullInt64
+		if err := rows.Scan(&c.Bucket, &teamKey, &c.Posts, &c.Edits, &c.Deletions, &c.Reactions, &c.Users, &c.ReactionOnlyUsers); err != nil {
+			log.Printf("Failed to scan activity count: %v", err)
+			return nil, err
+		}
+		if teamKey.Valid {
+			t := int(teamKey.Int64)
+			c.TeamKey = &t
+		}
+		counts = append(counts, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		log.Printf("Error iterating activity count rows: %v", err)
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+// AnalyticsFilter はリアクションや共有されたファイル・リンクの集計条件です
+type AnalyticsFilter struct {
+	Policy      ActivityPolicy
+	WorkspaceID int        // このワークスペースのチャンネルのみ（0 の場合はすべて）
+	TeamKey     *int       // 指定した場合は、リアクション・投稿の時点でこのチームに所属していたユーザーのみ
+	UserKey     string     // 指定した場合はこのユーザーのみ
+	Oldest      *time.Time // この日時以降（含む）
+	Latest      *time.Time // この日時より前
+	Limit       int        // ランキング（GetTopEmoji、GetTopDomains）で返す件数
+}
+
+// where は集計のユーザー（user）と日時（at）の列に対する条件を conditions に加えた WHERE 句を返します
+// チームの判定には user_assignments を別名 a で結合しておく必要があります
+func (f AnalyticsFilter) where(user string, at string, conditions []string, args []interface{}) (string, []interface{}) {
+	addCondition := func(format string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(format, len(args)))
+	}
+	if f.TeamKey != nil {
+		addCondition("a.team_key = $%d", *f.TeamKey)
+	}
+	if f.UserKey != "" {
+		addCondition(user+" = $%d", f.UserKey)
+	}
+	if f.Oldest != nil {
+		addCondition(at+" >= $%d", f.Oldest.UTC())
+	}
+	if f.Latest != nil {
+		addCondition(at+" < $%d", f.Latest.UTC())
+	}
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// EmojiCount は絵文字ごとのリアクションの数です
+type EmojiCount struct {
+	Emoji string `json:"emoji"`
+	Count int    `json:"count"` // リアクションの数
+	Users int    `json:"users"` // リアクションしたユーザーの数
+}
+
+// GetTopEmoji はリアクションに使われた絵文字を多い順に返します
+// チームとユーザーはリアクションしたユーザーで絞り込みます
+func (r *Repository) GetTopEmoji(filter AnalyticsFilter) ([]EmojiCount, error) {
+	scope, args := workspaceCondition(filter.WorkspaceID, nil)
+	reactions, args := filter.Policy.reactionsQuery(scope, args)
+	where, args := filter.where("rx.reactor", "rx.at", nil, args)
+	args = append(args, filter.Limit)
+
+	query := `
+		SELECT rx.emoji, COUNT(*), COUNT(DISTINCT rx.reactor)
+		FROM (` + reactions + `) rx
+		LEFT JOIN users u ON u.user_key = rx.reactor
+		LEFT JOIN user_assignments a
+		       ON a.user_id = u.id
+		      AND rx.at >= a.valid_from
+		      AND (a.valid_to IS NULL OR rx.at < a.valid_to)
+		` + where + `
+		GROUP BY rx.emoji
+		ORDER BY COUNT(*) DESC, rx.emoji ASC
+		LIMIT $` + fmt.Sprint(len(args))
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		log.Printf("Failed to get top emoji: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []EmojiCount{}
+	for rows.Next() {
+		var c EmojiCount
+		if err := rows.Scan(&c.Emoji, &c.Count, &c.Users); err != nil {
+			log.Printf("Failed to scan emoji count: %v", err)
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		log.Printf("Error iterating emoji count rows: %v", err)
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+// ReactionBalance はユーザーごとのリアクションした数とされた数です
+type ReactionBalance struct {
+	UserKey  string `json:"user_key"`
+	UserName string `json:"user_name"` // 保存されていないユーザーの場合は空
+	Given    int    `json:"given"`     // 他のユーザーのメッセージにリアクションした数
+	Received int    `json:"received"`  // 自分のメッセージに他のユーザーからリアクションされた数
+}
+
+// GetReactionBalances はユーザーごとのリアクションした数とされた数を、合計の多い順に返します
+// 自分のメッセージへのリアクションはどちらにも数えません
+// チームはリアクションの時点で有効だった所属で、した数はリアクションしたユーザー、された数は投稿者の所属で判定します
+func (r *Repository) GetReactionBalances(filter AnalyticsFilter) ([]ReactionBalance, error) {
+	scope, args := workspaceCondition(filter.WorkspaceID, nil)
+	reactions, args := filter.Policy.reactionsQuery(scope, args)
+	where, args := filter.where("s.user_key", "s.at", nil, args)
+
+	query := `
+		WITH rx AS (` + reactions + `
+		), sides AS (
+			SELECT reactor AS user_key, at, 1 AS given, 0 AS received FROM rx WHERE reactor <> author
+			UNION ALL
+			SELECT author, at, 0, 1 FROM rx WHERE reactor <> author AND author <> ''
+		)
+		SELECT s.user_key, COALESCE(MAX(u.user_name), ''), SUM(s.given), SUM(s.received)
+		FROM sides s
+		LEFT JOIN users u ON u.user_key = s.user_key
+		LEFT JOIN user_assignments a
+		       ON a.user_id = u.id
+		      AND s.at >= a.valid_from
+		      AND (a.valid_to IS NULL OR s.at < a.valid_to)
+		` + where + `
+		GROUP BY s.user_key
+		ORDER BY SUM(s.given) + SUM(s.received) DESC, s.user_key ASC`
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		log.Printf("Failed to get reaction balances: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	balances := []ReactionBalance{}
+	for rows.Next() {
+		var b ReactionBalance
+		if err := rows.Scan(&b.UserKey, &b.UserName, &b.Given, &b.Received); err != nil {
+			log.Printf("Failed to scan reaction balance: %v", err)
+			return nil, err
+		}
+		balances = append(balances, b)
+	}
+
+	if err = rows.Err(); err != nil {
+		log.Printf("Error iterating reaction balance rows: %v", err)
+		return nil, err
+	}
+
+	return balances, nil
+}
+
+// DomainCount はリンクのドメインごとの件数です
+type DomainCount struct {
+	Domain   string `json:"domain"`
+	Links    int    `json:"links"`    // リンクの数
+	Messages int    `json:"messages"` // リンクを含むメッセージの数
+	Users    int    `json:"users"`    // リンクを投稿したユーザーの数
+}
+
+// GetTopDomains はメッセージに含まれるリンクのドメインを多い順に返します
+// 追跡対象のチャンネルの削除されていないメッセージのうち、方針で人の活動とみなすメッセージが対象です
+// チームとユーザーは投稿者で、チームは投稿の時点で有効だった所属で絞り込みます
+func (r *Repository) GetTopDomains(filter AnalyticsFilter) ([]DomainCount, error) {
+	scope, args := workspaceCondition(filter.WorkspaceID, nil)
+	human, args := filter.Policy.condition("m", "pu", args)
+	where, args := filter.where("m.user_key", "m.posted_at", []string{scope, human}, args)
+	args = append(args, filter.Limit)
+
+	query := `
+		SELECT l.domain, SUM(l.links), COUNT(DISTINCT m.id), COUNT(DISTINCT m.user_key)
+		FROM message_links l
+		JOIN messages m ON m.id = l.message_id AND m.deleted_at IS NULL
+		JOIN teams t ON t.id = m.team_id AND t.is_tracked
+		LEFT JOIN users pu ON pu.user_key = m.user_key
+		LEFT JOIN user_assignments a
+		       ON a.user_id = pu.id
+		      AND m.posted_at >= a.valid_from
+		      AND (a.valid_to IS NULL OR m.posted_at < a.valid_to)
+		` + where + `
+		GROUP BY l.domain
+		ORDER BY SUM(l.links) DESC, l.domain ASC
+		LIMIT $` + fmt.Sprint(len(args))
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		log.Printf("Failed to get top domains: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []DomainCount{}
+	for rows.Next() {
+		var c DomainCount
+		if err := rows.Scan(&c.Domain, &c.Links, &c.Messages, &c.Users); err != nil {
+			log.Printf("Failed to scan domain count: %v", err)
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		log.Printf("Error iterating domain count rows: %v", err)
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+// FileShareCount はチームとファイルの分類ごとの共有の件数です
+type FileShareCount struct {
+	TeamKey   *int   `json:"team_key"` // 所属履歴がないユーザーの分は nil
+	Category  string `json:"category"`
+	Files     int    `json:"files"`
+	TotalSize int64  `json:"total_size"` // バイト数の合計
+	Users     int    `json:"users"`      // 共有したユーザーの数
+}
+
+// GetFileShares は共有されたファイルの件数をチームと分類ごとに集計します
+// 対象のメッセージは GetTopDomains と同じです
+// チームとユーザーはファイルをアップロードしたユーザー（不明な場合は投稿者）で、チームは投稿の時点で有効だった所属で絞り込みます
+func (r *Repository) GetFileShares(filter AnalyticsFilter) ([]FileShareCount, error) {
+	scope, args := workspaceCondition(filter.WorkspaceID, nil)
+	human, args := filter.Policy.condition("m", "pu", args)
+	// ファイルをアップロードしたユーザー（古いデータなどで不明な場合は投稿者）
+	const uploader = "COALESCE(NULLIF(f.user_key, ''), m.user_key)"
+	where, args := filter.where(uploader, "m.posted_at", []string{scope, human}, args)
+
+	query := `
+		SELECT a.team_key, f.category, COUNT(*), COALESCE(SUM(f.size), 0), COUNT(DISTINCT ` + uploader + `)
+		FROM message_files f
+		JOIN messages m ON m.id = f.message_id AND m.deleted_at IS NULL
+		JOIN teams t ON t.id = m.team_id AND t.is_tracked
+		LEFT JOIN users pu ON pu.user_key = ` + uploader + `
+		LEFT JOIN user_assignments a
+		       ON a.user_id = pu.id
+		      AND m.posted_at >= a.valid_from
+		      AND (a.valid_to IS NULL OR m.posted_at < a.valid_to)
+		` + where + `
+		GROUP BY a.team_key, f.category
+		ORDER BY a.team_key ASC NULLS LAST, COUNT(*) DESC, f.category ASC`
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		log.Printf("Failed to get file shares: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []FileShareCount{}
+	for rows.Next() {
+		var c FileShareCount
+		var teamKey sql.NullInt64
+		if err := rows.Scan(&teamKey, &c.Category, &c.Files, &c.TotalSize, &c.Users); err != nil {
+			log.Printf("Failed to scan file share count: %v", err)
+			return nil, err
+		}
+		if teamKey.Valid {
+			t := int(teamKey.Int64)
+			c.TeamKey = &t
+		}
+		counts = append(counts, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		log.Printf("Error iterating file share count rows: %v", err)
+		return nil, err
+	}
+
+	return counts, nil
+}
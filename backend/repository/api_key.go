@@ -0,0 +1,115 @@
+// backend/repository/api_key.go
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+)
+
+// apiKeyColumns は api_keys から読み込む列です
+const apiKeyColumns = `id, name, prefix, role, team_key, workspace_id, created_at, last_used_at, revoked_at`
+
+// CreateAPIKey は API キーを登録します。keyHash はキーの SHA-256（16進）です
+// role が lead / member の場合、teamKey はそのキーで見られるチームです
+// workspaceID はキーで扱えるワークスペースです（nil はすべてのワークスペース）
+func (r *Repository) CreateAPIKey(name string, prefix string, keyHash string, role string, teamKey *int, workspaceID *int) (APIKey, error) {
+	var key APIKey
+	err := r.db.QueryRow(`
+		INSERT INTO api_keys (name, prefix, key_hash, role, team_key, workspace_id)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING `+apiKeyColumns+`
+	`, name, prefix, keyHash, role, teamKey, workspaceID).Scan(&key.ID, &key.Name, &key.Prefix, &key.Role, &key.TeamKey, &key.WorkspaceID, &key.CreatedAt, &key.LastUsedAt, &key.RevokedAt)
+	if err != nil {
+		log.Printf("Failed to create API key (name: %s): %v", name, err)
+		return APIKey{}, translateError(err)
+	}
+	return key, nil
+}
+
+// ListAPIKeys は登録されているすべての API キーを登録順に取得します（無効化したものを含む）
+func (r *Repository) ListAPIKeys() ([]APIKey, error) {
+	rows, err := r.db.Query(`
+		SELECT ` + apiKeyColumns + `
+		FROM api_keys
+		ORDER BY id ASC
+	`)
+	if err != nil {
+		log.Printf("Failed to list API keys: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		var key APIKey
+		if err := rows.Scan(&key.ID, &key.Name, &key.Prefix, &key.Role, &key.TeamKey, &key.WorkspaceID, &key.CreatedAt, &key.LastUsedAt, &key.RevokedAt); err != nil {
+			log.Printf("Failed to scan API key: %v", err)
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	if err = rows.Err(); err != nil {
+		log.Printf("Error iterating API key rows: %v", err)
+		return nil, err
+	}
+	return keys, nil
+}
+
+// GetActiveAPIKeyByHash はハッシュが一致する有効な API キーを取得し、最終利用日時を更新します
+// 見つからない場合や無効化されている場合は ErrNotFound を返します
+func (r *Repository) GetActiveAPIKeyByHash(keyHash string) (APIKey, error) {
+	var key APIKey
+	err := r.db.QueryRow(`
+		UPDATE api_keys
+		SET last_used_at = CURRENT_TIMESTAMP AT TIME ZONE 'UTC'
+		WHERE key_hash = $1 AND revoked_at IS NULL
+		RETURNING `+apiKeyColumns+`
+	`, keyHash).Scan(&key.ID, &key.Name, &key.Prefix, &key.Role, &key.TeamKey, &key.WorkspaceID, &key.CreatedAt, &key.LastUsedAt, &key.RevokedAt)
+	if err == sql.ErrNoRows {
+		return APIKey{}, fmt.Errorf("%w: no active API key", ErrNotFound)
+	}
+	if err != nil {
+		log.Printf("Failed to get API key: %v", err)
+		return APIKey{}, err
+	}
+	return key, nil
+}
+
+// GetActiveAPIKey は指定の無効化されていない API キーを取得します
+// 見つからない場合や無効化されている場合は ErrNotFound を返します
+func (r *Repository) GetActiveAPIKey(id int) (APIKey, error) {
+	var key APIKey
+	err := r.db.QueryRow(`
+		SELECT `+apiKeyColumns+`
+		FROM api_keys
+		WHERE id = $1 AND revoked_at IS NULL
+	`, id).Scan(&key.ID, &key.Name, &key.Prefix, &key.Role, &key.TeamKey, &key.WorkspaceID, &key.CreatedAt, &key.LastUsedAt, &key.RevokedAt)
+	if err == sql.ErrNoRows {
+		return APIKey{}, fmt.Errorf("%w: no active API key with id %d", ErrNotFound, id)
+	}
+	if err != nil {
+		log.Printf("Failed to get API key (id: %d): %v", id, err)
+		return APIKey{}, err
+	}
+	return key, nil
+}
+
+// RevokeAPIKey は API キーを無効化します
+// 見つからない場合は ErrNotFound を返します。既に無効化されている場合は何もしません
+func (r *Repository) RevokeAPIKey(id int) error {
+	result, err := r.db.Exec(`
+		UPDATE api_keys
+		SET revoked_at = COALESCE(revoked_at, CURRENT_TIMESTAMP AT TIME ZONE 'UTC')
+		WHERE id = $1
+	`, id)
+	if err != nil {
+		log.Printf("Failed to revoke API key (id: %d): %v", id, err)
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: no API key found with id %d", ErrNotFound, id)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+// backend/repository/artifact.go
+package repository
+
+import (
+	"database/sql"
+	"log"
+
+	"github.com/lib/pq"
+)
+
+// saveMessageFiles はメッセージで共有されたファイルのメタデータを Slack から取得した内容に合わせます
+func saveMessageFiles(tx *sql.Tx, messageID int64, files []MessageFile) error {
+	fileIDs := []string{}
+	for _, f := range files {
+		_, err := tx.Exec(`
+			INSERT INTO message_files (message_id, file_id, user_key, filetype, mimetype, category, size, is_external, external_type)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			ON CONFLICT (message_id, file_id) DO UPDATE
+			SET user_key = $3, filetype = $4, mimetype = $5, category = $6, size = $7, is_external = $8, external_type = $9
+		`, messageID, f.FileID, f.UserKey, f.Filetype, f.Mimetype, f.Category, f.Size, f.IsExternal, f.ExternalType)
+		if err != nil {
+			log.Printf("Failed to save message file (message_id: %d, file_id: %s): %v", messageID, f.FileID, err)
+			return err
+		}
+		fileIDs = append(fileIDs, f.FileID)
+	}
+
+	_, err := tx.Exec(`
+		DELETE FROM message_files WHERE message_id = $1 AND NOT (file_id = ANY($2))
+	`, messageID, pq.Array(fileIDs))
+	if err != nil {
+		log.Printf("Failed to delete removed message files (message_id: %d): %v", messageID, err)
+	}
+	return err
+}
+
+// saveMessageLinks はメッセージに含まれるリンクのドメインを本文の内容に合わせます
+func saveMessageLinks(tx *sql.Tx, messageID int64, links []MessageLink) error {
+	domains := []string{}
+	for _, link := range links {
+		_, err := tx.Exec(`
+			INSERT INTO message_links (message_id, domain, links)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (message_id, domain) DO UPDATE SET links = $3
+		`, messageID, link.Domain, link.Links)
+		if err != nil {
+			log.Printf("Failed to save message link (message_id: %d): %v", messageID, err)
+			return err
+		}
+		domains = append(domains, link.Domain)
+	}
+
+	_, err := tx.Exec(`
+		DELETE FROM message_links WHERE message_id = $1 AND NOT (domain = ANY($2))
+	`, messageID, pq.Array(domains))
+	if err != nil {
+		log.Printf("Failed to delete removed message links (message_id: %d): %v", messageID, err)
+	}
+	return err
+}
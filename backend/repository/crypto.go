@@ -0,0 +1,403 @@
+// backend/repository/crypto.go
+package repository
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// encryptedPrefix は暗号化した値の先頭に付ける文字列です
+// 保存形式は "enc:v1:<鍵ID>:<暗号化したデータ鍵（base64）>:<暗号文（base64）>" です
+const encryptedPrefix = "enc:v1:"
+
+// plaintextPrefix は暗号化せずに保存した値の先頭に付ける文字列です
+// 値の中身（メッセージ本文など）が encryptedPrefix で始まっていても暗号文と取り違えないよう、保存する値には必ずどちらかを付けます
+// どちらも付いていない値は、保存形式を記録する前に保存した値です
+const plaintextPrefix = "plain:"
+
+// EncryptionKey は鍵暗号化鍵（KEK）です。Key は 32 バイト（AES-256）です
+type EncryptionKey struct {
+	ID  string
+	Key []byte
+}
+
+// Cipher は DB に保存するトークンやメッセージ本文をエンベロープ暗号化します
+// 値ごとにランダムなデータ鍵（AES-256-GCM）で暗号化し、データ鍵は鍵暗号化鍵で暗号化して値と一緒に保存します
+// 新しい値は先頭の鍵（primary）で暗号化し、それ以外の鍵は鍵のローテーション前に保存した値の復号にだけ使います
+type Cipher struct {
+	primary string
+	keys    map[string]cipher.AEAD // 鍵ID → 鍵暗号化鍵
+}
+
+// NewCipher は鍵暗号化鍵の一覧から Cipher を作ります。先頭の鍵で暗号化します
+func NewCipher(keys []EncryptionKey) (*Cipher, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("no encryption keys")
+	}
+	c := &Cipher{primary: keys[0].ID, keys: map[string]cipher.AEAD{}}
+	for _, key := range keys {
+		if key.ID == "" || strings.Contains(key.ID, ":") {
+			return nil, fmt.Errorf("invalid encryption key id %q", key.ID)
+		}
+		if _, ok := c.keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate encryption key id %s", key.ID)
+		}
+		if len(key.Key) != 32 {
+			return nil, fmt.Errorf("encryption key %s must be 32 bytes", key.ID)
+		}
+		aead, err := newAEAD(key.Key)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %s: %w", key.ID, err)
+		}
+		c.keys[key.ID] = aead
+	}
+	return c, nil
+}
+
+// PrimaryKeyID は新しい値の暗号化に使う鍵のIDを返します
+func (c *Cipher) PrimaryKeyID() string {
+	return c.primary
+}
+
+// ParseEncryptionKeys は "鍵ID:鍵（base64）" をカンマまたは改行で区切った一覧を読み取ります
+// 空行と "#" から始まる行は無視します。先頭の鍵で暗号化し、残りは復号にだけ使います
+func ParseEncryptionKeys(spec string) ([]EncryptionKey, error) {
+	keys := []EncryptionKey{}
+	for _, line := range strings.FieldsFunc(spec, func(r rune) bool { return r == ',' || r == '\n' }) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		id, encoded, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("encryption key must be <id>:<base64 key>")
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %s is not valid base64: %w", id, err)
+		}
+		keys = append(keys, EncryptionKey{ID: strings.TrimSpace(id), Key: key})
+	}
+	return keys, nil
+}
+
+// LoadCipher は環境変数の値（spec）または鍵ファイル（path）の鍵から Cipher を作ります
+// 両方とも空の場合は nil を返し、暗号化しません
+func LoadCipher(spec string, path string) (*Cipher, error) {
+	if path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read encryption key file: %w", err)
+		}
+		spec = string(content)
+	}
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+	keys, err := ParseEncryptionKeys(spec)
+	if err != nil {
+		return nil, err
+	}
+	return NewCipher(keys)
+}
+
+// Encrypt は値を primary の鍵で暗号化します。空文字は暗号化しません
+func (c *Cipher) Encrypt(plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", fmt.Errorf("failed to generate data key: %w", err)
+	}
+	data, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := seal(data, []byte(plaintext), nil)
+	if err != nil {
+		return "", err
+	}
+	return c.wrap(dataKey, sealed)
+}
+
+// Decrypt は Encrypt で暗号化した値を復号します
+func (c *Cipher) Decrypt(value string) (string, error) {
+	keyID, dataKey, sealed, err := c.unwrap(value)
+	if err != nil {
+		return "", err
+	}
+	data, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(data, sealed, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt value (key %s): %w", keyID, err)
+	}
+	return string(plaintext), nil
+}
+
+// Rewrap は保存されている値を primary の鍵の暗号化に揃えます
+// 暗号化されていない値は暗号化し、古い鍵で暗号化した値はデータ鍵だけを primary の鍵で暗号化し直します（本文は再暗号化しない）
+// 変更がない場合は changed = false を返します
+func (c *Cipher) Rewrap(value string) (rewrapped string, changed bool, err error) {
+	if value == "" {
+		return "", false, nil
+	}
+	plaintext, encrypted := storedPlaintext(value)
+	if !encrypted {
+		rewrapped, err = c.Encrypt(plaintext)
+		return rewrapped, err == nil, err
+	}
+	keyID, dataKey, sealed, err := c.unwrap(value)
+	if err != nil {
+		return "", false, err
+	}
+	if keyID == c.primary {
+		return value, false, nil
+	}
+	rewrapped, err = c.wrap(dataKey, sealed)
+	return rewrapped, err == nil, err
+}
+
+// wrap はデータ鍵を primary の鍵で暗号化し、暗号文と一緒に保存形式にします
+func (c *Cipher) wrap(dataKey []byte, sealed []byte) (string, error) {
+	wrapped, err := seal(c.keys[c.primary], dataKey, []byte(c.primary))
+	if err != nil {
+		return "", err
+	}
+	return encryptedPrefix + c.primary + ":" + base64.RawStdEncoding.EncodeToString(wrapped) + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// unwrap は保存形式の値から鍵ID、復号したデータ鍵、暗号文を取り出します
+func (c *Cipher) unwrap(value string) (keyID string, dataKey []byte, sealed []byte, err error) {
+	parts := strings.Split(strings.TrimPrefix(value, encryptedPrefix), ":")
+	if len(parts) != 3 {
+		return "", nil, nil, errors.New("malformed encrypted value")
+	}
+	keyID = parts[0]
+	kek, ok := c.keys[keyID]
+	if !ok {
+		return "", nil, nil, fmt.Errorf("encryption key %s is not configured", keyID)
+	}
+	wrapped, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", nil, nil, errors.New("malformed encrypted value")
+	}
+	if sealed, err = base64.RawStdEncoding.DecodeString(parts[2]); err != nil {
+		return "", nil, nil, errors.New("malformed encrypted value")
+	}
+	if dataKey, err = open(kek, wrapped, []byte(keyID)); err != nil {
+		return "", nil, nil, fmt.Errorf("failed to decrypt data key (key %s): %w", keyID, err)
+	}
+	return keyID, dataKey, sealed, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal は nonce を先頭に付けた暗号文を返します
+func seal(aead cipher.AEAD, plaintext []byte, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// open は seal で作った暗号文を復号します
+func open(aead cipher.AEAD, sealed []byte, additionalData []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additionalData)
+}
+
+// storedPlaintext は保存されている値が暗号化されているかどうかを保存形式の印から判定し、
+// 暗号化されていない場合は印を除いた値を返します
+// 印のない値は保存形式を記録する前に保存した値で、その当時は暗号文だけが encryptedPrefix で始まる形式でした
+func storedPlaintext(value string) (plaintext string, encrypted bool) {
+	if rest, ok := strings.CutPrefix(value, plaintextPrefix); ok {
+		return rest, false
+	}
+	if strings.HasPrefix(value, encryptedPrefix) {
+		return "", true
+	}
+	return value, false
+}
+
+// encrypt は保存する値を返します。暗号化が有効な場合は暗号文、無効な場合は plaintextPrefix を付けた値です
+// 空文字はそのまま返します
+func (r *Repository) encrypt(plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+	if r.cipher == nil {
+		return plaintextPrefix + plaintext, nil
+	}
+	encrypted, err := r.cipher.Encrypt(plaintext)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt: %w", err)
+	}
+	return encrypted, nil
+}
+
+// decrypt は保存されている値を復号します。暗号化されていない値は印を除いて返します
+// 暗号化された値があるのに鍵が設定されていない場合はエラーを返します
+func (r *Repository) decrypt(value string) (string, error) {
+	plaintext, encrypted := storedPlaintext(value)
+	if !encrypted {
+		return plaintext, nil
+	}
+	if r.cipher == nil {
+		return "", errors.New("value is encrypted but no encryption key is configured")
+	}
+	return r.cipher.Decrypt(value)
+}
+
+// rewrapBatchSize は暗号化し直すときに一度に読み込むメッセージの件数です
+const rewrapBatchSize = 1000
+
+// EncryptionReport は保存済みの値を暗号化し直した結果です
+type EncryptionReport struct {
+	KeyID      string `json:"key_id"`     // 暗号化に使った鍵（primary）のID
+	Workspaces int64  `json:"workspaces"` // トークンを暗号化し直したワークスペースの数
+	Messages   int64  `json:"messages"`   // 本文を暗号化し直したメッセージの数
+}
+
+// RewrapStoredValues は保存済みのトークンとメッセージ本文を primary の鍵の暗号化に揃えます
+// 暗号化を有効にする前に保存した値は暗号化し、古い鍵で暗号化した値はデータ鍵を暗号化し直します
+// 鍵のローテーションでは、新しい鍵を先頭に追加して実行し、終わったら古い鍵を外します
+func (r *Repository) RewrapStoredValues() (EncryptionReport, error) {
+	if r.cipher == nil {
+		return EncryptionReport{}, fmt.Errorf("%w: no encryption key is configured", ErrInvalid)
+	}
+	report := EncryptionReport{KeyID: r.cipher.PrimaryKeyID()}
+
+	rows, err := r.db.Query(`SELECT id, bot_token, user_token FROM workspaces ORDER BY id`)
+	if err != nil {
+		log.Printf("Failed to read workspace tokens: %v", err)
+		return report, err
+	}
+	type workspaceTokens struct {
+		id                  int
+		botToken, userToken string
+	}
+	workspaces := []workspaceTokens{}
+	for rows.Next() {
+		var w workspaceTokens
+		if err := rows.Scan(&w.id, &w.botToken, &w.userToken); err != nil {
+			rows.Close()
+			return report, err
+		}
+		workspaces = append(workspaces, w)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return report, err
+	}
+	for _, w := range workspaces {
+		botToken, botChanged, err := r.cipher.Rewrap(w.botToken)
+		if err != nil {
+			return report, fmt.Errorf("workspace %d: %w", w.id, err)
+		}
+		userToken, userChanged, err := r.cipher.Rewrap(w.userToken)
+		if err != nil {
+			return report, fmt.Errorf("workspace %d: %w", w.id, err)
+		}
+		if !botChanged && !userChanged {
+			continue
+		}
+		if _, err := r.db.Exec(`UPDATE workspaces SET bot_token = $2, user_token = $3 WHERE id = $1`, w.id, botToken, userToken); err != nil {
+			log.Printf("Failed to update workspace tokens (id: %d): %v", w.id, err)
+			return report, err
+		}
+		report.Workspaces++
+	}
+
+	var lastID int64
+	for {
+		rewrapped, last, err := r.rewrapMessageBatch(lastID)
+		if err != nil {
+			return report, err
+		}
+		report.Messages += rewrapped
+		if last == 0 {
+			return report, nil
+		}
+		lastID = last
+	}
+}
+
+// rewrapMessageBatch は afterID より後のメッセージを rewrapBatchSize 件まで暗号化し直します
+// 暗号化し直した件数と、読み込んだ最後のメッセージのID（残りがない場合は 0）を返します
+func (r *Repository) rewrapMessageBatch(afterID int64) (int64, int64, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT id, text FROM messages
+		WHERE id > $1 AND text <> ''
+		ORDER BY id
+		LIMIT $2
+		FOR UPDATE
+	`, afterID, rewrapBatchSize)
+	if err != nil {
+		log.Printf("Failed to read messages for rewrap: %v", err)
+		return 0, 0, err
+	}
+	type messageText struct {
+		id   int64
+		text string
+	}
+	messages := []messageText{}
+	for rows.Next() {
+		var m messageText
+		if err := rows.Scan(&m.id, &m.text); err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+		messages = append(messages, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+	if len(messages) == 0 {
+		return 0, 0, nil
+	}
+
+	var rewrapped int64
+	for _, m := range messages {
+		text, changed, err := r.cipher.Rewrap(m.text)
+		if err != nil {
+			return 0, 0, fmt.Errorf("message %d: %w", m.id, err)
+		}
+		if !changed {
+			continue
+		}
+		if _, err := tx.Exec(`UPDATE messages SET text = $2 WHERE id = $1`, m.id, text); err != nil {
+			log.Printf("Failed to update message text (id: %d): %v", m.id, err)
+			return 0, 0, err
+		}
+		rewrapped++
+	}
+	return rewrapped, messages[len(messages)-1].id, tx.Commit()
+}
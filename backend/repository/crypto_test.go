@@ -0,0 +1,107 @@
+// backend/repository/crypto_test.go
+package repository
+
+import (
+	"strings"
+	"testing"
+)
+
+func testCipher(t *testing.T, ids ...string) *Cipher {
+	t.Helper()
+	keys := []EncryptionKey{}
+	for _, id := range ids {
+		// 同じ鍵IDには同じ鍵を使う
+		keys = append(keys, EncryptionKey{ID: id, Key: []byte(strings.Repeat(id, 32)[:32])})
+	}
+	c, err := NewCipher(keys)
+	if err != nil {
+		t.Fatalf("NewCipher() error = %v", err)
+	}
+	return c
+}
+
+func TestRepositoryEncryptDecrypt(t *testing.T) {
+	values := []string{
+		"hello",
+		"enc:v1:k1:AAAA:BBBB", // 暗号文と同じ形式で始まる本文
+		"plain:hello",
+		"",
+	}
+
+	for _, tt := range []struct {
+		name   string
+		cipher *Cipher
+	}{
+		{"without key", nil},
+		{"with key", testCipher(t, "k1")},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Repository{cipher: tt.cipher}
+			for _, value := range values {
+				stored, err := r.encrypt(value)
+				if err != nil {
+					t.Fatalf("encrypt(%q) error = %v", value, err)
+				}
+				if value != "" && tt.cipher == nil && stored != plaintextPrefix+value {
+					t.Errorf("encrypt(%q) = %q, want plaintext with prefix", value, stored)
+				}
+				got, err := r.decrypt(stored)
+				if err != nil {
+					t.Fatalf("decrypt(%q) error = %v", stored, err)
+				}
+				if got != value {
+					t.Errorf("decrypt(encrypt(%q)) = %q", value, got)
+				}
+			}
+		})
+	}
+}
+
+func TestRepositoryDecryptLegacyValues(t *testing.T) {
+	r := &Repository{}
+	if got, err := r.decrypt("legacy text"); err != nil || got != "legacy text" {
+		t.Errorf("decrypt(legacy) = %q, %v", got, err)
+	}
+	// 鍵なしで保存した暗号文のような本文は、印があれば暗号文として扱わない
+	if got, err := r.decrypt(plaintextPrefix + "enc:v1:x"); err != nil || got != "enc:v1:x" {
+		t.Errorf("decrypt(marked) = %q, %v", got, err)
+	}
+}
+
+func TestCipherRewrap(t *testing.T) {
+	old := testCipher(t, "k1")
+	rotated := testCipher(t, "k2", "k1")
+	r := &Repository{cipher: rotated}
+
+	encrypted, err := old.Encrypt("secret")
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+
+	for _, value := range []string{encrypted, plaintextPrefix + "enc:v1:x", "legacy"} {
+		rewrapped, changed, err := rotated.Rewrap(value)
+		if err != nil {
+			t.Fatalf("Rewrap(%q) error = %v", value, err)
+		}
+		if !changed || !strings.HasPrefix(rewrapped, encryptedPrefix+"k2:") {
+			t.Errorf("Rewrap(%q) = %q, %v; want encrypted with k2", value, rewrapped, changed)
+		}
+		want, _ := (&Repository{cipher: old}).decrypt(value)
+		if got, err := r.decrypt(rewrapped); err != nil || got != want {
+			t.Errorf("decrypt(Rewrap(%q)) = %q, %v; want %q", value, got, err, want)
+		}
+	}
+
+	if _, changed, err := rotated.Rewrap(mustRewrap(t, rotated, encrypted)); err != nil || changed {
+		t.Errorf("Rewrap of a value already under the primary key changed = %v, err = %v", changed, err)
+	}
+}
+
+func mustRewrap(t *testing.T, c *Cipher, value string) string {
+	t.Helper()
+	rewrapped, _, err := c.Rewrap(value)
+	if err != nil {
+		t.Fatalf("Rewrap() error = %v", err)
+	}
+	return rewrapped
+}
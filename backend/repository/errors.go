@@ -0,0 +1,44 @@
+// backend/repository/errors.go
+package repository
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// Repository が返すセンチネルエラー
+// 呼び出し側は errors.Is で判定し、ハンドラーで HTTP ステータスに対応付けます
+var (
+	// ErrNotFound は対象の行が存在しないことを表します (404)
+	ErrNotFound = errors.New("not found")
+	// ErrConflict は一意制約や参照制約など、現在の状態と矛盾する操作であることを表します (409)
+	ErrConflict = errors.New("conflict")
+	// ErrInvalid は入力値が不正であることを表します (422)
+	ErrInvalid = errors.New("invalid")
+	// ErrUnauthorized は認証されていない、または認証情報が不正であることを表します (401)
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrForbidden は認証されているが操作が許可されていないことを表します (403)
+	ErrForbidden = errors.New("forbidden")
+	// ErrUnavailable はサーバーの設定が足りないなど、サーバー側の理由で操作を実行できないことを表します (503)
+	ErrUnavailable = errors.New("unavailable")
+)
+
+// translateError は Postgres の制約違反をセンチネルエラーに変換します
+// それ以外のエラーはそのまま返します
+func translateError(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return err
+	}
+
+	switch pqErr.Code.Name() {
+	case "unique_violation", "foreign_key_violation":
+		return fmt.Errorf("%w: %s", ErrConflict, pqErr.Message)
+	case "check_violation", "not_null_violation":
+		return fmt.Errorf("%w: %s", ErrInvalid, pqErr.Message)
+	default:
+		return err
+	}
+}
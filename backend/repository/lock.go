@@ -0,0 +1,75 @@
+// backend/repository/lock.go
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"log"
+)
+
+// advisoryLockNamespace は Postgres の advisory lock の第1キーです
+// 他の用途の advisory lock とキーが衝突しないよう、リソースのロックはこの名前空間で取ります
+const advisoryLockNamespace = 0x534C4B // "SLK"
+
+// ResourceLock はリソース単位で取得した Postgres の advisory lock です
+// セッション単位のロックのため、取得したコネクションを Release まで保持します
+type ResourceLock struct {
+	conn     *sql.Conn
+	resource string
+}
+
+// TryLockResource はリソースのロックの取得を試みます
+// 他のセッション（別のリクエストや別のレプリカ）がロックを持っている場合は acquired = false を返します
+func (r *Repository) TryLockResource(resource string) (*ResourceLock, bool, error) {
+	ctx := context.Background()
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		log.Printf("Failed to get connection for lock (resource: %s): %v", resource, err)
+		return nil, false, err
+	}
+
+	var acquired bool
+	err = conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1, hashtext($2))`, advisoryLockNamespace, resource).
+		Scan(&acquired)
+	if err != nil {
+		conn.Close()
+		log.Printf("Failed to try advisory lock (resource: %s): %v", resource, err)
+		return nil, false, err
+	}
+	if !acquired {
+		conn.Close()
+		return nil, false, nil
+	}
+
+	return &ResourceLock{conn: conn, resource: resource}, true, nil
+}
+
+// LockResource はリソースのロックを取得します。他のセッションがロックを持っている場合は解放されるまで待ちます
+func (r *Repository) LockResource(resource string) (*ResourceLock, error) {
+	ctx := context.Background()
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		log.Printf("Failed to get connection for lock (resource: %s): %v", resource, err)
+		return nil, err
+	}
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1, hashtext($2))`, advisoryLockNamespace, resource); err != nil {
+		conn.Close()
+		log.Printf("Failed to acquire advisory lock (resource: %s): %v", resource, err)
+		return nil, err
+	}
+
+	return &ResourceLock{conn: conn, resource: resource}, nil
+}
+
+// Release はロックを解放し、保持していたコネクションを返却します
+func (l *ResourceLock) Release() error {
+	defer l.conn.Close()
+
+	_, err := l.conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1, hashtext($2))`, advisoryLockNamespace, l.resource)
+	if err != nil {
+		// コネクションを閉じればセッションが終わり、ロックも解放される
+		log.Printf("Failed to release advisory lock (resource: %s): %v", l.resource, err)
+	}
+	return err
+}
@@ -0,0 +1,362 @@
+// backend/repository/message.go
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// SaveMessages は指定チームのメッセージをまとめてDBに保存します
+// 同じ (channel_id, ts) のメッセージが既にある場合は内容を更新します
+// 取得できたメッセージは削除されていないので、論理削除済みでも元に戻します
+// 編集されたメッセージは編集日時ごとに message_edits に記録し、リアクションと共有されたファイル・リンクは取得した内容に合わせます
+// 本文は暗号化が有効な場合は暗号化し、メタデータのみのモードでは保存しません
+// 追跡から除外されたユーザーと個人データを消去したユーザーの投稿・リアクション・ファイルは保存しません
+// cutoffs の保持期限を過ぎたメッセージは保存せず、本文の保持期限を過ぎたメッセージは本文を保存しません
+func (r *Repository) SaveMessages(teamID int, messages []SlackConversation, cutoffs RetentionCutoffs) error {
+	messages = withinRetention(messages, cutoffs)
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := lockForIngest(tx); err != nil {
+		return err
+	}
+	excluded, err := r.excludedUsers(tx)
+	if err != nil {
+		return err
+	}
+	messages = withoutOptedOut(messages, excluded)
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO messages (team_id, channel_id, ts, user_key, workspace_id, text, thread_ts, subtype, bot_id,
+		                      reply_count, latest_reply, posted_at, edited_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), $8, $9, $10, NULLIF($11, ''), $12, $13)
+		ON CONFLICT (channel_id, ts) DO UPDATE
+		SET user_key = $4, workspace_id = $5, text = $6, thread_ts = NULLIF($7, ''), subtype = $8, bot_id = $9,
+		    reply_count = $10, latest_reply = NULLIF($11, ''),
+		    edited_at = GREATEST(messages.edited_at, EXCLUDED.edited_at), deleted_at = NULL,
+		    updated_at = CURRENT_TIMESTAMP
+		RETURNING id
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare insert message: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, m := range messages {
+		// posted_at などは TIMESTAMP (タイムゾーンなし) なので UTC で保存する
+		text, err := r.messageText(m.Text)
+		if err != nil {
+			return err
+		}
+		var id int64
+		err = stmt.QueryRow(teamID, m.ChannelID, m.TS, m.UserID, m.WorkspaceID, text, m.ThreadTS, m.Subtype, m.BotID,
+			m.ReplyCount, m.LatestReply, m.PostedAt.UTC(), utcOrNil(m.EditedAt)).Scan(&id)
+		if err != nil {
+			log.Printf("Failed to save message (channel_id: %s, ts: %s): %v", m.ChannelID, m.TS, err)
+			return err
+		}
+		if m.EditedAt != nil {
+			if err := insertMessageEdit(tx, id, m.UserID, *m.EditedAt); err != nil {
+				return err
+			}
+		}
+		if err := saveMessageReactions(tx, id, m.Reactions, m.PostedAt); err != nil {
+			return err
+		}
+		if err := saveMessageFiles(tx, id, m.Files); err != nil {
+			return err
+		}
+		if err := saveMessageLinks(tx, id, m.Links); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ApplyMessageEdit は保存済みのメッセージに Slack での編集を反映します
+// 本文に含まれるリンクと共有されたファイルは編集後の links と files に合わせます。本文の保存方法は SaveMessages と同じです
+// 追跡から除外されたユーザーと個人データを消去したユーザーが共有したファイルは保存しません
+// 本文の保持期限（cutoffs.MessageText）より前に投稿されたメッセージは本文を保存しません
+// メッセージが保存されていない場合と、メタデータの保持期限（cutoffs.MessageMetadata）より前に投稿されたメッセージの場合は何もせず false を返します
+func (r *Repository) ApplyMessageEdit(channelID string, ts string, text string, links []MessageLink, files []MessageFile, editedAt time.Time, cutoffs RetentionCutoffs) (bool, error) {
+	text, err := r.messageText(text)
+	if err != nil {
+		return false, err
+	}
+	tx, err := r.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := lockForIngest(tx); err != nil {
+		return false, err
+	}
+	excluded, err := r.excludedUsers(tx)
+	if err != nil {
+		return false, err
+	}
+
+	var id int64
+	var userKey string
+	err = tx.QueryRow(`
+		UPDATE messages
+		SET text = CASE WHEN posted_at < $5 THEN '' ELSE $3 END, edited_at = GREATEST(edited_at, $4),
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE channel_id = $1 AND ts = $2 AND ($6::timestamp IS NULL OR posted_at >= $6)
+		RETURNING id, user_key
+	`, channelID, ts, text, editedAt.UTC(), utcOrNil(cutoffs.MessageText), utcOrNil(cutoffs.MessageMetadata)).Scan(&id, &userKey)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		log.Printf("Failed to apply message edit (channel_id: %s, ts: %s): %v", channelID, ts, err)
+		return false, err
+	}
+
+	if err := insertMessageEdit(tx, id, userKey, editedAt); err != nil {
+		return false, err
+	}
+	kept := make([]MessageFile, 0, len(files))
+	for _, file := range files {
+		if !excluded(file.UserKey) {
+			kept = append(kept, file)
+		}
+	}
+	if err := saveMessageFiles(tx, id, kept); err != nil {
+		return false, err
+	}
+	if err := saveMessageLinks(tx, id, links); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// messageText は保存するメッセージ本文を返します
+// メタデータのみのモードでは空文字、暗号化が有効な場合は暗号文です
+func (r *Repository) messageText(text string) (string, error) {
+	if r.metadataOnly {
+		return "", nil
+	}
+	return r.encrypt(text)
+}
+
+// DropMessageText は保存済みのすべてのメッセージの本文を消去し、消去した件数を返します
+// メタデータのみのモードに切り替えたときに、それまでに保存した本文を消すために使います
+func (r *Repository) DropMessageText() (int64, error) {
+	result, err := r.db.Exec(`UPDATE messages SET text = '', updated_at = CURRENT_TIMESTAMP WHERE text <> ''`)
+	if err != nil {
+		log.Printf("Failed to drop message text: %v", err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// MarkMessageDeleted は保存済みのメッセージを論理削除します
+// メッセージが保存されていない場合は false を返します
+func (r *Repository) MarkMessageDeleted(channelID string, ts string, deletedAt time.Time) (bool, error) {
+	result, err := r.db.Exec(`
+		UPDATE messages
+		SET deleted_at = $3, updated_at = CURRENT_TIMESTAMP
+		WHERE channel_id = $1 AND ts = $2 AND deleted_at IS NULL
+	`, channelID, ts, deletedAt.UTC())
+	if err != nil {
+		log.Printf("Failed to mark message deleted (channel_id: %s, ts: %s): %v", channelID, ts, err)
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// MarkMissingMessagesDeleted は oldest 以降 latest より前の保存済みメッセージのうち、
+// present に含まれないものを論理削除し、削除した件数を返します
+// Slack から取得し直した期間に対して、Slack 側で削除されたメッセージを見つけるために使います
+func (r *Repository) MarkMissingMessagesDeleted(channelID string, oldest string, latest string, present []string) (int64, error) {
+	result, err := r.db.Exec(`
+		UPDATE messages
+		SET deleted_at = CURRENT_TIMESTAMP AT TIME ZONE 'UTC', updated_at = CURRENT_TIMESTAMP
+		WHERE channel_id = $1 AND ts >= $2 AND ts < $3 AND deleted_at IS NULL
+		  AND NOT (ts = ANY($4))
+	`, channelID, oldest, latest, pq.Array(present))
+	if err != nil {
+		log.Printf("Failed to mark missing messages deleted (channel_id: %s): %v", channelID, err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// insertMessageEdit は編集履歴を記録します。同じ編集日時の記録が既にある場合は何もしません
+func insertMessageEdit(tx *sql.Tx, messageID int64, userKey string, editedAt time.Time) error {
+	_, err := tx.Exec(`
+		INSERT INTO message_edits (message_id, user_key, edited_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (message_id, edited_at) DO NOTHING
+	`, messageID, userKey, editedAt.UTC())
+	if err != nil {
+		log.Printf("Failed to insert message edit (message_id: %d): %v", messageID, err)
+	}
+	return err
+}
+
+// utcOrNil は TIMESTAMP (タイムゾーンなし) の列に保存するため UTC に変換します
+func utcOrNil(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UTC()
+}
+
+// GetChannelSyncedTS は指定チャンネルの差分取り込みで保存済みの最新の ts を返します
+// まだ差分取り込みをしていない場合は空文字を返します
+func (r *Repository) GetChannelSyncedTS(channelID string) (string, error) {
+	var ts string
+	err := r.db.QueryRow(`SELECT latest_ts FROM channel_sync_states WHERE channel_id = $1`, channelID).Scan(&ts)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		log.Printf("Failed to get channel sync state (channel_id: %s): %v", channelID, err)
+		return "", err
+	}
+	return ts, nil
+}
+
+// SaveChannelSyncedTS は指定チャンネルの差分取り込みの位置を記録します
+// 既に記録されている位置より古い ts では更新しません
+func (r *Repository) SaveChannelSyncedTS(channelID string, ts string) error {
+	_, err := r.db.Exec(`
+		INSERT INTO channel_sync_states (channel_id, latest_ts)
+		VALUES ($1, $2)
+		ON CONFLICT (channel_id) DO UPDATE
+		SET latest_ts = GREATEST(channel_sync_states.latest_ts, EXCLUDED.latest_ts), updated_at = CURRENT_TIMESTAMP
+	`, channelID, ts)
+	if err != nil {
+		log.Printf("Failed to save channel sync state (channel_id: %s): %v", channelID, err)
+	}
+	return err
+}
+
+// ListMessages は条件に合うメッセージを新しい順に取得します
+// 各メッセージには投稿時点で有効だった所属（grade, team_key）とリアクションを付けます
+// 次のページがある場合は、次のページの取得に使うカーソルを返します
+func (r *Repository) ListMessages(filter MessageFilter) ([]SlackConversation, string, error) {
+	conditions := []string{"m.channel_id = $1"}
+	args := []interface{}{filter.ChannelID}
+	addCondition := func(format string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(format, len(args)))
+	}
+
+	if filter.UserKey != "" {
+		addCondition("m.user_key = $%d", filter.UserKey)
+	}
+	if !filter.IncludeDeleted {
+		conditions = append(conditions, "m.deleted_at IS NULL")
+	}
+	if filter.Policy != nil {
+		var condition string
+		condition, args = filter.Policy.condition("m", "u", args)
+		conditions = append(conditions, condition)
+	}
+	// ts は "秒(10桁).マイクロ秒(6桁)" の固定長なので文字列比較で大小を判定できる
+	if filter.Oldest != "" {
+		addCondition("m.ts >= $%d", filter.Oldest)
+	}
+	if filter.Latest != "" {
+		addCondition("m.ts < $%d", filter.Latest)
+	}
+	if filter.Cursor != "" {
+		addCondition("m.ts < $%d", filter.Cursor)
+	}
+
+	// 次のページの有無を判定するため 1 件多く取得する
+	args = append(args, filter.Limit+1)
+	query := `
+		SELECT m.channel_id, m.user_key, m.workspace_id, m.text, m.ts, COALESCE(m.thread_ts, ''), m.subtype, m.bot_id, m.posted_at,
+		       m.reply_count, COALESCE(m.latest_reply, ''),
+		       m.edited_at, m.deleted_at, a.grade, a.team_key
+		FROM messages m
+		LEFT JOIN users u ON u.user_key = m.user_key
+		LEFT JOIN user_assignments a
+		       ON a.user_id = u.id
+		      AND m.posted_at >= a.valid_from
+		      AND (a.valid_to IS NULL OR m.posted_at < a.valid_to)
+		WHERE ` + strings.Join(conditions, " AND ") + `
+		ORDER BY m.ts DESC
+		LIMIT $` + fmt.Sprint(len(args))
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		log.Printf("Failed to list messages (channel_id: %s): %v", filter.ChannelID, err)
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	messages := []SlackConversation{}
+	for rows.Next() {
+		var m SlackConversation
+		var grade, teamKey sql.NullInt64
+		var editedAt, deletedAt sql.NullTime
+		if err := rows.Scan(&m.ChannelID, &m.UserID, &m.WorkspaceID, &m.Text, &m.TS, &m.ThreadTS, &m.Subtype, &m.BotID, &m.PostedAt,
+			&m.ReplyCount, &m.LatestReply,
+			&editedAt, &deletedAt, &grade, &teamKey); err != nil {
+			log.Printf("Failed to scan message: %v", err)
+			return nil, "", err
+		}
+		if m.Text, err = r.decrypt(m.Text); err != nil {
+			log.Printf("Failed to decrypt message (channel_id: %s, ts: %s): %v", m.ChannelID, m.TS, err)
+			return nil, "", err
+		}
+		if grade.Valid && teamKey.Valid {
+			g, t := int(grade.Int64), int(teamKey.Int64)
+			m.Grade, m.TeamKey = &g, &t
+		}
+		m.IsThreadReply = m.ThreadTS != "" && m.ThreadTS != m.TS
+		if editedAt.Valid {
+			m.EditedAt = &editedAt.Time
+		}
+		if deletedAt.Valid {
+			m.DeletedAt = &deletedAt.Time
+		}
+		messages = append(messages, m)
+	}
+
+	if err = rows.Err(); err != nil {
+		log.Printf("Error iterating message rows: %v", err)
+		return nil, "", err
+	}
+
+	nextCursor := ""
+	if len(messages) > filter.Limit {
+		messages = messages[:filter.Limit]
+		nextCursor = messages[len(messages)-1].TS
+	}
+
+	tss := make([]string, len(messages))
+	for i, m := range messages {
+		tss[i] = m.TS
+	}
+	reactions, err := r.listMessageReactions(filter.ChannelID, tss)
+	if err != nil {
+		return nil, "", err
+	}
+	for i := range messages {
+		messages[i].Reactions = reactions[messages[i].TS]
+		if messages[i].Reactions == nil {
+			messages[i].Reactions = []MessageReaction{}
+		}
+	}
+
+	return messages, nextCursor, nil
+}
@@ -6,17 +6,41 @@ import (
 )
 
 type User struct {
-	ID       int    `json:"id" db:"id"`
-	UserKey  string `json:"user_key" db:"user_key"`
-	UserName string `json:"user_name" db:"user_name"`
-	Grade    int    `json:"grade" db:"grade"`
-	TeamKey  int    `json:"team_key" db:"team_key"`
+	ID          int    `json:"id" db:"id"`
+	WorkspaceID int    `json:"workspace_id" db:"workspace_id"` // 複数ワークスペース対応前のユーザーは 0
+	UserKey     string `json:"user_key" db:"user_key"`
+	UserName    string `json:"user_name" db:"user_name"`
+	Grade       int    `json:"grade" db:"grade"`
+	TeamKey     int    `json:"team_key" db:"team_key"`
+	// Slack 側の状態（users.list の is_bot / deleted）
+	IsBot     bool `json:"is_bot" db:"is_bot"`
+	IsDeleted bool `json:"is_deleted" db:"is_deleted"`
+	// ダッシュボードでの権限（"admin", "lead", "member"）
+	Role string `json:"role" db:"role"`
+	// 追跡から除外されているかどうか（メッセージ・リアクション・在席状況を保存せず、集計にも含めない）
+	OptedOut bool `json:"opted_out" db:"opted_out"`
 }
 
 type Team struct {
 	ID          int    `json:"id" db:"id"`
+	WorkspaceID int    `json:"workspace_id" db:"workspace_id"` // 複数ワークスペース対応前のチームは 0
 	ChannelID   string `json:"channel_id" db:"channel_id"`
 	ChannelName string `json:"channel_name" db:"channel_name"`
+	IsTracked   bool   `json:"is_tracked" db:"is_tracked"` // false の場合は同期・集計の対象外
+}
+
+// Workspace は OAuth でインストールした Slack ワークスペースです
+// トークンは API のレスポンスに含めません
+type Workspace struct {
+	ID          int       `json:"id"`
+	SlackTeamID string    `json:"slack_team_id"` // Slack のワークスペースID（"T" で始まる）
+	Name        string    `json:"name"`
+	URL         string    `json:"url"` // 例: "https://example.slack.com/"
+	BotUserID   string    `json:"bot_user_id"`
+	BotToken    string    `json:"-"`
+	UserToken   string    `json:"-"`
+	InstalledAt time.Time `json:"installed_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
 }
 
 type ActivityLog struct {
@@ -31,6 +55,8 @@ type ActivityLog struct {
 type SlackUser struct {
 	ID      string `json:"id"`
 	Name    string `json:"name"`
+	IsBot   bool   `json:"is_bot"`
+	Deleted bool   `json:"deleted"`
 	Profile struct {
 		DisplayName string `json:"display_name"`
 		RealName    string `json:"real_name"`
@@ -50,4 +76,169 @@ type SlackConversation struct {
 	Text        string `json:"text"`
 	Timestamp   string `json:"timestamp"`
 	// Timestamp   time.Time `json:"ts"`
+	TS       string    `json:"ts"`                  // Slack のメッセージID（例: "1601055549.000100"）
+	ThreadTS string    `json:"thread_ts,omitempty"` // スレッドの親メッセージの ts
+	Subtype  string    `json:"subtype"`             // 通常の投稿は空。"channel_join", "bot_message" など
+	BotID    string    `json:"bot_id,omitempty"`    // ボット・アプリによる投稿の場合のボットID
+	PostedAt time.Time `json:"-"`
+	// スレッドの情報（返信数と最新の返信の ts はスレッドの親メッセージのみ）
+	IsThreadReply bool   `json:"is_thread_reply"`
+	ReplyCount    int    `json:"reply_count"`
+	LatestReply   string `json:"latest_reply,omitempty"`
+	// 表示用に付ける情報（保存はしない）
+	UserName    string            `json:"user_name"` // 投稿者の表示名（不明な場合は空）
+	ChannelName string            `json:"channel_name"`
+	Permalink   string            `json:"permalink,omitempty"`
+	PlainText   string            `json:"plain_text"` // Text（mrkdwn）から書式を除き、メンションを名前にしたもの
+	HTML        string            `json:"html"`       // Text を表示用の安全な HTML にしたもの
+	Reactions   []MessageReaction `json:"reactions"`
+	// 共有されたファイルとリンクのメタデータ（取り込み時のみ使う）
+	Files []MessageFile `json:"-"`
+	Links []MessageLink `json:"-"`
+	// Slack で最後に編集された日時と削除された日時（該当しない場合は nil）
+	EditedAt  *time.Time `json:"edited_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// 投稿時点で有効だった所属（所属履歴がないユーザーの場合は nil）
+	Grade   *int `json:"grade"`
+	TeamKey *int `json:"team_key"`
+}
+
+// MessageReaction はメッセージに付いた絵文字ごとのリアクションです
+type MessageReaction struct {
+	Emoji string   `json:"emoji"` // 絵文字の名前（コロンなし）
+	Users []string `json:"users"` // リアクションしたユーザーのSlackユーザーID
+	// Slack 上のリアクションの数。Slack の履歴では Users が途中までしか返らないことがあり、その場合は len(Users) より大きい
+	Count int `json:"count"`
+}
+
+// MessageFile はメッセージで共有されたファイルのメタデータです。ファイル名・タイトル・中身は持ちません
+type MessageFile struct {
+	FileID       string `json:"file_id"`
+	UserKey      string `json:"user_key"` // アップロードしたユーザー
+	Filetype     string `json:"filetype"`
+	Mimetype     string `json:"mimetype"`
+	Category     string `json:"category"` // 集計用の分類（"document", "snippet", "image" など）
+	Size         int64  `json:"size"`
+	IsExternal   bool   `json:"is_external"`
+	ExternalType string `json:"external_type,omitempty"`
+}
+
+// MessageLink はメッセージに含まれるリンクのドメインごとの数です
+// URL は本文の一部なので保存しません
+type MessageLink struct {
+	Domain string `json:"domain"` // 小文字のホスト名（先頭の "www." は除く）
+	Links  int    `json:"links"`  // このドメインの（重複を除いた）リンクの数
+}
+
+// MessageFilter は ListMessages の検索条件です
+// Oldest / Latest / Cursor は正規化済みの Slack ts（"1601055549.000100" 形式）で指定します
+type MessageFilter struct {
+	ChannelID string
+	UserKey   string // 指定した場合はこのユーザーの投稿のみ
+	Oldest    string // この ts 以降（含む）
+	Latest    string // この ts より前（含まない）
+	Cursor    string // 前のページの next_cursor。この ts より古い投稿を返す
+	Limit     int
+	// true の場合は Slack で削除されたメッセージも含める
+	IncludeDeleted bool
+	// 指定した場合は、このポリシーで人の活動とみなすメッセージのみ
+	Policy *ActivityPolicy
+}
+
+// メンバーシップの由来
+const (
+	MembershipSourceSlack  = "slack"  // conversations.members から同期
+	MembershipSourceManual = "manual" // 手動での上書き
+)
+
+// TeamMember はチームに所属するユーザーと、その所属の由来を表します
+type TeamMember struct {
+	User
+	Source string `json:"source"`
+}
+
+// UserTeam はユーザーが所属するチームと、その所属の由来を表します
+type UserTeam struct {
+	Team
+	Source string `json:"source"`
+}
+
+// UserAssignment はある期間に有効だったユーザーの grade と team_key を表します
+// ValidTo が nil の場合は現在も有効です
+type UserAssignment struct {
+	ID        int        `json:"id"`
+	UserID    int        `json:"user_id"`
+	UserKey   string     `json:"user_key"`
+	Grade     int        `json:"grade"`
+	TeamKey   int        `json:"team_key"`
+	ValidFrom time.Time  `json:"valid_from"`
+	ValidTo   *time.Time `json:"valid_to"`
+}
+
+// 同期ジョブの状態
+const (
+	JobStatusQueued    = "queued"
+	JobStatusRunning   = "running"
+	JobStatusSucceeded = "succeeded"
+	JobStatusFailed    = "failed"
+)
+
+// SyncJob は非同期で実行される同期ジョブの状態と進捗を表します
+type SyncJob struct {
+	ID         int64      `json:"id"`
+	Kind       string     `json:"kind"`
+	Resource   string     `json:"resource"`
+	Status     string     `json:"status"`
+	Processed  int        `json:"processed"`
+	Total      int        `json:"total"` // 不明な場合は 0
+	Error      string     `json:"error,omitempty"`
+	Window     SyncWindow `json:"window"`
+	Checkpoint string     `json:"checkpoint,omitempty"` // 期間指定の取り込みで保存済みの最も古い ts
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// Finished はジョブが終了しているかどうかを返します
+func (j SyncJob) Finished() bool {
+	return j.Status == JobStatusSucceeded || j.Status == JobStatusFailed
+}
+
+// SyncJobChannel は複数チャンネルの同期ジョブにおける、チャンネルごとの進捗を表します
+type SyncJobChannel struct {
+	JobID       int64      `json:"job_id"`
+	TeamID      int        `json:"team_id"`
+	ChannelName string     `json:"channel_name"`
+	Status      string     `json:"status"`
+	Synced      int        `json:"synced"`
+	Error       string     `json:"error,omitempty"`
+	Checkpoint  string     `json:"checkpoint,omitempty"` // 期間指定の取り込みで保存済みの最も古い ts
+	StartedAt   *time.Time `json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at"`
+}
+
+// SyncWindow は会話履歴を取り込む期間です（正規化済みの Slack ts、空なら指定なし。Latest は含まない）
+// Oldest と Latest のどちらも空の場合は、前回の続きからの差分取り込みになります
+type SyncWindow struct {
+	Oldest string `json:"oldest,omitempty"`
+	Latest string `json:"latest,omitempty"`
+}
+
+// IsZero は期間が指定されていないかどうかを返します
+func (w SyncWindow) IsZero() bool {
+	return w.Oldest == "" && w.Latest == ""
+}
+
+// APIKey はバックエンド API の認証に使う API キーです。キーそのものは保存しません
+type APIKey struct {
+	ID          int        `json:"id"`
+	Name        string     `json:"name"`
+	Prefix      string     `json:"prefix"` // キーの先頭（どのキーか見分けるため）
+	Role        string     `json:"role"`
+	TeamKey     *int       `json:"team_key"`     // Role が lead / member の場合に見られるチーム
+	WorkspaceID *int       `json:"workspace_id"` // キーで扱えるワークスペース（nil はすべてのワークスペースを扱う admin のキー）
+	CreatedAt   time.Time  `json:"created_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
 }
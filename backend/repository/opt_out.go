@@ -0,0 +1,178 @@
+// backend/repository/opt_out.go
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+)
+
+// OptOutReport はユーザーを追跡から除外したときに削除した行数です
+type OptOutReport struct {
+	UserKey         string `json:"user_key"`
+	Messages        int64  `json:"messages"`         // 投稿したメッセージ（編集履歴・リアクション・ファイル・リンクを含めて削除）
+	Reactions       int64  `json:"reactions"`        // 他のユーザーのメッセージへのリアクション
+	Edits           int64  `json:"edits"`            // 他のユーザーのメッセージの編集履歴
+	Files           int64  `json:"files"`            // 他のユーザーのメッセージで共有したファイル
+	PresenceSamples int64  `json:"presence_samples"` // activity_logs の在席状況
+}
+
+// SetUserOptedOut はユーザーを追跡から除外する、または除外を取り消します
+// 除外する場合は、同じトランザクションでユーザーのメッセージ・リアクション・編集履歴・ファイル・在席状況を削除します
+// 除外を取り消しても削除したデータは戻りません。見つからない場合は ErrNotFound を返します
+// 個人データを消去したユーザーの除外は取り消せません（ErrConflict を返します）
+func (r *Repository) SetUserOptedOut(id int, optedOut bool) (OptOutReport, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		log.Printf("Failed to begin transaction for opt-out (user_id: %d): %v", id, err)
+		return OptOutReport{}, fmt.Errorf("database error beginning transaction for id %d: %w", id, err)
+	}
+	defer tx.Rollback()
+
+	if err := lockForOptOut(tx); err != nil {
+		return OptOutReport{}, err
+	}
+
+	var report OptOutReport
+	var erased bool
+	err = tx.QueryRow(`
+		UPDATE users
+		SET opted_out = $2, opted_out_at = CASE WHEN $2 THEN COALESCE(opted_out_at, CURRENT_TIMESTAMP) END
+		WHERE id = $1
+		RETURNING user_key, erased_at IS NOT NULL
+	`, id, optedOut).Scan(&report.UserKey, &erased)
+	if err == sql.ErrNoRows {
+		return OptOutReport{}, fmt.Errorf("%w: no user found with id %d", ErrNotFound, id)
+	}
+	if err != nil {
+		log.Printf("Failed to update opt-out (user_id: %d): %v", id, err)
+		return OptOutReport{}, err
+	}
+	if erased && !optedOut {
+		return OptOutReport{}, fmt.Errorf("%w: personal data of user %d has been erased", ErrConflict, id)
+	}
+
+	if optedOut {
+		// メッセージを先に削除し、そのメッセージの編集履歴・リアクション・ファイルは ON DELETE CASCADE で消す
+		purges := []struct {
+			count *int64
+			query string
+			arg   interface{}
+		}{
+			{&report.Messages, `DELETE FROM messages WHERE user_key = $1`, report.UserKey},
+			{&report.Reactions, `DELETE FROM message_reactions WHERE user_key = $1`, report.UserKey},
+			{&report.Edits, `DELETE FROM message_edits WHERE user_key = $1`, report.UserKey},
+			{&report.Files, `DELETE FROM message_files WHERE user_key = $1`, report.UserKey},
+			{&report.PresenceSamples, `DELETE FROM activity_logs WHERE user_id = $1`, id},
+		}
+		for _, purge := range purges {
+			result, err := tx.Exec(purge.query, purge.arg)
+			if err != nil {
+				log.Printf("Failed to purge data of opted-out user (user_id: %d): %v", id, err)
+				return OptOutReport{}, err
+			}
+			if *purge.count, err = result.RowsAffected(); err != nil {
+				return OptOutReport{}, err
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Failed to commit opt-out (user_id: %d): %v", id, err)
+		return OptOutReport{}, fmt.Errorf("database error committing opt-out for id %d: %w", id, err)
+	}
+	return report, nil
+}
+
+// optOutLockResource は取り込みと、追跡からの除外・個人データの消去を排他するための advisory lock のリソース名です
+// 取り込みは共有ロック、除外と消去は排他ロックをトランザクションの終わりまで取ります
+// 取り込みの途中で除外がコミットされると、除外したユーザーのデータが削除の後に保存されてしまうためです
+const optOutLockResource = "opt-out"
+
+// lockForIngest は取り込みのトランザクションで共有ロックを取ります。除外・消去のトランザクションが終わるまで待ちます
+// ロックを取った後に excludedUsers を読めば、取り込みが終わるまでその内容は変わりません
+func lockForIngest(tx *sql.Tx) error {
+	_, err := tx.Exec(`SELECT pg_advisory_xact_lock_shared($1, hashtext($2))`, advisoryLockNamespace, optOutLockResource)
+	if err != nil {
+		log.Printf("Failed to acquire ingest lock: %v", err)
+	}
+	return err
+}
+
+// lockForOptOut は除外・消去のトランザクションで排他ロックを取ります。実行中の取り込みが終わるまで待ちます
+func lockForOptOut(tx *sql.Tx) error {
+	_, err := tx.Exec(`SELECT pg_advisory_xact_lock($1, hashtext($2))`, advisoryLockNamespace, optOutLockResource)
+	if err != nil {
+		log.Printf("Failed to acquire opt-out lock: %v", err)
+	}
+	return err
+}
+
+// optedOutUserKeys は追跡から除外されたユーザーの user_key の集合を返します
+func optedOutUserKeys(tx *sql.Tx) (map[string]bool, error) {
+	rows, err := tx.Query(`SELECT user_key FROM users WHERE opted_out`)
+	if err != nil {
+		log.Printf("Failed to get opted-out users: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := map[string]bool{}
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys[key] = true
+	}
+	return keys, rows.Err()
+}
+
+// excludedUsers は取り込まないユーザーかどうかを返す関数を返します
+// 追跡から除外されたユーザーと、個人データを消去したユーザー（user_key を消去の印に置き換えた行）が対象です
+// 取り込みで使う場合は、先に lockForIngest でロックを取ります
+func (r *Repository) excludedUsers(tx *sql.Tx) (func(userKey string) bool, error) {
+	optedOut, err := optedOutUserKeys(tx)
+	if err != nil {
+		return nil, err
+	}
+	return func(userKey string) bool {
+		return len(optedOut) > 0 && (optedOut[userKey] || optedOut[r.erasedUserKey(userKey)])
+	}, nil
+}
+
+// withoutOptedOut は取り込まないユーザー（excluded）の分を除いたメッセージを返します
+// 除外されたユーザーの投稿は取り込まず、他のユーザーの投稿からはリアクションと共有したファイルを除きます
+func withoutOptedOut(messages []SlackConversation, excluded func(userKey string) bool) []SlackConversation {
+	kept := make([]SlackConversation, 0, len(messages))
+	for _, m := range messages {
+		if excluded(m.UserID) {
+			continue
+		}
+		reactions := make([]MessageReaction, 0, len(m.Reactions))
+		for _, reaction := range m.Reactions {
+			users := make([]string, 0, len(reaction.Users))
+			for _, userKey := range reaction.Users {
+				if !excluded(userKey) {
+					users = append(users, userKey)
+				}
+			}
+			// Count は Slack 上の数なので、除いた分を引いてリアクションを取得しきれたかどうかの判定を保つ
+			reaction.Count -= len(reaction.Users) - len(users)
+			reaction.Users = users
+			if reaction.Count > 0 || len(users) > 0 {
+				reactions = append(reactions, reaction)
+			}
+		}
+		m.Reactions = reactions
+		files := make([]MessageFile, 0, len(m.Files))
+		for _, file := range m.Files {
+			if !excluded(file.UserKey) {
+				files = append(files, file)
+			}
+		}
+		m.Files = files
+		kept = append(kept, m)
+	}
+	return kept
+}
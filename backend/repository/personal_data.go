@@ -0,0 +1,394 @@
+// backend/repository/personal_data.go
+package repository
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// PersonalData はユーザー 1 人について保存しているすべてのデータです（個人データの開示請求に使う）
+type PersonalData struct {
+	Profile     User                 `json:"profile"`
+	Assignments []UserAssignment     `json:"assignments"` // grade と team_key の履歴
+	Memberships []PersonalMembership `json:"memberships"`
+	Messages    []PersonalMessage    `json:"messages"`
+	Reactions   []PersonalReaction   `json:"reactions"`
+	Edits       []PersonalEdit       `json:"edits"`
+	Files       []PersonalFile       `json:"files"`
+	Links       []PersonalLink       `json:"links"` // 投稿したメッセージに含まれるリンクのドメイン
+	Presence    []PresenceSample     `json:"presence"`
+}
+
+// PersonalMembership はチームのメンバーシップの行です（manual 行での除外も含む）
+type PersonalMembership struct {
+	TeamID      int        `json:"team_id"`
+	ChannelID   string     `json:"channel_id"`
+	ChannelName string     `json:"channel_name"`
+	Source      string     `json:"source"` // "slack" または "manual"
+	IsExcluded  bool       `json:"is_excluded"`
+	CreatedAt   *time.Time `json:"created_at"`
+}
+
+// PersonalMessage はユーザーが投稿したメッセージです
+type PersonalMessage struct {
+	ChannelID  string     `json:"channel_id"`
+	TS         string     `json:"ts"`
+	ThreadTS   string     `json:"thread_ts,omitempty"`
+	Subtype    string     `json:"subtype"`
+	Text       string     `json:"text"`
+	ReplyCount int        `json:"reply_count"`
+	PostedAt   time.Time  `json:"posted_at"`
+	EditedAt   *time.Time `json:"edited_at,omitempty"`
+	DeletedAt  *time.Time `json:"deleted_at,omitempty"`
+}
+
+// PersonalReaction はユーザーが付けたリアクションです。メッセージはチャンネルと ts で示します
+type PersonalReaction struct {
+	ChannelID string    `json:"channel_id"`
+	TS        string    `json:"ts"`
+	Emoji     string    `json:"emoji"`
+	ReactedAt time.Time `json:"reacted_at"`
+}
+
+// PersonalEdit はユーザーによるメッセージの編集です
+type PersonalEdit struct {
+	ChannelID string    `json:"channel_id"`
+	TS        string    `json:"ts"`
+	EditedAt  time.Time `json:"edited_at"`
+}
+
+// PersonalFile はユーザーが共有したファイルのメタデータです
+type PersonalFile struct {
+	ChannelID string `json:"channel_id"`
+	TS        string `json:"ts"`
+	MessageFile
+}
+
+// PersonalLink はユーザーが投稿したメッセージに含まれるリンクのドメインと、そのドメインのリンクの数です
+type PersonalLink struct {
+	ChannelID string `json:"channel_id"`
+	TS        string `json:"ts"`
+	MessageLink
+}
+
+// PresenceSample は activity_logs の在席状況の 1 行です
+type PresenceSample struct {
+	Timestamp *time.Time `json:"timestamp"`
+	Status    string     `json:"status"`
+	CreatedAt *time.Time `json:"created_at"`
+}
+
+// DataErasure は個人データの消去の記録です。消去した件数だけを持ちます
+type DataErasure struct {
+	ID              int64     `json:"id"`
+	UserID          int       `json:"user_id"`
+	RequestedBy     string    `json:"requested_by"` // "self" は本人、それ以外は "種類:ID"
+	Messages        int64     `json:"messages"`     // 投稿したメッセージ（編集履歴・リアクション・ファイル・リンクを含めて削除）
+	Reactions       int64     `json:"reactions"`
+	Edits           int64     `json:"edits"`
+	Files           int64     `json:"files"`
+	PresenceSamples int64     `json:"presence_samples"`
+	Memberships     int64     `json:"memberships"`
+	Assignments     int64     `json:"assignments"`
+	ErasedAt        time.Time `json:"erased_at"`
+}
+
+// GetPersonalData はユーザーについて保存しているすべてのデータを取得します
+// 読み込み中に同期が進んでも食い違わないよう、1 つの読み取り専用トランザクションで読み込みます
+// メッセージ本文は復号して返します。見つからない場合は ErrNotFound を返します
+func (r *Repository) GetPersonalData(id int) (PersonalData, error) {
+	tx, err := r.db.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		log.Printf("Failed to begin transaction for personal data export (user_id: %d): %v", id, err)
+		return PersonalData{}, fmt.Errorf("database error beginning transaction for id %d: %w", id, err)
+	}
+	defer tx.Rollback()
+
+	var data PersonalData
+	user := &data.Profile
+	err = tx.QueryRow(`
+		SELECT id, COALESCE(workspace_id, 0), user_key, user_name, grade, team_key, is_bot, is_deleted, role, opted_out
+		FROM users WHERE id = $1
+	`, id).Scan(&user.ID, &user.WorkspaceID, &user.UserKey, &user.UserName, &user.Grade, &user.TeamKey, &user.IsBot, &user.IsDeleted, &user.Role, &user.OptedOut)
+	if err == sql.ErrNoRows {
+		return PersonalData{}, fmt.Errorf("%w: no user found with id %d", ErrNotFound, id)
+	}
+	if err != nil {
+		log.Printf("Failed to get user for personal data export (user_id: %d): %v", id, err)
+		return PersonalData{}, err
+	}
+
+	data.Assignments = []UserAssignment{}
+	err = queryEach(tx, `
+		SELECT id, user_id, grade, team_key, valid_from, valid_to
+		FROM user_assignments WHERE user_id = $1 ORDER BY valid_from
+	`, []interface{}{id}, func(rows *sql.Rows) error {
+		a := UserAssignment{UserKey: user.UserKey}
+		var validTo sql.NullTime
+		if err := rows.Scan(&a.ID, &a.UserID, &a.Grade, &a.TeamKey, &a.ValidFrom, &validTo); err != nil {
+			return err
+		}
+		a.ValidTo = timeOrNil(validTo)
+		data.Assignments = append(data.Assignments, a)
+		return nil
+	})
+	if err != nil {
+		return PersonalData{}, fmt.Errorf("failed to export assignments: %w", err)
+	}
+
+	data.Memberships = []PersonalMembership{}
+	err = queryEach(tx, `
+		SELECT t.id, t.channel_id, t.channel_name, m.source, m.is_excluded, m.created_at
+		FROM team_memberships m JOIN teams t ON t.id = m.team_id
+		WHERE m.user_id = $1 ORDER BY t.id, m.source
+	`, []interface{}{id}, func(rows *sql.Rows) error {
+		var m PersonalMembership
+		var createdAt sql.NullTime
+		if err := rows.Scan(&m.TeamID, &m.ChannelID, &m.ChannelName, &m.Source, &m.IsExcluded, &createdAt); err != nil {
+			return err
+		}
+		m.CreatedAt = timeOrNil(createdAt)
+		data.Memberships = append(data.Memberships, m)
+		return nil
+	})
+	if err != nil {
+		return PersonalData{}, fmt.Errorf("failed to export memberships: %w", err)
+	}
+
+	data.Messages = []PersonalMessage{}
+	err = queryEach(tx, `
+		SELECT channel_id, ts, COALESCE(thread_ts, ''), subtype, text, reply_count, posted_at, edited_at, deleted_at
+		FROM messages WHERE user_key = $1 ORDER BY posted_at, channel_id, ts
+	`, []interface{}{user.UserKey}, func(rows *sql.Rows) error {
+		var m PersonalMessage
+		var editedAt, deletedAt sql.NullTime
+		if err := rows.Scan(&m.ChannelID, &m.TS, &m.ThreadTS, &m.Subtype, &m.Text, &m.ReplyCount, &m.PostedAt, &editedAt, &deletedAt); err != nil {
+			return err
+		}
+		var err error
+		if m.Text, err = r.decrypt(m.Text); err != nil {
+			return fmt.Errorf("failed to decrypt message (channel_id: %s, ts: %s): %w", m.ChannelID, m.TS, err)
+		}
+		m.EditedAt, m.DeletedAt = timeOrNil(editedAt), timeOrNil(deletedAt)
+		data.Messages = append(data.Messages, m)
+		return nil
+	})
+	if err != nil {
+		return PersonalData{}, fmt.Errorf("failed to export messages: %w", err)
+	}
+
+	data.Reactions = []PersonalReaction{}
+	err = queryEach(tx, `
+		SELECT m.channel_id, m.ts, r.emoji, r.reacted_at
+		FROM message_reactions r JOIN messages m ON m.id = r.message_id
+		WHERE r.user_key = $1 ORDER BY r.reacted_at, m.channel_id, m.ts
+	`, []interface{}{user.UserKey}, func(rows *sql.Rows) error {
+		var reaction PersonalReaction
+		if err := rows.Scan(&reaction.ChannelID, &reaction.TS, &reaction.Emoji, &reaction.ReactedAt); err != nil {
+			return err
+		}
+		data.Reactions = append(data.Reactions, reaction)
+		return nil
+	})
+	if err != nil {
+		return PersonalData{}, fmt.Errorf("failed to export reactions: %w", err)
+	}
+
+	data.Edits = []PersonalEdit{}
+	err = queryEach(tx, `
+		SELECT m.channel_id, m.ts, e.edited_at
+		FROM message_edits e JOIN messages m ON m.id = e.message_id
+		WHERE e.user_key = $1 ORDER BY e.edited_at, m.channel_id, m.ts
+	`, []interface{}{user.UserKey}, func(rows *sql.Rows) error {
+		var edit PersonalEdit
+		if err := rows.Scan(&edit.ChannelID, &edit.TS, &edit.EditedAt); err != nil {
+			return err
+		}
+		data.Edits = append(data.Edits, edit)
+		return nil
+	})
+	if err != nil {
+		return PersonalData{}, fmt.Errorf("failed to export edits: %w", err)
+	}
+
+	data.Files = []PersonalFile{}
+	err = queryEach(tx, `
+		SELECT m.channel_id, m.ts, f.file_id, f.user_key, f.filetype, f.mimetype, f.category, f.size, f.is_external, f.external_type
+		FROM message_files f JOIN messages m ON m.id = f.message_id
+		WHERE f.user_key = $1 ORDER BY m.posted_at, m.channel_id, m.ts
+	`, []interface{}{user.UserKey}, func(rows *sql.Rows) error {
+		var f PersonalFile
+		if err := rows.Scan(&f.ChannelID, &f.TS, &f.FileID, &f.UserKey, &f.Filetype, &f.Mimetype, &f.Category, &f.Size, &f.IsExternal, &f.ExternalType); err != nil {
+			return err
+		}
+		data.Files = append(data.Files, f)
+		return nil
+	})
+	if err != nil {
+		return PersonalData{}, fmt.Errorf("failed to export files: %w", err)
+	}
+
+	data.Links = []PersonalLink{}
+	err = queryEach(tx, `
+		SELECT m.channel_id, m.ts, l.domain, l.links
+		FROM message_links l JOIN messages m ON m.id = l.message_id
+		WHERE m.user_key = $1 ORDER BY m.posted_at, m.channel_id, m.ts, l.domain
+	`, []interface{}{user.UserKey}, func(rows *sql.Rows) error {
+		var link PersonalLink
+		if err := rows.Scan(&link.ChannelID, &link.TS, &link.Domain, &link.Links); err != nil {
+			return err
+		}
+		data.Links = append(data.Links, link)
+		return nil
+	})
+	if err != nil {
+		return PersonalData{}, fmt.Errorf("failed to export links: %w", err)
+	}
+
+	data.Presence = []PresenceSample{}
+	err = queryEach(tx, `
+		SELECT timestamp, COALESCE(status, ''), created_at
+		FROM activity_logs WHERE user_id = $1 ORDER BY COALESCE(timestamp, created_at), id
+	`, []interface{}{id}, func(rows *sql.Rows) error {
+		var sample PresenceSample
+		var timestamp, createdAt sql.NullTime
+		if err := rows.Scan(&timestamp, &sample.Status, &createdAt); err != nil {
+			return err
+		}
+		sample.Timestamp, sample.CreatedAt = timeOrNil(timestamp), timeOrNil(createdAt)
+		data.Presence = append(data.Presence, sample)
+		return nil
+	})
+	if err != nil {
+		return PersonalData{}, fmt.Errorf("failed to export presence: %w", err)
+	}
+
+	return data, nil
+}
+
+// EraseUserData はユーザーの個人データを 1 つのトランザクションで消去し、消去の記録を残します
+// メッセージ・リアクション・編集履歴・ファイル・在席状況・メンバーシップ・所属履歴は削除し、
+// ユーザーの行は、user_key を鍵付きハッシュ（erasedUserKey）に置き換え、ユーザー名・グレード・チームを消して
+// 追跡からの除外を設定した状態で残します。同期やイベントではこのハッシュと照合して取り込み直しません
+// 見つからない場合は ErrNotFound、ハッシュの鍵（Config.ErasureKey）がない場合は ErrUnavailable を返します
+func (r *Repository) EraseUserData(id int, requestedBy string) (DataErasure, error) {
+	// 鍵がないと元の Slack ユーザーIDを総当たりで復元できるハッシュになるので、消去しない
+	if len(r.erasureKey) == 0 {
+		return DataErasure{}, fmt.Errorf("%w: erasure key is not configured", ErrUnavailable)
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		log.Printf("Failed to begin transaction for data erasure (user_id: %d): %v", id, err)
+		return DataErasure{}, fmt.Errorf("database error beginning transaction for id %d: %w", id, err)
+	}
+	defer tx.Rollback()
+
+	if err := lockForOptOut(tx); err != nil {
+		return DataErasure{}, err
+	}
+
+	erasure := DataErasure{UserID: id, RequestedBy: requestedBy}
+	var userKey string
+	err = tx.QueryRow(`SELECT user_key FROM users WHERE id = $1 FOR UPDATE`, id).Scan(&userKey)
+	if err == sql.ErrNoRows {
+		return DataErasure{}, fmt.Errorf("%w: no user found with id %d", ErrNotFound, id)
+	}
+	if err != nil {
+		log.Printf("Failed to get user for data erasure (user_id: %d): %v", id, err)
+		return DataErasure{}, err
+	}
+
+	// メッセージを先に削除し、そのメッセージの編集履歴・リアクション・ファイル・リンクは ON DELETE CASCADE で消す
+	purges := []struct {
+		count *int64
+		query string
+		arg   interface{}
+	}{
+		{&erasure.Messages, `DELETE FROM messages WHERE user_key = $1`, userKey},
+		{&erasure.Reactions, `DELETE FROM message_reactions WHERE user_key = $1`, userKey},
+		{&erasure.Edits, `DELETE FROM message_edits WHERE user_key = $1`, userKey},
+		{&erasure.Files, `DELETE FROM message_files WHERE user_key = $1`, userKey},
+		{&erasure.PresenceSamples, `DELETE FROM activity_logs WHERE user_id = $1`, id},
+		{&erasure.Memberships, `DELETE FROM team_memberships WHERE user_id = $1`, id},
+		{&erasure.Assignments, `DELETE FROM user_assignments WHERE user_id = $1`, id},
+	}
+	for _, purge := range purges {
+		result, err := tx.Exec(purge.query, purge.arg)
+		if err != nil {
+			log.Printf("Failed to erase personal data (user_id: %d): %v", id, err)
+			return DataErasure{}, err
+		}
+		if *purge.count, err = result.RowsAffected(); err != nil {
+			return DataErasure{}, err
+		}
+	}
+
+	// user_key は取り込み直さないための照合に使う鍵付きハッシュに置き換え、それ以外の個人を識別できる値を消す
+	_, err = tx.Exec(`
+		UPDATE users
+		SET user_key = $3, user_name = $2, grade = DEFAULT, team_key = DEFAULT, role = 'member',
+		    opted_out = TRUE, opted_out_at = COALESCE(opted_out_at, CURRENT_TIMESTAMP), erased_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`, id, fmt.Sprintf("erased-%d", id), r.erasedUserKey(userKey))
+	if err != nil {
+		log.Printf("Failed to anonymize user (user_id: %d): %v", id, err)
+		return DataErasure{}, err
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO data_erasures (user_id, requested_by, messages, reactions, edits, files, presence_samples, memberships, assignments)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id, erased_at
+	`, id, requestedBy, erasure.Messages, erasure.Reactions, erasure.Edits, erasure.Files, erasure.PresenceSamples,
+		erasure.Memberships, erasure.Assignments).Scan(&erasure.ID, &erasure.ErasedAt)
+	if err != nil {
+		log.Printf("Failed to record data erasure (user_id: %d): %v", id, err)
+		return DataErasure{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Failed to commit data erasure (user_id: %d): %v", id, err)
+		return DataErasure{}, fmt.Errorf("database error committing data erasure for id %d: %w", id, err)
+	}
+	return erasure, nil
+}
+
+// erasedUserKeyPrefix は個人データを消去したユーザーの user_key の接頭辞です
+const erasedUserKeyPrefix = "erased:"
+
+// erasedUserKey は個人データを消去したユーザーの user_key の代わりに残す値です
+// 元の Slack ユーザーIDを復元できないよう鍵付きハッシュにし、消去済みの user_key をもう一度ハッシュにしても同じ値を返します
+func (r *Repository) erasedUserKey(userKey string) string {
+	if strings.HasPrefix(userKey, erasedUserKeyPrefix) {
+		return userKey
+	}
+	mac := hmac.New(sha256.New, r.erasureKey)
+	mac.Write([]byte("erased-user:" + userKey))
+	return erasedUserKeyPrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// queryEach はトランザクションでクエリを実行し、行ごとに scan を呼び出します
+func queryEach(tx *sql.Tx, query string, args []interface{}, scan func(rows *sql.Rows) error) error {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		log.Printf("Failed to query personal data: %v", err)
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			log.Printf("Failed to scan personal data: %v", err)
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,64 @@
+// backend/repository/personal_data_test.go
+package repository
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestErasedUserKey(t *testing.T) {
+	r := &Repository{erasureKey: []byte("key-1")}
+
+	erased := r.erasedUserKey("U123")
+	if !strings.HasPrefix(erased, erasedUserKeyPrefix) || strings.Contains(erased, "U123") {
+		t.Fatalf("erasedUserKey(U123) = %q, want a hash with the erased prefix", erased)
+	}
+	if got := r.erasedUserKey("U123"); got != erased {
+		t.Errorf("erasedUserKey is not deterministic: %q, %q", erased, got)
+	}
+	if got := r.erasedUserKey(erased); got != erased {
+		t.Errorf("erasedUserKey(erased) = %q, want it unchanged", got)
+	}
+	if got := r.erasedUserKey("U456"); got == erased {
+		t.Errorf("different users got the same erased key %q", got)
+	}
+	if got := (&Repository{erasureKey: []byte("key-2")}).erasedUserKey("U123"); got == erased {
+		t.Errorf("different keys got the same erased key %q", got)
+	}
+}
+
+func TestWithoutOptedOutSkipsErasedUsers(t *testing.T) {
+	r := &Repository{erasureKey: []byte("key-1")}
+	optedOut := map[string]bool{r.erasedUserKey("U1"): true, "U2": true}
+	excluded := func(userKey string) bool { return optedOut[userKey] || optedOut[r.erasedUserKey(userKey)] }
+
+	messages := []SlackConversation{
+		{TS: "1", UserID: "U1"},
+		{TS: "2", UserID: "U2"},
+		{
+			TS:        "3",
+			UserID:    "U3",
+			Reactions: []MessageReaction{{Emoji: "tada", Users: []string{"U1", "U3"}, Count: 2}},
+			Files:     []MessageFile{{FileID: "F1", UserKey: "U1"}, {FileID: "F2", UserKey: "U3"}},
+		},
+	}
+
+	got := withoutOptedOut(messages, excluded)
+	if len(got) != 1 || got[0].TS != "3" {
+		t.Fatalf("withoutOptedOut() = %+v, want only the message of U3", got)
+	}
+	if reactions := got[0].Reactions; len(reactions) != 1 || len(reactions[0].Users) != 1 || reactions[0].Users[0] != "U3" || reactions[0].Count != 1 {
+		t.Errorf("reactions = %+v, want only the reaction of U3", reactions)
+	}
+	if files := got[0].Files; len(files) != 1 || files[0].FileID != "F2" {
+		t.Errorf("files = %+v, want only the file of U3", files)
+	}
+}
+
+func TestEraseUserDataRequiresKey(t *testing.T) {
+	r := &Repository{}
+	if _, err := r.EraseUserData(1, "self"); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("EraseUserData() without erasure key error = %v, want %v", err, ErrUnavailable)
+	}
+}
@@ -0,0 +1,144 @@
+// backend/repository/reaction.go
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// saveMessageReactions はメッセージのリアクションを Slack から取得した内容に合わせます
+// 新しいリアクションはリアクションした日時が分からないので投稿日時で記録し、既にあるリアクションの日時は変えません
+// Slack の履歴ではユーザーが途中までしか返らないことがあるので、その場合は取得できなかったリアクションを削除しません
+func saveMessageReactions(tx *sql.Tx, messageID int64, reactions []MessageReaction, postedAt time.Time) error {
+	complete := true
+	for _, reaction := range reactions {
+		if reaction.Count > len(reaction.Users) {
+			complete = false
+		}
+		for _, userKey := range reaction.Users {
+			if err := insertMessageReaction(tx, messageID, reaction.Emoji, userKey, postedAt); err != nil {
+				return err
+			}
+		}
+	}
+	if !complete {
+		return nil
+	}
+
+	emojis, users := []string{}, []string{}
+	for _, reaction := range reactions {
+		for _, userKey := range reaction.Users {
+			emojis = append(emojis, reaction.Emoji)
+			users = append(users, userKey)
+		}
+	}
+	_, err := tx.Exec(`
+		DELETE FROM message_reactions r
+		WHERE r.message_id = $1
+		  AND (r.emoji, r.user_key) NOT IN (SELECT * FROM unnest($2::text[], $3::text[]))
+	`, messageID, pq.Array(emojis), pq.Array(users))
+	if err != nil {
+		log.Printf("Failed to delete removed reactions (message_id: %d): %v", messageID, err)
+	}
+	return err
+}
+
+// insertMessageReaction はリアクションを記録します。既に記録されている場合は何もしません
+func insertMessageReaction(tx *sql.Tx, messageID int64, emoji string, userKey string, reactedAt time.Time) error {
+	_, err := tx.Exec(`
+		INSERT INTO message_reactions (message_id, emoji, user_key, reacted_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (message_id, emoji, user_key) DO NOTHING
+	`, messageID, emoji, userKey, reactedAt.UTC())
+	if err != nil {
+		log.Printf("Failed to insert reaction (message_id: %d, emoji: %s): %v", messageID, emoji, err)
+	}
+	return err
+}
+
+// AddMessageReaction は保存済みのメッセージにリアクションを追加します
+// メッセージが保存されていない場合と、リアクションしたユーザーが追跡から除外されている（個人データを消去した場合を含む）場合は何もせず false を返します
+func (r *Repository) AddMessageReaction(channelID string, ts string, emoji string, userKey string, reactedAt time.Time) (bool, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := lockForIngest(tx); err != nil {
+		return false, err
+	}
+	result, err := tx.Exec(`
+		INSERT INTO message_reactions (message_id, emoji, user_key, reacted_at)
+		SELECT id, $3, $4, $5 FROM messages
+		WHERE channel_id = $1 AND ts = $2
+		  AND NOT EXISTS (SELECT 1 FROM users WHERE user_key IN ($4, $6) AND opted_out)
+		ON CONFLICT (message_id, emoji, user_key) DO NOTHING
+	`, channelID, ts, emoji, userKey, reactedAt.UTC(), r.erasedUserKey(userKey))
+	if err != nil {
+		log.Printf("Failed to add reaction (channel_id: %s, ts: %s): %v", channelID, ts, err)
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, tx.Commit()
+}
+
+// RemoveMessageReaction は保存済みのメッセージからリアクションを削除します
+// リアクションが記録されていない場合は false を返します
+func (r *Repository) RemoveMessageReaction(channelID string, ts string, emoji string, userKey string) (bool, error) {
+	result, err := r.db.Exec(`
+		DELETE FROM message_reactions r
+		USING messages m
+		WHERE m.id = r.message_id AND m.channel_id = $1 AND m.ts = $2
+		  AND r.emoji = $3 AND r.user_key = $4
+	`, channelID, ts, emoji, userKey)
+	if err != nil {
+		log.Printf("Failed to remove reaction (channel_id: %s, ts: %s): %v", channelID, ts, err)
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// listMessageReactions は指定チャンネルのメッセージのリアクションを ts ごとに取得します
+// 絵文字は最初にリアクションされた順、ユーザーはリアクションした順に並べます
+func (r *Repository) listMessageReactions(channelID string, tss []string) (map[string][]MessageReaction, error) {
+	rows, err := r.db.Query(`
+		SELECT m.ts, r.emoji, array_agg(r.user_key ORDER BY r.reacted_at, r.id)
+		FROM message_reactions r
+		JOIN messages m ON m.id = r.message_id
+		WHERE m.channel_id = $1 AND m.ts = ANY($2)
+		GROUP BY m.ts, r.emoji
+		ORDER BY m.ts, MIN(r.reacted_at), MIN(r.id)
+	`, channelID, pq.Array(tss))
+	if err != nil {
+		log.Printf("Failed to list reactions (channel_id: %s): %v", channelID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	reactions := map[string][]MessageReaction{}
+	for rows.Next() {
+		var ts string
+		var reaction MessageReaction
+		if err := rows.Scan(&ts, &reaction.Emoji, pq.Array(&reaction.Users)); err != nil {
+			log.Printf("Failed to scan reaction: %v", err)
+			return nil, err
+		}
+		reaction.Count = len(reaction.Users)
+		reactions[ts] = append(reactions[ts], reaction)
+	}
+
+	if err = rows.Err(); err != nil {
+		log.Printf("Error iterating reaction rows: %v", err)
+		return nil, err
+	}
+	return reactions, nil
+}
@@ -5,45 +5,107 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"strings"
 )
 
 type Repository struct {
-	db *sql.DB
+	db           *sql.DB
+	cipher       *Cipher // nil の場合は暗号化しない
+	metadataOnly bool    // true の場合はメッセージ本文を保存しない
+	erasureKey   []byte  // 個人データを消去したユーザーの user_key の代わりに残すハッシュの鍵
 }
 
-func NewRepository(db *sql.DB) *Repository {
-	return &Repository{db: db}
+// Config はリポジトリの保存方法の設定です
+type Config struct {
+	// Cipher を設定すると、Slack のトークンとメッセージ本文を暗号化して保存し、読み込むときに復号します
+	Cipher *Cipher
+	// MetadataOnly が true の場合、メッセージ本文を保存しません（本文は空文字になります）
+	MetadataOnly bool
+	// ErasureKey は個人データを消去したユーザーの user_key を置き換える鍵付きハッシュの鍵です
+	// 消去したユーザーを取り込み直さないための照合に使うので、変えると以前に消去したユーザーを見分けられなくなります
+	// 空の場合は個人データを消去できません（EraseUserData は ErrUnavailable を返します）
+	ErasureKey []byte
+}
+
+func NewRepository(db *sql.DB, config Config) *Repository {
+	return &Repository{
+		db:           db,
+		cipher:       config.Cipher,
+		metadataOnly: config.MetadataOnly,
+		erasureKey:   config.ErasureKey,
+	}
 }
 
 // SaveUser はユーザー情報をDBに保存します
+// 既存ユーザーの場合はユーザー名のみ更新し、grade と team_key は所属履歴を守るため変更しません
+// 複数ワークスペース対応前のユーザー（workspace_id が NULL）は取り込んだワークスペースに結び付けます
+// 新規ユーザーの場合は最初の所属を所属履歴に登録します
+// 新規ユーザーのチームは取り込んだワークスペースの最初のチームにします（ワークスペースにチームがまだない場合は user.TeamKey）
+// 個人データを消去したユーザーは保存しません
+// Slack のユーザーIDは 1 つのワークスペースにだけ結び付けます。Enterprise Grid で複数のワークスペースに属するユーザーのように、
+// 別のワークスペースに登録済みのユーザーIDの場合は保存せず ErrConflict を返します
 func (r *Repository) SaveUser(user User) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		log.Printf("Failed to begin transaction for save user: %v", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockForIngest(tx); err != nil {
+		return err
+	}
+	var erased bool
+	err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM users WHERE user_key = $1)`, r.erasedUserKey(user.UserKey)).Scan(&erased)
+	if err != nil {
+		log.Printf("Failed to check erased user: %v", err)
+		return err
+	}
+	if erased {
+		return nil
+	}
+
 	query := `
-		INSERT INTO users (user_key, user_name, grade, team_key)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO users (user_key, user_name, grade, team_key, is_bot, is_deleted, workspace_id)
+		VALUES ($1, $2, $3, COALESCE((SELECT MIN(id) FROM teams WHERE workspace_id = $7), $4), $5, $6, $7)
 		ON CONFLICT (user_key) DO UPDATE
-		SET user_name = $2, grade = $3, team_key = $4
+		SET user_name = CASE WHEN users.erased_at IS NULL THEN $2 ELSE users.user_name END, is_bot = $5, is_deleted = $6, workspace_id = COALESCE(users.workspace_id, $7)
+		WHERE users.workspace_id IS NULL OR users.workspace_id = $7
+		RETURNING id, grade, team_key
 	`
-	
-	_, err := r.db.Exec(query, user.UserKey, user.UserName, user.Grade, user.TeamKey)
+
+	var saved User
+	err = tx.QueryRow(query, user.UserKey, user.UserName, user.Grade, user.TeamKey, user.IsBot, user.IsDeleted, user.WorkspaceID).
+		Scan(&saved.ID, &saved.Grade, &saved.TeamKey)
+	if err == sql.ErrNoRows {
+		// ON CONFLICT の WHERE で更新しなかった = 別のワークスペースのユーザー
+		return fmt.Errorf("%w: user %s belongs to another workspace", ErrConflict, user.UserKey)
+	}
 	if err != nil {
 		log.Printf("Failed to save user: %v", err)
 		return err
 	}
-	
-	return nil
+
+	if err := insertInitialAssignment(tx, saved.ID, saved.Grade, saved.TeamKey); err != nil {
+		log.Printf("Failed to save initial assignment (user_id: %d): %v", saved.ID, err)
+		return err
+	}
+
+	return tx.Commit()
 }
 
 // SaveTeam はチームとチャンネルの対応をDBに保存します
+// 複数ワークスペース対応前のチーム（workspace_id が NULL）は取り込んだワークスペースに結び付けます
 func (r *Repository) SaveTeam(team Team) error {
 	query := `
-		INSERT INTO teams (channel_id, channel_name) -- id を INSERT 文から除外
-		VALUES ($1, $2)                             -- 引数も $1, $2 に
+		INSERT INTO teams (channel_id, channel_name, workspace_id) -- id を INSERT 文から除外
+		VALUES ($1, $2, $3)
 		ON CONFLICT (channel_id) DO UPDATE          -- コンフリクトは channel_id でチェック (UNIQUE 制約が必要)
-		SET channel_name = $2                       -- channel_name を更新
+		SET channel_name = $2, workspace_id = COALESCE(teams.workspace_id, $3)
 	`
 
 	// Exec に渡す引数から team.ID を削除
-	_, err := r.db.Exec(query, team.ChannelID, team.ChannelName)
+	_, err := r.db.Exec(query, team.ChannelID, team.ChannelName, team.WorkspaceID)
 	if err != nil {
 		log.Printf("Failed to save team (channel_id: %s): %v", team.ChannelID, err) // ログに詳細追加
 		return err
@@ -54,44 +116,151 @@ func (r *Repository) SaveTeam(team Team) error {
 
 // GetAllUsers はすべてのユーザー情報を取得します
 func (r *Repository) GetAllUsers() ([]User, error) {
-	query := `SELECT id, user_key, user_name, grade, team_key FROM users`
-	
-	rows, err := r.db.Query(query)
+	users, _, err := r.ListUsers(UserFilter{IncludeBots: true, IncludeDeleted: true, SortField: "id"})
+	return users, err
+}
+
+// UserSortColumns は ListUsers で指定できるソートフィールドと対応するカラムです
+var UserSortColumns = map[string]string{
+	"id":        "id",
+	"user_key":  "user_key",
+	"user_name": "user_name",
+	"grade":     "grade",
+	"team_key":  "team_key",
+}
+
+// UserFilter は ListUsers の検索条件です
+type UserFilter struct {
+	WorkspaceID    int    // 0 以外の場合はこのワークスペースのユーザーのみ
+	TeamKey        *int   // 指定した場合はこのチームのユーザーのみ
+	UserKey        string // 指定した場合はこの user_key のユーザーのみ
+	Grade          *int   // 指定した場合はこのグレードのユーザーのみ
+	Query          string // user_name または user_key の部分一致（大文字小文字を区別しない）
+	IncludeBots    bool   // false の場合はボットを除外
+	IncludeDeleted bool   // false の場合は Slack 上で削除済みのユーザーを除外
+	SortField      string // UserSortColumns のキー。空の場合は id
+	SortDesc       bool
+	Limit          int // 0 の場合は件数制限なし
+	Offset         int
+}
+
+// ListUsers は条件に合うユーザー一覧と、ページングを適用する前の総件数を取得します
+func (r *Repository) ListUsers(filter UserFilter) ([]User, int, error) {
+	var conditions []string
+	var args []interface{}
+	addCondition := func(format string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(format, len(args)))
+	}
+
+	if filter.WorkspaceID != 0 {
+		addCondition("workspace_id = $%d", filter.WorkspaceID)
+	}
+	if filter.TeamKey != nil {
+		addCondition("team_key = $%d", *filter.TeamKey)
+	}
+	if filter.UserKey != "" {
+		addCondition("user_key = $%d", filter.UserKey)
+	}
+	if filter.Grade != nil {
+		addCondition("grade = $%d", *filter.Grade)
+	}
+	if filter.Query != "" {
+		addCondition("(user_name ILIKE $%[1]d OR user_key ILIKE $%[1]d)", "%"+escapeLike(filter.Query)+"%")
+	}
+	if !filter.IncludeBots {
+		conditions = append(conditions, "NOT is_bot")
+	}
+	if !filter.IncludeDeleted {
+		conditions = append(conditions, "NOT is_deleted")
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM users `+where, args...).Scan(&total); err != nil {
+		log.Printf("Failed to count users: %v", err)
+		return nil, 0, err
+	}
+
+	column, ok := UserSortColumns[filter.SortField]
+	if !ok {
+		column = "id"
+	}
+	direction := "ASC"
+	if filter.SortDesc {
+		direction = "DESC"
+	}
+	// ソート順を一意にするため id を第2キーにする
+	query := `SELECT id, COALESCE(workspace_id, 0), user_key, user_name, grade, team_key, is_bot, is_deleted, role, opted_out FROM users ` + where +
+		` ORDER BY ` + column + ` ` + direction + `, id ` + direction
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+	if filter.Offset > 0 {
+		args = append(args, filter.Offset)
+		query += fmt.Sprintf(" OFFSET $%d", len(args))
+	}
+
+	rows, err := r.db.Query(query, args...)
 	if err != nil {
 		log.Printf("Failed to get users: %v", err)
-		return nil, err
+		return nil, 0, err
 	}
 	defer rows.Close()
-	
+
 	var users []User
 	for rows.Next() {
 		var user User
-		if err := rows.Scan(&user.ID, &user.UserKey, &user.UserName, &user.Grade, &user.TeamKey); err != nil {
+		if err := rows.Scan(&user.ID, &user.WorkspaceID, &user.UserKey, &user.UserName, &user.Grade, &user.TeamKey, &user.IsBot, &user.IsDeleted, &user.Role, &user.OptedOut); err != nil {
 			log.Printf("Failed to scan user: %v", err)
-			return nil, err
+			return nil, 0, err
 		}
 		users = append(users, user)
 	}
 
 	// rows.Err() をチェックして、ループ中のエラーを確認 (重要)
 	if err = rows.Err(); err != nil {
-		log.Printf("Error iterating team rows: %v", err)
-		return nil, err
+		log.Printf("Error iterating user rows: %v", err)
+		return nil, 0, err
 	}
 
 	// データがない場合、空のスライスを返す（nil ではなく）
 	if users == nil {
-		return []User{}, nil // nil ではなく空スライスを返すのが一般的
+		return []User{}, total, nil // nil ではなく空スライスを返すのが一般的
 	}
-	
-	return users, nil
+
+	return users, total, nil
 }
 
-// GetAllTeams はすべてのチーム情報を取得します (新規追加)
-func (r *Repository) GetAllTeams() ([]Team, error) {
-	query := `SELECT id, channel_id, channel_name FROM teams ORDER BY id ASC` // ORDER BY を追加すると良いかも
+// escapeLike は LIKE パターンの特殊文字をエスケープします
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// GetAllTeams は指定ワークスペースのすべてのチーム情報を取得します
+// workspaceID が 0 の場合はすべてのワークスペースのチームを返します
+func (r *Repository) GetAllTeams(workspaceID int) ([]Team, error) {
+	return r.queryTeams(workspaceID, false)
+}
+
+// GetTrackedTeams は指定ワークスペースの追跡対象 (is_tracked) のチーム情報を取得します
+// 同期や集計はこの一覧に含まれるチームだけを対象にします。workspaceID が 0 の場合はすべてのワークスペースのチームを返します
+func (r *Repository) GetTrackedTeams(workspaceID int) ([]Team, error) {
+	return r.queryTeams(workspaceID, true)
+}
+
+func (r *Repository) queryTeams(workspaceID int, trackedOnly bool) ([]Team, error) {
+	query := `
+		SELECT id, COALESCE(workspace_id, 0), channel_id, channel_name, is_tracked FROM teams
+		WHERE ($1 = 0 OR workspace_id = $1) AND (is_tracked OR NOT $2)
+		ORDER BY id ASC`
 
-	rows, err := r.db.Query(query)
+	rows, err := r.db.Query(query, workspaceID, trackedOnly)
 	if err != nil {
 		log.Printf("Failed to get teams: %v", err)
 		return nil, err // エラーを返す
@@ -102,7 +271,7 @@ func (r *Repository) GetAllTeams() ([]Team, error) {
 	for rows.Next() {
 		var team Team
 		// Scan するカラムの順番を SELECT 文に合わせる
-		if err := rows.Scan(&team.ID, &team.ChannelID, &team.ChannelName); err != nil {
+		if err := rows.Scan(&team.ID, &team.WorkspaceID, &team.ChannelID, &team.ChannelName, &team.IsTracked); err != nil {
 			log.Printf("Failed to scan team: %v", err)
 			return nil, err // エラーを返す
 		}
@@ -125,39 +294,245 @@ func (r *Repository) GetAllTeams() ([]Team, error) {
 	return teams, nil
 }
 
-// UpdateUser は指定されたIDのユーザー情報を更新します (新規追加)
+// GetTeamByID は指定されたIDのチーム情報を取得します
+// 見つからない場合は ErrNotFound を返します
+func (r *Repository) GetTeamByID(id int) (Team, error) {
+	query := `SELECT id, COALESCE(workspace_id, 0), channel_id, channel_name, is_tracked FROM teams WHERE id = $1`
+
+	var team Team
+	err := r.db.QueryRow(query, id).Scan(&team.ID, &team.WorkspaceID, &team.ChannelID, &team.ChannelName, &team.IsTracked)
+	if err == sql.ErrNoRows {
+		return Team{}, fmt.Errorf("%w: no team found with id %d", ErrNotFound, id)
+	}
+	if err != nil {
+		log.Printf("Failed to get team (id: %d): %v", id, err)
+		return Team{}, err
+	}
+
+	return team, nil
+}
+
+// GetTeamByChannelID は指定された Slack チャンネルIDのチーム情報を取得します
+// 見つからない場合は ErrNotFound を返します
+func (r *Repository) GetTeamByChannelID(channelID string) (Team, error) {
+	query := `SELECT id, COALESCE(workspace_id, 0), channel_id, channel_name, is_tracked FROM teams WHERE channel_id = $1`
+
+	var team Team
+	err := r.db.QueryRow(query, channelID).Scan(&team.ID, &team.WorkspaceID, &team.ChannelID, &team.ChannelName, &team.IsTracked)
+	if err == sql.ErrNoRows {
+		return Team{}, fmt.Errorf("%w: no team found with channel_id %s", ErrNotFound, channelID)
+	}
+	if err != nil {
+		log.Printf("Failed to get team (channel_id: %s): %v", channelID, err)
+		return Team{}, err
+	}
+
+	return team, nil
+}
+
+// UpdateTeam は指定されたIDのチーム名と追跡フラグを更新します
+// channel_id は Slack 側の識別子なので更新しません
+func (r *Repository) UpdateTeam(id int, team Team) error {
+	query := `UPDATE teams SET channel_name = $2, is_tracked = $3 WHERE id = $1`
+
+	result, err := r.db.Exec(query, id, team.ChannelName, team.IsTracked)
+	if err != nil {
+		log.Printf("Failed to update team (id: %d): %v", id, err)
+		return fmt.Errorf("database error executing update query for team %d: %w", id, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("database error getting rows affected for team %d: %w", id, err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("%w: no team found with id %d", ErrNotFound, id)
+	}
+
+	return nil
+}
+
+// DeleteTeam は指定されたIDのチームを削除します
+// team_key がこのチームを指すユーザーがいる場合、reassignTo が nil なら ErrConflict を返します
+// reassignTo が指定された場合はそのチームへ移し、所属履歴にも記録します
+// メンバーシップは外部キーの ON DELETE CASCADE で削除されます
+func (r *Repository) DeleteTeam(id int, reassignTo *int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("database error beginning transaction for team %d: %w", id, err)
+	}
+	defer tx.Rollback()
+
+	var locked int
+	err = tx.QueryRow(`SELECT id FROM teams WHERE id = $1 FOR UPDATE`, id).Scan(&locked)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("%w: no team found with id %d", ErrNotFound, id)
+	}
+	if err != nil {
+		log.Printf("Failed to lock team (id: %d): %v", id, err)
+		return err
+	}
+
+	// 削除するチームを team_key に持つユーザー（同時更新に備えて行ロックを取る）
+	rows, err := tx.Query(`SELECT id, grade FROM users WHERE team_key = $1 FOR UPDATE`, id)
+	if err != nil {
+		log.Printf("Failed to get users of team (id: %d): %v", id, err)
+		return err
+	}
+	var affected []User
+	for rows.Next() {
+		var user User
+		if err := rows.Scan(&user.ID, &user.Grade); err != nil {
+			rows.Close()
+			return err
+		}
+		affected = append(affected, user)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(affected) > 0 {
+		if reassignTo == nil {
+			return fmt.Errorf("%w: %d users still belong to team %d", ErrConflict, len(affected), id)
+		}
+		if *reassignTo == id {
+			return fmt.Errorf("%w: cannot reassign users of team %d to itself", ErrConflict, id)
+		}
+
+		var targetExists bool
+		if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM teams WHERE id = $1)`, *reassignTo).Scan(&targetExists); err != nil {
+			return err
+		}
+		if !targetExists {
+			return fmt.Errorf("%w: no team found with id %d to reassign users to", ErrNotFound, *reassignTo)
+		}
+
+		for _, user := range affected {
+			if _, err := tx.Exec(`UPDATE users SET team_key = $2 WHERE id = $1`, user.ID, *reassignTo); err != nil {
+				log.Printf("Failed to reassign user (id: %d): %v", user.ID, err)
+				return err
+			}
+			if err := changeAssignment(tx, user.ID, user.Grade, *reassignTo); err != nil {
+				log.Printf("Failed to change assignment (user_id: %d): %v", user.ID, err)
+				return err
+			}
+		}
+	}
+
+	if _, err := tx.Exec(`DELETE FROM teams WHERE id = $1`, id); err != nil {
+		log.Printf("Failed to delete team (id: %d): %v", id, err)
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("database error committing delete for team %d: %w", id, err)
+	}
+
+	log.Printf("Successfully deleted team with id %d (reassigned users: %d)", id, len(affected))
+	return nil
+}
+
+// GetUserByID は指定されたIDのユーザー情報を取得します
+// 見つからない場合は ErrNotFound を返します
+func (r *Repository) GetUserByID(id int) (User, error) {
+	query := `SELECT id, COALESCE(workspace_id, 0), user_key, user_name, grade, team_key, is_bot, is_deleted, role, opted_out FROM users WHERE id = $1`
+
+	var user User
+	err := r.db.QueryRow(query, id).
+		Scan(&user.ID, &user.WorkspaceID, &user.UserKey, &user.UserName, &user.Grade, &user.TeamKey, &user.IsBot, &user.IsDeleted, &user.Role, &user.OptedOut)
+	if err == sql.ErrNoRows {
+		return User{}, fmt.Errorf("%w: no user found with id %d", ErrNotFound, id)
+	}
+	if err != nil {
+		log.Printf("Failed to get user (id: %d): %v", id, err)
+		return User{}, err
+	}
+
+	return user, nil
+}
+
+// UpdateUser は指定されたIDのユーザー情報（ユーザー名・グレード・チーム・権限）を更新します
+// user_key は Slack のユーザーIDなので更新しません
+// grade または team_key が変わった場合は、現在の所属を閉じて新しい所属を所属履歴に追加します
+// 見つからない場合は ErrNotFound を返します
 func (r *Repository) UpdateUser(id int, user User) error {
-	// user_key は通常更新しないことが多いが、リクエストに含まれるなら更新対象に入れる
-	// もし user_key を更新したくない場合は SET 句から user_key = $2 を削除し、引数の順番も調整する
+	tx, err := r.db.Begin()
+	if err != nil {
+		log.Printf("Failed to begin transaction for update user (id: %d): %v", id, err)
+		return fmt.Errorf("database error beginning transaction for id %d: %w", id, err)
+	}
+	defer tx.Rollback()
+
+	// 変更前の所属を取得（同時更新に備えて行ロックを取る）
+	var current User
+	err = tx.QueryRow(`SELECT grade, team_key FROM users WHERE id = $1 FOR UPDATE`, id).
+		Scan(&current.Grade, &current.TeamKey)
+	if err == sql.ErrNoRows {
+		log.Printf("No user found with id %d to update", id)
+		return fmt.Errorf("%w: no user found with id %d", ErrNotFound, id)
+	}
+	if err != nil {
+		log.Printf("Failed to select user for update (id: %d): %v", id, err)
+		return fmt.Errorf("database error selecting user for id %d: %w", id, err)
+	}
+
 	query := `
 		UPDATE users
-		SET user_key = $2, user_name = $3, grade = $4, team_key = $5
+		SET user_name = $2, grade = $3, team_key = $4, role = $5
 		WHERE id = $1
 	`
 
-	// Exec を実行し、結果を取得
-	result, err := r.db.Exec(query, id, user.UserKey, user.UserName, user.Grade, user.TeamKey)
-	if err != nil {
+	if _, err := tx.Exec(query, id, user.UserName, user.Grade, user.TeamKey, user.Role); err != nil {
 		log.Printf("Failed to execute update user query (id: %d): %v", id, err)
-		return fmt.Errorf("database error executing update query for id %d: %w", id, err) // エラーラップ
+		return fmt.Errorf("database error executing update query for id %d: %w", id, translateError(err)) // エラーラップ
+	}
+
+	if current.Grade != user.Grade || current.TeamKey != user.TeamKey {
+		if err := changeAssignment(tx, id, user.Grade, user.TeamKey); err != nil {
+			log.Printf("Failed to change assignment (user_id: %d): %v", id, err)
+			return fmt.Errorf("database error changing assignment for id %d: %w", id, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Failed to commit update user (id: %d): %v", id, err)
+		return fmt.Errorf("database error committing update for id %d: %w", id, err)
+	}
+
+	log.Printf("Successfully updated user with id %d", id)
+	return nil
+}
+
+// DeleteUser は指定されたIDのユーザーを削除します
+// メンバーシップと所属履歴は外部キーの ON DELETE CASCADE で削除されます
+// 追跡から除外したユーザーと個人データを消去したユーザーは削除しません（ErrConflict を返します）
+// 行を削除すると除外と消去の記録がなくなり、次の同期で取り込み直してしまうためです
+// 見つからない場合は ErrNotFound、他のテーブルから参照されている場合は ErrConflict を返します
+func (r *Repository) DeleteUser(id int) error {
+	result, err := r.db.Exec(`DELETE FROM users WHERE id = $1 AND NOT opted_out AND erased_at IS NULL`, id)
+	if err != nil {
+		log.Printf("Failed to delete user (id: %d): %v", id, err)
+		return fmt.Errorf("database error deleting user %d: %w", id, translateError(err))
 	}
 
-	// 更新された行数を取得 (任意だが、更新が成功したか確認できる)
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		log.Printf("Failed to get rows affected for update user (id: %d): %v", id, err)
-		// RowsAffected のエラーは続行しても良い場合もあるが、ここではエラーとして返す
 		return fmt.Errorf("database error getting rows affected for id %d: %w", id, err)
 	}
-
-	// 更新対象のIDが存在せず、更新が行われなかった場合
 	if rowsAffected == 0 {
-		log.Printf("No user found with id %d to update", id)
-		// ここでエラーを返すか、成功として扱うかは要件による
-		// 例: 存在しないIDの場合はエラーとする
-		return fmt.Errorf("no user found with id %d", id) // エラーとして返す例
+		var exists bool
+		if err := r.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)`, id).Scan(&exists); err != nil {
+			log.Printf("Failed to check user (id: %d): %v", id, err)
+			return fmt.Errorf("database error checking user %d: %w", id, err)
+		}
+		if exists {
+			return fmt.Errorf("%w: user %d is opted out or erased and cannot be deleted", ErrConflict, id)
+		}
+		return fmt.Errorf("%w: no user found with id %d", ErrNotFound, id)
 	}
 
-	log.Printf("Successfully updated user with id %d", id)
+	log.Printf("Successfully deleted user with id %d", id)
 	return nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,160 @@
+// backend/repository/retention.go
+package repository
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+// RetentionCutoffs はデータの種類ごとの保持期限です。この日時より前のデータが期限切れです（nil は無期限）
+type RetentionCutoffs struct {
+	MessageText     *time.Time `json:"message_text"`     // メッセージ本文（投稿日時で判定し、本文だけを消去する）
+	MessageMetadata *time.Time `json:"message_metadata"` // メッセージとリアクション・編集履歴・ファイル・リンク（投稿日時で判定して削除する）
+	PresenceSamples *time.Time `json:"presence_samples"` // activity_logs の在席状況
+	Aggregates      *time.Time `json:"aggregates"`       // 集計（保存しないので、集計 API でこれより前の期間を返さない）
+}
+
+// RetentionRun は保持期限を過ぎたデータの削除 1 回分の結果です
+type RetentionRun struct {
+	ID              int64            `json:"id"`
+	JobID           *int64           `json:"job_id"` // 削除を実行したジョブ
+	Cutoffs         RetentionCutoffs `json:"cutoffs"`
+	TextsCleared    int64            `json:"texts_cleared"`    // 本文を消去したメッセージの数
+	MessagesDeleted int64            `json:"messages_deleted"` // 削除したメッセージの数
+	PresenceDeleted int64            `json:"presence_deleted"` // 削除した在席状況の数
+	Error           string           `json:"error,omitempty"`  // 途中で失敗した場合のエラー（それまでの件数は記録する）
+	StartedAt       time.Time        `json:"started_at"`
+	FinishedAt      time.Time        `json:"finished_at"`
+}
+
+// withinRetention は保持期限に合わせて保存するメッセージを返します
+// メタデータの保持期限より前に投稿されたメッセージは保存せず、本文の保持期限より前に投稿されたメッセージは本文を空にします
+// 期限切れのデータを削除した後に、取り込み直しや編集で保存し直さないためです
+func withinRetention(messages []SlackConversation, cutoffs RetentionCutoffs) []SlackConversation {
+	if cutoffs.MessageText == nil && cutoffs.MessageMetadata == nil {
+		return messages
+	}
+	kept := make([]SlackConversation, 0, len(messages))
+	for _, m := range messages {
+		if cutoffs.MessageMetadata != nil && m.PostedAt.Before(*cutoffs.MessageMetadata) {
+			continue
+		}
+		if cutoffs.MessageText != nil && m.PostedAt.Before(*cutoffs.MessageText) {
+			m.Text = ""
+		}
+		kept = append(kept, m)
+	}
+	return kept
+}
+
+// ClearMessageTextBefore は before より前に投稿されたメッセージのうち、本文が残っているものを最大 limit 件消去します
+// 消去した件数を返します。limit 件より少なければ、期限切れの本文はもう残っていません
+func (r *Repository) ClearMessageTextBefore(before time.Time, limit int) (int64, error) {
+	result, err := r.db.Exec(`
+		UPDATE messages SET text = '', updated_at = CURRENT_TIMESTAMP
+		WHERE id IN (SELECT id FROM messages WHERE posted_at < $1 AND text <> '' LIMIT $2)
+	`, before.UTC(), limit)
+	if err != nil {
+		log.Printf("Failed to clear expired message text: %v", err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// DeleteMessagesBefore は before より前に投稿されたメッセージを最大 limit 件削除し、削除した件数を返します
+// リアクション・編集履歴・ファイル・リンクは外部キーの ON DELETE CASCADE で削除されます
+func (r *Repository) DeleteMessagesBefore(before time.Time, limit int) (int64, error) {
+	result, err := r.db.Exec(`
+		DELETE FROM messages
+		WHERE id IN (SELECT id FROM messages WHERE posted_at < $1 LIMIT $2)
+	`, before.UTC(), limit)
+	if err != nil {
+		log.Printf("Failed to delete expired messages: %v", err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// DeletePresenceBefore は before より前の在席状況（activity_logs）を最大 limit 件削除し、削除した件数を返します
+// 日時（timestamp）がない行は記録日時で判定します
+func (r *Repository) DeletePresenceBefore(before time.Time, limit int) (int64, error) {
+	result, err := r.db.Exec(`
+		DELETE FROM activity_logs
+		WHERE id IN (SELECT id FROM activity_logs WHERE COALESCE(timestamp, created_at) < $1 LIMIT $2)
+	`, before.UTC(), limit)
+	if err != nil {
+		log.Printf("Failed to delete expired presence samples: %v", err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// SaveRetentionRun は削除の結果を記録し、IDを付けて返します
+func (r *Repository) SaveRetentionRun(run RetentionRun) (RetentionRun, error) {
+	err := r.db.QueryRow(`
+		INSERT INTO retention_runs (job_id, text_before, metadata_before, presence_before, aggregates_before,
+		                            texts_cleared, messages_deleted, presence_deleted, error, started_at, finished_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING id
+	`, run.JobID, utcOrNil(run.Cutoffs.MessageText), utcOrNil(run.Cutoffs.MessageMetadata), utcOrNil(run.Cutoffs.PresenceSamples),
+		utcOrNil(run.Cutoffs.Aggregates), run.TextsCleared, run.MessagesDeleted, run.PresenceDeleted, run.Error,
+		run.StartedAt.UTC(), run.FinishedAt.UTC()).Scan(&run.ID)
+	if err != nil {
+		log.Printf("Failed to save retention run: %v", err)
+		return RetentionRun{}, err
+	}
+	return run, nil
+}
+
+// ListRetentionRuns は削除の結果を新しい順に最大 limit 件返します
+func (r *Repository) ListRetentionRuns(limit int) ([]RetentionRun, error) {
+	rows, err := r.db.Query(`
+		SELECT id, job_id, text_before, metadata_before, presence_before, aggregates_before,
+		       texts_cleared, messages_deleted, presence_deleted, error, started_at, finished_at
+		FROM retention_runs
+		ORDER BY started_at DESC, id DESC
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		log.Printf("Failed to list retention runs: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []RetentionRun{}
+	for rows.Next() {
+		var run RetentionRun
+		var jobID sql.NullInt64
+		var text, metadata, presence, aggregates sql.NullTime
+		if err := rows.Scan(&run.ID, &jobID, &text, &metadata, &presence, &aggregates,
+			&run.TextsCleared, &run.MessagesDeleted, &run.PresenceDeleted, &run.Error, &run.StartedAt, &run.FinishedAt); err != nil {
+			log.Printf("Failed to scan retention run: %v", err)
+			return nil, err
+		}
+		if jobID.Valid {
+			run.JobID = &jobID.Int64
+		}
+		run.Cutoffs = RetentionCutoffs{
+			MessageText:     timeOrNil(text),
+			MessageMetadata: timeOrNil(metadata),
+			PresenceSamples: timeOrNil(presence),
+			Aggregates:      timeOrNil(aggregates),
+		}
+		runs = append(runs, run)
+	}
+
+	if err = rows.Err(); err != nil {
+		log.Printf("Error iterating retention run rows: %v", err)
+		return nil, err
+	}
+	return runs, nil
+}
+
+// timeOrNil は NULL の場合は nil を返します
+func timeOrNil(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
@@ -0,0 +1,36 @@
+// backend/repository/retention_test.go
+package repository
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWithinRetention(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	textCutoff := now.AddDate(0, 0, -30)
+	metadataCutoff := now.AddDate(0, 0, -90)
+	messages := []SlackConversation{
+		{TS: "recent", Text: "recent", PostedAt: now.AddDate(0, 0, -1)},
+		{TS: "text-expired", Text: "old", PostedAt: now.AddDate(0, 0, -60)},
+		{TS: "expired", Text: "older", PostedAt: now.AddDate(0, 0, -120)},
+	}
+
+	got := withinRetention(messages, RetentionCutoffs{MessageText: &textCutoff, MessageMetadata: &metadataCutoff})
+	if len(got) != 2 {
+		t.Fatalf("withinRetention() returned %d messages, want 2", len(got))
+	}
+	if got[0].TS != "recent" || got[0].Text != "recent" {
+		t.Errorf("recent message = %+v, want it unchanged", got[0])
+	}
+	if got[1].TS != "text-expired" || got[1].Text != "" {
+		t.Errorf("message past the text cutoff = %+v, want empty text", got[1])
+	}
+	if messages[1].Text != "old" {
+		t.Errorf("withinRetention() modified its input")
+	}
+
+	if got := withinRetention(messages, RetentionCutoffs{}); len(got) != len(messages) {
+		t.Errorf("withinRetention() without cutoffs returned %d messages, want %d", len(got), len(messages))
+	}
+}
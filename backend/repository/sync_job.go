@@ -0,0 +1,284 @@
+// backend/repository/sync_job.go
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const syncJobColumns = `id, kind, resource, status, processed, total, error, window_oldest, window_latest, checkpoint, created_at, started_at, finished_at, updated_at`
+
+func scanSyncJob(row interface{ Scan(...interface{}) error }) (SyncJob, error) {
+	var job SyncJob
+	var startedAt, finishedAt sql.NullTime
+	err := row.Scan(&job.ID, &job.Kind, &job.Resource, &job.Status, &job.Processed, &job.Total, &job.Error,
+		&job.Window.Oldest, &job.Window.Latest, &job.Checkpoint, &job.CreatedAt, &startedAt, &finishedAt, &job.UpdatedAt)
+	if err != nil {
+		return SyncJob{}, err
+	}
+	if startedAt.Valid {
+		job.StartedAt = &startedAt.Time
+	}
+	if finishedAt.Valid {
+		job.FinishedAt = &finishedAt.Time
+	}
+	return job, nil
+}
+
+// CreateSyncJob は queued 状態の同期ジョブを作成します
+// 会話履歴の取り込みで期間を指定しない場合、window は空にします
+// 同じリソースに未完了のジョブがある場合は一意制約により ErrConflict を返します
+func (r *Repository) CreateSyncJob(kind string, resource string, window SyncWindow) (SyncJob, error) {
+	query := `
+		INSERT INTO sync_jobs (kind, resource, status, window_oldest, window_latest)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING ` + syncJobColumns
+
+	job, err := scanSyncJob(r.db.QueryRow(query, kind, resource, JobStatusQueued, window.Oldest, window.Latest))
+	if err != nil {
+		log.Printf("Failed to create sync job (kind: %s, resource: %s): %v", kind, resource, err)
+		return SyncJob{}, translateError(err)
+	}
+	return job, nil
+}
+
+// GetSyncJob は指定されたIDの同期ジョブを取得します
+// 見つからない場合は ErrNotFound を返します
+func (r *Repository) GetSyncJob(id int64) (SyncJob, error) {
+	job, err := scanSyncJob(r.db.QueryRow(`SELECT `+syncJobColumns+` FROM sync_jobs WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return SyncJob{}, fmt.Errorf("%w: no sync job found with id %d", ErrNotFound, id)
+	}
+	if err != nil {
+		log.Printf("Failed to get sync job (id: %d): %v", id, err)
+		return SyncJob{}, err
+	}
+	return job, nil
+}
+
+// StartSyncJob は同期ジョブを running 状態にします
+func (r *Repository) StartSyncJob(id int64) error {
+	_, err := r.db.Exec(`
+		UPDATE sync_jobs
+		SET status = $2, started_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`, id, JobStatusRunning)
+	if err != nil {
+		log.Printf("Failed to start sync job (id: %d): %v", id, err)
+	}
+	return err
+}
+
+// UpdateSyncJobProgress は同期ジョブの進捗を更新します
+// 進捗が変わらない場合もハートビートとして updated_at を更新するために呼び出します
+func (r *Repository) UpdateSyncJobProgress(id int64, processed int, total int) error {
+	_, err := r.db.Exec(`
+		UPDATE sync_jobs
+		SET processed = $2, total = $3, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`, id, processed, total)
+	if err != nil {
+		log.Printf("Failed to update sync job progress (id: %d): %v", id, err)
+	}
+	return err
+}
+
+// FinishSyncJob は同期ジョブを終了状態にします
+// jobErr が nil なら succeeded、そうでなければ failed としてエラー内容を記録します
+func (r *Repository) FinishSyncJob(id int64, processed int, total int, jobErr error) error {
+	status, message := JobStatusSucceeded, ""
+	if jobErr != nil {
+		status, message = JobStatusFailed, jobErr.Error()
+	}
+
+	_, err := r.db.Exec(`
+		UPDATE sync_jobs
+		SET status = $2, processed = $3, total = $4, error = $5,
+		    finished_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`, id, status, processed, total, message)
+	if err != nil {
+		log.Printf("Failed to finish sync job (id: %d): %v", id, err)
+	}
+	return err
+}
+
+// SaveSyncJobCheckpoint は期間指定の取り込みで保存済みの最も古い ts を記録します
+func (r *Repository) SaveSyncJobCheckpoint(id int64, ts string) error {
+	_, err := r.db.Exec(`
+		UPDATE sync_jobs SET checkpoint = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1
+	`, id, ts)
+	if err != nil {
+		log.Printf("Failed to save sync job checkpoint (id: %d): %v", id, err)
+	}
+	return err
+}
+
+// FailStaleSyncJobs は staleAfter 以上ハートビートが途絶えている未完了のジョブを failed にします
+// サーバーの再起動などで中断されたジョブが running のまま残らないようにするためのものです
+func (r *Repository) FailStaleSyncJobs(staleAfter time.Duration) (int64, error) {
+	result, err := r.db.Exec(`
+		UPDATE sync_jobs
+		SET status = $1, error = 'interrupted: no heartbeat from worker',
+		    finished_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE status IN ($2, $3) AND updated_at < CURRENT_TIMESTAMP - make_interval(secs => $4)
+	`, JobStatusFailed, JobStatusQueued, JobStatusRunning, staleAfter.Seconds())
+	if err != nil {
+		log.Printf("Failed to fail stale sync jobs: %v", err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// TouchSyncJobs は指定したジョブの updated_at を更新します（ハートビート）
+func (r *Repository) TouchSyncJobs(ids []int64) error {
+	_, err := r.db.Exec(`UPDATE sync_jobs SET updated_at = CURRENT_TIMESTAMP WHERE id = ANY($1)`, pq.Array(ids))
+	if err != nil {
+		log.Printf("Failed to touch sync jobs: %v", err)
+	}
+	return err
+}
+
+// FindActiveSyncJob は指定リソースの未完了（queued または running）のジョブのうち最新のものを取得します
+// 見つからない場合は ErrNotFound を返します
+func (r *Repository) FindActiveSyncJob(resource string) (SyncJob, error) {
+	query := `
+		SELECT ` + syncJobColumns + `
+		FROM sync_jobs
+		WHERE resource = $1 AND status IN ($2, $3)
+		ORDER BY id DESC
+		LIMIT 1
+	`
+	job, err := scanSyncJob(r.db.QueryRow(query, resource, JobStatusQueued, JobStatusRunning))
+	if err == sql.ErrNoRows {
+		return SyncJob{}, fmt.Errorf("%w: no active sync job for %s", ErrNotFound, resource)
+	}
+	if err != nil {
+		log.Printf("Failed to find active sync job (resource: %s): %v", resource, err)
+		return SyncJob{}, err
+	}
+	return job, nil
+}
+
+// RequeueSyncJob は終了したジョブを再開のため queued 状態に戻します
+// failed 以外のジョブや、同じリソースに未完了のジョブがある場合は ErrConflict を返します
+func (r *Repository) RequeueSyncJob(id int64) (SyncJob, error) {
+	query := `
+		UPDATE sync_jobs
+		SET status = $2, error = '', finished_at = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND status = $3
+		RETURNING ` + syncJobColumns
+
+	job, err := scanSyncJob(r.db.QueryRow(query, id, JobStatusQueued, JobStatusFailed))
+	if err == sql.ErrNoRows {
+		if _, err := r.GetSyncJob(id); err != nil {
+			return SyncJob{}, err
+		}
+		return SyncJob{}, fmt.Errorf("%w: only failed jobs can be resumed (job %d)", ErrConflict, id)
+	}
+	if err != nil {
+		log.Printf("Failed to requeue sync job (id: %d): %v", id, err)
+		return SyncJob{}, translateError(err)
+	}
+	return job, nil
+}
+
+// CreateSyncJobChannels はジョブで同期するチャンネルを queued 状態で登録します
+func (r *Repository) CreateSyncJobChannels(jobID int64, teamIDs []int) error {
+	_, err := r.db.Exec(`
+		INSERT INTO sync_job_channels (job_id, team_id, status)
+		SELECT $1, unnest($2::int[]), $3
+		ON CONFLICT (job_id, team_id) DO NOTHING
+	`, jobID, pq.Array(teamIDs), JobStatusQueued)
+	if err != nil {
+		log.Printf("Failed to create sync job channels (job_id: %d): %v", jobID, err)
+	}
+	return err
+}
+
+// GetSyncJobChannels はジョブのチャンネルごとの進捗を取得します
+func (r *Repository) GetSyncJobChannels(jobID int64) ([]SyncJobChannel, error) {
+	rows, err := r.db.Query(`
+		SELECT c.job_id, c.team_id, COALESCE(t.channel_name, ''), c.status, c.synced, c.error, c.checkpoint, c.started_at, c.finished_at
+		FROM sync_job_channels c
+		LEFT JOIN teams t ON t.id = c.team_id
+		WHERE c.job_id = $1
+		ORDER BY c.team_id ASC
+	`, jobID)
+	if err != nil {
+		log.Printf("Failed to get sync job channels (job_id: %d): %v", jobID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	channels := []SyncJobChannel{}
+	for rows.Next() {
+		var ch SyncJobChannel
+		var startedAt, finishedAt sql.NullTime
+		if err := rows.Scan(&ch.JobID, &ch.TeamID, &ch.ChannelName, &ch.Status, &ch.Synced, &ch.Error, &ch.Checkpoint, &startedAt, &finishedAt); err != nil {
+			log.Printf("Failed to scan sync job channel: %v", err)
+			return nil, err
+		}
+		if startedAt.Valid {
+			ch.StartedAt = &startedAt.Time
+		}
+		if finishedAt.Valid {
+			ch.FinishedAt = &finishedAt.Time
+		}
+		channels = append(channels, ch)
+	}
+
+	if err = rows.Err(); err != nil {
+		log.Printf("Error iterating sync job channel rows: %v", err)
+		return nil, err
+	}
+
+	return channels, nil
+}
+
+// StartSyncJobChannel はチャンネルの同期を running 状態にします
+func (r *Repository) StartSyncJobChannel(jobID int64, teamID int) error {
+	_, err := r.db.Exec(`
+		UPDATE sync_job_channels
+		SET status = $3, error = '', started_at = CURRENT_TIMESTAMP, finished_at = NULL
+		WHERE job_id = $1 AND team_id = $2
+	`, jobID, teamID, JobStatusRunning)
+	if err != nil {
+		log.Printf("Failed to start sync job channel (job_id: %d, team_id: %d): %v", jobID, teamID, err)
+	}
+	return err
+}
+
+// FinishSyncJobChannel はチャンネルの同期を終了状態にします
+// syncErr が nil なら succeeded、そうでなければ failed としてエラー内容を記録します
+func (r *Repository) FinishSyncJobChannel(jobID int64, teamID int, synced int, syncErr error) error {
+	status, message := JobStatusSucceeded, ""
+	if syncErr != nil {
+		status, message = JobStatusFailed, syncErr.Error()
+	}
+
+	_, err := r.db.Exec(`
+		UPDATE sync_job_channels
+		SET status = $3, synced = synced + $4, error = $5, finished_at = CURRENT_TIMESTAMP
+		WHERE job_id = $1 AND team_id = $2
+	`, jobID, teamID, status, synced, message)
+	if err != nil {
+		log.Printf("Failed to finish sync job channel (job_id: %d, team_id: %d): %v", jobID, teamID, err)
+	}
+	return err
+}
+
+// SaveSyncJobChannelCheckpoint は期間指定の取り込みでチャンネルごとに保存済みの最も古い ts を記録します
+func (r *Repository) SaveSyncJobChannelCheckpoint(jobID int64, teamID int, ts string) error {
+	_, err := r.db.Exec(`
+		UPDATE sync_job_channels SET checkpoint = $3 WHERE job_id = $1 AND team_id = $2
+	`, jobID, teamID, ts)
+	if err != nil {
+		log.Printf("Failed to save sync job channel checkpoint (job_id: %d, team_id: %d): %v", jobID, teamID, err)
+	}
+	return err
+}
@@ -0,0 +1,148 @@
+// backend/repository/team_membership.go
+package repository
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/lib/pq"
+)
+
+// ReplaceSlackMemberships は指定チームの Slack 由来のメンバーシップを userKeys で置き換えます
+// manual 行には触れません。users テーブルに存在しない userKey と、個人データを消去したユーザーは無視されます
+func (r *Repository) ReplaceSlackMemberships(teamID int, userKeys []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		`DELETE FROM team_memberships WHERE team_id = $1 AND source = $2`,
+		teamID, MembershipSourceSlack,
+	); err != nil {
+		log.Printf("Failed to delete slack memberships (team_id: %d): %v", teamID, err)
+		return err
+	}
+
+	query := `
+		INSERT INTO team_memberships (team_id, user_id, source)
+		SELECT $1, id, $2 FROM users WHERE user_key = ANY($3) AND erased_at IS NULL
+	`
+	if _, err := tx.Exec(query, teamID, MembershipSourceSlack, pq.Array(userKeys)); err != nil {
+		log.Printf("Failed to insert slack memberships (team_id: %d): %v", teamID, err)
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SaveManualMembership は手動でのメンバーシップ上書きを保存します
+// excluded が true の場合、Slack 側で所属していてもメンバーから除外されます
+func (r *Repository) SaveManualMembership(teamID int, userID int, excluded bool) error {
+	query := `
+		INSERT INTO team_memberships (team_id, user_id, source, is_excluded)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (team_id, user_id, source) DO UPDATE
+		SET is_excluded = $4
+	`
+
+	_, err := r.db.Exec(query, teamID, userID, MembershipSourceManual, excluded)
+	if err != nil {
+		log.Printf("Failed to save manual membership (team_id: %d, user_id: %d): %v", teamID, userID, err)
+		return translateError(err)
+	}
+
+	return nil
+}
+
+// DeleteManualMembership は手動でのメンバーシップ上書きを削除し、Slack 由来の状態に戻します
+func (r *Repository) DeleteManualMembership(teamID int, userID int) error {
+	_, err := r.db.Exec(
+		`DELETE FROM team_memberships WHERE team_id = $1 AND user_id = $2 AND source = $3`,
+		teamID, userID, MembershipSourceManual,
+	)
+	if err != nil {
+		log.Printf("Failed to delete manual membership (team_id: %d, user_id: %d): %v", teamID, userID, err)
+		return err
+	}
+
+	return nil
+}
+
+// effectiveMembershipsQuery は (team_id, user_id) ごとに manual 行を優先した有効なメンバーシップを返すサブクエリです
+const effectiveMembershipsQuery = `
+	SELECT DISTINCT ON (team_id, user_id) team_id, user_id, source, is_excluded
+	FROM team_memberships
+	ORDER BY team_id, user_id, CASE source WHEN 'manual' THEN 0 ELSE 1 END
+`
+
+// GetTeamMembers は指定チームの有効なメンバー一覧を取得します
+func (r *Repository) GetTeamMembers(teamID int) ([]TeamMember, error) {
+	query := `
+		SELECT u.id, COALESCE(u.workspace_id, 0), u.user_key, u.user_name, u.grade, u.team_key, u.is_bot, u.is_deleted, u.role, u.opted_out, m.source
+		FROM (` + effectiveMembershipsQuery + `) m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.team_id = $1 AND NOT m.is_excluded
+		ORDER BY u.id ASC
+	`
+
+	rows, err := r.db.Query(query, teamID)
+	if err != nil {
+		log.Printf("Failed to get team members (team_id: %d): %v", teamID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []TeamMember{}
+	for rows.Next() {
+		var m TeamMember
+		if err := rows.Scan(&m.ID, &m.WorkspaceID, &m.UserKey, &m.UserName, &m.Grade, &m.TeamKey, &m.IsBot, &m.IsDeleted, &m.Role, &m.OptedOut, &m.Source); err != nil {
+			log.Printf("Failed to scan team member: %v", err)
+			return nil, err
+		}
+		members = append(members, m)
+	}
+
+	if err = rows.Err(); err != nil {
+		log.Printf("Error iterating team member rows: %v", err)
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// GetUserTeams は指定ユーザーが有効に所属するチーム一覧を取得します
+func (r *Repository) GetUserTeams(userID int) ([]UserTeam, error) {
+	query := `
+		SELECT t.id, COALESCE(t.workspace_id, 0), t.channel_id, t.channel_name, t.is_tracked, m.source
+		FROM (` + effectiveMembershipsQuery + `) m
+		JOIN teams t ON t.id = m.team_id
+		WHERE m.user_id = $1 AND NOT m.is_excluded
+		ORDER BY t.id ASC
+	`
+
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		log.Printf("Failed to get user teams (user_id: %d): %v", userID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	teams := []UserTeam{}
+	for rows.Next() {
+		var t UserTeam
+		if err := rows.Scan(&t.ID, &t.WorkspaceID, &t.ChannelID, &t.ChannelName, &t.IsTracked, &t.Source); err != nil {
+			log.Printf("Failed to scan user team: %v", err)
+			return nil, err
+		}
+		teams = append(teams, t)
+	}
+
+	if err = rows.Err(); err != nil {
+		log.Printf("Error iterating user team rows: %v", err)
+		return nil, err
+	}
+
+	return teams, nil
+}
@@ -0,0 +1,119 @@
+// backend/repository/user_assignment.go
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+)
+
+// insertInitialAssignment は所属履歴を持たないユーザーに最初の所属を登録します
+// 最初の所属は 'epoch' (1970-01-01) から有効とし、登録前の活動もこの所属として扱います
+func insertInitialAssignment(tx *sql.Tx, userID int, grade int, teamKey int) error {
+	query := `
+		INSERT INTO user_assignments (user_id, grade, team_key, valid_from)
+		SELECT $1, $2, $3, 'epoch'
+		WHERE NOT EXISTS (SELECT 1 FROM user_assignments WHERE user_id = $1)
+	`
+	_, err := tx.Exec(query, userID, grade, teamKey)
+	return err
+}
+
+// changeAssignment は現在の所属を閉じ、新しい所属を追加します
+// メッセージの投稿日時と比較できるよう UTC で記録します
+// トランザクション内の CURRENT_TIMESTAMP は同じ値を返すため、前の所属の valid_to と次の所属の valid_from は一致します
+func changeAssignment(tx *sql.Tx, userID int, grade int, teamKey int) error {
+	if _, err := tx.Exec(
+		`UPDATE user_assignments SET valid_to = CURRENT_TIMESTAMP AT TIME ZONE 'UTC' WHERE user_id = $1 AND valid_to IS NULL`,
+		userID,
+	); err != nil {
+		return err
+	}
+
+	_, err := tx.Exec(
+		`INSERT INTO user_assignments (user_id, grade, team_key, valid_from) VALUES ($1, $2, $3, CURRENT_TIMESTAMP AT TIME ZONE 'UTC')`,
+		userID, grade, teamKey,
+	)
+	return err
+}
+
+// ReassignForeignTeams はワークスペースのユーザーのうち、別のワークスペースのチーム（存在しないチームを含む）に
+// 所属しているユーザーを、ワークスペースの最初のチームに付け替え、付け替えたユーザー数を返します
+// チームを取り込む前に取り込んだユーザーは仮のチームになっているため、チームを取り込んだ後に呼び出します
+// 仮の所属は実際の所属ではないため、所属履歴も新しい所属を追加せずに書き換えます
+func (r *Repository) ReassignForeignTeams(workspaceID int) (int64, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	foreign := `NOT EXISTS (SELECT 1 FROM teams t WHERE t.id = %s AND t.workspace_id = $1)`
+	result, err := tx.Exec(`
+		UPDATE users u
+		SET team_key = d.id
+		FROM (SELECT MIN(id) AS id FROM teams WHERE workspace_id = $1) d
+		WHERE u.workspace_id = $1 AND d.id IS NOT NULL AND `+fmt.Sprintf(foreign, "u.team_key"), workspaceID)
+	if err != nil {
+		log.Printf("Failed to reassign users to workspace teams (workspace_id: %d): %v", workspaceID, err)
+		return 0, err
+	}
+	_, err = tx.Exec(`
+		UPDATE user_assignments a
+		SET team_key = d.id
+		FROM users u, (SELECT MIN(id) AS id FROM teams WHERE workspace_id = $1) d
+		WHERE a.user_id = u.id AND u.workspace_id = $1 AND d.id IS NOT NULL AND `+fmt.Sprintf(foreign, "a.team_key"), workspaceID)
+	if err != nil {
+		log.Printf("Failed to reassign user assignments to workspace teams (workspace_id: %d): %v", workspaceID, err)
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
+}
+
+// GetUserAssignments は指定ユーザーの所属履歴を古い順に取得します
+func (r *Repository) GetUserAssignments(userID int) ([]UserAssignment, error) {
+	return r.queryAssignments(`WHERE a.user_id = $1`, userID)
+}
+
+func (r *Repository) queryAssignments(where string, args ...interface{}) ([]UserAssignment, error) {
+	query := `
+		SELECT a.id, a.user_id, u.user_key, a.grade, a.team_key, a.valid_from, a.valid_to
+		FROM user_assignments a
+		JOIN users u ON u.id = a.user_id
+		` + where + `
+		ORDER BY a.user_id ASC, a.valid_from ASC
+	`
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		log.Printf("Failed to get user assignments: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	assignments := []UserAssignment{}
+	for rows.Next() {
+		var a UserAssignment
+		var validTo sql.NullTime
+		if err := rows.Scan(&a.ID, &a.UserID, &a.UserKey, &a.Grade, &a.TeamKey, &a.ValidFrom, &validTo); err != nil {
+			log.Printf("Failed to scan user assignment: %v", err)
+			return nil, err
+		}
+		if validTo.Valid {
+			a.ValidTo = &validTo.Time
+		}
+		assignments = append(assignments, a)
+	}
+
+	if err = rows.Err(); err != nil {
+		log.Printf("Error iterating user assignment rows: %v", err)
+		return nil, err
+	}
+
+	return assignments, nil
+}
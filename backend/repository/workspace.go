@@ -0,0 +1,141 @@
+// backend/repository/workspace.go
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+)
+
+// workspaceColumns は workspaces から読み込む列です（scanWorkspace の順）
+const workspaceColumns = `id, slack_team_id, name, url, bot_user_id, bot_token, user_token, installed_at, updated_at`
+
+// rowScanner は *sql.Row と *sql.Rows の共通のメソッドです
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanWorkspace はワークスペースを読み込み、トークンを復号します
+func (r *Repository) scanWorkspace(row rowScanner) (Workspace, error) {
+	var w Workspace
+	err := row.Scan(&w.ID, &w.SlackTeamID, &w.Name, &w.URL, &w.BotUserID, &w.BotToken, &w.UserToken, &w.InstalledAt, &w.UpdatedAt)
+	if err != nil {
+		return Workspace{}, err
+	}
+	if w.BotToken, err = r.decrypt(w.BotToken); err != nil {
+		return Workspace{}, fmt.Errorf("failed to decrypt bot token of workspace %d: %w", w.ID, err)
+	}
+	if w.UserToken, err = r.decrypt(w.UserToken); err != nil {
+		return Workspace{}, fmt.Errorf("failed to decrypt user token of workspace %d: %w", w.ID, err)
+	}
+	return w, nil
+}
+
+// SaveWorkspace はワークスペースとトークンを保存します
+// 同じ Slack ワークスペースを再インストールした場合は名前・URL・トークンを更新します
+// ユーザートークンが空の場合は保存済みのユーザートークンを残します。トークンは暗号化が有効な場合は暗号化して保存します
+func (r *Repository) SaveWorkspace(w Workspace) (Workspace, error) {
+	botToken, err := r.encrypt(w.BotToken)
+	if err != nil {
+		return Workspace{}, err
+	}
+	userToken, err := r.encrypt(w.UserToken)
+	if err != nil {
+		return Workspace{}, err
+	}
+	row := r.db.QueryRow(`
+		INSERT INTO workspaces (slack_team_id, name, url, bot_user_id, bot_token, user_token)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (slack_team_id) DO UPDATE
+		SET name = $2, url = $3, bot_user_id = $4, bot_token = $5,
+		    user_token = COALESCE(NULLIF($6, ''), workspaces.user_token),
+		    updated_at = CURRENT_TIMESTAMP AT TIME ZONE 'UTC'
+		RETURNING `+workspaceColumns,
+		w.SlackTeamID, w.Name, w.URL, w.BotUserID, botToken, userToken)
+	saved, err := r.scanWorkspace(row)
+	if err != nil {
+		log.Printf("Failed to save workspace (slack_team_id: %s): %v", w.SlackTeamID, err)
+		return Workspace{}, err
+	}
+	return saved, nil
+}
+
+// ListWorkspaces はインストールされているすべてのワークスペースを登録順に取得します
+func (r *Repository) ListWorkspaces() ([]Workspace, error) {
+	rows, err := r.db.Query(`SELECT ` + workspaceColumns + ` FROM workspaces ORDER BY id ASC`)
+	if err != nil {
+		log.Printf("Failed to list workspaces: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	workspaces := []Workspace{}
+	for rows.Next() {
+		w, err := r.scanWorkspace(rows)
+		if err != nil {
+			log.Printf("Failed to scan workspace: %v", err)
+			return nil, err
+		}
+		workspaces = append(workspaces, w)
+	}
+
+	if err = rows.Err(); err != nil {
+		log.Printf("Error iterating workspace rows: %v", err)
+		return nil, err
+	}
+	return workspaces, nil
+}
+
+// GetWorkspaceByID は指定されたIDのワークスペースを取得します
+// 見つからない場合は ErrNotFound を返します
+func (r *Repository) GetWorkspaceByID(id int) (Workspace, error) {
+	w, err := r.scanWorkspace(r.db.QueryRow(`SELECT `+workspaceColumns+` FROM workspaces WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return Workspace{}, fmt.Errorf("%w: no workspace found with id %d", ErrNotFound, id)
+	}
+	if err != nil {
+		log.Printf("Failed to get workspace (id: %d): %v", id, err)
+		return Workspace{}, err
+	}
+	return w, nil
+}
+
+// GetWorkspaceBySlackTeamID は指定された Slack ワークスペースIDのワークスペースを取得します
+// 見つからない場合は ErrNotFound を返します
+func (r *Repository) GetWorkspaceBySlackTeamID(slackTeamID string) (Workspace, error) {
+	w, err := r.scanWorkspace(r.db.QueryRow(`SELECT `+workspaceColumns+` FROM workspaces WHERE slack_team_id = $1`, slackTeamID))
+	if err == sql.ErrNoRows {
+		return Workspace{}, fmt.Errorf("%w: no workspace found with slack_team_id %s", ErrNotFound, slackTeamID)
+	}
+	if err != nil {
+		log.Printf("Failed to get workspace (slack_team_id: %s): %v", slackTeamID, err)
+		return Workspace{}, err
+	}
+	return w, nil
+}
+
+// AdoptUnscopedRows は複数ワークスペース対応前のユーザーとチーム（workspace_id が NULL）を指定ワークスペースに結び付けます
+// 環境変数のトークンで動かしていた環境を移行するときに使い、結び付けたユーザー数とチーム数を返します
+func (r *Repository) AdoptUnscopedRows(workspaceID int) (users int64, teams int64, err error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`UPDATE users SET workspace_id = $1 WHERE workspace_id IS NULL`, workspaceID)
+	if err != nil {
+		log.Printf("Failed to adopt users into workspace %d: %v", workspaceID, err)
+		return 0, 0, err
+	}
+	users, _ = result.RowsAffected()
+
+	result, err = tx.Exec(`UPDATE teams SET workspace_id = $1 WHERE workspace_id IS NULL`, workspaceID)
+	if err != nil {
+		log.Printf("Failed to adopt teams into workspace %d: %v", workspaceID, err)
+		return 0, 0, err
+	}
+	teams, _ = result.RowsAffected()
+
+	return users, teams, tx.Commit()
+}
@@ -0,0 +1,298 @@
+// backend/usecase/analytics_usecase.go
+package usecase
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"backend/repository"
+)
+
+// AnalyticsUsecase は取り込んだメッセージの集計を提供します
+// 集計は追跡対象のチャンネルだけを対象にし、チームは各時点で有効だった所属で判定します
+// どのメッセージを人の活動として数えるかは、すべての集計で policy に従います
+// チーム単位の集計はすべての主体が見られますが、ユーザーで絞り込む場合は GetUser と同じ権限が必要です
+// 集計はリクエストで選んだワークスペースのチームだけを対象にします
+// プライバシーレベルが aggregate の場合は、ユーザーで絞り込めるのは本人だけで、人数が最小グループサイズに満たない行は返しません
+// 集計の保持期限がある場合は、期限より前の期間を集計しません
+type AnalyticsUsecase struct {
+	repo      *repository.Repository
+	policy    repository.ActivityPolicy
+	users     *UserDirectory
+	privacy   PrivacyPolicy
+	retention RetentionPolicy
+}
+
+func NewAnalyticsUsecase(repo *repository.Repository, policy repository.ActivityPolicy, users *UserDirectory, privacy PrivacyPolicy, retention RetentionPolicy) *AnalyticsUsecase {
+	return &AnalyticsUsecase{
+		repo:      repo,
+		policy:    policy,
+		users:     users,
+		privacy:   privacy,
+		retention: retention,
+	}
+}
+
+// normalMessageSubtype は設定で通常の投稿（subtype が空のメッセージ）を表す名前です
+const normalMessageSubtype = "message"
+
+// DefaultHumanSubtypes は人の活動とみなす subtype の既定値です
+// 参加・退出やトピック変更などのシステムメッセージ、bot_message は含めません
+var DefaultHumanSubtypes = []string{normalMessageSubtype, "thread_broadcast", "me_message", "file_share"}
+
+// ParseActivityPolicy は設定値から人の活動とみなすメッセージの方針を作ります
+// subtypes はカンマ区切りの subtype の一覧で、通常の投稿は "message" と書きます。空の場合は DefaultHumanSubtypes を使います
+// excludeBots は "false" の場合のみボットの投稿も数えます
+func ParseActivityPolicy(subtypes string, excludeBots string) repository.ActivityPolicy {
+	names := DefaultHumanSubtypes
+	if strings.TrimSpace(subtypes) != "" {
+		names = strings.Split(subtypes, ",")
+	}
+
+	policy := repository.ActivityPolicy{
+		Subtypes:    []string{},
+		ExcludeBots: excludeBots != "false",
+	}
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == normalMessageSubtype {
+			name = ""
+		}
+		policy.Subtypes = append(policy.Subtypes, name)
+	}
+	return policy
+}
+
+// GetPolicy は集計に使っている人の活動の方針を返します
+func (u *AnalyticsUsecase) GetPolicy() repository.ActivityPolicy {
+	return u.policy
+}
+
+// GetPrivacy は集計に適用しているプライバシーの設定を返します
+func (u *AnalyticsUsecase) GetPrivacy() PrivacyPolicy {
+	return u.privacy
+}
+
+// authorizeUserKey は集計をユーザーで絞り込んでよいかどうかを確認し、仮名で指定された場合は user_key に戻します
+func (u *AnalyticsUsecase) authorizeUserKey(actor Principal, userKey string) (string, error) {
+	userKey, err := u.privacy.resolveUserKey(u.users, userKey)
+	if err != nil {
+		return "", err
+	}
+	if userKey != "" {
+		if err := u.privacy.authorizeIndividual(actor, userKey, "filtering by user"); err != nil {
+			return "", err
+		}
+	}
+	if err := u.users.authorizeUserKey(actor, userKey); err != nil {
+		return "", err
+	}
+	return userKey, nil
+}
+
+// DefaultActivityInterval は集計の単位を指定しない場合の既定値です
+const DefaultActivityInterval = "day"
+
+// ActivityQuery はアクティビティ集計の条件です
+// Oldest / Latest は Slack ts、RFC3339、または "2006-01-02" 形式で指定します
+type ActivityQuery struct {
+	Interval string
+	TeamKey  *int
+	UserKey  string
+	Oldest   string
+	Latest   string
+}
+
+// GetActivity は投稿・編集・削除・リアクションの件数を期間とチームごとに集計します
+func (u *AnalyticsUsecase) GetActivity(actor Principal, workspaceID int, q ActivityQuery) ([]repository.ActivityCount, error) {
+	var err error
+	if q.UserKey, err = u.authorizeUserKey(actor, q.UserKey); err != nil {
+		return nil, fmt.Errorf("GetActivity: %w", err)
+	}
+	filter := repository.ActivityFilter{
+		Policy:      u.policy,
+		WorkspaceID: workspaceID,
+		Interval:    q.Interval,
+		TeamKey:     q.TeamKey,
+		UserKey:     q.UserKey,
+	}
+	if filter.Interval == "" {
+		filter.Interval = DefaultActivityInterval
+	}
+	if !repository.ActivityIntervals[filter.Interval] {
+		return nil, fmt.Errorf("%w: interval must be one of hour, day, week, month", repository.ErrInvalid)
+	}
+
+	if filter.Oldest, filter.Latest, err = parseAnalyticsRange(q.Oldest, q.Latest); err != nil {
+		return nil, err
+	}
+	filter.Oldest = u.retention.clampOldest(filter.Oldest)
+
+	counts, err := u.repo.GetActivityCounts(filter)
+	if err != nil {
+		return nil, fmt.Errorf("GetActivity: %w", err)
+	}
+	visible := []repository.ActivityCount{}
+	for _, c := range counts {
+		if !u.privacy.suppressed(c.Users, actor.IsSelf(filter.UserKey)) {
+			visible = append(visible, c)
+		}
+	}
+	return visible, nil
+}
+
+// parseAnalyticsRange は集計の期間を日時に変換します。指定されていない端は nil を返します
+func parseAnalyticsRange(oldest string, latest string) (*time.Time, *time.Time, error) {
+	window, err := ParseSyncWindow(oldest, latest)
+	if err != nil {
+		return nil, nil, err
+	}
+	var from, to *time.Time
+	if window.Oldest != "" {
+		t, _ := ParseSlackTimestamp(window.Oldest)
+		from = &t
+	}
+	if window.Latest != "" {
+		t, _ := ParseSlackTimestamp(window.Latest)
+		to = &t
+	}
+	return from, to, nil
+}
+
+// DefaultRankingLimit と MaxRankingLimit はランキング（絵文字、ドメイン）で返す件数の既定値と上限です
+const (
+	DefaultRankingLimit = 10
+	MaxRankingLimit     = 100
+)
+
+// AnalyticsQuery はリアクションや共有されたファイル・リンクの集計条件です
+// Oldest / Latest は Slack ts、RFC3339、または "2006-01-02" 形式で指定します
+type AnalyticsQuery struct {
+	TeamKey *int
+	UserKey string
+	Oldest  string
+	Latest  string
+	Limit   int // ランキングのみ
+}
+
+// analyticsFilter は集計条件を repository.AnalyticsFilter に変換します
+// ユーザーで絞り込む場合は、主体がそのユーザーを見られることを確認します
+func (u *AnalyticsUsecase) analyticsFilter(actor Principal, workspaceID int, q AnalyticsQuery) (repository.AnalyticsFilter, error) {
+	var err error
+	if q.UserKey, err = u.authorizeUserKey(actor, q.UserKey); err != nil {
+		return repository.AnalyticsFilter{}, err
+	}
+	filter := repository.AnalyticsFilter{
+		Policy:      u.policy,
+		WorkspaceID: workspaceID,
+		TeamKey:     q.TeamKey,
+		UserKey:     q.UserKey,
+		Limit:       q.Limit,
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultRankingLimit
+	}
+	if filter.Limit > MaxRankingLimit {
+		filter.Limit = MaxRankingLimit
+	}
+	if filter.Oldest, filter.Latest, err = parseAnalyticsRange(q.Oldest, q.Latest); err != nil {
+		return repository.AnalyticsFilter{}, err
+	}
+	filter.Oldest = u.retention.clampOldest(filter.Oldest)
+	return filter, nil
+}
+
+// GetTopEmoji はリアクションに使われた絵文字を多い順に返します
+// チームとユーザーはリアクションしたユーザーで絞り込みます
+func (u *AnalyticsUsecase) GetTopEmoji(actor Principal, workspaceID int, q AnalyticsQuery) ([]repository.EmojiCount, error) {
+	filter, err := u.analyticsFilter(actor, workspaceID, q)
+	if err != nil {
+		return nil, err
+	}
+
+	counts, err := u.repo.GetTopEmoji(filter)
+	if err != nil {
+		return nil, fmt.Errorf("GetTopEmoji: %w", err)
+	}
+	visible := []repository.EmojiCount{}
+	for _, c := range counts {
+		if !u.privacy.suppressed(c.Users, actor.IsSelf(filter.UserKey)) {
+			visible = append(visible, c)
+		}
+	}
+	return visible, nil
+}
+
+// GetReactionBalances はユーザーごとのリアクションした数とされた数を返します
+// ユーザーごとの詳細なので、lead は自分のチーム、member は自分だけに絞り込みます
+// 仮名にする場合は本人以外のユーザーを仮名にし、aggregate の場合は誰でも自分だけに絞り込みます
+func (u *AnalyticsUsecase) GetReactionBalances(actor Principal, workspaceID int, q AnalyticsQuery) ([]repository.ReactionBalance, error) {
+	var err error
+	if q.UserKey, err = u.privacy.resolveUserKey(u.users, q.UserKey); err != nil {
+		return nil, fmt.Errorf("GetReactionBalances: %w", err)
+	}
+	if q.UserKey, err = u.privacy.scopeIndividual(actor, q.UserKey, "viewing reaction balances"); err != nil {
+		return nil, fmt.Errorf("GetReactionBalances: %w", err)
+	}
+	if q.TeamKey, q.UserKey, err = scopeUserQuery(actor, q.TeamKey, q.UserKey); err != nil {
+		return nil, fmt.Errorf("GetReactionBalances: %w", err)
+	}
+	filter, err := u.analyticsFilter(actor, workspaceID, q)
+	if err != nil {
+		return nil, err
+	}
+
+	balances, err := u.repo.GetReactionBalances(filter)
+	if err != nil {
+		return nil, fmt.Errorf("GetReactionBalances: %w", err)
+	}
+	for i := range balances {
+		b := &balances[i]
+		if userKey := u.privacy.userKey(actor, b.UserKey); userKey != b.UserKey {
+			b.UserKey, b.UserName = userKey, userKey
+		}
+	}
+	return balances, nil
+}
+
+// GetTopDomains はメッセージに含まれるリンクのドメインを多い順に返します
+// チームとユーザーは投稿者で絞り込みます
+func (u *AnalyticsUsecase) GetTopDomains(actor Principal, workspaceID int, q AnalyticsQuery) ([]repository.DomainCount, error) {
+	filter, err := u.analyticsFilter(actor, workspaceID, q)
+	if err != nil {
+		return nil, err
+	}
+
+	counts, err := u.repo.GetTopDomains(filter)
+	if err != nil {
+		return nil, fmt.Errorf("GetTopDomains: %w", err)
+	}
+	visible := []repository.DomainCount{}
+	for _, c := range counts {
+		if !u.privacy.suppressed(c.Users, actor.IsSelf(filter.UserKey)) {
+			visible = append(visible, c)
+		}
+	}
+	return visible, nil
+}
+
+// GetFileShares は共有されたファイルの件数をチームと分類（文書、スニペットなど）ごとに集計します
+func (u *AnalyticsUsecase) GetFileShares(actor Principal, workspaceID int, q AnalyticsQuery) ([]repository.FileShareCount, error) {
+	filter, err := u.analyticsFilter(actor, workspaceID, q)
+	if err != nil {
+		return nil, err
+	}
+
+	counts, err := u.repo.GetFileShares(filter)
+	if err != nil {
+		return nil, fmt.Errorf("GetFileShares: %w", err)
+	}
+	visible := []repository.FileShareCount{}
+	for _, c := range counts {
+		if !u.privacy.suppressed(c.Users, actor.IsSelf(filter.UserKey)) {
+			visible = append(visible, c)
+		}
+	}
+	return visible, nil
+}
@@ -0,0 +1,124 @@
+// backend/usecase/artifacts.go
+package usecase
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"backend/repository"
+
+	"github.com/slack-go/slack"
+)
+
+// ファイルの種類（message_files.category）
+// 何を共有しているかの集計に使うため、Slack の filetype / mode を大まかにまとめます
+const (
+	FileCategoryDocument     = "document"     // 文書（PDF、Word、Google ドキュメント、Slack の投稿・Canvas など）
+	FileCategorySpreadsheet  = "spreadsheet"  // 表計算（Excel、CSV、Google スプレッドシートなど）
+	FileCategoryPresentation = "presentation" // プレゼンテーション
+	FileCategorySnippet      = "snippet"      // コードスニペット
+	FileCategoryImage        = "image"
+	FileCategoryMedia        = "media" // 動画・音声
+	FileCategoryArchive      = "archive"
+	FileCategoryOther        = "other"
+)
+
+var fileCategoriesByType = map[string]string{
+	"pdf": FileCategoryDocument, "doc": FileCategoryDocument, "docx": FileCategoryDocument, "odt": FileCategoryDocument,
+	"rtf": FileCategoryDocument, "gdoc": FileCategoryDocument, "markdown": FileCategoryDocument, "text": FileCategoryDocument,
+	"post": FileCategoryDocument, "space": FileCategoryDocument, "quip": FileCategoryDocument, "canvas": FileCategoryDocument,
+	"xls": FileCategorySpreadsheet, "xlsx": FileCategorySpreadsheet, "ods": FileCategorySpreadsheet,
+	"csv": FileCategorySpreadsheet, "tsv": FileCategorySpreadsheet, "gsheet": FileCategorySpreadsheet,
+	"ppt": FileCategoryPresentation, "pptx": FileCategoryPresentation, "odp": FileCategoryPresentation,
+	"key": FileCategoryPresentation, "gpres": FileCategoryPresentation,
+	"zip": FileCategoryArchive, "gzip": FileCategoryArchive, "tar": FileCategoryArchive, "7z": FileCategoryArchive,
+}
+
+// fileCategory はファイルの種類を判定します
+// Slack のスニペット（mode が snippet）は言語に関わらずスニペットとして扱います
+func fileCategory(file slack.File) string {
+	switch file.Mode {
+	case "snippet":
+		return FileCategorySnippet
+	case "post", "docs", "canvas", "quip":
+		return FileCategoryDocument
+	}
+	if category, ok := fileCategoriesByType[strings.ToLower(file.Filetype)]; ok {
+		return category
+	}
+	mimetype := strings.ToLower(file.Mimetype)
+	switch {
+	case strings.HasPrefix(mimetype, "image/"):
+		return FileCategoryImage
+	case strings.HasPrefix(mimetype, "video/"), strings.HasPrefix(mimetype, "audio/"):
+		return FileCategoryMedia
+	}
+	return FileCategoryOther
+}
+
+// toMessageFiles はメッセージで共有されたファイルのメタデータを取り出します
+// ファイル名・タイトル・中身・URL は保存しません
+func toMessageFiles(files []slack.File) []repository.MessageFile {
+	result := []repository.MessageFile{}
+	for _, file := range files {
+		// 削除済みのファイルは ID と mode だけが返る
+		if file.ID == "" || file.Mode == "tombstone" || file.Mode == "hidden_by_limit" {
+			continue
+		}
+		result = append(result, repository.MessageFile{
+			FileID:       file.ID,
+			UserKey:      file.User,
+			Filetype:     file.Filetype,
+			Mimetype:     file.Mimetype,
+			Category:     fileCategory(file),
+			Size:         int64(file.Size),
+			IsExternal:   file.IsExternal,
+			ExternalType: file.ExternalType,
+		})
+	}
+	return result
+}
+
+// mrkdwnLinkPattern は mrkdwn の本文中のリンク（<https://example.com|ラベル> の URL の部分）です
+var mrkdwnLinkPattern = regexp.MustCompile(`<(https?://[^|>\s]+)(?:\|[^>]*)?>`)
+
+// ExtractMessageLinks はメッセージの本文と添付（リンクの展開を含む）に含まれるリンクを、ドメインごとに数えて返します
+// 同じ URL は 1 回だけ数え、ドメインを判定できない URL は含めません
+func ExtractMessageLinks(message slack.Message) []repository.MessageLink {
+	var urls []string
+	for _, match := range mrkdwnLinkPattern.FindAllStringSubmatch(ExtractMessageText(message), -1) {
+		urls = append(urls, match[1])
+	}
+	for _, attachment := range message.Attachments {
+		urls = append(urls, attachment.OriginalURL, attachment.FromURL)
+	}
+
+	links := []repository.MessageLink{}
+	index := map[string]int{}
+	seen := map[string]bool{}
+	for _, raw := range urls {
+		raw = strings.NewReplacer("&amp;", "&", "&lt;", "<", "&gt;", ">").Replace(raw)
+		domain := linkDomain(raw)
+		if domain == "" || seen[raw] {
+			continue
+		}
+		seen[raw] = true
+		if i, ok := index[domain]; ok {
+			links[i].Links++
+			continue
+		}
+		index[domain] = len(links)
+		links = append(links, repository.MessageLink{Domain: domain, Links: 1})
+	}
+	return links
+}
+
+// linkDomain は URL のドメインを小文字で返します。先頭の "www." は除きます
+func linkDomain(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
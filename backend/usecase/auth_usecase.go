@@ -0,0 +1,369 @@
+// backend/usecase/auth_usecase.go
+package usecase
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/repository"
+)
+
+// 認証された主体の種類
+const (
+	PrincipalAPIKey = "api_key" // API キー、または API キーでログインしたセッション
+	PrincipalUser   = "user"    // Slack でログインしたユーザー（ID は users.user_key）
+	PrincipalSystem = "system"  // コマンドなどサーバー内部の処理（SystemPrincipal）
+)
+
+// Principal は認証された主体（API の呼び出し元）です
+type Principal struct {
+	Kind string `json:"kind"` // PrincipalAPIKey など
+	ID   string `json:"id"`   // 種類ごとの ID（API キーの場合はキーの ID、ユーザーの場合は Slack ユーザーID）
+	Name string `json:"name"`
+	// 権限（RoleAdmin など）と、lead / member の場合に見られるチーム
+	// セッションには保存せず、リクエストのたびに DB の値を読み込みます
+	Role    string `json:"role"`
+	TeamKey *int   `json:"team_key"`
+	// 主体が属するワークスペース（nil の場合、admin はすべてのワークスペースを選べ、それ以外はどのワークスペースも選べない）
+	WorkspaceID *int `json:"workspace_id"`
+}
+
+// apiKeyPrefix は発行する API キーの先頭に付ける文字列です（どこで使うキーか分かるように）
+const apiKeyPrefix = "slk_"
+
+// DefaultSessionTTL はセッションの有効期間の既定値です
+const DefaultSessionTTL = 7 * 24 * time.Hour
+
+// AuthUsecase は API キー、Slack でのログイン（OpenID Connect）、セッションによる認証を提供します
+// セッションはサーバーに保存せず、sessionSecret で署名したトークンをクッキーに入れて使います
+// oidc が nil の場合、Slack でのログインは無効です
+type AuthUsecase struct {
+	tokenSigner
+	repo       *repository.Repository
+	users      *UserDirectory
+	oidc       *OIDCProvider
+	sessionTTL time.Duration
+}
+
+func NewAuthUsecase(repo *repository.Repository, users *UserDirectory, oidc *OIDCProvider, sessionSecret []byte, sessionTTL time.Duration) *AuthUsecase {
+	if sessionTTL <= 0 {
+		sessionTTL = DefaultSessionTTL
+	}
+	return &AuthUsecase{
+		tokenSigner: tokenSigner{secret: sessionSecret},
+		repo:        repo,
+		users:       users,
+		oidc:        oidc,
+		sessionTTL:  sessionTTL,
+	}
+}
+
+// NewRandomSecret はセッションの署名用のランダムな鍵を作ります
+// SESSION_SECRET が設定されていない場合に使い、再起動するとそれまでのセッションは無効になります
+func NewRandomSecret() ([]byte, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate secret: %w", err)
+	}
+	return secret, nil
+}
+
+// SessionTTL はセッションの有効期間を返します
+func (u *AuthUsecase) SessionTTL() time.Duration {
+	return u.sessionTTL
+}
+
+// CreateAPIKey は API キーを発行します
+// workspaceID はキーで扱えるワークスペースで、nil（すべてのワークスペース）にできるのは admin のキーだけです
+// role が lead の場合は teamKey（見られるチーム）が必要で、チームは workspaceID のワークスペースのものにします
+// キーそのものは保存しないので、返したキーは呼び出し元で一度だけ表示してください
+func (u *AuthUsecase) CreateAPIKey(name string, role string, workspaceID *int, teamKey *int) (string, repository.APIKey, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", repository.APIKey{}, fmt.Errorf("%w: name is required", repository.ErrInvalid)
+	}
+	if role == "" {
+		role = RoleAdmin
+	}
+	if !Roles[role] {
+		return "", repository.APIKey{}, fmt.Errorf("%w: role must be one of admin, lead, member", repository.ErrInvalid)
+	}
+	if role == RoleLead && teamKey == nil {
+		return "", repository.APIKey{}, fmt.Errorf("%w: team is required for lead API keys", repository.ErrInvalid)
+	}
+	if role != RoleAdmin && workspaceID == nil {
+		return "", repository.APIKey{}, fmt.Errorf("%w: workspace is required for lead and member API keys", repository.ErrInvalid)
+	}
+	if teamKey != nil && workspaceID != nil {
+		team, err := u.repo.GetTeamByID(*teamKey)
+		if errors.Is(err, repository.ErrNotFound) {
+			return "", repository.APIKey{}, fmt.Errorf("%w: team %d does not exist", repository.ErrInvalid, *teamKey)
+		}
+		if err != nil {
+			return "", repository.APIKey{}, fmt.Errorf("failed to get team: %w", err)
+		}
+		if team.WorkspaceID != *workspaceID {
+			return "", repository.APIKey{}, fmt.Errorf("%w: team %d is not in workspace %d", repository.ErrInvalid, *teamKey, *workspaceID)
+		}
+	}
+
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", repository.APIKey{}, fmt.Errorf("failed to generate API key: %w", err)
+	}
+	key := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(random)
+
+	apiKey, err := u.repo.CreateAPIKey(name, key[:len(apiKeyPrefix)+6], hashAPIKey(key), role, teamKey, workspaceID)
+	if err != nil {
+		return "", repository.APIKey{}, fmt.Errorf("failed to create API key: %w", err)
+	}
+	return key, apiKey, nil
+}
+
+// ListAPIKeys は発行した API キーの一覧を返します（無効化したものを含む）
+func (u *AuthUsecase) ListAPIKeys() ([]repository.APIKey, error) {
+	keys, err := u.repo.ListAPIKeys()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey は API キーを無効化します。このキーでログインしたセッションも使えなくなります
+func (u *AuthUsecase) RevokeAPIKey(id int) error {
+	if err := u.repo.RevokeAPIKey(id); err != nil {
+		return fmt.Errorf("failed to revoke API key: %w", err)
+	}
+	return nil
+}
+
+// AuthenticateAPIKey は API キーを検証し、キーの主体を返します
+// キーが不正・無効化済みの場合は ErrUnauthorized を返します
+func (u *AuthUsecase) AuthenticateAPIKey(key string) (Principal, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return Principal{}, fmt.Errorf("%w: invalid API key", repository.ErrUnauthorized)
+	}
+
+	apiKey, err := u.repo.GetActiveAPIKeyByHash(hashAPIKey(key))
+	if errors.Is(err, repository.ErrNotFound) {
+		return Principal{}, fmt.Errorf("%w: invalid API key", repository.ErrUnauthorized)
+	}
+	if err != nil {
+		return Principal{}, fmt.Errorf("failed to authenticate API key: %w", err)
+	}
+	return apiKeyPrincipal(apiKey), nil
+}
+
+// apiKeyPrincipal は API キーの主体を返します
+func apiKeyPrincipal(apiKey repository.APIKey) Principal {
+	return Principal{
+		Kind:        PrincipalAPIKey,
+		ID:          strconv.Itoa(apiKey.ID),
+		Name:        apiKey.Name,
+		Role:        apiKey.Role,
+		TeamKey:     apiKey.TeamKey,
+		WorkspaceID: apiKey.WorkspaceID,
+	}
+}
+
+// userPrincipal は Slack でログインしたユーザーの主体を返します
+func userPrincipal(user repository.User) Principal {
+	teamKey := user.TeamKey
+	principal := Principal{
+		Kind:    PrincipalUser,
+		ID:      user.UserKey,
+		Name:    user.UserName,
+		Role:    user.Role,
+		TeamKey: &teamKey,
+	}
+	if user.WorkspaceID != 0 {
+		workspaceID := user.WorkspaceID
+		principal.WorkspaceID = &workspaceID
+	}
+	return principal
+}
+
+// hashAPIKey は API キーの SHA-256 を16進で返します
+// キーは十分に長いランダムな値なので、パスワードのような低速なハッシュは使いません
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// sessionClaims はセッショントークンの中身です
+type sessionClaims struct {
+	Kind      string `json:"kind"`
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	ExpiresAt int64  `json:"exp"` // Unix 秒
+}
+
+// CreateSession は主体のセッショントークンと有効期限を返します
+func (u *AuthUsecase) CreateSession(principal Principal) (string, time.Time, error) {
+	expiresAt := time.Now().Add(u.sessionTTL)
+	token, err := u.signToken(sessionClaims{
+		Kind:      principal.Kind,
+		ID:        principal.ID,
+		Name:      principal.Name,
+		ExpiresAt: expiresAt.Unix(),
+	})
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to encode session: %w", err)
+	}
+	return token, expiresAt, nil
+}
+
+// AuthenticateSession はセッショントークンの署名と有効期限を検証し、主体を返します
+// API キーでログインしたセッションはキーが無効化されていないこと、
+// Slack でログインしたセッションはユーザーが削除されていないことも確認し、現在の権限を読み込みます
+// トークンが不正・期限切れの場合は ErrUnauthorized を返します
+func (u *AuthUsecase) AuthenticateSession(token string) (Principal, error) {
+	var claims sessionClaims
+	if err := u.verifyToken(token, &claims); err != nil {
+		return Principal{}, err
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return Principal{}, fmt.Errorf("%w: session expired", repository.ErrUnauthorized)
+	}
+
+	switch claims.Kind {
+	case PrincipalAPIKey:
+		id, err := strconv.Atoi(claims.ID)
+		if err != nil {
+			return Principal{}, fmt.Errorf("%w: invalid session", repository.ErrUnauthorized)
+		}
+		apiKey, err := u.repo.GetActiveAPIKey(id)
+		if errors.Is(err, repository.ErrNotFound) {
+			return Principal{}, fmt.Errorf("%w: API key has been revoked", repository.ErrUnauthorized)
+		}
+		if err != nil {
+			return Principal{}, fmt.Errorf("failed to check API key: %w", err)
+		}
+		return apiKeyPrincipal(apiKey), nil
+	case PrincipalUser:
+		user, err := u.activeUser(claims.ID)
+		if err != nil {
+			return Principal{}, err
+		}
+		return userPrincipal(user), nil
+	default:
+		return Principal{}, fmt.Errorf("%w: invalid session", repository.ErrUnauthorized)
+	}
+}
+
+// activeUser は user_key のユーザーを返します
+// 取り込まれていない、Slack で削除された、またはボットのユーザーの場合は ErrForbidden を返します
+func (u *AuthUsecase) activeUser(userKey string) (repository.User, error) {
+	user, ok, err := u.users.Lookup(userKey)
+	if err == nil && !ok {
+		// 直近に取り込んだユーザーがキャッシュにない場合があるので、読み込み直して確認する
+		// 存在しないユーザーでのログインのたびに全ユーザーを読み込まないよう、読み込み直すのは一定間隔に 1 回まで
+		u.users.InvalidateOlderThan(userDirectoryMissRefreshInterval)
+		user, ok, err = u.users.Lookup(userKey)
+	}
+	if err != nil {
+		return repository.User{}, fmt.Errorf("failed to look up user: %w", err)
+	}
+	if !ok || user.IsDeleted || user.IsBot {
+		return repository.User{}, fmt.Errorf("%w: user %s is not allowed to sign in", repository.ErrForbidden, userKey)
+	}
+	return user, nil
+}
+
+// oidcLoginTTL は Slack でのログインを開始してから戻ってくるまでの有効期間です
+const oidcLoginTTL = 10 * time.Minute
+
+// oidcLoginState はログイン開始時にクッキーに保存し、戻ってきたときに照合する値です
+type oidcLoginState struct {
+	State     string `json:"state"`
+	Nonce     string `json:"nonce"`
+	ExpiresAt int64  `json:"exp"` // Unix 秒
+}
+
+// OIDCEnabled は Slack でのログインが設定されているかどうかを返します
+func (u *AuthUsecase) OIDCEnabled() bool {
+	return u.oidc != nil
+}
+
+// BeginOIDCLogin は Slack でのログインを開始します
+// ユーザーを送る認可 URL と、戻ってきたときに CompleteOIDCLogin に渡すログイン状態（署名済み）を返します
+// ログイン状態は呼び出し元でクッキーなどに保存してください
+func (u *AuthUsecase) BeginOIDCLogin() (authURL string, loginState string, err error) {
+	if u.oidc == nil {
+		return "", "", fmt.Errorf("%w: Sign in with Slack is not configured", repository.ErrNotFound)
+	}
+
+	state := oidcLoginState{ExpiresAt: time.Now().Add(oidcLoginTTL).Unix()}
+	if state.State, err = randomToken(); err != nil {
+		return "", "", err
+	}
+	if state.Nonce, err = randomToken(); err != nil {
+		return "", "", err
+	}
+	if loginState, err = u.signToken(state); err != nil {
+		return "", "", err
+	}
+	if authURL, err = u.oidc.AuthCodeURL(state.State, state.Nonce); err != nil {
+		return "", "", fmt.Errorf("failed to build authorization URL: %w", err)
+	}
+	return authURL, loginState, nil
+}
+
+// CompleteOIDCLogin は認可後に戻ってきたリクエストの state と code を検証し、Slack ユーザーの主体を返します
+// Slack ユーザーIDを users.user_key として、取り込み済みのユーザーだけがログインできます
+// インストール済みのワークスペースのユーザーは、ID トークンのワークスペースがユーザーのワークスペースと一致する必要があります
+func (u *AuthUsecase) CompleteOIDCLogin(loginState string, state string, code string) (Principal, error) {
+	if u.oidc == nil {
+		return Principal{}, fmt.Errorf("%w: Sign in with Slack is not configured", repository.ErrNotFound)
+	}
+
+	var expected oidcLoginState
+	if err := u.verifyToken(loginState, &expected); err != nil {
+		return Principal{}, fmt.Errorf("%w: login session not found", repository.ErrUnauthorized)
+	}
+	if time.Now().Unix() >= expected.ExpiresAt {
+		return Principal{}, fmt.Errorf("%w: login session expired", repository.ErrUnauthorized)
+	}
+	if state == "" || !hmac.Equal([]byte(state), []byte(expected.State)) {
+		return Principal{}, fmt.Errorf("%w: state mismatch", repository.ErrUnauthorized)
+	}
+	if code == "" {
+		return Principal{}, fmt.Errorf("%w: authorization code is missing", repository.ErrUnauthorized)
+	}
+
+	claims, err := u.oidc.Exchange(code, expected.Nonce)
+	if err != nil {
+		return Principal{}, err
+	}
+	user, err := u.activeUser(claims.UserID)
+	if err != nil {
+		return Principal{}, err
+	}
+	if user.WorkspaceID != 0 {
+		workspace, err := u.repo.GetWorkspaceBySlackTeamID(claims.TeamID)
+		if errors.Is(err, repository.ErrNotFound) || (err == nil && workspace.ID != user.WorkspaceID) {
+			return Principal{}, fmt.Errorf("%w: user %s signed in to an unexpected workspace %s", repository.ErrForbidden, claims.UserID, claims.TeamID)
+		}
+		if err != nil {
+			return Principal{}, fmt.Errorf("failed to get workspace: %w", err)
+		}
+	}
+	return userPrincipal(user), nil
+}
+
+// randomToken は state や nonce に使うランダムな文字列を返します
+func randomToken() (string, error) {
+	random := make([]byte, 24)
+	if _, err := rand.Read(random); err != nil {
+		return "", fmt.Errorf("failed to generate random token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(random), nil
+}
@@ -0,0 +1,111 @@
+// backend/usecase/authorization.go
+package usecase
+
+import (
+	"fmt"
+
+	"backend/repository"
+)
+
+// 主体の権限
+// admin はすべての操作、lead は自分のチームのユーザーごとの詳細の閲覧、
+// member は自分のプロフィールとチーム単位の集計の閲覧ができます
+const (
+	RoleAdmin  = "admin"
+	RoleLead   = "lead"
+	RoleMember = "member"
+)
+
+// Roles は有効な権限の一覧です
+var Roles = map[string]bool{
+	RoleAdmin:  true,
+	RoleLead:   true,
+	RoleMember: true,
+}
+
+// SystemPrincipal はコマンドやサーバー内部の処理など、利用者を介さない呼び出しの主体です（admin 権限）
+var SystemPrincipal = Principal{Kind: PrincipalSystem, ID: "system", Name: "system", Role: RoleAdmin}
+
+// IsAdmin は主体が admin 権限を持つかどうかを返します
+func (p Principal) IsAdmin() bool {
+	return p.Role == RoleAdmin
+}
+
+// IsSelf は主体が user_key のユーザー本人（Slack でログインしたユーザー）かどうかを返します
+func (p Principal) IsSelf(userKey string) bool {
+	return p.Kind == PrincipalUser && p.ID == userKey
+}
+
+// leadsTeam は主体が teamKey のチームの lead かどうかを返します
+func (p Principal) leadsTeam(teamKey int) bool {
+	return p.Role == RoleLead && p.TeamKey != nil && *p.TeamKey == teamKey
+}
+
+// forbidden は権限がない場合のエラーを返します
+func forbidden(actor Principal, action string) error {
+	return fmt.Errorf("%w: %s %s (role: %s) is not allowed to %s", repository.ErrForbidden, actor.Kind, actor.ID, actor.Role, action)
+}
+
+// authorizeAdmin は admin だけに許可された操作かどうかを確認します
+func authorizeAdmin(actor Principal, action string) error {
+	if actor.IsAdmin() {
+		return nil
+	}
+	return forbidden(actor, action)
+}
+
+// authorizeUser はユーザーごとの詳細（プロフィール、メッセージ、所属履歴など）を見てよいかどうかを確認します
+// admin はすべてのユーザー、lead は自分のチームのユーザー、それ以外は本人だけを見られます
+func authorizeUser(actor Principal, user repository.User) error {
+	if actor.IsAdmin() || actor.IsSelf(user.UserKey) || actor.leadsTeam(user.TeamKey) {
+		return nil
+	}
+	return forbidden(actor, "view user "+user.UserKey)
+}
+
+// authorizeTeam はチームのメンバーごとの詳細を見てよいかどうかを確認します
+// admin はすべてのチーム、lead は自分のチームだけを見られます
+func authorizeTeam(actor Principal, teamKey int) error {
+	if actor.IsAdmin() || actor.leadsTeam(teamKey) {
+		return nil
+	}
+	return forbidden(actor, fmt.Sprintf("view members of team %d", teamKey))
+}
+
+// scopeUserQuery はユーザーごとの詳細を含む一覧の絞り込み条件を主体の権限に合わせます
+// admin はそのまま、lead は自分のチーム、それ以外は本人に絞り込みます
+// 権限の外のチームやユーザーが指定されている場合は ErrForbidden を返します
+func scopeUserQuery(actor Principal, teamKey *int, userKey string) (*int, string, error) {
+	switch {
+	case actor.IsAdmin():
+		return teamKey, userKey, nil
+	case actor.Role == RoleLead && actor.TeamKey != nil:
+		if teamKey != nil && *teamKey != *actor.TeamKey {
+			return nil, "", forbidden(actor, fmt.Sprintf("view members of team %d", *teamKey))
+		}
+		return actor.TeamKey, userKey, nil
+	case actor.Kind == PrincipalUser:
+		if userKey != "" && userKey != actor.ID {
+			return nil, "", forbidden(actor, "view user "+userKey)
+		}
+		return teamKey, actor.ID, nil
+	default:
+		return nil, "", forbidden(actor, "view individual users")
+	}
+}
+
+// authorizeUserKey は集計をユーザーで絞り込んでよいかどうかを確認します
+// 絞り込まない（チーム単位の）集計はすべての主体が見られます
+func (u *UserDirectory) authorizeUserKey(actor Principal, userKey string) error {
+	if userKey == "" || actor.IsAdmin() || actor.IsSelf(userKey) {
+		return nil
+	}
+	user, ok, err := u.Lookup(userKey)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return forbidden(actor, "view user "+userKey)
+	}
+	return authorizeUser(actor, user)
+}
@@ -0,0 +1,122 @@
+// backend/usecase/authorization_test.go
+package usecase
+
+import (
+	"errors"
+	"testing"
+
+	"backend/repository"
+)
+
+func intPtr(v int) *int {
+	return &v
+}
+
+// 権限のテストで使う主体
+var (
+	testAdmin         = Principal{Kind: PrincipalUser, ID: "U9", Role: RoleAdmin}
+	testAdminKey      = Principal{Kind: PrincipalAPIKey, ID: "1", Role: RoleAdmin}
+	testLead          = Principal{Kind: PrincipalUser, ID: "U8", Role: RoleLead, TeamKey: intPtr(1)}
+	testLeadNoTeam    = Principal{Kind: PrincipalUser, ID: "U7", Role: RoleLead}
+	testLeadKeyNoTeam = Principal{Kind: PrincipalAPIKey, ID: "2", Role: RoleLead}
+	testMember        = Principal{Kind: PrincipalUser, ID: "U1", Role: RoleMember, TeamKey: intPtr(1)}
+	testMemberKey     = Principal{Kind: PrincipalAPIKey, ID: "3", Role: RoleMember, TeamKey: intPtr(1)}
+	testMemberKeyNone = Principal{Kind: PrincipalAPIKey, ID: "4", Role: RoleMember}
+)
+
+func TestAuthorizeUser(t *testing.T) {
+	own := repository.User{ID: 1, UserKey: "U1", TeamKey: 1}
+	other := repository.User{ID: 2, UserKey: "U2", TeamKey: 2}
+
+	tests := []struct {
+		name    string
+		actor   Principal
+		user    repository.User
+		wantErr error
+	}{
+		{"admin views any user", testAdmin, other, nil},
+		{"admin key views any user", testAdminKey, other, nil},
+		{"system views any user", SystemPrincipal, other, nil},
+		{"lead views own team", testLead, own, nil},
+		{"lead cannot view other team", testLead, other, repository.ErrForbidden},
+		{"lead without team cannot view users", testLeadNoTeam, own, repository.ErrForbidden},
+		{"member views themselves", testMember, own, nil},
+		{"member cannot view teammates", testMember, repository.User{ID: 3, UserKey: "U3", TeamKey: 1}, repository.ErrForbidden},
+		{"member key is not the user", testMemberKey, own, repository.ErrForbidden},
+		{"member key without team", testMemberKeyNone, own, repository.ErrForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := authorizeUser(tt.actor, tt.user); !errors.Is(err, tt.wantErr) {
+				t.Errorf("authorizeUser() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuthorizeTeam(t *testing.T) {
+	tests := []struct {
+		name    string
+		actor   Principal
+		teamKey int
+		wantErr error
+	}{
+		{"admin views any team", testAdmin, 2, nil},
+		{"admin key views any team", testAdminKey, 2, nil},
+		{"lead views own team", testLead, 1, nil},
+		{"lead cannot view other team", testLead, 2, repository.ErrForbidden},
+		{"lead without team", testLeadNoTeam, 1, repository.ErrForbidden},
+		{"lead key without team", testLeadKeyNoTeam, 1, repository.ErrForbidden},
+		{"member cannot view own team members", testMember, 1, repository.ErrForbidden},
+		{"member key cannot view team members", testMemberKey, 1, repository.ErrForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := authorizeTeam(tt.actor, tt.teamKey); !errors.Is(err, tt.wantErr) {
+				t.Errorf("authorizeTeam() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestScopeUserQuery(t *testing.T) {
+	tests := []struct {
+		name        string
+		actor       Principal
+		teamKey     *int
+		userKey     string
+		wantTeamKey *int
+		wantUserKey string
+		wantErr     error
+	}{
+		{"admin keeps no condition", testAdmin, nil, "", nil, "", nil},
+		{"admin keeps the condition", testAdminKey, intPtr(2), "U2", intPtr(2), "U2", nil},
+		{"lead is scoped to own team", testLead, nil, "", intPtr(1), "", nil},
+		{"lead may filter own team", testLead, intPtr(1), "U1", intPtr(1), "U1", nil},
+		{"lead cannot filter other team", testLead, intPtr(2), "", nil, "", repository.ErrForbidden},
+		{"lead without team is scoped to themselves", testLeadNoTeam, nil, "", nil, "U7", nil},
+		{"lead key without team is rejected", testLeadKeyNoTeam, nil, "", nil, "", repository.ErrForbidden},
+		{"member is scoped to themselves", testMember, nil, "", nil, "U1", nil},
+		{"member may filter themselves", testMember, nil, "U1", nil, "U1", nil},
+		{"member cannot filter others", testMember, nil, "U2", nil, "", repository.ErrForbidden},
+		{"member key is rejected", testMemberKey, nil, "", nil, "", repository.ErrForbidden},
+		{"member key without team is rejected", testMemberKeyNone, nil, "", nil, "", repository.ErrForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			teamKey, userKey, err := scopeUserQuery(tt.actor, tt.teamKey, tt.userKey)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("scopeUserQuery() error = %v, want %v", err, tt.wantErr)
+			}
+			if (teamKey == nil) != (tt.wantTeamKey == nil) || (teamKey != nil && *teamKey != *tt.wantTeamKey) {
+				t.Errorf("scopeUserQuery() team_key = %v, want %v", teamKey, tt.wantTeamKey)
+			}
+			if userKey != tt.wantUserKey {
+				t.Errorf("scopeUserQuery() user_key = %q, want %q", userKey, tt.wantUserKey)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package usecase
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"strconv"
@@ -14,88 +15,599 @@ import (
 
 // ConversationUsecase は会話に関するユースケースを提供します
 type ConversationUsecase struct {
-	repo          *repository.Repository
-	slackTokenBot string
+	repo       *repository.Repository
+	workspaces *SlackWorkspaces // ワークスペースごとのトークンとレート制限
+	// 差分取り込みのたびに取得し直して、Slack で削除されたメッセージを探す直近の期間（0 なら探さない）
+	reconcileWindow time.Duration
+	// 人の活動とみなすメッセージの方針（集計と同じもの）
+	policy repository.ActivityPolicy
+	// メッセージに投稿者の表示名を付けるためのユーザー一覧
+	users *UserDirectory
+	// 投稿者やメンションを仮名にするかどうかと、本文を本人以外に返すかどうか
+	privacy PrivacyPolicy
+	// 保持期限を過ぎたメッセージや本文を取り込み直さないための保持日数
+	retention RetentionPolicy
 }
 
 // 初期化関数
-func NewConversationUsecase(repo *repository.Repository, slackTokenBot string) *ConversationUsecase {
+func NewConversationUsecase(repo *repository.Repository, workspaces *SlackWorkspaces, reconcileWindow time.Duration, policy repository.ActivityPolicy, users *UserDirectory, privacy PrivacyPolicy, retention RetentionPolicy) *ConversationUsecase {
 	return &ConversationUsecase{
-		repo:          repo,
-		slackTokenBot: slackTokenBot,
+		repo:            repo,
+		workspaces:      workspaces,
+		reconcileWindow: reconcileWindow,
+		policy:          policy,
+		users:           users,
+		privacy:         privacy,
+		retention:       retention,
 	}
 }
 
-// InitializeChannelConversations は指定したチャンネルの会話履歴の初期化を行います
-func (u *ConversationUsecase) InitializeChannelConversations(channelID string) ([]repository.SlackConversation, error) {
-	api := slack.New(u.slackTokenBot)
-	allMessages := []slack.Message{}
-	allConversations := []repository.SlackConversation{}
+// メッセージ一覧のページサイズ
+const (
+	DefaultMessagesLimit = 100
+	MaxMessagesLimit     = 1000
+)
+
+// MessageQuery は保存済みメッセージの検索条件です
+// Oldest / Latest は Slack ts（例: "1601055549.000100"）、RFC3339、または "2006-01-02" 形式で指定します
+type MessageQuery struct {
+	UserKey        string
+	Oldest         string
+	Latest         string
+	Cursor         string
+	Limit          int // 0 の場合は DefaultMessagesLimit
+	IncludeDeleted bool
+	HumanOnly      bool // true の場合は人の活動とみなすメッセージのみ（集計と同じ方針）
+}
+
+// SyncOptions は会話履歴の取り込み方法の指定です
+type SyncOptions struct {
+	// Window が空の場合は、前回の差分取り込みの続きから最新までを取り込みます
+	// 指定した場合は、その期間だけを新しい順に取り込みます（バックフィル）
+	Window repository.SyncWindow
+	// Checkpoint は中断した期間指定の取り込みで保存済みの最も古い ts です
+	// 指定すると、その ts より新しいメッセージは取り込み済みとして続きから再開します
+	Checkpoint string
+	// OnCheckpoint は期間指定の取り込みでページを保存するたびに、保存済みの最も古い ts を渡して呼ばれます
+	OnCheckpoint func(ts string) error
+}
+
+// ParseSyncWindow は取り込む期間の指定を正規化済みの Slack ts に変換します
+// oldest / latest は Slack ts、RFC3339、または "2006-01-02" 形式で指定します
+func ParseSyncWindow(oldest string, latest string) (repository.SyncWindow, error) {
+	var window repository.SyncWindow
+	var err error
+	if window.Oldest, err = ParseTimeBound(oldest); err != nil {
+		return repository.SyncWindow{}, fmt.Errorf("%w: oldest: %v", repository.ErrInvalid, err)
+	}
+	if window.Latest, err = ParseTimeBound(latest); err != nil {
+		return repository.SyncWindow{}, fmt.Errorf("%w: latest: %v", repository.ErrInvalid, err)
+	}
+	if window.Oldest != "" && window.Latest != "" && window.Oldest >= window.Latest {
+		return repository.SyncWindow{}, fmt.Errorf("%w: oldest must be before latest", repository.ErrInvalid)
+	}
+	return window, nil
+}
 
-	// チャンネルにボットを参加させる
-	_, _, _, err := api.JoinConversation(channelID)
+// SyncChannel は指定チームのチャンネルの会話履歴を Slack から取り込み、DBに保存します
+// 期間を指定しない場合は前回の差分取り込みより新しいものだけを取得し、
+// 期間を指定した場合はその期間のメッセージを取得します。保存した件数を返します
+// Slack へはチームのワークスペースのボットトークンでアクセスします
+// 取得済みのメッセージ数を progress で通知します
+func (u *ConversationUsecase) SyncChannel(teamID int, opts SyncOptions, progress ProgressFunc) (int, error) {
+	// 追跡対象のチームのみ取り込む
+	team, err := u.repo.GetTeamByID(teamID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get team: %w", err)
+	}
+	if err := requireTrackedTeam(team); err != nil {
+		return 0, err
+	}
+	channelID := team.ChannelID
+
+	api, limits, _, err := u.workspaces.BotClient(team.WorkspaceID)
+	if err != nil {
+		return 0, err
+	}
+
+	// チャンネルにボットを参加させる（conversations.join は Tier 3）
+	err = callSlack(limits.Tier3, func() error {
+		_, _, _, err := api.JoinConversation(channelID)
+		return err
+	})
 	if err != nil {
 		if strings.Contains(err.Error(), "missing_scope") {
 			log.Printf("スコープが不足しています: %v", err)
-			return nil, fmt.Errorf("missing required scope: %w", err)
+			return 0, fmt.Errorf("missing required scope: %w", err)
 		}
 		log.Printf("チャンネルへの参加に失敗しました: %v", err)
-		return nil, fmt.Errorf("failed to join channel: %w", err)
+		return 0, fmt.Errorf("failed to join channel: %w", err)
+	}
+
+	if opts.Window.IsZero() {
+		return u.syncChannelIncremental(api, limits, team, progress)
+	}
+	return u.syncChannelWindow(api, limits, team, opts, progress)
+}
+
+// syncChannelIncremental は前回の差分取り込みより新しいメッセージを取り込みます
+// reconcileWindow が設定されている場合は直近の期間も取得し直し、編集を反映して削除されたメッセージを論理削除します
+func (u *ConversationUsecase) syncChannelIncremental(api *slack.Client, limits *SlackRateLimits, team repository.Team, progress ProgressFunc) (int, error) {
+	allMessages := []slack.Message{}
+	now := time.Now()
+
+	// 前回の差分取り込みより新しいものだけを取得する（oldest は含まない）
+	// 期間指定の取り込みで保存したメッセージは位置に影響しない
+	syncedTS, err := u.repo.GetChannelSyncedTS(team.ChannelID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get channel sync state: %w", err)
+	}
+
+	oldest, reconcileFrom := syncedTS, ""
+	if u.reconcileWindow > 0 {
+		reconcileFrom = ToSlackTS(now.Add(-u.reconcileWindow))
+		if oldest != "" && reconcileFrom < oldest {
+			oldest = reconcileFrom
+		}
 	}
 
 	historyParams := slack.GetConversationHistoryParameters{
-		ChannelID: channelID,
+		ChannelID: team.ChannelID,
+		Oldest:    oldest,
 		Limit:     1000,
 	}
 
+	err = fetchHistory(limits, api, &historyParams, func(messages []slack.Message) error {
+		allMessages = append(allMessages, messages...)
+		progress.report(len(allMessages), 0)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	conversations := toConversations(team.ChannelID, allMessages)
+
+	// ページの途中で失敗した場合に古いメッセージが欠けないよう、すべて取得してからまとめて保存する
+	if err := u.repo.SaveMessages(team.ID, conversations, u.retention.Cutoffs(time.Now())); err != nil {
+		return 0, fmt.Errorf("failed to save messages: %w", err)
+	}
+	if len(allMessages) > 0 {
+		// conversations.history は新しい順に返すので、先頭が最新のメッセージ
+		if err := u.repo.SaveChannelSyncedTS(team.ChannelID, allMessages[0].Timestamp); err != nil {
+			return 0, fmt.Errorf("failed to save channel sync state: %w", err)
+		}
+	}
+
+	// 取得し直した期間にあるのに Slack から返ってこなかったメッセージは削除されている
+	if reconcileFrom != "" {
+		present := []string{}
+		for _, message := range allMessages {
+			if message.Timestamp >= reconcileFrom {
+				present = append(present, message.Timestamp)
+			}
+		}
+		deleted, err := u.repo.MarkMissingMessagesDeleted(team.ChannelID, reconcileFrom, ToSlackTS(now), present)
+		if err != nil {
+			return 0, fmt.Errorf("failed to reconcile deleted messages: %w", err)
+		}
+		if deleted > 0 {
+			log.Printf("チャンネル %s で削除された %d 件のメッセージを反映しました", team.ChannelID, deleted)
+		}
+	}
+
+	return len(conversations), nil
+}
+
+// syncChannelWindow は指定された期間のメッセージを新しい順に取り込みます
+// ページごとに保存してチェックポイントを記録するので、中断しても続きから再開できます
+func (u *ConversationUsecase) syncChannelWindow(api *slack.Client, limits *SlackRateLimits, team repository.Team, opts SyncOptions, progress ProgressFunc) (int, error) {
+	latest := opts.Window.Latest
+	if opts.Checkpoint != "" {
+		latest = opts.Checkpoint
+	}
+
+	historyParams := slack.GetConversationHistoryParameters{
+		ChannelID: team.ChannelID,
+		Oldest:    opts.Window.Oldest,
+		Latest:    latest,
+		Inclusive: false, // latest は含まない（チェックポイントの ts は保存済み）
+		Limit:     1000,
+	}
+
+	saved := 0
+	err := fetchHistory(limits, api, &historyParams, func(messages []slack.Message) error {
+		if len(messages) == 0 {
+			return nil
+		}
+		if err := u.repo.SaveMessages(team.ID, toConversations(team.ChannelID, messages), u.retention.Cutoffs(time.Now())); err != nil {
+			return fmt.Errorf("failed to save messages: %w", err)
+		}
+		saved += len(messages)
+		progress.report(saved, 0)
+
+		// 新しい順に返るので、末尾がこのページで最も古いメッセージ
+		if opts.OnCheckpoint != nil {
+			if err := opts.OnCheckpoint(messages[len(messages)-1].Timestamp); err != nil {
+				return fmt.Errorf("failed to save checkpoint: %w", err)
+			}
+		}
+		return nil
+	})
+	return saved, err
+}
+
+// fetchHistory は conversations.history を最後のページまで取得し、ページごとに handle を呼び出します
+func fetchHistory(limits *SlackRateLimits, api *slack.Client, params *slack.GetConversationHistoryParameters, handle func([]slack.Message) error) error {
 	for {
-		history, err := api.GetConversationHistory(&historyParams)
+		// conversations.history は Tier 3。並列に同期する他のチャンネルとリミッターを共有する
+		var history *slack.GetConversationHistoryResponse
+		err := callSlack(limits.Tier3, func() (err error) {
+			history, err = api.GetConversationHistory(params)
+			return err
+		})
 		if err != nil {
 			log.Printf("会話履歴の取得に失敗しました: %v", err)
-			return nil, fmt.Errorf("failed to fetch conversation history: %w", err)
+			return fmt.Errorf("failed to fetch conversation history: %w", err)
 		}
 
-		allMessages = append(allMessages, history.Messages...)
+		if err := handle(history.Messages); err != nil {
+			return err
+		}
 		if history.ResponseMetaData.NextCursor == "" {
-			break
+			return nil
 		}
 
-		historyParams.Cursor = history.ResponseMetaData.NextCursor
-		time.Sleep(1200 * time.Millisecond)
+		params.Cursor = history.ResponseMetaData.NextCursor
 	}
+}
 
-	for _, message := range allMessages {
-		ts, err := FormatSlackTimestamp(message.Timestamp)
+// toConversations は Slack のメッセージを保存用の形式に変換します
+func toConversations(channelID string, messages []slack.Message) []repository.SlackConversation {
+	conversations := []repository.SlackConversation{}
+	for _, message := range messages {
+		postedAt, err := ParseSlackTimestamp(message.Timestamp)
 		if err != nil {
 			log.Printf("タイムスタンプのフォーマットに失敗しました: %v", err)
 			continue
 		}
-		allConversations = append(allConversations, repository.SlackConversation{
+		conversation := repository.SlackConversation{
 			ChannelID:   channelID,
 			UserID:      message.User,
 			WorkspaceID: message.Team,
-			Text:        message.Text,
-			Timestamp:   ts,
-		})
+			Text:        ExtractMessageText(message),
+			TS:          message.Timestamp,
+			ThreadTS:    message.ThreadTimestamp,
+			Subtype:     message.SubType,
+			BotID:       message.BotID,
+			PostedAt:    postedAt,
+			ReplyCount:  message.ReplyCount,
+			LatestReply: message.LatestReply,
+		}
+		if message.Edited != nil {
+			if editedAt, err := ParseSlackTimestamp(message.Edited.Timestamp); err == nil {
+				conversation.EditedAt = &editedAt
+			}
+		}
+		conversation.Files = toMessageFiles(message.Files)
+		conversation.Links = ExtractMessageLinks(message)
+		for _, reaction := range message.Reactions {
+			conversation.Reactions = append(conversation.Reactions, repository.MessageReaction{
+				Emoji: reaction.Name,
+				Users: reaction.Users,
+				Count: reaction.Count,
+			})
+		}
+		conversations = append(conversations, conversation)
 	}
+	return conversations
+}
 
-	return allConversations, nil
+// ApplyMessageEdit は Slack の message_changed イベントで通知された編集後のメッセージを保存済みのメッセージに反映します
+// 本文・リンク・共有されたファイルを更新し、editedTS を編集日時として記録します
+// 追跡対象外のチャンネルや、取り込んでいないメッセージ、保持期限を過ぎたメッセージの場合は何もしません
+func (u *ConversationUsecase) ApplyMessageEdit(channelID string, message slack.Message, editedTS string) error {
+	if ok, err := u.isTrackedChannel(channelID); err != nil || !ok {
+		return err
+	}
+	editedAt, err := ParseSlackTimestamp(editedTS)
+	if err != nil {
+		return fmt.Errorf("%w: edited ts: %v", repository.ErrInvalid, err)
+	}
+
+	text, links, files := ExtractMessageText(message), ExtractMessageLinks(message), toMessageFiles(message.Files)
+	if _, err := u.repo.ApplyMessageEdit(channelID, message.Timestamp, text, links, files, editedAt, u.retention.Cutoffs(time.Now())); err != nil {
+		return fmt.Errorf("failed to apply message edit: %w", err)
+	}
+	return nil
+}
+
+// ApplyMessageDeletion は Slack の message_deleted イベントで通知された削除を保存済みのメッセージに反映します
+// メッセージは論理削除し、deletedTS（イベントの発生時刻）を削除日時として記録します
+func (u *ConversationUsecase) ApplyMessageDeletion(channelID string, ts string, deletedTS string) error {
+	if ok, err := u.isTrackedChannel(channelID); err != nil || !ok {
+		return err
+	}
+	deletedAt, err := ParseSlackTimestamp(deletedTS)
+	if err != nil {
+		deletedAt = time.Now()
+	}
+
+	if _, err := u.repo.MarkMessageDeleted(channelID, ts, deletedAt); err != nil {
+		return fmt.Errorf("failed to mark message deleted: %w", err)
+	}
+	return nil
 }
 
+// ApplyReactionAdded は Slack の reaction_added イベントで通知されたリアクションを保存済みのメッセージに反映します
+// reactedTS（イベントの発生時刻）をリアクションした日時として記録します
+// 追跡対象外のチャンネルや、取り込んでいないメッセージの場合は何もしません
+func (u *ConversationUsecase) ApplyReactionAdded(channelID string, ts string, emoji string, userKey string, reactedTS string) error {
+	if ok, err := u.isTrackedChannel(channelID); err != nil || !ok {
+		return err
+	}
+	reactedAt, err := ParseSlackTimestamp(reactedTS)
+	if err != nil {
+		reactedAt = time.Now()
+	}
+
+	if _, err := u.repo.AddMessageReaction(channelID, ts, emoji, userKey, reactedAt); err != nil {
+		return fmt.Errorf("failed to add reaction: %w", err)
+	}
+	return nil
+}
+
+// ApplyReactionRemoved は Slack の reaction_removed イベントで通知されたリアクションの取り消しを反映します
+func (u *ConversationUsecase) ApplyReactionRemoved(channelID string, ts string, emoji string, userKey string) error {
+	if ok, err := u.isTrackedChannel(channelID); err != nil || !ok {
+		return err
+	}
+
+	if _, err := u.repo.RemoveMessageReaction(channelID, ts, emoji, userKey); err != nil {
+		return fmt.Errorf("failed to remove reaction: %w", err)
+	}
+	return nil
+}
+
+// isTrackedChannel は Slack のチャンネルIDが追跡対象のチームのものかどうかを返します
+func (u *ConversationUsecase) isTrackedChannel(channelID string) (bool, error) {
+	team, err := u.repo.GetTeamByChannelID(channelID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get team: %w", err)
+	}
+	return team.IsTracked, nil
+}
+
+// GetChannelMessages は指定チームのチャンネルの保存済みメッセージを新しい順に取得します
+// 各メッセージには投稿者の表示名、チャンネル名、Slack のパーマリンクと、本文のプレーンテキスト・HTML を付けます
+// パーマリンクはインストール時に保存したワークスペースURLで組み立て、Slack にはアクセスしません。次のページがある場合は next_cursor を返します
+// メッセージはユーザーごとの詳細なので、admin はすべてのチーム、lead は自分のチームのメッセージを、それ以外は自分のメッセージだけを取得できます
+// 仮名にする場合は本人以外の投稿者・リアクション・メンションを仮名に置き換え、aggregate の場合は誰でも自分のメッセージだけを取得できます
+func (u *ConversationUsecase) GetChannelMessages(actor Principal, workspaceID int, teamID int, q MessageQuery) ([]repository.SlackConversation, string, error) {
+	team, err := u.repo.GetTeamByID(teamID)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get team: %w", err)
+	}
+	if err := checkWorkspace(workspaceID, team.WorkspaceID, fmt.Sprintf("team %d", teamID)); err != nil {
+		return nil, "", err
+	}
+	if q.UserKey, err = u.privacy.resolveUserKey(u.users, q.UserKey); err != nil {
+		return nil, "", err
+	}
+	if q.UserKey, err = u.privacy.scopeIndividual(actor, q.UserKey, "viewing messages"); err != nil {
+		return nil, "", err
+	}
+	if !actor.IsAdmin() && !actor.leadsTeam(teamID) {
+		if actor.Kind != PrincipalUser {
+			return nil, "", forbidden(actor, fmt.Sprintf("view messages of team %d", teamID))
+		}
+		if q.UserKey != "" && q.UserKey != actor.ID {
+			return nil, "", forbidden(actor, "view messages of user "+q.UserKey)
+		}
+		q.UserKey = actor.ID
+	}
+
+	filter := repository.MessageFilter{
+		ChannelID:      team.ChannelID,
+		UserKey:        q.UserKey,
+		Limit:          q.Limit,
+		IncludeDeleted: q.IncludeDeleted,
+	}
+	if q.HumanOnly {
+		filter.Policy = &u.policy
+	}
+	if filter.Limit == 0 {
+		filter.Limit = DefaultMessagesLimit
+	}
+	if filter.Limit < 1 || filter.Limit > MaxMessagesLimit {
+		return nil, "", fmt.Errorf("%w: limit must be between 1 and %d", repository.ErrInvalid, MaxMessagesLimit)
+	}
+	if filter.Oldest, err = ParseTimeBound(q.Oldest); err != nil {
+		return nil, "", fmt.Errorf("%w: oldest: %v", repository.ErrInvalid, err)
+	}
+	if filter.Latest, err = ParseTimeBound(q.Latest); err != nil {
+		return nil, "", fmt.Errorf("%w: latest: %v", repository.ErrInvalid, err)
+	}
+	if filter.Cursor, err = NormalizeSlackTS(q.Cursor); err != nil {
+		return nil, "", fmt.Errorf("%w: cursor: %v", repository.ErrInvalid, err)
+	}
+
+	messages, nextCursor, err := u.repo.ListMessages(filter)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list messages: %w", err)
+	}
+
+	resolver, err := u.newMessageResolver(team.WorkspaceID)
+	if err != nil {
+		return nil, "", err
+	}
+	workspaceURL := u.getWorkspaceURL(team.WorkspaceID)
+	for i := range messages {
+		m := &messages[i]
+		m.Timestamp = m.PostedAt.In(time.Local).Format(slackTimestampLayout)
+		m.ChannelName = team.ChannelName
+		m.Permalink = buildPermalink(workspaceURL, m.ChannelID, m.TS, m.ThreadTS)
+
+		user, ok, err := u.users.Lookup(m.UserID)
+		if err != nil {
+			return nil, "", err
+		}
+		if ok {
+			m.UserName = user.UserName
+		}
+		if userKey := u.privacy.userKey(actor, m.UserID); userKey != m.UserID {
+			m.UserID, m.UserName = userKey, userKey
+		}
+		for j := range m.Reactions {
+			for k, reactor := range m.Reactions[j].Users {
+				m.Reactions[j].Users[k] = u.privacy.userKey(actor, reactor)
+			}
+		}
+		// メンションを仮名にしてから変換するので、仮名のメンションは仮名のまま表示される
+		m.Text = u.privacy.maskMentions(actor, m.Text)
+
+		rendered := RenderMrkdwn(m.Text, resolver)
+		m.PlainText, m.HTML = rendered.Plain, rendered.HTML
+	}
+
+	return messages, nextCursor, nil
+}
+
+// messageResolver はメッセージ本文のメンションとチャンネルリンクを、保存済みのユーザーとチームで解決します
+type messageResolver struct {
+	users    *UserDirectory
+	channels map[string]string // Slack のチャンネルID → チャンネル名
+}
+
+// newMessageResolver はワークスペースのチーム一覧を読み込んで messageResolver を作ります
+func (u *ConversationUsecase) newMessageResolver(workspaceID int) (messageResolver, error) {
+	teams, err := u.repo.GetAllTeams(workspaceID)
+	if err != nil {
+		return messageResolver{}, fmt.Errorf("failed to get teams: %w", err)
+	}
+	channels := make(map[string]string, len(teams))
+	for _, team := range teams {
+		channels[team.ChannelID] = team.ChannelName
+	}
+	return messageResolver{users: u.users, channels: channels}, nil
+}
+
+func (r messageResolver) UserName(userID string) (string, bool) {
+	user, ok, err := r.users.Lookup(userID)
+	if err != nil || !ok {
+		return "", false
+	}
+	return user.UserName, true
+}
+
+func (r messageResolver) ChannelName(channelID string) (string, bool) {
+	name, ok := r.channels[channelID]
+	return name, ok
+}
+
+// getWorkspaceURL はワークスペースのURL（例: "https://example.slack.com/"）を返します
+// インストール時に auth.test で取得して保存したものを使います。ワークスペースが不明な場合は空文字を返します
+func (u *ConversationUsecase) getWorkspaceURL(workspaceID int) string {
+	if workspaceID == 0 {
+		return ""
+	}
+	workspace, err := u.workspaces.Get(workspaceID)
+	if err != nil {
+		log.Printf("ワークスペースURLの取得に失敗しました: %v", err)
+		return ""
+	}
+	return workspace.URL
+}
+
+// buildPermalink は Slack のメッセージのパーマリンクを組み立てます
+// スレッドの返信の場合はスレッドを開くURLにします。ワークスペースURLが不明な場合は空文字を返します
+func buildPermalink(workspaceURL string, channelID string, ts string, threadTS string) string {
+	if workspaceURL == "" {
+		return ""
+	}
+	permalink := fmt.Sprintf("%s/archives/%s/p%s", strings.TrimSuffix(workspaceURL, "/"), channelID, strings.Replace(ts, ".", "", 1))
+	if threadTS != "" && threadTS != ts {
+		permalink += fmt.Sprintf("?thread_ts=%s&cid=%s", threadTS, channelID)
+	}
+	return permalink
+}
+
+// NormalizeSlackTS は Slack ts を "秒(10桁).マイクロ秒(6桁)" の固定長に揃えます
+// 空文字の場合は空文字を返します
+func NormalizeSlackTS(ts string) (string, error) {
+	if ts == "" {
+		return "", nil
+	}
+
+	seconds, micros, _ := strings.Cut(ts, ".")
+	sec, err := strconv.ParseInt(seconds, 10, 64)
+	if err != nil || sec < 0 {
+		return "", fmt.Errorf("invalid timestamp '%s'", ts)
+	}
+	if len(micros) > 6 {
+		return "", fmt.Errorf("invalid timestamp '%s'", ts)
+	}
+	micros += strings.Repeat("0", 6-len(micros))
+	usec, err := strconv.ParseInt(micros, 10, 64)
+	if err != nil || usec < 0 {
+		return "", fmt.Errorf("invalid timestamp '%s'", ts)
+	}
+
+	return fmt.Sprintf("%010d.%06d", sec, usec), nil
+}
+
+// ParseTimeBound は期間指定の値を正規化済みの Slack ts に変換します
+// Slack ts、RFC3339、"2006-01-02"（ローカルタイムの0時）のいずれかを受け付けます
+func ParseTimeBound(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return ToSlackTS(t), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return ToSlackTS(t), nil
+	}
+	return NormalizeSlackTS(value)
+}
+
+// ToSlackTS は time.Time を正規化済みの Slack ts に変換します
+func ToSlackTS(t time.Time) string {
+	return fmt.Sprintf("%010d.%06d", t.Unix(), t.Nanosecond()/1000)
+}
+
+// slackTimestampLayout は "YYYY/MM/DD hh:mm:ss" (24時間表記) に対応するGoのレイアウトです
+const slackTimestampLayout = "2006/01/02 15:04:05"
+
 // FormatSlackTimestamp は Slack API から取得したタイムスタンプ文字列
 // (例: "1601055549.000100") を受け取り、
 // "YYYY/MM/DD hh:mm:ss" (24時間表記) の文字列にフォーマットします
 // エラーが発生した場合は、0 とエラーを返します。
 func FormatSlackTimestamp(slackTs string) (string, error) {
+	t, err := ParseSlackTimestamp(slackTs)
+	if err != nil {
+		return "0", err
+	}
+
+	// time.Time 型の値を指定したレイアウト文字列でフォーマット
+	return t.Format(slackTimestampLayout), nil
+}
+
+// ParseSlackTimestamp は Slack API から取得したタイムスタンプ文字列
+// (例: "1601055549.000100") を秒単位の time.Time に変換します
+func ParseSlackTimestamp(slackTs string) (time.Time, error) {
 	if slackTs == "" {
-		return "0", fmt.Errorf("input timestamp string is empty")
+		return time.Time{}, fmt.Errorf("input timestamp string is empty")
 	}
 
 	// "." で文字列を分割
 	parts := strings.Split(slackTs, ".")
 	if len(parts) == 0 {
 		// 通常はありえないが念のため
-		return "0", fmt.Errorf("invalid timestamp format: splitting resulted in zero parts for '%s'", slackTs)
+		return time.Time{}, fmt.Errorf("invalid timestamp format: splitting resulted in zero parts for '%s'", slackTs)
 	}
 
 	// 最初の部分（秒の部分）を取得
@@ -107,18 +619,10 @@ func FormatSlackTimestamp(slackTs string) (string, error) {
 	unixTimeSeconds, err := strconv.ParseInt(secondsStr, 10, 64)
 	if err != nil {
 		// 変換に失敗した場合（数字以外の文字が含まれているなど）
-		return "0", fmt.Errorf("failed to parse timestamp '%s' to int64: %v", secondsStr, err)
+		return time.Time{}, fmt.Errorf("failed to parse timestamp '%s' to int64: %v", secondsStr, err)
 	}
 
 	// int64のUnixタイムスタンプ(秒)を time.Time 型に変換
 	// 第2引数はナノ秒部分。秒単位のタイムスタンプなら0でOK
-	t := time.Unix(unixTimeSeconds, 0)
-
-	// time.Time 型の値を指定したレイアウト文字列でフォーマット
-	// "YYYY/MM/DD hh:mm:ss" (24時間表記) に対応するGoのレイアウトは "2006/01/02 15:04:05"
-	formattedTime := t.Format("2006/01/02 15:04:05")
-
-	// 正常に変換できたらUnixタイムスタンプ(秒)を返す
-	// return unixTimeSeconds, nil
-	return formattedTime, nil
+	return time.Unix(unixTimeSeconds, 0), nil
 }
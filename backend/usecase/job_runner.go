@@ -0,0 +1,235 @@
+// backend/usecase/job_runner.go
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"backend/repository"
+)
+
+const (
+	// jobHeartbeatInterval はジョブのハートビート（updated_at の更新）の間隔です
+	jobHeartbeatInterval = 30 * time.Second
+	// JobStaleAfter はハートビートが途絶えたジョブを中断されたとみなすまでの時間です
+	JobStaleAfter = 2 * time.Minute
+	// jobProgressInterval は進捗をDBに書き込む最小間隔です
+	jobProgressInterval = time.Second
+)
+
+// ProgressFunc は同期処理の進捗を通知します。total が不明な場合は 0 を渡します
+type ProgressFunc func(processed int, total int)
+
+// report は f が nil でなければ進捗を通知します
+func (f ProgressFunc) report(processed int, total int) {
+	if f != nil {
+		f(processed, total)
+	}
+}
+
+// JobFunc はジョブの本体です。進捗は progress で通知します
+type JobFunc func(jobID int64, progress ProgressFunc) error
+
+type queuedJob struct {
+	id       int64
+	resource string
+	run      JobFunc
+}
+
+// JobConflictError は同じリソースの同期が既に実行中であることを表します
+// errors.Is(err, repository.ErrConflict) が true になります
+type JobConflictError struct {
+	Resource string
+	Job      *repository.SyncJob // 実行中のジョブ（別プロセスが記録前の場合などは nil）
+}
+
+func (e *JobConflictError) Error() string {
+	if e.Job != nil {
+		return fmt.Sprintf("sync for %s is already in progress (job %d)", e.Resource, e.Job.ID)
+	}
+	return fmt.Sprintf("sync for %s is already in progress", e.Resource)
+}
+
+func (e *JobConflictError) Unwrap() error {
+	return repository.ErrConflict
+}
+
+// JobRunner は同期ジョブをキューに積み、ワーカーで非同期に実行します
+// ジョブの状態と進捗は sync_jobs テーブルに記録されます
+type JobRunner struct {
+	repo  *repository.Repository
+	queue chan queuedJob
+
+	mu    sync.Mutex
+	owned map[int64]struct{} // このプロセスが受け付けた未完了のジョブ（ハートビート対象）
+}
+
+// NewJobRunner は queueSize 件までジョブを積める JobRunner を作成します
+func NewJobRunner(repo *repository.Repository, queueSize int) *JobRunner {
+	return &JobRunner{
+		repo:  repo,
+		queue: make(chan queuedJob, queueSize),
+		owned: map[int64]struct{}{},
+	}
+}
+
+// Start は workers 個のワーカーとハートビートを開始します
+// 開始前に、以前のプロセスで中断されたジョブを failed にします
+func (r *JobRunner) Start(workers int) {
+	if n, err := r.repo.FailStaleSyncJobs(JobStaleAfter); err != nil {
+		log.Printf("Failed to clean up stale sync jobs: %v", err)
+	} else if n > 0 {
+		log.Printf("Marked %d interrupted sync jobs as failed", n)
+	}
+
+	for i := 0; i < workers; i++ {
+		go r.work()
+	}
+	go r.heartbeat()
+}
+
+// Enqueue はジョブを作成してキューに積みます。ジョブはすぐには実行されません
+// 同じリソースのジョブがこのプロセスまたは他のレプリカで未完了の場合は *JobConflictError を返します
+// リソースのロック（Postgres の advisory lock）はワーカーが実行を始めるときに取り、ジョブが終了するまで保持します
+// window は会話履歴を期間指定で取り込むジョブの場合のみ指定し、ジョブと一緒に記録します
+func (r *JobRunner) Enqueue(kind string, resource string, window repository.SyncWindow, run JobFunc) (repository.SyncJob, error) {
+	return r.enqueue(resource, func() (repository.SyncJob, error) {
+		job, err := r.repo.CreateSyncJob(kind, resource, window)
+		if err != nil {
+			return repository.SyncJob{}, fmt.Errorf("failed to create sync job: %w", err)
+		}
+		return job, nil
+	}, run)
+}
+
+// Resume は failed で終了したジョブを同じジョブIDのまま再びキューに積みます
+// 何をやり直すか（成功済みの部分を飛ばすかどうか）は run 側で判断します
+func (r *JobRunner) Resume(job repository.SyncJob, run JobFunc) (repository.SyncJob, error) {
+	return r.enqueue(job.Resource, func() (repository.SyncJob, error) {
+		requeued, err := r.repo.RequeueSyncJob(job.ID)
+		if err != nil {
+			return repository.SyncJob{}, fmt.Errorf("failed to requeue sync job: %w", err)
+		}
+		return requeued, nil
+	}, run)
+}
+
+// enqueue は prepare でジョブを用意し、キューに積みます
+// 重複は sync_jobs の一意制約（リソースごとに未完了のジョブは 1 件まで）で検出します
+func (r *JobRunner) enqueue(resource string, prepare func() (repository.SyncJob, error), run JobFunc) (repository.SyncJob, error) {
+	job, err := prepare()
+	if errors.Is(err, repository.ErrConflict) {
+		// 落ちたレプリカのジョブが未完了のまま残っている場合は failed にしてからやり直す
+		if n, staleErr := r.repo.FailStaleSyncJobs(JobStaleAfter); staleErr == nil && n > 0 {
+			log.Printf("Marked %d interrupted sync jobs as failed", n)
+			job, err = prepare()
+		}
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrConflict) {
+			if active, findErr := r.repo.FindActiveSyncJob(resource); findErr == nil {
+				return repository.SyncJob{}, &JobConflictError{Resource: resource, Job: &active}
+			}
+		}
+		return repository.SyncJob{}, err
+	}
+
+	r.mu.Lock()
+	r.owned[job.ID] = struct{}{}
+	r.mu.Unlock()
+
+	queued := queuedJob{id: job.ID, resource: resource, run: run}
+	select {
+	case r.queue <- queued:
+		return job, nil
+	default:
+		err := fmt.Errorf("job queue is full")
+		r.finish(queued, 0, 0, err)
+		return repository.SyncJob{}, err
+	}
+}
+
+func (r *JobRunner) work() {
+	for job := range r.queue {
+		r.execute(job)
+	}
+}
+
+func (r *JobRunner) execute(job queuedJob) {
+	// 一括同期ジョブがチャンネル単位のロックを持っている場合などは、解放されるまで待つ
+	lock, err := r.repo.LockResource(job.resource)
+	if err != nil {
+		r.finish(job, 0, 0, fmt.Errorf("failed to lock %s: %w", job.resource, err))
+		return
+	}
+	defer lock.Release()
+
+	if err := r.repo.StartSyncJob(job.id); err != nil {
+		r.finish(job, 0, 0, fmt.Errorf("failed to start job: %w", err))
+		return
+	}
+
+	// 進捗の書き込みは jobProgressInterval ごとに間引く
+	var processed, total int
+	var lastWrite time.Time
+	// ジョブ内で並列に処理する場合もあるため、進捗の更新は排他する
+	var mu sync.Mutex
+	progress := func(p int, t int) {
+		mu.Lock()
+		defer mu.Unlock()
+		processed, total = p, t
+		if time.Since(lastWrite) < jobProgressInterval {
+			return
+		}
+		lastWrite = time.Now()
+		r.repo.UpdateSyncJobProgress(job.id, processed, total)
+	}
+
+	err = runJob(job.id, job.run, progress)
+	if err != nil {
+		log.Printf("Sync job %d failed: %v", job.id, err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	r.finish(job, processed, total, err)
+}
+
+// runJob はジョブを実行し、panic した場合もエラーとして返します
+func runJob(id int64, run JobFunc, progress ProgressFunc) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("job panicked: %v", p)
+		}
+	}()
+	return run(id, progress)
+}
+
+// finish はジョブの終了を記録します。リソースのロックは execute が終了の記録後に解放します
+func (r *JobRunner) finish(job queuedJob, processed int, total int, jobErr error) {
+	r.repo.FinishSyncJob(job.id, processed, total, jobErr)
+
+	r.mu.Lock()
+	delete(r.owned, job.id)
+	r.mu.Unlock()
+}
+
+func (r *JobRunner) heartbeat() {
+	ticker := time.NewTicker(jobHeartbeatInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		r.mu.Lock()
+		ids := make([]int64, 0, len(r.owned))
+		for id := range r.owned {
+			ids = append(ids, id)
+		}
+		r.mu.Unlock()
+
+		if len(ids) > 0 {
+			r.repo.TouchSyncJobs(ids)
+		}
+	}
+}
@@ -0,0 +1,388 @@
+// backend/usecase/job_usecase.go
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+
+	"backend/repository"
+)
+
+// 同期ジョブの種類
+const (
+	JobKindUsersInit       = "users_init"
+	JobKindChannelsInit    = "channels_init"
+	JobKindChannelSync     = "channel_sync"
+	JobKindChannelsSyncAll = "channels_sync_all"
+)
+
+// ワークスペース単位のジョブのリソース名（"workspace:<ID>:" の後に付ける）
+const (
+	usersResource    = "users"
+	channelsResource = "channels"
+	syncAllResource  = "channels:sync"
+)
+
+// JobUsecase は Slack との同期処理をジョブとして開始し、その状態を提供します
+type JobUsecase struct {
+	repo                *repository.Repository
+	runner              *JobRunner
+	slackUsecase        *SlackUsecase
+	conversationUsecase *ConversationUsecase
+	channelWorkers      int // 全チャンネル同期で並列に同期するチャンネル数
+}
+
+func NewJobUsecase(repo *repository.Repository, runner *JobRunner, slackUsecase *SlackUsecase, conversationUsecase *ConversationUsecase, channelWorkers int) *JobUsecase {
+	if channelWorkers < 1 {
+		channelWorkers = 1
+	}
+	return &JobUsecase{
+		repo:                repo,
+		runner:              runner,
+		slackUsecase:        slackUsecase,
+		conversationUsecase: conversationUsecase,
+		channelWorkers:      channelWorkers,
+	}
+}
+
+// 同期ジョブの開始・再開・参照はすべて admin のみ行えます
+// ジョブはワークスペースごとに実行し、他のワークスペースのジョブは存在しないものとして扱います
+
+// StartInitializeUsers はワークスペースのユーザー初期化をジョブとして開始します
+func (u *JobUsecase) StartInitializeUsers(actor Principal, workspaceID int) (repository.SyncJob, error) {
+	if err := authorizeAdmin(actor, "initialize users"); err != nil {
+		return repository.SyncJob{}, fmt.Errorf("StartInitializeUsers: %w", err)
+	}
+	if _, err := u.slackUsecase.workspaces.Get(workspaceID); err != nil {
+		return repository.SyncJob{}, fmt.Errorf("StartInitializeUsers: %w", err)
+	}
+	return u.runner.Enqueue(JobKindUsersInit, workspaceResource(workspaceID, usersResource), repository.SyncWindow{}, u.initializeUsersJob(workspaceID))
+}
+
+// StartInitializeChannels はワークスペースのチャンネル初期化をジョブとして開始します
+func (u *JobUsecase) StartInitializeChannels(actor Principal, workspaceID int) (repository.SyncJob, error) {
+	if err := authorizeAdmin(actor, "initialize channels"); err != nil {
+		return repository.SyncJob{}, fmt.Errorf("StartInitializeChannels: %w", err)
+	}
+	if _, err := u.slackUsecase.workspaces.Get(workspaceID); err != nil {
+		return repository.SyncJob{}, fmt.Errorf("StartInitializeChannels: %w", err)
+	}
+	return u.runner.Enqueue(JobKindChannelsInit, workspaceResource(workspaceID, channelsResource), repository.SyncWindow{}, u.initializeChannelsJob(workspaceID))
+}
+
+// StartChannelSync はチャンネルの会話履歴の取り込みをジョブとして開始します
+// window を指定するとその期間だけを取り込み、空の場合は前回の続きから差分を取り込みます
+// チームが存在しない・追跡対象外の場合はジョブを作らずにエラーを返します
+func (u *JobUsecase) StartChannelSync(actor Principal, workspaceID int, teamID int, window repository.SyncWindow) (repository.SyncJob, error) {
+	if err := authorizeAdmin(actor, "sync channels"); err != nil {
+		return repository.SyncJob{}, fmt.Errorf("StartChannelSync: %w", err)
+	}
+	team, err := u.slackUsecase.getTeam(workspaceID, teamID)
+	if err != nil {
+		return repository.SyncJob{}, fmt.Errorf("StartChannelSync: %w", err)
+	}
+	if err := requireTrackedTeam(team); err != nil {
+		return repository.SyncJob{}, fmt.Errorf("StartChannelSync: %w", err)
+	}
+
+	return u.runner.Enqueue(JobKindChannelSync, channelResource(teamID), window, u.channelSyncJob(teamID, window, ""))
+}
+
+// StartSyncAllChannels はワークスペースの追跡対象のすべてのチャンネルの会話履歴の取り込みをジョブとして開始します
+// チャンネルは channelWorkers 個まで並列に同期し、Slack のレート制限はワークスペース全体で共有します
+// window の扱いは StartChannelSync と同じです
+func (u *JobUsecase) StartSyncAllChannels(actor Principal, workspaceID int, window repository.SyncWindow) (repository.SyncJob, error) {
+	if err := authorizeAdmin(actor, "sync channels"); err != nil {
+		return repository.SyncJob{}, fmt.Errorf("StartSyncAllChannels: %w", err)
+	}
+	if _, err := u.slackUsecase.workspaces.Get(workspaceID); err != nil {
+		return repository.SyncJob{}, fmt.Errorf("StartSyncAllChannels: %w", err)
+	}
+	return u.runner.Enqueue(JobKindChannelsSyncAll, workspaceResource(workspaceID, syncAllResource), window, u.syncAllChannelsJob(workspaceID, window))
+}
+
+// ResumeJob は failed で終了したジョブを同じジョブIDで再開します
+// 全チャンネル同期の場合は、成功済みのチャンネルを飛ばして失敗・未完了のチャンネルだけを同期し直します
+// 期間指定の取り込みは、記録済みのチェックポイントより古いメッセージから続きを取り込みます
+func (u *JobUsecase) ResumeJob(actor Principal, workspaceID int, id int64) (repository.SyncJob, error) {
+	if err := authorizeAdmin(actor, "resume jobs"); err != nil {
+		return repository.SyncJob{}, fmt.Errorf("ResumeJob: %w", err)
+	}
+	// コマンドの強制終了などでハートビートが途絶えたまま残っているジョブも再開できるよう、先に failed にしておく
+	if _, err := u.repo.FailStaleSyncJobs(JobStaleAfter); err != nil {
+		return repository.SyncJob{}, fmt.Errorf("ResumeJob: %w", err)
+	}
+
+	job, jobWorkspaceID, err := u.getJob(workspaceID, id)
+	if err != nil {
+		return repository.SyncJob{}, fmt.Errorf("ResumeJob: %w", err)
+	}
+	if jobWorkspaceID == 0 {
+		// 複数ワークスペース対応前のジョブは選ばれたワークスペースで再開する
+		jobWorkspaceID = workspaceID
+	}
+	if job.Status != repository.JobStatusFailed {
+		return repository.SyncJob{}, fmt.Errorf("ResumeJob: %w: only failed jobs can be resumed (job %d is %s)", repository.ErrConflict, id, job.Status)
+	}
+
+	var run JobFunc
+	switch job.Kind {
+	case JobKindUsersInit:
+		run = u.initializeUsersJob(jobWorkspaceID)
+	case JobKindChannelsInit:
+		run = u.initializeChannelsJob(jobWorkspaceID)
+	case JobKindChannelSync:
+		teamID, err := parseChannelResource(job.Resource)
+		if err != nil {
+			return repository.SyncJob{}, fmt.Errorf("ResumeJob: %w", err)
+		}
+		run = u.channelSyncJob(teamID, job.Window, job.Checkpoint)
+	case JobKindChannelsSyncAll:
+		run = u.syncAllChannelsJob(jobWorkspaceID, job.Window)
+	default:
+		return repository.SyncJob{}, fmt.Errorf("ResumeJob: %w: unknown job kind %s", repository.ErrInvalid, job.Kind)
+	}
+
+	resumed, err := u.runner.Resume(job, run)
+	if err != nil {
+		return repository.SyncJob{}, fmt.Errorf("ResumeJob: %w", err)
+	}
+	return resumed, nil
+}
+
+// GetJob は指定されたIDの同期ジョブを取得します
+func (u *JobUsecase) GetJob(actor Principal, workspaceID int, id int64) (repository.SyncJob, error) {
+	if err := authorizeAdmin(actor, "view jobs"); err != nil {
+		return repository.SyncJob{}, fmt.Errorf("GetJob: %w", err)
+	}
+	job, _, err := u.getJob(workspaceID, id)
+	if err != nil {
+		return repository.SyncJob{}, fmt.Errorf("GetJob: %w", err)
+	}
+	return job, nil
+}
+
+// GetJobChannels は全チャンネル同期ジョブのチャンネルごとの進捗を取得します
+// それ以外のジョブでは空のスライスを返します
+func (u *JobUsecase) GetJobChannels(actor Principal, workspaceID int, id int64) ([]repository.SyncJobChannel, error) {
+	if err := authorizeAdmin(actor, "view jobs"); err != nil {
+		return nil, fmt.Errorf("GetJobChannels: %w", err)
+	}
+	if _, _, err := u.getJob(workspaceID, id); err != nil {
+		return nil, fmt.Errorf("GetJobChannels: %w", err)
+	}
+	channels, err := u.repo.GetSyncJobChannels(id)
+	if err != nil {
+		return nil, fmt.Errorf("GetJobChannels: %w", err)
+	}
+	return channels, nil
+}
+
+// getJob は指定されたIDの同期ジョブと、ジョブのワークスペースを取得します
+// 他のワークスペースのジョブの場合は ErrNotFound を返します。複数ワークスペース対応前のジョブのワークスペースは 0 です
+func (u *JobUsecase) getJob(workspaceID int, id int64) (repository.SyncJob, int, error) {
+	job, err := u.repo.GetSyncJob(id)
+	if err != nil {
+		return repository.SyncJob{}, 0, err
+	}
+	jobWorkspaceID, err := u.jobWorkspaceID(job)
+	if err != nil {
+		return repository.SyncJob{}, 0, err
+	}
+	if jobWorkspaceID != 0 {
+		if err := checkWorkspace(workspaceID, jobWorkspaceID, fmt.Sprintf("job %d", id)); err != nil {
+			return repository.SyncJob{}, 0, err
+		}
+	}
+	return job, jobWorkspaceID, nil
+}
+
+// jobWorkspaceID はジョブのリソース名からジョブのワークスペースを返します
+// チャンネル単位のジョブはチームのワークスペースです
+func (u *JobUsecase) jobWorkspaceID(job repository.SyncJob) (int, error) {
+	if strings.HasPrefix(job.Resource, "channel:") {
+		teamID, err := parseChannelResource(job.Resource)
+		if err != nil {
+			return 0, err
+		}
+		team, err := u.repo.GetTeamByID(teamID)
+		if errors.Is(err, repository.ErrNotFound) {
+			return 0, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to get team %d: %w", teamID, err)
+		}
+		return team.WorkspaceID, nil
+	}
+	return parseWorkspaceResource(job.Resource), nil
+}
+
+func (u *JobUsecase) initializeUsersJob(workspaceID int) JobFunc {
+	return func(_ int64, progress ProgressFunc) error {
+		return u.slackUsecase.InitializeUsers(workspaceID, progress)
+	}
+}
+
+func (u *JobUsecase) initializeChannelsJob(workspaceID int) JobFunc {
+	return func(_ int64, progress ProgressFunc) error {
+		return u.slackUsecase.InitializeChannels(workspaceID, progress)
+	}
+}
+
+func (u *JobUsecase) channelSyncJob(teamID int, window repository.SyncWindow, checkpoint string) JobFunc {
+	return func(jobID int64, progress ProgressFunc) error {
+		opts := SyncOptions{
+			Window:     window,
+			Checkpoint: checkpoint,
+			OnCheckpoint: func(ts string) error {
+				return u.repo.SaveSyncJobCheckpoint(jobID, ts)
+			},
+		}
+		_, err := u.conversationUsecase.SyncChannel(teamID, opts, progress)
+		return err
+	}
+}
+
+func (u *JobUsecase) syncAllChannelsJob(workspaceID int, window repository.SyncWindow) JobFunc {
+	return func(jobID int64, progress ProgressFunc) error {
+		channels, err := u.repo.GetSyncJobChannels(jobID)
+		if err != nil {
+			return fmt.Errorf("failed to get job channels: %w", err)
+		}
+
+		// 初回実行時は追跡対象のチャンネルを登録する。再開時は登録済みのものを使う
+		if len(channels) == 0 {
+			teams, err := u.repo.GetTrackedTeams(workspaceID)
+			if err != nil {
+				return fmt.Errorf("failed to get tracked teams: %w", err)
+			}
+			teamIDs := make([]int, len(teams))
+			for i, team := range teams {
+				teamIDs[i] = team.ID
+			}
+			if err := u.repo.CreateSyncJobChannels(jobID, teamIDs); err != nil {
+				return fmt.Errorf("failed to register job channels: %w", err)
+			}
+			if channels, err = u.repo.GetSyncJobChannels(jobID); err != nil {
+				return fmt.Errorf("failed to get job channels: %w", err)
+			}
+		}
+
+		var pending []repository.SyncJobChannel
+		done := 0
+		for _, ch := range channels {
+			if ch.Status == repository.JobStatusSucceeded {
+				done++
+				continue
+			}
+			pending = append(pending, ch)
+		}
+		total := len(channels)
+		progress.report(done, total)
+
+		// channelWorkers 個のワーカーで pending のチャンネルを同期する
+		var mu sync.Mutex
+		failed := 0
+		queue := make(chan repository.SyncJobChannel)
+		var wg sync.WaitGroup
+		for i := 0; i < u.channelWorkers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for ch := range queue {
+					err := u.syncJobChannel(jobID, ch, window)
+
+					mu.Lock()
+					done++
+					if err != nil {
+						failed++
+					}
+					progress.report(done, total)
+					mu.Unlock()
+				}
+			}()
+		}
+		for _, ch := range pending {
+			queue <- ch
+		}
+		close(queue)
+		wg.Wait()
+
+		if failed > 0 {
+			return fmt.Errorf("%d of %d channels failed to sync", failed, total)
+		}
+		return nil
+	}
+}
+
+// syncJobChannel は全チャンネル同期ジョブの中で 1 チャンネルを同期し、結果を記録します
+// 同じチャンネルを単独で同期するジョブが実行中の場合は失敗として記録し、再開時にやり直します
+func (u *JobUsecase) syncJobChannel(jobID int64, ch repository.SyncJobChannel, window repository.SyncWindow) error {
+	teamID := ch.TeamID
+	resource := channelResource(teamID)
+	lock, acquired, err := u.repo.TryLockResource(resource)
+	if err != nil {
+		err = fmt.Errorf("failed to lock %s: %w", resource, err)
+		u.repo.FinishSyncJobChannel(jobID, teamID, 0, err)
+		return err
+	}
+	if !acquired {
+		err := &JobConflictError{Resource: resource}
+		u.repo.FinishSyncJobChannel(jobID, teamID, 0, err)
+		return err
+	}
+	defer lock.Release()
+
+	u.repo.StartSyncJobChannel(jobID, teamID)
+	opts := SyncOptions{
+		Window:     window,
+		Checkpoint: ch.Checkpoint,
+		OnCheckpoint: func(ts string) error {
+			return u.repo.SaveSyncJobChannelCheckpoint(jobID, teamID, ts)
+		},
+	}
+	synced, err := u.conversationUsecase.SyncChannel(teamID, opts, nil)
+	if err != nil {
+		log.Printf("Failed to sync channel (job: %d, team: %d): %v", jobID, teamID, err)
+	}
+	u.repo.FinishSyncJobChannel(jobID, teamID, synced, err)
+	return err
+}
+
+// workspaceResource はワークスペース単位のジョブのリソース名を返します
+func workspaceResource(workspaceID int, name string) string {
+	return fmt.Sprintf("workspace:%d:%s", workspaceID, name)
+}
+
+// parseWorkspaceResource は workspaceResource で作ったリソース名からワークスペースIDを取り出します
+// 複数ワークスペース対応前のリソース名（"users" など）の場合は 0 を返します
+func parseWorkspaceResource(resource string) int {
+	rest, ok := strings.CutPrefix(resource, "workspace:")
+	if !ok {
+		return 0
+	}
+	id, _, _ := strings.Cut(rest, ":")
+	workspaceID, err := strconv.Atoi(id)
+	if err != nil {
+		return 0
+	}
+	return workspaceID
+}
+
+// channelResource はチャンネル単位のジョブのリソース名を返します
+func channelResource(teamID int) string {
+	return fmt.Sprintf("channel:%d", teamID)
+}
+
+// parseChannelResource は channelResource で作ったリソース名からチームIDを取り出します
+func parseChannelResource(resource string) (int, error) {
+	teamID, err := strconv.Atoi(strings.TrimPrefix(resource, "channel:"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid channel resource %s: %w", resource, err)
+	}
+	return teamID, nil
+}
@@ -0,0 +1,388 @@
+// backend/usecase/mrkdwn.go
+package usecase
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/slack-go/slack"
+)
+
+// MrkdwnResolver は mrkdwn のメンションとチャンネルリンクを名前に解決します
+type MrkdwnResolver interface {
+	UserName(userID string) (string, bool)
+	ChannelName(channelID string) (string, bool)
+}
+
+// RenderedText は mrkdwn を変換した結果です
+type RenderedText struct {
+	Plain string // 分析用のプレーンテキスト（書式の記号を除き、メンションやリンクは名前・ラベルにする）
+	HTML  string // 表示用の HTML（テキストはすべてエスケープし、生成したタグと http(s)/mailto のリンクだけを含む）
+}
+
+var (
+	// <@U123|name>, <#C123|name>, <!here>, <https://example.com|label> などの Slack の特殊な記法
+	mrkdwnTokenPattern = regexp.MustCompile(`<([^<>\n]+)>`)
+	mrkdwnCodePattern  = regexp.MustCompile("`([^`\n]+)`")
+	// 書式の記号は単語の境界にある場合のみ有効（例: 2*3*4 は太字にしない）
+	mrkdwnBoldPattern   = regexp.MustCompile(`(^|[\s(\x00])\*([^*\n]+)\*($|[\s).,!?:;\x00])`)
+	mrkdwnItalicPattern = regexp.MustCompile(`(^|[\s(\x00])_([^_\n]+)_($|[\s).,!?:;\x00])`)
+	mrkdwnStrikePattern = regexp.MustCompile(`(^|[\s(\x00])~([^~\n]+)~($|[\s).,!?:;\x00])`)
+	mrkdwnEmojiPattern  = regexp.MustCompile(`:([a-z0-9_+\-']+):(?::skin-tone-[2-6]:)?`)
+	// プレースホルダー（\x00 番号 \x00）。Slack のテキストに NUL は含まれない
+	mrkdwnPlaceholderPattern = regexp.MustCompile("\x00([0-9]+)\x00")
+)
+
+// mrkdwnEmoji はよく使われる絵文字コードと Unicode の対応です
+// ここにない絵文字（カスタム絵文字を含む）は :name: のまま残します
+var mrkdwnEmoji = map[string]string{
+	"smile": "😄", "smiley": "😃", "grinning": "😀", "laughing": "😆", "joy": "😂", "sweat_smile": "😅",
+	"wink": "😉", "blush": "😊", "slightly_smiling_face": "🙂", "thinking_face": "🤔", "sob": "😭", "cry": "😢",
+	"scream": "😱", "sunglasses": "😎", "+1": "👍", "thumbsup": "👍", "-1": "👎", "thumbsdown": "👎",
+	"ok_hand": "👌", "clap": "👏", "pray": "🙏", "bow": "🙇", "wave": "👋", "raised_hands": "🙌", "muscle": "💪",
+	"eyes": "👀", "heart": "❤️", "tada": "🎉", "fire": "🔥", "rocket": "🚀", "star": "⭐", "sparkles": "✨",
+	"100": "💯", "white_check_mark": "✅", "heavy_check_mark": "✔️", "x": "❌", "warning": "⚠️", "bulb": "💡",
+	"memo": "📝", "question": "❓", "exclamation": "❗", "zap": "⚡", "coffee": "☕", "beer": "🍺",
+}
+
+// RenderMrkdwn は Slack の mrkdwn をプレーンテキストと安全な HTML に変換します
+func RenderMrkdwn(text string, resolver MrkdwnResolver) RenderedText {
+	return RenderedText{
+		Plain: mrkdwnRenderer{resolver: resolver}.render(text),
+		HTML:  mrkdwnRenderer{resolver: resolver, html: true}.render(text),
+	}
+}
+
+type mrkdwnRenderer struct {
+	resolver MrkdwnResolver
+	html     bool
+}
+
+// render は ``` で囲まれた整形済みテキストとそれ以外に分けて変換します
+func (r mrkdwnRenderer) render(text string) string {
+	// NUL はプレースホルダーの区切りに使うので、本文に含まれていた場合は取り除く
+	text = strings.ReplaceAll(text, "\x00", "")
+
+	var out strings.Builder
+	for i, segment := range strings.Split(text, "```") {
+		// 奇数番目が ``` の内側。閉じられていない ``` は通常のテキストとして扱う
+		if i%2 == 1 && i < strings.Count(text, "```") {
+			content := strings.Trim(segment, "\n")
+			if r.html {
+				out.WriteString("<pre>" + r.escape(content) + "</pre>")
+			} else {
+				out.WriteString(r.escape(content) + "\n")
+			}
+			continue
+		}
+		if i%2 == 1 {
+			segment = "```" + segment
+		}
+		if !r.html && i > 0 && i%2 == 0 {
+			// 整形済みテキストの後ろには改行を入れているので、直後の改行は重ねない
+			segment = strings.TrimPrefix(segment, "\n")
+		}
+		out.WriteString(r.lines(segment))
+	}
+	return strings.TrimRight(out.String(), "\n")
+}
+
+// lines は行ごとに引用（"> "）を判定しながら変換します
+func (r mrkdwnRenderer) lines(segment string) string {
+	lines := strings.Split(segment, "\n")
+	rendered := make([]string, 0, len(lines))
+	for _, line := range lines {
+		// Slack のテキストでは > は &gt; にエスケープされている
+		quote, isQuote := strings.CutPrefix(line, "&gt;")
+		if !isQuote {
+			rendered = append(rendered, r.inline(line))
+			continue
+		}
+		quote = strings.TrimPrefix(quote, " ")
+		if r.html {
+			rendered = append(rendered, "<blockquote>"+r.inline(quote)+"</blockquote>")
+		} else {
+			rendered = append(rendered, r.inline(quote))
+		}
+	}
+
+	if !r.html {
+		return strings.Join(rendered, "\n")
+	}
+	// 引用はブロック要素なので、前後に改行タグを入れない
+	var out strings.Builder
+	for i, line := range rendered {
+		if i > 0 && !strings.HasPrefix(line, "<blockquote>") && !strings.HasSuffix(rendered[i-1], "</blockquote>") {
+			out.WriteString("<br>")
+		}
+		out.WriteString(line)
+	}
+	return out.String()
+}
+
+// inline は 1 行の中のコード、特殊な記法、書式、絵文字を変換します
+// コードと特殊な記法は先にプレースホルダーに置き換え、中身に書式が適用されないようにします
+func (r mrkdwnRenderer) inline(line string) string {
+	var placeholders []string
+	hold := func(rendered string) string {
+		placeholders = append(placeholders, rendered)
+		return fmt.Sprintf("\x00%d\x00", len(placeholders)-1)
+	}
+
+	line = mrkdwnCodePattern.ReplaceAllStringFunc(line, func(match string) string {
+		code := r.escape(match[1 : len(match)-1])
+		if r.html {
+			return hold("<code>" + code + "</code>")
+		}
+		return hold(code)
+	})
+	line = mrkdwnTokenPattern.ReplaceAllStringFunc(line, func(match string) string {
+		return hold(r.token(match[1 : len(match)-1]))
+	})
+
+	line = r.escape(line)
+	line = r.emphasis(line, mrkdwnBoldPattern, "strong")
+	line = r.emphasis(line, mrkdwnItalicPattern, "em")
+	line = r.emphasis(line, mrkdwnStrikePattern, "del")
+	line = mrkdwnEmojiPattern.ReplaceAllStringFunc(line, func(match string) string {
+		name := strings.Trim(strings.SplitN(match, "::", 2)[0], ":")
+		if emoji, ok := mrkdwnEmoji[name]; ok {
+			return emoji
+		}
+		return match
+	})
+
+	return mrkdwnPlaceholderPattern.ReplaceAllStringFunc(line, func(match string) string {
+		i, err := strconv.Atoi(match[1 : len(match)-1])
+		if err != nil || i >= len(placeholders) {
+			return ""
+		}
+		return placeholders[i]
+	})
+}
+
+// emphasis は書式の記号で囲まれた部分を HTML のタグにします（プレーンテキストでは記号を取り除きます）
+func (r mrkdwnRenderer) emphasis(line string, pattern *regexp.Regexp, tag string) string {
+	replacement := "${1}${2}${3}"
+	if r.html {
+		replacement = "${1}<" + tag + ">${2}</" + tag + ">${3}"
+	}
+	// 隣り合う書式（*a* *b*）で区切りの文字を共有できないため、変化がなくなるまで繰り返す
+	for {
+		replaced := pattern.ReplaceAllString(line, replacement)
+		if replaced == line {
+			return line
+		}
+		line = replaced
+	}
+}
+
+// token は <...> の記法を変換します
+func (r mrkdwnRenderer) token(token string) string {
+	target, label, hasLabel := strings.Cut(token, "|")
+
+	switch {
+	case strings.HasPrefix(target, "@"):
+		// ユーザーへのメンション
+		userID := target[1:]
+		name, ok := r.resolver.UserName(userID)
+		if !ok {
+			name = label
+			if !hasLabel {
+				name = userID
+			}
+		}
+		return r.mention("@"+name, "mention")
+	case strings.HasPrefix(target, "#"):
+		// チャンネルへのリンク
+		channelID := target[1:]
+		name, ok := r.resolver.ChannelName(channelID)
+		if !ok {
+			name = label
+			if !hasLabel {
+				name = channelID
+			}
+		}
+		return r.mention("#"+name, "channel")
+	case strings.HasPrefix(target, "!"):
+		// <!here>, <!channel>, <!subteam^S123|@group>, <!date^...|fallback> など
+		command := strings.SplitN(target[1:], "^", 2)[0]
+		if hasLabel {
+			return r.mention(label, command)
+		}
+		return r.mention("@"+command, command)
+	default:
+		// URL（ラベルがない場合は URL をそのまま表示する）
+		text := label
+		if !hasLabel {
+			text = strings.TrimPrefix(target, "mailto:")
+		}
+		return r.link(target, text)
+	}
+}
+
+func (r mrkdwnRenderer) mention(text string, class string) string {
+	if !r.html {
+		return r.escape(text)
+	}
+	return `<span class="slack-` + html.EscapeString(class) + `">` + r.escape(text) + `</span>`
+}
+
+// link はリンクを変換します。HTML では http(s) と mailto 以外のスキームはリンクにしません
+func (r mrkdwnRenderer) link(target string, text string) string {
+	if !r.html {
+		return r.escape(text)
+	}
+	url := html.UnescapeString(target)
+	lower := strings.ToLower(url)
+	if !strings.HasPrefix(lower, "http://") && !strings.HasPrefix(lower, "https://") && !strings.HasPrefix(lower, "mailto:") {
+		return r.escape(text)
+	}
+	return `<a href="` + html.EscapeString(url) + `" target="_blank" rel="noopener noreferrer">` + r.escape(text) + `</a>`
+}
+
+// escape は Slack のエスケープ（&amp; &lt; &gt;）を戻し、HTML の場合は改めてエスケープします
+func (r mrkdwnRenderer) escape(text string) string {
+	text = strings.NewReplacer("&lt;", "<", "&gt;", ">", "&amp;", "&").Replace(text)
+	if r.html {
+		return html.EscapeString(text)
+	}
+	return text
+}
+
+// ExtractMessageText はメッセージの本文を mrkdwn で返します
+// text が空のメッセージ（blocks や attachments だけを持つボットの投稿など）は、それらから本文を組み立てます
+func ExtractMessageText(message slack.Message) string {
+	if message.Text != "" {
+		return message.Text
+	}
+
+	var parts []string
+	for _, block := range message.Blocks.BlockSet {
+		if text := blockText(block); text != "" {
+			parts = append(parts, text)
+		}
+	}
+	for _, attachment := range message.Attachments {
+		if text := attachmentText(attachment); text != "" {
+			parts = append(parts, text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+func blockText(block slack.Block) string {
+	switch b := block.(type) {
+	case *slack.SectionBlock:
+		var parts []string
+		if b.Text != nil {
+			parts = append(parts, textObjectText(b.Text))
+		}
+		for _, field := range b.Fields {
+			parts = append(parts, textObjectText(field))
+		}
+		return joinNonEmpty(parts, "\n")
+	case *slack.HeaderBlock:
+		if b.Text != nil {
+			return textObjectText(b.Text)
+		}
+	case *slack.ContextBlock:
+		var parts []string
+		for _, element := range b.ContextElements.Elements {
+			if text, ok := element.(*slack.TextBlockObject); ok {
+				parts = append(parts, textObjectText(text))
+			}
+		}
+		return joinNonEmpty(parts, " ")
+	case *slack.RichTextBlock:
+		var parts []string
+		for _, element := range b.Elements {
+			parts = append(parts, richTextElementText(element))
+		}
+		return joinNonEmpty(parts, "\n")
+	}
+	return ""
+}
+
+// textObjectText は plain_text を mrkdwn として扱えるようにエスケープして返します
+func textObjectText(text *slack.TextBlockObject) string {
+	if text.Type == slack.PlainTextType {
+		return slackEscape(text.Text)
+	}
+	return text.Text
+}
+
+func richTextElementText(element slack.RichTextElement) string {
+	switch e := element.(type) {
+	case *slack.RichTextSection:
+		return richTextSectionText(e.Elements)
+	case *slack.RichTextQuote:
+		lines := strings.Split(richTextSectionText(e.Elements), "\n")
+		for i, line := range lines {
+			lines[i] = "&gt; " + line
+		}
+		return strings.Join(lines, "\n")
+	case *slack.RichTextPreformatted:
+		return "```" + richTextSectionText(e.Elements) + "```"
+	case *slack.RichTextList:
+		var items []string
+		for _, item := range e.Elements {
+			items = append(items, "• "+richTextElementText(item))
+		}
+		return strings.Join(items, "\n")
+	}
+	return ""
+}
+
+func richTextSectionText(elements []slack.RichTextSectionElement) string {
+	var out strings.Builder
+	for _, element := range elements {
+		switch e := element.(type) {
+		case *slack.RichTextSectionTextElement:
+			out.WriteString(slackEscape(e.Text))
+		case *slack.RichTextSectionUserElement:
+			out.WriteString("<@" + e.UserID + ">")
+		case *slack.RichTextSectionChannelElement:
+			out.WriteString("<#" + e.ChannelID + ">")
+		case *slack.RichTextSectionEmojiElement:
+			out.WriteString(":" + e.Name + ":")
+		case *slack.RichTextSectionLinkElement:
+			if e.Text != "" {
+				out.WriteString("<" + e.URL + "|" + slackEscape(e.Text) + ">")
+			} else {
+				out.WriteString("<" + e.URL + ">")
+			}
+		}
+	}
+	return out.String()
+}
+
+func attachmentText(attachment slack.Attachment) string {
+	parts := []string{attachment.Pretext, attachment.Title, attachment.Text}
+	for _, field := range attachment.Fields {
+		parts = append(parts, joinNonEmpty([]string{field.Title, field.Value}, ": "))
+	}
+	text := joinNonEmpty(parts, "\n")
+	if text == "" {
+		text = attachment.Fallback
+	}
+	return text
+}
+
+// slackEscape は Slack と同じように &, <, > をエスケープします
+func slackEscape(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
+
+func joinNonEmpty(parts []string, sep string) string {
+	nonEmpty := parts[:0:0]
+	for _, part := range parts {
+		if part != "" {
+			nonEmpty = append(nonEmpty, part)
+		}
+	}
+	return strings.Join(nonEmpty, sep)
+}
@@ -0,0 +1,228 @@
+// backend/usecase/mrkdwn_test.go
+package usecase
+
+import (
+	"testing"
+
+	"github.com/slack-go/slack"
+)
+
+type fakeMrkdwnResolver struct {
+	users    map[string]string
+	channels map[string]string
+}
+
+func (f fakeMrkdwnResolver) UserName(userID string) (string, bool) {
+	name, ok := f.users[userID]
+	return name, ok
+}
+
+func (f fakeMrkdwnResolver) ChannelName(channelID string) (string, bool) {
+	name, ok := f.channels[channelID]
+	return name, ok
+}
+
+func TestRenderMrkdwn(t *testing.T) {
+	resolver := fakeMrkdwnResolver{
+		users:    map[string]string{"U1": "alice"},
+		channels: map[string]string{"C1": "general"},
+	}
+
+	tests := []struct {
+		name  string
+		text  string
+		plain string
+		html  string
+	}{
+		{
+			name:  "user mention resolved",
+			text:  "hi <@U1>",
+			plain: "hi @alice",
+			html:  `hi <span class="slack-mention">@alice</span>`,
+		},
+		{
+			name:  "user mention falls back to label then id",
+			text:  "<@U2|bob> <@U3>",
+			plain: "@bob @U3",
+			html:  `<span class="slack-mention">@bob</span> <span class="slack-mention">@U3</span>`,
+		},
+		{
+			name:  "channel link",
+			text:  "see <#C1> and <#C2|random>",
+			plain: "see #general and #random",
+			html:  `see <span class="slack-channel">#general</span> and <span class="slack-channel">#random</span>`,
+		},
+		{
+			name:  "special mention",
+			text:  "<!here> <!subteam^S1|@devs>",
+			plain: "@here @devs",
+			html:  `<span class="slack-here">@here</span> <span class="slack-subteam">@devs</span>`,
+		},
+		{
+			name:  "http link with label",
+			text:  "<https://example.com/?a=1&amp;b=2|docs>",
+			plain: "docs",
+			html:  `<a href="https://example.com/?a=1&amp;b=2" target="_blank" rel="noopener noreferrer">docs</a>`,
+		},
+		{
+			name:  "mailto link without label",
+			text:  "<mailto:a@example.com>",
+			plain: "a@example.com",
+			html:  `<a href="mailto:a@example.com" target="_blank" rel="noopener noreferrer">a@example.com</a>`,
+		},
+		{
+			name:  "javascript scheme is not linked",
+			text:  "<javascript:alert(1)|click>",
+			plain: "click",
+			html:  "click",
+		},
+		{
+			name:  "javascript scheme with mixed case is not linked",
+			text:  "<JavaScript:alert(1)>",
+			plain: "JavaScript:alert(1)",
+			html:  "JavaScript:alert(1)",
+		},
+		{
+			name:  "data and relative urls are not linked",
+			text:  "<data:text/html,x|a> </path|b>",
+			plain: "a b",
+			html:  "a b",
+		},
+		{
+			name:  "html is escaped",
+			text:  `&lt;script&gt;alert("x")&lt;/script&gt; &amp; 'q'`,
+			plain: `<script>alert("x")</script> & 'q'`,
+			html:  `&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt; &amp; &#39;q&#39;`,
+		},
+		{
+			name:  "link label is escaped",
+			text:  `<https://example.com|&lt;b&gt;"x">`,
+			plain: `<b>"x"`,
+			html:  `<a href="https://example.com" target="_blank" rel="noopener noreferrer">&lt;b&gt;&#34;x&#34;</a>`,
+		},
+		{
+			name:  "adjacent emphasis",
+			text:  "*a* *b* _c_ ~d~",
+			plain: "a b c d",
+			html:  "<strong>a</strong> <strong>b</strong> <em>c</em> <del>d</del>",
+		},
+		{
+			name:  "nested emphasis",
+			text:  "*bold _italic_ text*",
+			plain: "bold italic text",
+			html:  "<strong>bold <em>italic</em> text</strong>",
+		},
+		{
+			name:  "emphasis markers inside words are kept",
+			text:  "2*3*4 snake_case_name",
+			plain: "2*3*4 snake_case_name",
+			html:  "2*3*4 snake_case_name",
+		},
+		{
+			name:  "inline code is not formatted",
+			text:  "run `*x* <@U1>` now",
+			plain: "run *x* <@U1> now",
+			html:  "run <code>*x* &lt;@U1&gt;</code> now",
+		},
+		{
+			name:  "preformatted block",
+			text:  "before\n```\n*x* &lt;b&gt;\n```\nafter",
+			plain: "before\n*x* <b>\nafter",
+			html:  "before<br><pre>*x* &lt;b&gt;</pre><br>after",
+		},
+		{
+			name:  "unclosed preformatted block is plain text",
+			text:  "a ``` *b*",
+			plain: "a ``` b",
+			html:  "a ``` <strong>b</strong>",
+		},
+		{
+			name:  "quote",
+			text:  "&gt; quoted\nreply",
+			plain: "quoted\nreply",
+			html:  "<blockquote>quoted</blockquote>reply",
+		},
+		{
+			name:  "emoji",
+			text:  ":tada: :custom_emoji: :+1::skin-tone-3:",
+			plain: "🎉 :custom_emoji: 👍",
+			html:  "🎉 :custom_emoji: 👍",
+		},
+		{
+			name:  "nul in text cannot forge placeholders",
+			text:  "x\x000\x00 \x009\x00 <@U1>",
+			plain: "x0 9 @alice",
+			html:  `x0 9 <span class="slack-mention">@alice</span>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := RenderMrkdwn(tt.text, resolver)
+			if got.Plain != tt.plain {
+				t.Errorf("Plain = %q, want %q", got.Plain, tt.plain)
+			}
+			if got.HTML != tt.html {
+				t.Errorf("HTML = %q, want %q", got.HTML, tt.html)
+			}
+		})
+	}
+}
+
+func TestExtractMessageText(t *testing.T) {
+	tests := []struct {
+		name    string
+		message slack.Message
+		want    string
+	}{
+		{
+			name:    "text takes precedence",
+			message: slack.Message{Msg: slack.Msg{Text: "hello", Attachments: []slack.Attachment{{Text: "ignored"}}}},
+			want:    "hello",
+		},
+		{
+			name: "section and header blocks",
+			message: slack.Message{Msg: slack.Msg{Blocks: slack.Blocks{BlockSet: []slack.Block{
+				slack.NewHeaderBlock(slack.NewTextBlockObject(slack.PlainTextType, "Title <1>", false, false)),
+				slack.NewSectionBlock(
+					slack.NewTextBlockObject(slack.MarkdownType, "*body*", false, false),
+					[]*slack.TextBlockObject{slack.NewTextBlockObject(slack.MarkdownType, "field", false, false)},
+					nil,
+				),
+			}}}},
+			want: "Title &lt;1&gt;\n*body*\nfield",
+		},
+		{
+			name: "rich text block",
+			message: slack.Message{Msg: slack.Msg{Blocks: slack.Blocks{BlockSet: []slack.Block{
+				slack.NewRichTextBlock("b1", slack.NewRichTextSection(
+					slack.NewRichTextSectionTextElement("hi ", nil),
+					slack.NewRichTextSectionUserElement("U1", nil),
+					slack.NewRichTextSectionLinkElement("https://example.com", "site", nil),
+				)),
+			}}}},
+			want: "hi <@U1><https://example.com|site>",
+		},
+		{
+			name: "attachments",
+			message: slack.Message{Msg: slack.Msg{Attachments: []slack.Attachment{
+				{Pretext: "pre", Title: "title", Text: "text", Fields: []slack.AttachmentField{{Title: "k", Value: "v"}}},
+				{Fallback: "fallback only"},
+			}}},
+			want: "pre\ntitle\ntext\nk: v\nfallback only",
+		},
+		{
+			name:    "empty message",
+			message: slack.Message{},
+			want:    "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExtractMessageText(tt.message); got != tt.want {
+				t.Errorf("ExtractMessageText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
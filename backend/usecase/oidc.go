@@ -0,0 +1,329 @@
+// backend/usecase/oidc.go
+package usecase
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"backend/repository"
+)
+
+// DefaultOIDCIssuer は Slack の OpenID Connect（Sign in with Slack）の issuer です
+// テストではローカルの OIDC サーバーの URL を設定して差し替えます
+const DefaultOIDCIssuer = "https://slack.com"
+
+// oidcKeysTTL は署名鍵（JWKS）を取得し直すまでの時間です。知らない kid のトークンが来た場合はすぐに取得し直します
+const oidcKeysTTL = time.Hour
+
+// OIDCConfig は OpenID Connect プロバイダーの設定です
+type OIDCConfig struct {
+	Issuer       string // 空の場合は DefaultOIDCIssuer
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string // 認可後に戻る URL（GET /auth/slack/callback）
+	// 指定した場合は、このワークスペース（https://slack.com/team_id）のユーザーだけを受け付ける
+	TeamID string
+}
+
+// OIDCClaims は ID トークンから取り出したユーザーの情報です
+type OIDCClaims struct {
+	UserID string // Slack ユーザーID（users.user_key）
+	TeamID string // Slack ワークスペースID
+	Name   string
+	Email  string
+}
+
+// OIDCProvider は OpenID Connect の認可コードフローで ID トークンを取得・検証します
+// エンドポイントと署名鍵は issuer の /.well-known/openid-configuration から取得します
+type OIDCProvider struct {
+	config     OIDCConfig
+	httpClient *http.Client
+
+	mu            sync.Mutex
+	discovery     *oidcDiscovery
+	keys          map[string]*rsa.PublicKey // kid → 公開鍵
+	keysFetchedAt time.Time
+}
+
+// oidcDiscovery は /.well-known/openid-configuration のうち使う項目です
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+func NewOIDCProvider(config OIDCConfig) *OIDCProvider {
+	if config.Issuer == "" {
+		config.Issuer = DefaultOIDCIssuer
+	}
+	config.Issuer = strings.TrimSuffix(config.Issuer, "/")
+	return &OIDCProvider{
+		config:     config,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// AuthCodeURL はユーザーを送る認可エンドポイントの URL を返します
+func (p *OIDCProvider) AuthCodeURL(state string, nonce string) (string, error) {
+	discovery, err := p.getDiscovery()
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{
+		"response_type": {"code"},
+		"scope":         {"openid profile email"},
+		"client_id":     {p.config.ClientID},
+		"redirect_uri":  {p.config.RedirectURL},
+		"state":         {state},
+		"nonce":         {nonce},
+	}
+	if p.config.TeamID != "" {
+		query.Set("team", p.config.TeamID)
+	}
+
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return discovery.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange は認可コードをトークンエンドポイントで ID トークンと交換し、検証したユーザーの情報を返します
+// nonce は AuthCodeURL に渡した値で、ID トークンの nonce と一致する必要があります
+func (p *OIDCProvider) Exchange(code string, nonce string) (OIDCClaims, error) {
+	discovery, err := p.getDiscovery()
+	if err != nil {
+		return OIDCClaims{}, err
+	}
+
+	response, err := p.httpClient.PostForm(discovery.TokenEndpoint, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"client_id":     {p.config.ClientID},
+		"client_secret": {p.config.ClientSecret},
+		"redirect_uri":  {p.config.RedirectURL},
+	})
+	if err != nil {
+		return OIDCClaims{}, fmt.Errorf("failed to request token: %w", err)
+	}
+	defer response.Body.Close()
+
+	// Slack は失敗時も 200 で {"ok": false, "error": ...} を返す
+	var token struct {
+		OK      *bool  `json:"ok"`
+		Error   string `json:"error"`
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&token); err != nil {
+		return OIDCClaims{}, fmt.Errorf("failed to decode token response: %w", err)
+	}
+	if response.StatusCode != http.StatusOK || (token.OK != nil && !*token.OK) || token.IDToken == "" {
+		return OIDCClaims{}, fmt.Errorf("%w: token exchange failed: %s", repository.ErrUnauthorized, token.Error)
+	}
+
+	return p.verifyIDToken(token.IDToken, nonce)
+}
+
+// idTokenClaims は ID トークンのペイロードのうち使う項目です
+type idTokenClaims struct {
+	Issuer    string          `json:"iss"`
+	Subject   string          `json:"sub"`
+	Audience  json.RawMessage `json:"aud"` // 文字列または文字列の配列
+	ExpiresAt int64           `json:"exp"`
+	Nonce     string          `json:"nonce"`
+	Name      string          `json:"name"`
+	Email     string          `json:"email"`
+	UserID    string          `json:"https://slack.com/user_id"`
+	TeamID    string          `json:"https://slack.com/team_id"`
+}
+
+// verifyIDToken は ID トークン（RS256 の JWT）の署名・issuer・audience・有効期限・nonce を検証します
+func (p *OIDCProvider) verifyIDToken(idToken string, nonce string) (OIDCClaims, error) {
+	invalid := func(reason string) (OIDCClaims, error) {
+		return OIDCClaims{}, fmt.Errorf("%w: invalid ID token: %s", repository.ErrUnauthorized, reason)
+	}
+
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return invalid("malformed token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return invalid("malformed header")
+	}
+	if header.Alg != "RS256" {
+		return invalid("unsupported algorithm " + header.Alg)
+	}
+
+	key, err := p.getKey(header.Kid)
+	if err != nil {
+		return OIDCClaims{}, err
+	}
+	if key == nil {
+		return invalid("unknown key " + header.Kid)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return invalid("malformed signature")
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return invalid("signature mismatch")
+	}
+
+	var claims idTokenClaims
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return invalid("malformed payload")
+	}
+	if claims.Issuer != p.config.Issuer {
+		return invalid("unexpected issuer " + claims.Issuer)
+	}
+	if !audienceContains(claims.Audience, p.config.ClientID) {
+		return invalid("unexpected audience")
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return invalid("expired")
+	}
+	if claims.Nonce != nonce {
+		return invalid("nonce mismatch")
+	}
+
+	result := OIDCClaims{
+		UserID: claims.UserID,
+		TeamID: claims.TeamID,
+		Name:   claims.Name,
+		Email:  claims.Email,
+	}
+	// Slack 以外（ローカルの OIDC サーバーなど）では sub を Slack ユーザーIDとして扱う
+	if result.UserID == "" {
+		result.UserID = claims.Subject
+	}
+	if p.config.TeamID != "" && result.TeamID != p.config.TeamID {
+		return OIDCClaims{}, fmt.Errorf("%w: user does not belong to this workspace", repository.ErrForbidden)
+	}
+	return result, nil
+}
+
+// decodeJWTPart は JWT のヘッダーまたはペイロード（base64url の JSON）をデコードします
+func decodeJWTPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// audienceContains は aud（文字列または文字列の配列）に clientID が含まれるかどうかを返します
+func audienceContains(aud json.RawMessage, clientID string) bool {
+	var single string
+	if err := json.Unmarshal(aud, &single); err == nil {
+		return single == clientID
+	}
+	var multiple []string
+	if err := json.Unmarshal(aud, &multiple); err != nil {
+		return false
+	}
+	for _, a := range multiple {
+		if a == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+// getDiscovery は issuer の設定を取得します。取得できた設定はプロセスの間使い回します
+func (p *OIDCProvider) getDiscovery() (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var discovery oidcDiscovery
+	if err := p.getJSON(p.config.Issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, fmt.Errorf("failed to get OpenID configuration: %w", err)
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != p.config.Issuer {
+		return nil, fmt.Errorf("OpenID configuration issuer %s does not match %s", discovery.Issuer, p.config.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("OpenID configuration of %s is incomplete", p.config.Issuer)
+	}
+	p.discovery = &discovery
+	return p.discovery, nil
+}
+
+// getKey は kid の公開鍵を返します。見つからない場合は nil を返します
+// キャッシュにない kid や古いキャッシュの場合は JWKS を取得し直します（鍵のローテーション対応）
+func (p *OIDCProvider) getKey(kid string) (*rsa.PublicKey, error) {
+	discovery, err := p.getDiscovery()
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.keys[kid]; ok && time.Since(p.keysFetchedAt) < oidcKeysTTL {
+		return key, nil
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := p.getJSON(discovery.JWKSURI, &jwks); err != nil {
+		return nil, fmt.Errorf("failed to get JWKS: %w", err)
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, jwk := range jwks.Keys {
+		if jwk.Kty != "RSA" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(jwk.N)
+		e, errE := base64.RawURLEncoding.DecodeString(jwk.E)
+		if errN != nil || errE != nil || len(e) == 0 || len(e) > 4 {
+			continue
+		}
+		keys[jwk.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	p.keys = keys
+	p.keysFetchedAt = time.Now()
+	return p.keys[kid], nil
+}
+
+// getJSON は URL から JSON を取得してデコードします
+func (p *OIDCProvider) getJSON(rawURL string, v interface{}) error {
+	response, err := p.httpClient.Get(rawURL)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: status %d", rawURL, response.StatusCode)
+	}
+	return json.NewDecoder(response.Body).Decode(v)
+}
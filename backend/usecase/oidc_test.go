@@ -0,0 +1,254 @@
+// backend/usecase/oidc_test.go
+package usecase
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"backend/repository"
+)
+
+// testIssuer はテスト用のローカルの OIDC サーバーです（discovery、JWKS、トークンエンドポイント）
+// トークンエンドポイントは、テストで作った ID トークンを認可コードとして受け取り、そのまま返します
+type testIssuer struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	kid    string
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	issuer := &testIssuer{key: key, kid: "test-key"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 issuer.server.URL,
+			"authorization_endpoint": issuer.server.URL + "/authorize",
+			"token_endpoint":         issuer.server.URL + "/token",
+			"jwks_uri":               issuer.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": issuer.kid,
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "id_token": r.PostForm.Get("code")})
+	})
+	issuer.server = httptest.NewServer(mux)
+	t.Cleanup(issuer.server.Close)
+	return issuer
+}
+
+// sign は claims を key で署名した RS256 の ID トークンを返します
+func (i *testIssuer) sign(t *testing.T, key *rsa.PrivateKey, claims map[string]interface{}) string {
+	t.Helper()
+	encode := func(v interface{}) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatalf("failed to marshal: %v", err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signingInput := encode(map[string]string{"alg": "RS256", "kid": i.kid, "typ": "JWT"}) + "." + encode(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestOIDCProviderExchange(t *testing.T) {
+	issuer := newTestIssuer(t)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	const clientID = "client-1"
+	const nonce = "nonce-1"
+	validClaims := func() map[string]interface{} {
+		return map[string]interface{}{
+			"iss":                       issuer.server.URL,
+			"sub":                       "U123",
+			"aud":                       clientID,
+			"exp":                       time.Now().Add(time.Hour).Unix(),
+			"nonce":                     nonce,
+			"name":                      "Alice",
+			"email":                     "alice@example.com",
+			"https://slack.com/team_id": "T1",
+		}
+	}
+
+	tests := []struct {
+		name    string
+		teamID  string // OIDCConfig.TeamID
+		key     *rsa.PrivateKey
+		modify  func(claims map[string]interface{})
+		nonce   string
+		wantErr error
+		want    OIDCClaims
+	}{
+		{
+			name: "valid token",
+			want: OIDCClaims{UserID: "U123", TeamID: "T1", Name: "Alice", Email: "alice@example.com"},
+		},
+		{
+			name:   "slack user id claim takes precedence over sub",
+			modify: func(c map[string]interface{}) { c["https://slack.com/user_id"] = "U999" },
+			want:   OIDCClaims{UserID: "U999", TeamID: "T1", Name: "Alice", Email: "alice@example.com"},
+		},
+		{
+			name:   "audience array containing client id",
+			modify: func(c map[string]interface{}) { c["aud"] = []string{"other", clientID} },
+			want:   OIDCClaims{UserID: "U123", TeamID: "T1", Name: "Alice", Email: "alice@example.com"},
+		},
+		{
+			name:    "signature by another key",
+			key:     otherKey,
+			wantErr: repository.ErrUnauthorized,
+		},
+		{
+			name:    "wrong audience",
+			modify:  func(c map[string]interface{}) { c["aud"] = "other-client" },
+			wantErr: repository.ErrUnauthorized,
+		},
+		{
+			name:    "wrong issuer",
+			modify:  func(c map[string]interface{}) { c["iss"] = "https://evil.example.com" },
+			wantErr: repository.ErrUnauthorized,
+		},
+		{
+			name:    "expired",
+			modify:  func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Minute).Unix() },
+			wantErr: repository.ErrUnauthorized,
+		},
+		{
+			name:    "nonce mismatch",
+			nonce:   "another-nonce",
+			wantErr: repository.ErrUnauthorized,
+		},
+		{
+			name:    "user of another workspace",
+			teamID:  "T2",
+			wantErr: repository.ErrForbidden,
+		},
+		{
+			name:   "user of the configured workspace",
+			teamID: "T1",
+			want:   OIDCClaims{UserID: "U123", TeamID: "T1", Name: "Alice", Email: "alice@example.com"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := NewOIDCProvider(OIDCConfig{
+				Issuer:      issuer.server.URL,
+				ClientID:    clientID,
+				RedirectURL: "http://localhost:8080/auth/slack/callback",
+				TeamID:      tt.teamID,
+			})
+			claims := validClaims()
+			if tt.modify != nil {
+				tt.modify(claims)
+			}
+			key := tt.key
+			if key == nil {
+				key = issuer.key
+			}
+			requestNonce := tt.nonce
+			if requestNonce == "" {
+				requestNonce = nonce
+			}
+
+			got, err := provider.Exchange(issuer.sign(t, key, claims), requestNonce)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Exchange() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Exchange() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Exchange() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOIDCProviderMalformedToken(t *testing.T) {
+	issuer := newTestIssuer(t)
+	provider := NewOIDCProvider(OIDCConfig{Issuer: issuer.server.URL, ClientID: "client-1"})
+
+	for _, token := range []string{"", "not-a-jwt", "a.b.c", base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + ".e30."} {
+		if _, err := provider.Exchange(token, "nonce"); !errors.Is(err, repository.ErrUnauthorized) {
+			t.Errorf("Exchange(%q) error = %v, want %v", token, err, repository.ErrUnauthorized)
+		}
+	}
+}
+
+func TestOIDCProviderAuthCodeURL(t *testing.T) {
+	issuer := newTestIssuer(t)
+	provider := NewOIDCProvider(OIDCConfig{
+		Issuer:      issuer.server.URL + "/",
+		ClientID:    "client-1",
+		RedirectURL: "http://localhost:8080/auth/slack/callback",
+		TeamID:      "T1",
+	})
+
+	authURL, err := provider.AuthCodeURL("state-1", "nonce-1")
+	if err != nil {
+		t.Fatalf("AuthCodeURL() error = %v", err)
+	}
+	if !strings.HasPrefix(authURL, issuer.server.URL+"/authorize?") {
+		t.Fatalf("AuthCodeURL() = %s, want the authorization endpoint", authURL)
+	}
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("failed to parse %s: %v", authURL, err)
+	}
+	query := parsed.Query()
+	for name, want := range map[string]string{
+		"response_type": "code",
+		"client_id":     "client-1",
+		"redirect_uri":  "http://localhost:8080/auth/slack/callback",
+		"state":         "state-1",
+		"nonce":         "nonce-1",
+		"team":          "T1",
+	} {
+		if got := query.Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+// backend/usecase/personal_data.go
+package usecase
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+
+	"backend/repository"
+)
+
+// authorizePersonalData は個人データの開示・消去をしてよいかどうかを確認します（本人と admin のみ）
+func authorizePersonalData(actor Principal, user repository.User, action string) error {
+	if actor.IsAdmin() || actor.IsSelf(user.UserKey) {
+		return nil
+	}
+	return forbidden(actor, action+" of user "+user.UserKey)
+}
+
+// PersonalDataExport は開示する個人データです。WriteZip で種類ごとの JSON ファイルにまとめた ZIP を書き出します
+type PersonalDataExport struct {
+	data repository.PersonalData
+}
+
+// ExportPersonalData はユーザーについて保存しているすべてのデータを読み込みます（本人と admin のみ）
+// 開示請求に応えるためのものなので、プライバシーレベルに関わらず user_key・ユーザー名・メッセージ本文をそのまま含めます
+// レスポンスを書き始める前にエラーを返せるよう、読み込みと ZIP の書き出し（WriteZip）を分けています
+func (u *SlackUsecase) ExportPersonalData(actor Principal, workspaceID int, id int) (*PersonalDataExport, error) {
+	user, err := u.getUser(workspaceID, id)
+	if err != nil {
+		return nil, fmt.Errorf("ExportPersonalData: failed to get user from repository: %w", err)
+	}
+	if err := authorizePersonalData(actor, user, "export personal data"); err != nil {
+		return nil, fmt.Errorf("ExportPersonalData: %w", err)
+	}
+
+	data, err := u.repo.GetPersonalData(id)
+	if err != nil {
+		return nil, fmt.Errorf("ExportPersonalData: failed to get personal data from repository (id: %d): %w", id, err)
+	}
+
+	log.Printf("ユーザー %d の個人データを開示しました（%s %s、メッセージ %d 件、リアクション %d 件、在席状況 %d 件）",
+		id, actor.Kind, actor.ID, len(data.Messages), len(data.Reactions), len(data.Presence))
+	return &PersonalDataExport{data: data}, nil
+}
+
+// WriteZip は個人データを種類ごとの JSON ファイルにまとめた ZIP を w に書き出します
+// ZIP 全体をメモリに持たず、ファイルごとに書き出します
+func (e *PersonalDataExport) WriteZip(w io.Writer) error {
+	data := e.data
+	files := []struct {
+		name    string
+		content interface{}
+	}{
+		{"profile.json", map[string]interface{}{"user": data.Profile, "assignments": data.Assignments}},
+		{"memberships.json", data.Memberships},
+		{"messages.json", data.Messages},
+		{"reactions.json", data.Reactions},
+		{"edits.json", data.Edits},
+		{"files.json", data.Files},
+		{"links.json", data.Links},
+		{"presence.json", data.Presence},
+	}
+
+	archive := zip.NewWriter(w)
+	for _, file := range files {
+		fw, err := archive.Create(file.name)
+		if err != nil {
+			return fmt.Errorf("WriteZip: failed to add %s: %w", file.name, err)
+		}
+		encoder := json.NewEncoder(fw)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.content); err != nil {
+			return fmt.Errorf("WriteZip: failed to write %s: %w", file.name, err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return fmt.Errorf("WriteZip: failed to finish archive: %w", err)
+	}
+	return nil
+}
+
+// ErasePersonalData はユーザーの個人データを消去し、消去の記録を返します（本人と admin のみ）
+// ユーザーの行は user_key を鍵付きハッシュに置き換えて匿名化し、追跡から除外した状態で残すので、以降の同期で取り込み直すことはありません
+func (u *SlackUsecase) ErasePersonalData(actor Principal, workspaceID int, id int) (repository.DataErasure, error) {
+	user, err := u.getUser(workspaceID, id)
+	if err != nil {
+		return repository.DataErasure{}, fmt.Errorf("ErasePersonalData: failed to get user from repository: %w", err)
+	}
+	if err := authorizePersonalData(actor, user, "erase personal data"); err != nil {
+		return repository.DataErasure{}, fmt.Errorf("ErasePersonalData: %w", err)
+	}
+
+	// 記録に消去したユーザーの user_key が残らないよう、本人による消去は "self" と記録する
+	requestedBy := "self"
+	if !actor.IsSelf(user.UserKey) {
+		requestedBy = actor.Kind + ":" + actor.ID
+	}
+	erasure, err := u.repo.EraseUserData(id, requestedBy)
+	if err != nil {
+		return repository.DataErasure{}, fmt.Errorf("ErasePersonalData: failed to erase personal data in repository (id: %d): %w", id, err)
+	}
+	u.users.Invalidate()
+	log.Printf("ユーザー %d の個人データを消去しました（記録 %d、メッセージ %d 件、リアクション %d 件、在席状況 %d 件）",
+		id, erasure.ID, erasure.Messages, erasure.Reactions, erasure.PresenceSamples)
+	return erasure, nil
+}
@@ -0,0 +1,161 @@
+// backend/usecase/privacy.go
+package usecase
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"backend/repository"
+)
+
+// プライバシーレベル
+// full はそのまま返し、pseudonymized は user_key とユーザー名を仮名（ハッシュ化した固定のID）に置き換えます
+// aggregate は pseudonymized に加えて、個人の活動（メッセージ本文、ユーザーごとの集計）を本人以外に返さず、
+// 集計では人数が最小グループサイズに満たない行を返しません（k-匿名性）
+const (
+	PrivacyFull          = "full"
+	PrivacyPseudonymized = "pseudonymized"
+	PrivacyAggregate     = "aggregate"
+)
+
+// PrivacyLevels は有効なプライバシーレベルの一覧です
+var PrivacyLevels = map[string]bool{
+	PrivacyFull:          true,
+	PrivacyPseudonymized: true,
+	PrivacyAggregate:     true,
+}
+
+// DefaultMinGroupSize は aggregate で返す集計の行の最小人数の既定値です
+const DefaultMinGroupSize = 5
+
+// pseudonymPrefix は仮名の接頭辞です。Slack のユーザーID（U や W で始まる）と区別できるようにします
+const pseudonymPrefix = "p_"
+
+// PrivacyPolicy は API のレスポンスで個人をどこまで識別できるようにするかの設定です
+// 仮名は salt をキーにした HMAC なので、salt が同じなら再起動後も同じユーザーには同じ仮名が付きます
+// 本人のデータとサーバー内部の処理（SystemPrincipal）には適用しません
+type PrivacyPolicy struct {
+	Level        string `json:"level"`
+	MinGroupSize int    `json:"min_group_size"` // aggregate の場合のみ使う
+	salt         []byte
+}
+
+// NewPrivacyPolicy はプライバシーの設定を作ります
+// level が空の場合は full、minGroupSize が 0 以下の場合は DefaultMinGroupSize を使います
+func NewPrivacyPolicy(level string, minGroupSize int, salt []byte) (PrivacyPolicy, error) {
+	if level == "" {
+		level = PrivacyFull
+	}
+	if !PrivacyLevels[level] {
+		return PrivacyPolicy{}, fmt.Errorf("privacy level must be one of full, pseudonymized, aggregate: %s", level)
+	}
+	if level != PrivacyFull && len(salt) == 0 {
+		return PrivacyPolicy{}, fmt.Errorf("salt is required for privacy level %s", level)
+	}
+	if minGroupSize <= 0 {
+		minGroupSize = DefaultMinGroupSize
+	}
+	return PrivacyPolicy{Level: level, MinGroupSize: minGroupSize, salt: salt}, nil
+}
+
+// Pseudonymized は user_key とユーザー名を仮名に置き換えるかどうかを返します
+func (p PrivacyPolicy) Pseudonymized() bool {
+	return p.Level == PrivacyPseudonymized || p.Level == PrivacyAggregate
+}
+
+// AggregateOnly は個人の活動を本人以外に返さないかどうかを返します
+func (p PrivacyPolicy) AggregateOnly() bool {
+	return p.Level == PrivacyAggregate
+}
+
+// Pseudonym は user_key の仮名（例: "p_3f2a9c0d1e4b5a67"）を返します
+func (p PrivacyPolicy) Pseudonym(userKey string) string {
+	mac := hmac.New(sha256.New, p.salt)
+	mac.Write([]byte(userKey))
+	return pseudonymPrefix + hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// exempt は主体に userKey のユーザーを実名で見せてよいかどうかを返します
+func (p PrivacyPolicy) exempt(actor Principal, userKey string) bool {
+	return !p.Pseudonymized() || actor.Kind == PrincipalSystem || actor.IsSelf(userKey)
+}
+
+// userKey は主体に見せる userKey を返します
+func (p PrivacyPolicy) userKey(actor Principal, userKey string) string {
+	if userKey == "" || p.exempt(actor, userKey) {
+		return userKey
+	}
+	return p.Pseudonym(userKey)
+}
+
+// maskUser はユーザーの user_key とユーザー名を仮名に置き換えます
+func (p PrivacyPolicy) maskUser(actor Principal, user repository.User) repository.User {
+	if p.exempt(actor, user.UserKey) {
+		return user
+	}
+	user.UserKey = p.Pseudonym(user.UserKey)
+	user.UserName = user.UserKey
+	return user
+}
+
+// resolveUserKey は条件に指定された仮名を user_key に戻します
+// 仮名でない値はそのまま返し、どのユーザーの仮名でもない場合は ErrNotFound を返します
+func (p PrivacyPolicy) resolveUserKey(users *UserDirectory, userKey string) (string, error) {
+	if !p.Pseudonymized() || !strings.HasPrefix(userKey, pseudonymPrefix) {
+		return userKey, nil
+	}
+	user, ok, err := users.LookupPseudonym(userKey)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", fmt.Errorf("%w: no user found with pseudonym %s", repository.ErrNotFound, userKey)
+	}
+	return user.UserKey, nil
+}
+
+// authorizeIndividual は aggregate の場合に、主体が userKey のユーザーの活動を見てよいかどうかを確認します
+// 個人の活動は本人だけが見られます
+func (p PrivacyPolicy) authorizeIndividual(actor Principal, userKey string, action string) error {
+	if !p.AggregateOnly() || actor.Kind == PrincipalSystem || (userKey != "" && actor.IsSelf(userKey)) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s is not available with privacy level %s", repository.ErrForbidden, action, p.Level)
+}
+
+// scopeIndividual は aggregate の場合に、個人の活動の一覧（メッセージなど）の条件を本人に絞り込みます
+// 本人以外のユーザーを指定した場合や、ログインしたユーザーでない主体の場合は ErrForbidden を返します
+func (p PrivacyPolicy) scopeIndividual(actor Principal, userKey string, action string) (string, error) {
+	if !p.AggregateOnly() || actor.Kind == PrincipalSystem {
+		return userKey, nil
+	}
+	if actor.Kind == PrincipalUser && (userKey == "" || userKey == actor.ID) {
+		return actor.ID, nil
+	}
+	return "", p.authorizeIndividual(actor, userKey, action)
+}
+
+// suppressed は aggregate の場合に、users 人の行を返さないかどうかを返します
+// 本人だけに絞り込んだ集計（self が true）は人数に関わらず返します
+func (p PrivacyPolicy) suppressed(users int, self bool) bool {
+	return p.AggregateOnly() && !self && users < p.MinGroupSize
+}
+
+// mentionPattern は mrkdwn のユーザーへのメンション（<@U123> または <@U123|name>）です
+var mentionPattern = regexp.MustCompile(`<@([A-Z0-9]+)(?:\|[^<>\n]*)?>`)
+
+// maskMentions は mrkdwn のユーザーへのメンションを仮名に置き換えます
+// 表示名のラベルも除くので、変換後のメンションは仮名で表示されます
+func (p PrivacyPolicy) maskMentions(actor Principal, text string) string {
+	if !p.Pseudonymized() {
+		return text
+	}
+	return mentionPattern.ReplaceAllStringFunc(text, func(mention string) string {
+		userKey := mentionPattern.FindStringSubmatch(mention)[1]
+		return "<@" + p.userKey(actor, userKey) + ">"
+	})
+}
@@ -0,0 +1,159 @@
+// backend/usecase/privacy_test.go
+package usecase
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"backend/repository"
+)
+
+func testPrivacyPolicy(t *testing.T, level string) PrivacyPolicy {
+	t.Helper()
+	policy, err := NewPrivacyPolicy(level, 3, []byte("salt"))
+	if err != nil {
+		t.Fatalf("NewPrivacyPolicy(%s) error = %v", level, err)
+	}
+	return policy
+}
+
+func TestNewPrivacyPolicy(t *testing.T) {
+	if _, err := NewPrivacyPolicy("unknown", 0, []byte("salt")); err == nil {
+		t.Errorf("NewPrivacyPolicy(unknown) error = nil")
+	}
+	if _, err := NewPrivacyPolicy(PrivacyPseudonymized, 0, nil); err == nil {
+		t.Errorf("NewPrivacyPolicy(pseudonymized) without salt error = nil")
+	}
+	policy, err := NewPrivacyPolicy("", 0, nil)
+	if err != nil || policy.Level != PrivacyFull || policy.MinGroupSize != DefaultMinGroupSize {
+		t.Errorf("NewPrivacyPolicy(\"\") = %+v, %v; want full with the default group size", policy, err)
+	}
+}
+
+func TestPrivacyPolicyMaskUser(t *testing.T) {
+	teamKey := 1
+	user := repository.User{ID: 1, UserKey: "U1", UserName: "alice", TeamKey: 1}
+	admin := Principal{Kind: PrincipalUser, ID: "U9", Role: RoleAdmin}
+	adminKey := Principal{Kind: PrincipalAPIKey, ID: "1", Role: RoleAdmin}
+	lead := Principal{Kind: PrincipalUser, ID: "U8", Role: RoleLead, TeamKey: &teamKey}
+	self := Principal{Kind: PrincipalUser, ID: "U1", Role: RoleMember, TeamKey: &teamKey}
+
+	tests := []struct {
+		name   string
+		level  string
+		actor  Principal
+		masked bool
+	}{
+		{"full shows everyone", PrivacyFull, admin, false},
+		{"pseudonymized masks admin users", PrivacyPseudonymized, admin, true},
+		{"pseudonymized masks admin api keys", PrivacyPseudonymized, adminKey, true},
+		{"pseudonymized masks leads of the team", PrivacyPseudonymized, lead, true},
+		{"pseudonymized shows the user themselves", PrivacyPseudonymized, self, false},
+		{"pseudonymized shows the system", PrivacyPseudonymized, SystemPrincipal, false},
+		{"aggregate masks admin users", PrivacyAggregate, admin, true},
+		{"aggregate shows the user themselves", PrivacyAggregate, self, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := testPrivacyPolicy(t, tt.level)
+			got := policy.maskUser(tt.actor, user)
+			if !tt.masked {
+				if got != user {
+					t.Errorf("maskUser() = %+v, want %+v", got, user)
+				}
+				return
+			}
+			pseudonym := policy.Pseudonym(user.UserKey)
+			if got.UserKey != pseudonym || got.UserName != pseudonym {
+				t.Errorf("maskUser() = %+v, want user_key and user_name %s", got, pseudonym)
+			}
+			if got.ID != user.ID || got.TeamKey != user.TeamKey {
+				t.Errorf("maskUser() = %+v, want the other fields unchanged", got)
+			}
+			if got := policy.userKey(tt.actor, user.UserKey); got != pseudonym {
+				t.Errorf("userKey() = %s, want %s", got, pseudonym)
+			}
+		})
+	}
+}
+
+func TestPrivacyPolicyPseudonym(t *testing.T) {
+	policy := testPrivacyPolicy(t, PrivacyPseudonymized)
+	pseudonym := policy.Pseudonym("U1")
+	if !strings.HasPrefix(pseudonym, pseudonymPrefix) || strings.Contains(pseudonym, "U1") {
+		t.Errorf("Pseudonym(U1) = %s", pseudonym)
+	}
+	if policy.Pseudonym("U1") != pseudonym || policy.Pseudonym("U2") == pseudonym {
+		t.Errorf("Pseudonym is not a stable per-user value")
+	}
+	other, _ := NewPrivacyPolicy(PrivacyPseudonymized, 0, []byte("other salt"))
+	if other.Pseudonym("U1") == pseudonym {
+		t.Errorf("Pseudonym does not depend on the salt")
+	}
+}
+
+func TestPrivacyPolicyMaskMentions(t *testing.T) {
+	policy := testPrivacyPolicy(t, PrivacyPseudonymized)
+	admin := Principal{Kind: PrincipalUser, ID: "U9", Role: RoleAdmin}
+	self := Principal{Kind: PrincipalUser, ID: "U1", Role: RoleMember}
+
+	text := "hi <@U1|alice> and <@U2>"
+	want := "hi <@" + policy.Pseudonym("U1") + "> and <@" + policy.Pseudonym("U2") + ">"
+	if got := policy.maskMentions(admin, text); got != want {
+		t.Errorf("maskMentions(admin) = %q, want %q", got, want)
+	}
+	want = "hi <@U1> and <@" + policy.Pseudonym("U2") + ">"
+	if got := policy.maskMentions(self, text); got != want {
+		t.Errorf("maskMentions(self) = %q, want %q", got, want)
+	}
+	if got := testPrivacyPolicy(t, PrivacyFull).maskMentions(admin, text); got != text {
+		t.Errorf("maskMentions(full) = %q, want it unchanged", got)
+	}
+}
+
+func TestPrivacyPolicyIndividual(t *testing.T) {
+	admin := Principal{Kind: PrincipalUser, ID: "U9", Role: RoleAdmin}
+	adminKey := Principal{Kind: PrincipalAPIKey, ID: "1", Role: RoleAdmin}
+	self := Principal{Kind: PrincipalUser, ID: "U1", Role: RoleMember}
+
+	tests := []struct {
+		name    string
+		level   string
+		actor   Principal
+		userKey string
+		want    string
+		wantErr error
+	}{
+		{"pseudonymized keeps the condition", PrivacyPseudonymized, admin, "U1", "U1", nil},
+		{"aggregate rejects admins viewing others", PrivacyAggregate, admin, "U1", "", repository.ErrForbidden},
+		{"aggregate rejects admin api keys", PrivacyAggregate, adminKey, "", "", repository.ErrForbidden},
+		{"aggregate scopes users to themselves", PrivacyAggregate, self, "", "U1", nil},
+		{"aggregate allows the user themselves", PrivacyAggregate, self, "U1", "U1", nil},
+		{"aggregate rejects users viewing others", PrivacyAggregate, self, "U2", "", repository.ErrForbidden},
+		{"aggregate allows the system", PrivacyAggregate, SystemPrincipal, "U2", "U2", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := testPrivacyPolicy(t, tt.level).scopeIndividual(tt.actor, tt.userKey, "messages")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("scopeIndividual() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("scopeIndividual() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrivacyPolicySuppressed(t *testing.T) {
+	aggregate := testPrivacyPolicy(t, PrivacyAggregate)
+	if !aggregate.suppressed(2, false) || aggregate.suppressed(3, false) || aggregate.suppressed(1, true) {
+		t.Errorf("suppressed() does not follow the minimum group size of %d", aggregate.MinGroupSize)
+	}
+	if testPrivacyPolicy(t, PrivacyPseudonymized).suppressed(1, false) {
+		t.Errorf("suppressed() = true for pseudonymized")
+	}
+}
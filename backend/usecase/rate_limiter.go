@@ -0,0 +1,84 @@
+// backend/usecase/rate_limiter.go
+package usecase
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// rateLimitRetries は Slack から 429 (rate_limited) が返ったときに再試行する回数です
+const rateLimitRetries = 3
+
+// RateLimiter は呼び出しの間隔を一定以上に保つ、複数の goroutine で共有できるレートリミッターです
+type RateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// NewRateLimiter は 1 分あたり perMinute 回までに呼び出しを制限する RateLimiter を作成します
+func NewRateLimiter(perMinute int) *RateLimiter {
+	return &RateLimiter{interval: time.Minute / time.Duration(perMinute)}
+}
+
+// Wait は次の呼び出しが許可されるまで待ちます
+func (l *RateLimiter) Wait() {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	wait := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+
+	time.Sleep(wait)
+}
+
+// Pause は d の間、以降の呼び出しを止めます（Retry-After への対応）
+func (l *RateLimiter) Pause(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if resume := time.Now().Add(d); l.next.Before(resume) {
+		l.next = resume
+	}
+}
+
+// SlackRateLimits は Slack Web API のレート制限の Tier ごとのリミッターです
+// https://api.slack.com/apis/rate-limits
+// 同じトークンを使うすべての処理で共有し、並列に同期しても制限を超えないようにします
+type SlackRateLimits struct {
+	Tier2 *RateLimiter // users.list, conversations.list など（20回/分）
+	Tier3 *RateLimiter // conversations.history, conversations.join など（50回/分）
+	Tier4 *RateLimiter // conversations.members など（100回/分）
+}
+
+func NewSlackRateLimits() *SlackRateLimits {
+	return &SlackRateLimits{
+		Tier2: NewRateLimiter(20),
+		Tier3: NewRateLimiter(50),
+		Tier4: NewRateLimiter(100),
+	}
+}
+
+// callSlack は limiter で間隔を空けて call を呼び出します
+// Slack から 429 が返った場合は Retry-After の間リミッターを止め、再試行します
+func callSlack(limiter *RateLimiter, call func() error) error {
+	for attempt := 0; ; attempt++ {
+		limiter.Wait()
+
+		err := call()
+		var rateLimited *slack.RateLimitedError
+		if !errors.As(err, &rateLimited) || attempt >= rateLimitRetries {
+			return err
+		}
+
+		log.Printf("Slack API rate limited, retrying after %s", rateLimited.RetryAfter)
+		limiter.Pause(rateLimited.RetryAfter)
+	}
+}
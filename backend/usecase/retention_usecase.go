@@ -0,0 +1,209 @@
+// backend/usecase/retention_usecase.go
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"backend/repository"
+)
+
+// JobKindRetentionPurge は保持期限を過ぎたデータを削除するジョブの種類です
+const JobKindRetentionPurge = "retention_purge"
+
+// retentionResource は削除ジョブのリソース名です。ワークスペースに関係なくすべてのデータを対象にします
+const retentionResource = "retention"
+
+// 削除の既定値
+const (
+	DefaultRetentionBatchSize     = 1000           // 1 回の DELETE / UPDATE で処理する行数
+	DefaultRetentionPurgeInterval = 24 * time.Hour // 定期的な削除の間隔
+	DefaultRetentionRunsLimit     = 20             // 実行結果の一覧で返す件数
+	MaxRetentionRunsLimit         = 100
+)
+
+// RetentionPolicy はデータの種類ごとの保持日数です。0 の種類は無期限に保持します
+type RetentionPolicy struct {
+	MessageTextDays     int `json:"message_text_days"`     // メッセージ本文（過ぎたら本文だけを消去し、メタデータは残す）
+	MessageMetadataDays int `json:"message_metadata_days"` // メッセージとリアクション・編集履歴・ファイル・リンク
+	PresenceDays        int `json:"presence_days"`         // 在席状況（activity_logs）
+	AggregateDays       int `json:"aggregate_days"`        // 集計（集計 API でこれより前の期間を返さない）
+}
+
+// Enabled はいずれかの種類に保持期限があるかどうかを返します
+func (p RetentionPolicy) Enabled() bool {
+	return p.MessageTextDays > 0 || p.MessageMetadataDays > 0 || p.PresenceDays > 0 || p.AggregateDays > 0
+}
+
+// Cutoffs は now を基準にした種類ごとの保持期限を返します
+func (p RetentionPolicy) Cutoffs(now time.Time) repository.RetentionCutoffs {
+	return repository.RetentionCutoffs{
+		MessageText:     retentionCutoff(now, p.MessageTextDays),
+		MessageMetadata: retentionCutoff(now, p.MessageMetadataDays),
+		PresenceSamples: retentionCutoff(now, p.PresenceDays),
+		Aggregates:      retentionCutoff(now, p.AggregateDays),
+	}
+}
+
+// clampOldest は集計の期間の始まりを、集計の保持期限より前にならないように揃えます
+func (p RetentionPolicy) clampOldest(oldest *time.Time) *time.Time {
+	cutoff := retentionCutoff(time.Now(), p.AggregateDays)
+	if cutoff == nil || (oldest != nil && oldest.After(*cutoff)) {
+		return oldest
+	}
+	return cutoff
+}
+
+// retentionCutoff は now から days 日前の日時を返します。days が 0 以下の場合は nil（無期限）を返します
+func retentionCutoff(now time.Time, days int) *time.Time {
+	if days <= 0 {
+		return nil
+	}
+	cutoff := now.AddDate(0, 0, -days)
+	return &cutoff
+}
+
+// RetentionUsecase は保持期限を過ぎたデータの削除と、その実行結果を提供します
+// 削除は同期と同じジョブとして実行するので、進捗は GET /jobs/:id で確認でき、複数のレプリカで同時に実行されることはありません
+type RetentionUsecase struct {
+	repo      *repository.Repository
+	runner    *JobRunner
+	policy    RetentionPolicy
+	batchSize int
+}
+
+func NewRetentionUsecase(repo *repository.Repository, runner *JobRunner, policy RetentionPolicy, batchSize int) *RetentionUsecase {
+	if batchSize <= 0 {
+		batchSize = DefaultRetentionBatchSize
+	}
+	return &RetentionUsecase{
+		repo:      repo,
+		runner:    runner,
+		policy:    policy,
+		batchSize: batchSize,
+	}
+}
+
+// GetPolicy は保持期間の設定を返します
+func (u *RetentionUsecase) GetPolicy() RetentionPolicy {
+	return u.policy
+}
+
+// StartPurge は保持期限を過ぎたデータの削除をジョブとして開始します（admin のみ）
+// 既に実行中の場合は *JobConflictError を返します
+func (u *RetentionUsecase) StartPurge(actor Principal) (repository.SyncJob, error) {
+	if err := authorizeAdmin(actor, "purge expired data"); err != nil {
+		return repository.SyncJob{}, fmt.Errorf("StartPurge: %w", err)
+	}
+	if !u.policy.Enabled() {
+		return repository.SyncJob{}, fmt.Errorf("StartPurge: %w: no retention period is configured", repository.ErrInvalid)
+	}
+	return u.runner.Enqueue(JobKindRetentionPurge, retentionResource, repository.SyncWindow{}, u.purgeJob())
+}
+
+// ListRuns は削除の実行結果を新しい順に返します（admin のみ）
+func (u *RetentionUsecase) ListRuns(actor Principal, limit int) ([]repository.RetentionRun, error) {
+	if err := authorizeAdmin(actor, "view retention runs"); err != nil {
+		return nil, fmt.Errorf("ListRuns: %w", err)
+	}
+	if limit <= 0 {
+		limit = DefaultRetentionRunsLimit
+	}
+	if limit > MaxRetentionRunsLimit {
+		limit = MaxRetentionRunsLimit
+	}
+	runs, err := u.repo.ListRetentionRuns(limit)
+	if err != nil {
+		return nil, fmt.Errorf("ListRuns: %w", err)
+	}
+	return runs, nil
+}
+
+// StartSchedule は起動時と interval ごとに削除を開始します
+// 他のレプリカで実行中の場合は、その回は何もしません
+func (u *RetentionUsecase) StartSchedule(interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultRetentionPurgeInterval
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			u.startScheduledPurge()
+			<-ticker.C
+		}
+	}()
+}
+
+func (u *RetentionUsecase) startScheduledPurge() {
+	job, err := u.StartPurge(SystemPrincipal)
+	var conflict *JobConflictError
+	switch {
+	case errors.As(err, &conflict):
+		log.Printf("保持期限を過ぎたデータの削除は実行中のためスキップしました: %v", err)
+	case err != nil:
+		log.Printf("Failed to start retention purge: %v", err)
+	default:
+		log.Printf("保持期限を過ぎたデータの削除を開始しました（ジョブ %d）", job.ID)
+	}
+}
+
+// purgeJob は種類ごとに期限切れの行を batchSize 件ずつ削除し、実行結果を記録するジョブを返します
+// 途中で失敗した場合も、それまでに削除した件数とエラーを記録します
+func (u *RetentionUsecase) purgeJob() JobFunc {
+	return func(jobID int64, progress ProgressFunc) error {
+		run := repository.RetentionRun{JobID: &jobID, StartedAt: time.Now()}
+		run.Cutoffs = u.policy.Cutoffs(run.StartedAt)
+
+		err := u.purge(&run, progress)
+		if err != nil {
+			run.Error = err.Error()
+		}
+		run.FinishedAt = time.Now()
+		if _, saveErr := u.repo.SaveRetentionRun(run); saveErr != nil && err == nil {
+			err = fmt.Errorf("failed to save retention run: %w", saveErr)
+		}
+		if err != nil {
+			return err
+		}
+		log.Printf("保持期限を過ぎたデータを削除しました（本文の消去 %d 件、メッセージ %d 件、在席状況 %d 件）",
+			run.TextsCleared, run.MessagesDeleted, run.PresenceDeleted)
+		return nil
+	}
+}
+
+// purge は期限切れの行を削除し、件数を run に記録します
+// 削除するメッセージの本文を消去し直さないよう、メッセージの削除を先に行います
+func (u *RetentionUsecase) purge(run *repository.RetentionRun, progress ProgressFunc) error {
+	steps := []struct {
+		before *time.Time
+		count  *int64
+		purge  func(before time.Time, limit int) (int64, error)
+	}{
+		{run.Cutoffs.MessageMetadata, &run.MessagesDeleted, u.repo.DeleteMessagesBefore},
+		{run.Cutoffs.MessageText, &run.TextsCleared, u.repo.ClearMessageTextBefore},
+		{run.Cutoffs.PresenceSamples, &run.PresenceDeleted, u.repo.DeletePresenceBefore},
+	}
+
+	processed := 0
+	for _, step := range steps {
+		if step.before == nil {
+			continue
+		}
+		for {
+			n, err := step.purge(*step.before, u.batchSize)
+			if err != nil {
+				return err
+			}
+			*step.count += n
+			processed += int(n)
+			progress.report(processed, 0)
+			if n < int64(u.batchSize) {
+				break
+			}
+		}
+	}
+	return nil
+}
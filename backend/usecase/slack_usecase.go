@@ -3,75 +3,108 @@ package usecase
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"backend/repository"
+
+	"github.com/slack-go/slack"
 )
 
 type SlackUsecase struct {
 	repo       *repository.Repository
-	slackTokenUser string
-	slackTokenBot string
+	workspaces *SlackWorkspaces // ワークスペースごとのトークンとレート制限
+	users      *UserDirectory   // ユーザーを変更したらキャッシュを破棄する
+	privacy    PrivacyPolicy    // ユーザー情報のレスポンスを仮名にするかどうか
 }
 
-func NewSlackUsecase(repo *repository.Repository, slackTokenUser string, slackTokenBot string) *SlackUsecase {
+func NewSlackUsecase(repo *repository.Repository, workspaces *SlackWorkspaces, users *UserDirectory, privacy PrivacyPolicy) *SlackUsecase {
 	return &SlackUsecase{
 		repo:       repo,
-		slackTokenUser: slackTokenUser,
-		slackTokenBot: slackTokenBot,
+		workspaces: workspaces,
+		users:      users,
+		privacy:    privacy,
 	}
 }
 
-// InitializeUsers はSlack APIからユーザーリストを取得し、DBに保存します
-func (u *SlackUsecase) InitializeUsers() error {
+// InitializeUsers はSlack APIからワークスペースのユーザーリストを取得し、DBに保存します
+// 保存したユーザー数を progress で通知します
+func (u *SlackUsecase) InitializeUsers(workspaceID int, progress ProgressFunc) error {
+	workspace, err := u.workspaces.Get(workspaceID)
+	if err != nil {
+		return fmt.Errorf("InitializeUsers: %w", err)
+	}
+
 	// Slack APIからユーザーリストを取得
-	users, err := u.fetchSlackUsers()
+	users, err := u.fetchSlackUsers(workspace)
 	if err != nil {
 		return fmt.Errorf("InitializeUsers: failed to fetch slack users: %w", err)
 	}
 
 	// ユーザーをDBに保存
-	for _, slackUser := range users {
+	defer u.users.Invalidate()
+	for i, slackUser := range users {
 		// 表示名が空の場合は実名を使用
 		userName := slackUser.Profile.DisplayName
 		if userName == "" {
 			userName = slackUser.Profile.RealName
 		}
-		
+
 		user := repository.User{
 			UserKey:  slackUser.ID,
 			UserName: userName,
-			Grade:    1,         // 初期値
-			TeamKey:  1,         // 初期値
+			Grade:    1, // 初期値
+			TeamKey:  1, // 初期値（ワークスペースにチームがまだない場合のみ。チームを取り込むと付け替える）
+			// Slackbot は users.list で is_bot が false になるため ID で判定する
+			IsBot:       slackUser.IsBot || slackUser.ID == "USLACKBOT",
+			IsDeleted:   slackUser.Deleted,
+			WorkspaceID: workspace.ID,
 		}
-		
+
 		if err := u.repo.SaveUser(user); err != nil {
+			// Enterprise Grid で複数のワークスペースに属するユーザーは、最初に取り込んだワークスペースにだけ所属させる
+			if errors.Is(err, repository.ErrConflict) {
+				log.Printf("ユーザー %s は別のワークスペースに登録済みのため、ワークスペース %d には取り込みません", slackUser.ID, workspace.ID)
+				progress.report(i+1, len(users))
+				continue
+			}
 			return fmt.Errorf("InitializeUsers: failed to save user %s (%s): %w", userName, slackUser.ID, err)
 		}
+		progress.report(i+1, len(users))
 	}
 
 	return nil
 }
 
-// InitializeChannels は Slack API からチャンネルリストを取得し、フィルタリングしてDBに保存します (新規追加)
-func (u *SlackUsecase) InitializeChannels() error {
+// InitializeChannels は Slack API からワークスペースのチャンネルリストを取得し、フィルタリングしてDBに保存します (新規追加)
+// 処理したチャンネル数を progress で通知します
+func (u *SlackUsecase) InitializeChannels(workspaceID int, progress ProgressFunc) error {
+	workspace, err := u.workspaces.Get(workspaceID)
+	if err != nil {
+		return fmt.Errorf("InitializeChannels: %w", err)
+	}
+
 	// チャンネル一覧を取得
-	channels, err := u.fetchSlackChannels()
+	channels, err := u.fetchSlackChannels(workspace)
 	if err != nil {
 		return fmt.Errorf("InitializeChannels: failed to fetch slack channels: %w", err)
 	}
 
 	// フィルタリングとDBへの保存
-	for _, channel := range channels {
+	for i, channel := range channels {
 		// "develop" または "team" を含むチャンネルのみ保存
 		if strings.Contains(channel.Name, "develop") || strings.Contains(channel.Name, "team") {
 			team := repository.Team{
 				// ID:          teamKey, // DB が SERIAL で自動生成するなら不要
 				ChannelID:   channel.ID,
 				ChannelName: channel.Name,
+				WorkspaceID: workspace.ID,
 			}
 			// SaveTeam メソッドも ID を引数に取らないように修正が必要かも
 			if err := u.repo.SaveTeam(team); err != nil {
@@ -79,46 +112,237 @@ func (u *SlackUsecase) InitializeChannels() error {
 			}
 			// teamKey++ // ID を連番で振る場合
 		}
+		progress.report(i+1, len(channels))
+	}
+
+	// チームより先に取り込んだユーザーの仮のチームを、このワークスペースのチームに付け替える
+	if n, err := u.repo.ReassignForeignTeams(workspace.ID); err != nil {
+		return fmt.Errorf("InitializeChannels: failed to reassign users to teams: %w", err)
+	} else if n > 0 {
+		u.users.Invalidate()
+	}
+
+	// 保存したチームのメンバーシップを conversations.members から同期
+	if err := u.syncAllTeamMemberships(workspace); err != nil {
+		return fmt.Errorf("InitializeChannels: %w", err)
+	}
+	return nil
+}
+
+// SyncTeamMemberships は指定チームのメンバーシップを Slack の conversations.members から同期します（admin のみ）
+// 手動での上書きはそのまま残ります
+func (u *SlackUsecase) SyncTeamMemberships(actor Principal, workspaceID int, teamID int) error {
+	if err := authorizeAdmin(actor, "sync team members"); err != nil {
+		return fmt.Errorf("SyncTeamMemberships: %w", err)
+	}
+	team, err := u.getTeam(workspaceID, teamID)
+	if err != nil {
+		return fmt.Errorf("SyncTeamMemberships: failed to get team %d: %w", teamID, err)
+	}
+	if err := requireTrackedTeam(team); err != nil {
+		return fmt.Errorf("SyncTeamMemberships: %w", err)
+	}
+	workspace, err := u.workspaces.Get(team.WorkspaceID)
+	if err != nil {
+		return fmt.Errorf("SyncTeamMemberships: %w", err)
+	}
+	return u.syncTeamMemberships(workspace, team)
+}
+
+// syncAllTeamMemberships はワークスペースの追跡対象のすべてのチームのメンバーシップを同期します
+func (u *SlackUsecase) syncAllTeamMemberships(workspace repository.Workspace) error {
+	teams, err := u.repo.GetTrackedTeams(workspace.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get teams from repository: %w", err)
+	}
+	for _, team := range teams {
+		if err := u.syncTeamMemberships(workspace, team); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (u *SlackUsecase) syncTeamMemberships(workspace repository.Workspace, team repository.Team) error {
+	memberKeys, err := u.fetchSlackChannelMembers(workspace, team.ChannelID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch members of %s (%s): %w", team.ChannelName, team.ChannelID, err)
+	}
+	if err := u.repo.ReplaceSlackMemberships(team.ID, memberKeys); err != nil {
+		return fmt.Errorf("failed to save memberships of %s (%s): %w", team.ChannelName, team.ChannelID, err)
+	}
+	return nil
+}
+
+// GetTeamMembers は指定チームのメンバー一覧を取得します（admin と、そのチームの lead のみ）
+func (u *SlackUsecase) GetTeamMembers(actor Principal, workspaceID int, teamID int) ([]repository.TeamMember, error) {
+	if err := authorizeTeam(actor, teamID); err != nil {
+		return nil, fmt.Errorf("GetTeamMembers: %w", err)
+	}
+	if _, err := u.getTeam(workspaceID, teamID); err != nil {
+		return nil, fmt.Errorf("GetTeamMembers: %w", err)
+	}
+	members, err := u.repo.GetTeamMembers(teamID)
+	if err != nil {
+		return nil, fmt.Errorf("GetTeamMembers: failed to get members from repository: %w", err)
+	}
+	for i := range members {
+		members[i].User = u.privacy.maskUser(actor, members[i].User)
+	}
+	return members, nil
+}
+
+// GetUserTeams は指定ユーザーが所属するチーム一覧を取得します
+// 見られるユーザーは GetUser と同じです
+func (u *SlackUsecase) GetUserTeams(actor Principal, workspaceID int, userID int) ([]repository.UserTeam, error) {
+	if _, err := u.GetUser(actor, workspaceID, userID); err != nil {
+		return nil, fmt.Errorf("GetUserTeams: %w", err)
+	}
+	teams, err := u.repo.GetUserTeams(userID)
+	if err != nil {
+		return nil, fmt.Errorf("GetUserTeams: failed to get teams from repository: %w", err)
+	}
+	return teams, nil
+}
+
+// GetUserAssignments は指定ユーザーの grade と team_key の所属履歴を取得します
+// 見られるユーザーは GetUser と同じです
+func (u *SlackUsecase) GetUserAssignments(actor Principal, workspaceID int, userID int) ([]repository.UserAssignment, error) {
+	if _, err := u.GetUser(actor, workspaceID, userID); err != nil {
+		return nil, fmt.Errorf("GetUserAssignments: %w", err)
+	}
+	assignments, err := u.repo.GetUserAssignments(userID)
+	if err != nil {
+		return nil, fmt.Errorf("GetUserAssignments: failed to get assignments from repository: %w", err)
+	}
+	for i := range assignments {
+		assignments[i].UserKey = u.privacy.userKey(actor, assignments[i].UserKey)
+	}
+	return assignments, nil
+}
+
+// SetMembershipOverride はメンバーシップを手動で上書きします（admin のみ）
+// excluded が false なら所属させ、true なら Slack 側の所属に関わらず除外します
+func (u *SlackUsecase) SetMembershipOverride(actor Principal, workspaceID int, teamID int, userID int, excluded bool) error {
+	if err := authorizeAdmin(actor, "update team members"); err != nil {
+		return fmt.Errorf("SetMembershipOverride: %w", err)
+	}
+	if err := u.checkMembership(workspaceID, teamID, userID); err != nil {
+		return fmt.Errorf("SetMembershipOverride: %w", err)
+	}
+	if err := u.repo.SaveManualMembership(teamID, userID, excluded); err != nil {
+		return fmt.Errorf("SetMembershipOverride: failed to save membership (team: %d, user: %d): %w", teamID, userID, err)
+	}
+	return nil
+}
+
+// ClearMembershipOverride は手動での上書きを取り消し、Slack 由来の所属に戻します（admin のみ）
+func (u *SlackUsecase) ClearMembershipOverride(actor Principal, workspaceID int, teamID int, userID int) error {
+	if err := authorizeAdmin(actor, "update team members"); err != nil {
+		return fmt.Errorf("ClearMembershipOverride: %w", err)
+	}
+	if err := u.checkMembership(workspaceID, teamID, userID); err != nil {
+		return fmt.Errorf("ClearMembershipOverride: %w", err)
+	}
+	if err := u.repo.DeleteManualMembership(teamID, userID); err != nil {
+		return fmt.Errorf("ClearMembershipOverride: failed to delete membership (team: %d, user: %d): %w", teamID, userID, err)
 	}
 	return nil
 }
 
-// GetAllUsers はDBからすべてのユーザー情報を取得します (変更なし)
-func (u *SlackUsecase) GetAllUsers() ([]repository.User, error) {
-	users, err := u.repo.GetAllUsers()
+// checkMembership はチームとユーザーがどちらもワークスペースのものかどうかを確認します
+func (u *SlackUsecase) checkMembership(workspaceID int, teamID int, userID int) error {
+	if _, err := u.getTeam(workspaceID, teamID); err != nil {
+		return err
+	}
+	user, err := u.repo.GetUserByID(userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user %d: %w", userID, err)
+	}
+	return checkWorkspace(workspaceID, user.WorkspaceID, fmt.Sprintf("user %d", userID))
+}
+
+// ユーザー一覧のページサイズ
+const (
+	DefaultUsersLimit = 100
+	MaxUsersLimit     = 1000
+)
+
+// ListUsers はワークスペースの条件に合うユーザー一覧と総件数をDBから取得します
+// filter.Limit が 0 の場合は DefaultUsersLimit 件返します。範囲外の値は ErrInvalid を返します
+// admin 以外は、lead の場合は自分のチーム、member の場合は自分だけに絞り込みます
+// 仮名にする場合は、実名で探せてしまう q と user_key / user_name での並べ替えは使えません
+func (u *SlackUsecase) ListUsers(actor Principal, workspaceID int, filter repository.UserFilter) ([]repository.User, int, error) {
+	filter.WorkspaceID = workspaceID
+	if _, ok := repository.UserSortColumns[filter.SortField]; !ok {
+		return nil, 0, fmt.Errorf("ListUsers: %w: invalid sort field: %s", repository.ErrInvalid, filter.SortField)
+	}
+	if filter.Limit == 0 {
+		filter.Limit = DefaultUsersLimit
+	}
+	if filter.Limit < 1 || filter.Limit > MaxUsersLimit {
+		return nil, 0, fmt.Errorf("ListUsers: %w: limit must be between 1 and %d", repository.ErrInvalid, MaxUsersLimit)
+	}
+	if filter.Offset < 0 {
+		return nil, 0, fmt.Errorf("ListUsers: %w: offset must not be negative", repository.ErrInvalid)
+	}
+	var err error
+	if filter.TeamKey, filter.UserKey, err = scopeUserQuery(actor, filter.TeamKey, filter.UserKey); err != nil {
+		return nil, 0, fmt.Errorf("ListUsers: %w", err)
+	}
+	if u.privacy.Pseudonymized() && actor.Kind != PrincipalSystem {
+		if filter.Query != "" || filter.SortField == "user_key" || filter.SortField == "user_name" {
+			return nil, 0, fmt.Errorf("%w: q and sorting by user_key or user_name are not available with privacy level %s", repository.ErrInvalid, u.privacy.Level)
+		}
+	}
+
+	users, total, err := u.repo.ListUsers(filter)
 	if err != nil {
 		// Usecase層でもエラーをラップするとトレースしやすい
-		return nil, fmt.Errorf("GetAllUsers: failed to get users from repository: %w", err)
+		return nil, 0, fmt.Errorf("ListUsers: failed to get users from repository: %w", err)
 	}
-	return users, nil
+	for i := range users {
+		users[i] = u.privacy.maskUser(actor, users[i])
+	}
+	return users, total, nil
 }
 
-// GetAllChannels はDBからすべてのチーム（チャンネル）情報を取得します (新規追加)
-func (u *SlackUsecase) GetAllChannels() ([]repository.Team, error) {
-	teams, err := u.repo.GetAllTeams()
+// GetAllChannels はDBからワークスペースのすべてのチーム（チャンネル）情報を取得します (新規追加)
+// trackedOnly が true の場合は追跡対象のチームのみ返します
+func (u *SlackUsecase) GetAllChannels(workspaceID int, trackedOnly bool) ([]repository.Team, error) {
+	var teams []repository.Team
+	var err error
+	if trackedOnly {
+		teams, err = u.repo.GetTrackedTeams(workspaceID)
+	} else {
+		teams, err = u.repo.GetAllTeams(workspaceID)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("GetAllChannels: failed to get teams from repository: %w", err)
 	}
 	return teams, nil
 }
 
-// fetchSlackUsers はSlack APIからユーザーリストを取得します
-func (u *SlackUsecase) fetchSlackUsers() ([]repository.SlackUser, error) {
+// fetchSlackUsers はSlack APIからワークスペースのユーザーリストを取得します
+// ユーザートークンがない場合はボットトークンを使います
+func (u *SlackUsecase) fetchSlackUsers(workspace repository.Workspace) ([]repository.SlackUser, error) {
 	req, err := http.NewRequest("GET", "https://slack.com/api/users.list", nil)
 	if err != nil {
 		return nil, err
 	}
 	
-	req.Header.Add("Authorization", "Bearer "+u.slackTokenUser)
-	
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
+	token := workspace.UserToken
+	if token == "" {
+		token = workspace.BotToken
 	}
-	defer resp.Body.Close()
+	req.Header.Add("Authorization", "Bearer "+token)
 	
-	body, err := io.ReadAll(resp.Body)
+	// users.list は Tier 2
+	var body []byte
+	err = callSlack(u.workspaces.Limits(workspace.ID).Tier2, func() (err error) {
+		body, err = doSlackRequest(req)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -139,29 +363,27 @@ func (u *SlackUsecase) fetchSlackUsers() ([]repository.SlackUser, error) {
 	
 	return result.Users, nil
 }
-
-// fetchSlackChannels はSlack APIからチャンネル一覧を取得します
-func (u *SlackUsecase) fetchSlackChannels() ([]repository.SlackChannel, error) {
+	
+// fetchSlackChannels はSlack APIからワークスペースのチャンネル一覧を取得します
+func (u *SlackUsecase) fetchSlackChannels(workspace repository.Workspace) ([]repository.SlackChannel, error) {
 	req, err := http.NewRequest("GET", "https://slack.com/api/conversations.list", nil)
 	if err != nil {
 		return nil, err
 	}
 	
-	req.Header.Add("Authorization", "Bearer "+u.slackTokenBot)
+	req.Header.Add("Authorization", "Bearer "+workspace.BotToken)
 	
 	// パブリックチャンネルのみ取得
 	q := req.URL.Query()
 	q.Add("types", "public_channel")
 	req.URL.RawQuery = q.Encode()
 	
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	
-	body, err := io.ReadAll(resp.Body)
+	// conversations.list は Tier 2
+	var body []byte
+	err = callSlack(u.workspaces.Limits(workspace.ID).Tier2, func() (err error) {
+		body, err = doSlackRequest(req)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -182,16 +404,82 @@ func (u *SlackUsecase) fetchSlackChannels() ([]repository.SlackChannel, error) {
 	
 	return result.Channels, nil
 }
+	
+// fetchSlackChannelMembers は Slack API (conversations.members) からチャンネルのメンバーのユーザーIDを取得します
+func (u *SlackUsecase) fetchSlackChannelMembers(workspace repository.Workspace, channelID string) ([]string, error) {
+	members := []string{}
+	cursor := ""
+
+	for {
+		req, err := http.NewRequest("GET", "https://slack.com/api/conversations.members", nil)
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Add("Authorization", "Bearer "+workspace.BotToken)
+
+		q := req.URL.Query()
+		q.Add("channel", channelID)
+		q.Add("limit", "1000")
+		if cursor != "" {
+			q.Add("cursor", cursor)
+		}
+		req.URL.RawQuery = q.Encode()
+
+		// conversations.members は Tier 4
+		var body []byte
+		err = callSlack(u.workspaces.Limits(workspace.ID).Tier4, func() (err error) {
+			body, err = doSlackRequest(req)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		var result struct {
+			Ok               bool     `json:"ok"`
+			Error            string   `json:"error"`
+			Members          []string `json:"members"`
+			ResponseMetadata struct {
+				NextCursor string `json:"next_cursor"`
+			} `json:"response_metadata"`
+		}
+
+		if err := json.Unmarshal(body, &result); err != nil {
+			return nil, err
+		}
 
-// UpdateUser は指定されたIDのユーザー情報を更新します (新規追加)
-func (u *SlackUsecase) UpdateUser(id int, user repository.User) error {
-	// ここでビジネスロジック（バリデーションなど）を追加することも可能
+		if !result.Ok {
+			return nil, fmt.Errorf("Slack API error: %s", result.Error)
+		}
 
-	// RepositoryのUpdateUserメソッドを呼び出す
-	err := u.repo.UpdateUser(id, user)
+		members = append(members, result.Members...)
+		if result.ResponseMetadata.NextCursor == "" {
+			break
+		}
+		cursor = result.ResponseMetadata.NextCursor
+	}
+
+	return members, nil
+}
+
+// doSlackRequest は Slack Web API へのリクエストを送り、レスポンスボディを返します
+// 429 Too Many Requests の場合は Retry-After を持つ *slack.RateLimitedError を返します
+func doSlackRequest(req *http.Request) ([]byte, error) {
+	client := &http.Client{}
+	resp, err := client.Do(req)
 	if err != nil {
-		// エラーをラップして返す
-		return fmt.Errorf("failed to update user in repository (id: %d): %w", id, err)
+		return nil, err
 	}
-	return nil
-}
\ No newline at end of file
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		retryAfter, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+		if err != nil {
+			retryAfter = 60
+		}
+		return nil, &slack.RateLimitedError{RetryAfter: time.Duration(retryAfter) * time.Second}
+	}
+
+	return io.ReadAll(resp.Body)
+}
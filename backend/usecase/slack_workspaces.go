@@ -0,0 +1,61 @@
+// backend/usecase/slack_workspaces.go
+package usecase
+
+import (
+	"fmt"
+	"sync"
+
+	"backend/repository"
+
+	"github.com/slack-go/slack"
+)
+
+// SlackWorkspaces はワークスペースごとの Slack のトークンとレート制限を提供します
+// トークンは再インストールで変わるので毎回 DB から読み込み、レート制限はトークン（ワークスペース）単位で共有します
+type SlackWorkspaces struct {
+	repo *repository.Repository
+
+	mu     sync.Mutex
+	limits map[int]*SlackRateLimits // ワークスペースID → リミッター
+}
+
+func NewSlackWorkspaces(repo *repository.Repository) *SlackWorkspaces {
+	return &SlackWorkspaces{
+		repo:   repo,
+		limits: map[int]*SlackRateLimits{},
+	}
+}
+
+// Get は指定されたIDのワークスペースを返します
+// 複数ワークスペース対応前のチームなど、ワークスペースが決まっていない場合（0）は ErrConflict を返します
+func (w *SlackWorkspaces) Get(id int) (repository.Workspace, error) {
+	if id == 0 {
+		return repository.Workspace{}, fmt.Errorf("%w: no workspace is assigned; install the app or set SLACK_API_TOKEN_BOT", repository.ErrConflict)
+	}
+	workspace, err := w.repo.GetWorkspaceByID(id)
+	if err != nil {
+		return repository.Workspace{}, fmt.Errorf("failed to get workspace: %w", err)
+	}
+	return workspace, nil
+}
+
+// Limits はワークスペースのレート制限のリミッターを返します
+func (w *SlackWorkspaces) Limits(id int) *SlackRateLimits {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	limits, ok := w.limits[id]
+	if !ok {
+		limits = NewSlackRateLimits()
+		w.limits[id] = limits
+	}
+	return limits
+}
+
+// BotClient はワークスペースのボットトークンの Slack クライアントとリミッターを返します
+func (w *SlackWorkspaces) BotClient(id int) (*slack.Client, *SlackRateLimits, repository.Workspace, error) {
+	workspace, err := w.Get(id)
+	if err != nil {
+		return nil, nil, repository.Workspace{}, err
+	}
+	return slack.New(workspace.BotToken), w.Limits(id), workspace, nil
+}
@@ -0,0 +1,43 @@
+// backend/usecase/storage_usecase.go
+package usecase
+
+import (
+	"fmt"
+
+	"backend/repository"
+)
+
+// StorageUsecase は保存済みのデータの暗号化と本文の扱いの管理を提供します（admin のみ）
+type StorageUsecase struct {
+	repo *repository.Repository
+}
+
+func NewStorageUsecase(repo *repository.Repository) *StorageUsecase {
+	return &StorageUsecase{repo: repo}
+}
+
+// RewrapStoredValues は保存済みのトークンとメッセージ本文を現在の鍵（先頭の鍵）の暗号化に揃えます
+// 暗号化を有効にしたときと、鍵をローテーションしたときに実行します
+func (u *StorageUsecase) RewrapStoredValues(actor Principal) (repository.EncryptionReport, error) {
+	if err := authorizeAdmin(actor, "re-encrypt stored values"); err != nil {
+		return repository.EncryptionReport{}, fmt.Errorf("RewrapStoredValues: %w", err)
+	}
+	report, err := u.repo.RewrapStoredValues()
+	if err != nil {
+		return report, fmt.Errorf("RewrapStoredValues: %w", err)
+	}
+	return report, nil
+}
+
+// DropMessageText は保存済みのすべてのメッセージの本文を消去し、消去した件数を返します
+// メタデータのみのモード（MESSAGE_TEXT_MODE=metadata）に切り替えたときに実行します
+func (u *StorageUsecase) DropMessageText(actor Principal) (int64, error) {
+	if err := authorizeAdmin(actor, "drop message text"); err != nil {
+		return 0, fmt.Errorf("DropMessageText: %w", err)
+	}
+	dropped, err := u.repo.DropMessageText()
+	if err != nil {
+		return 0, fmt.Errorf("DropMessageText: %w", err)
+	}
+	return dropped, nil
+}
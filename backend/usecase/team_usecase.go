@@ -0,0 +1,96 @@
+// backend/usecase/team_usecase.go
+package usecase
+
+import (
+	"errors"
+	"fmt"
+
+	"backend/repository"
+)
+
+// TeamPatch はチームの部分更新の内容です。nil のフィールドは変更しません
+type TeamPatch struct {
+	ChannelName *string `json:"channel_name"`
+	IsTracked   *bool   `json:"is_tracked"`
+}
+
+// GetChannel は指定されたIDのチーム（チャンネル）情報を取得します
+func (u *SlackUsecase) GetChannel(workspaceID int, id int) (repository.Team, error) {
+	team, err := u.getTeam(workspaceID, id)
+	if err != nil {
+		return repository.Team{}, fmt.Errorf("GetChannel: failed to get team from repository: %w", err)
+	}
+	return team, nil
+}
+
+// ReplaceChannel はチーム名と追跡フラグをまとめて更新します（admin のみ）
+func (u *SlackUsecase) ReplaceChannel(actor Principal, workspaceID int, id int, channelName string, isTracked bool) (repository.Team, error) {
+	return u.PatchChannel(actor, workspaceID, id, TeamPatch{ChannelName: &channelName, IsTracked: &isTracked})
+}
+
+// PatchChannel はチーム情報を部分的に更新し、更新後のチーム情報を返します（admin のみ）
+func (u *SlackUsecase) PatchChannel(actor Principal, workspaceID int, id int, patch TeamPatch) (repository.Team, error) {
+	if err := authorizeAdmin(actor, "update channels"); err != nil {
+		return repository.Team{}, fmt.Errorf("PatchChannel: %w", err)
+	}
+	team, err := u.getTeam(workspaceID, id)
+	if err != nil {
+		return repository.Team{}, fmt.Errorf("PatchChannel: failed to get team from repository: %w", err)
+	}
+
+	if patch.ChannelName != nil {
+		team.ChannelName = *patch.ChannelName
+	}
+	if patch.IsTracked != nil {
+		team.IsTracked = *patch.IsTracked
+	}
+
+	if err := u.repo.UpdateTeam(id, team); err != nil {
+		return repository.Team{}, fmt.Errorf("PatchChannel: failed to update team in repository: %w", err)
+	}
+	return team, nil
+}
+
+// DeleteChannel はチームを削除します（admin のみ）
+// team_key がこのチームを指すユーザーがいる場合は reassignTo で同じワークスペースの移動先のチームを指定する必要があります
+func (u *SlackUsecase) DeleteChannel(actor Principal, workspaceID int, id int, reassignTo *int) error {
+	if err := authorizeAdmin(actor, "delete channels"); err != nil {
+		return fmt.Errorf("DeleteChannel: %w", err)
+	}
+	if _, err := u.getTeam(workspaceID, id); err != nil {
+		return fmt.Errorf("DeleteChannel: %w", err)
+	}
+	if reassignTo != nil {
+		if _, err := u.getTeam(workspaceID, *reassignTo); err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return fmt.Errorf("DeleteChannel: %w: reassign_to %d does not exist", repository.ErrInvalid, *reassignTo)
+			}
+			return fmt.Errorf("DeleteChannel: %w", err)
+		}
+	}
+	if err := u.repo.DeleteTeam(id, reassignTo); err != nil {
+		return fmt.Errorf("DeleteChannel: failed to delete team in repository: %w", err)
+	}
+	return nil
+}
+
+// getTeam は指定されたIDのチームを取得します。他のワークスペースのチームの場合は ErrNotFound を返します
+func (u *SlackUsecase) getTeam(workspaceID int, id int) (repository.Team, error) {
+	team, err := u.repo.GetTeamByID(id)
+	if err != nil {
+		return repository.Team{}, err
+	}
+	if err := checkWorkspace(workspaceID, team.WorkspaceID, fmt.Sprintf("team %d", id)); err != nil {
+		return repository.Team{}, err
+	}
+	return team, nil
+}
+
+// requireTrackedTeam はチームが追跡対象であることを確認します
+// 追跡対象外の場合は ErrConflict を返します
+func requireTrackedTeam(team repository.Team) error {
+	if !team.IsTracked {
+		return fmt.Errorf("%w: channel %s (%s) is not tracked", repository.ErrConflict, team.ChannelName, team.ChannelID)
+	}
+	return nil
+}
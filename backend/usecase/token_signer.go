@@ -0,0 +1,52 @@
+// backend/usecase/token_signer.go
+package usecase
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"backend/repository"
+)
+
+// tokenSigner はサーバーに保存しない値（セッション、ログインやインストールの state）を署名付きのトークンにします
+type tokenSigner struct {
+	secret []byte
+}
+
+// signToken は値を JSON にして署名したトークン（"中身（base64url）.署名（base64url）"）を返します
+func (s tokenSigner) signToken(v interface{}) (string, error) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + s.sign(encoded), nil
+}
+
+// verifyToken は signToken で作ったトークンの署名を検証し、中身を v にデコードします
+// 署名が一致しない場合は ErrUnauthorized を返します。有効期限は呼び出し元で確認します
+func (s tokenSigner) verifyToken(token string, v interface{}) error {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(s.sign(encoded))) {
+		return fmt.Errorf("%w: invalid session", repository.ErrUnauthorized)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return fmt.Errorf("%w: invalid session", repository.ErrUnauthorized)
+	}
+	if err := json.Unmarshal(payload, v); err != nil {
+		return fmt.Errorf("%w: invalid session", repository.ErrUnauthorized)
+	}
+	return nil
+}
+
+// sign は HMAC-SHA256 の署名を base64url で返します
+func (s tokenSigner) sign(encoded string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,116 @@
+// backend/usecase/user_directory.go
+package usecase
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"backend/repository"
+)
+
+// userDirectoryTTL はユーザー一覧のキャッシュを読み込み直すまでの時間です
+// このプロセスでの更新はすぐに反映し、他のレプリカでの更新はこの時間で反映します
+const userDirectoryTTL = 5 * time.Minute
+
+// userDirectoryMissRefreshInterval は見つからなかったユーザーを確認するために読み込み直す最小間隔です
+const userDirectoryMissRefreshInterval = 10 * time.Second
+
+// UserDirectory は Slack ユーザーID（user_key）からユーザーを引くための、メモリ上のユーザー一覧です
+// メッセージにユーザー名を付けるたびに DB を引かずに済むようにします
+type UserDirectory struct {
+	repo    *repository.Repository
+	privacy PrivacyPolicy
+
+	mu          sync.RWMutex
+	byKey       map[string]repository.User
+	byPseudonym map[string]repository.User // 仮名にする場合のみ。仮名 → ユーザー
+	loadedAt    time.Time                  // ゼロ値の場合は次の参照で読み込み直す
+	version     int                        // Invalidate のたびに増やし、読み込み中に破棄されたかどうかの判定に使う
+}
+
+// 仮名にする場合（privacy.Pseudonymized()）は、仮名からユーザーを引けるように読み込み時に仮名を計算しておきます
+func NewUserDirectory(repo *repository.Repository, privacy PrivacyPolicy) *UserDirectory {
+	return &UserDirectory{repo: repo, privacy: privacy}
+}
+
+// Lookup は user_key のユーザーを返します。見つからない場合は ok = false を返します
+func (d *UserDirectory) Lookup(userKey string) (user repository.User, ok bool, err error) {
+	if err := d.ensureLoaded(); err != nil {
+		return repository.User{}, false, err
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	user, ok = d.byKey[userKey]
+	return user, ok, nil
+}
+
+// LookupPseudonym は仮名のユーザーを返します。見つからない場合（仮名にしない場合を含む）は ok = false を返します
+func (d *UserDirectory) LookupPseudonym(pseudonym string) (user repository.User, ok bool, err error) {
+	if err := d.ensureLoaded(); err != nil {
+		return repository.User{}, false, err
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	user, ok = d.byPseudonym[pseudonym]
+	return user, ok, nil
+}
+
+// InvalidateOlderThan はキャッシュが age 以上前に読み込んだものの場合だけ破棄します
+// 見つからなかったユーザーを読み込み直して確認する場合に、DB の読み込みを age に 1 回までに抑えるために使います
+func (d *UserDirectory) InvalidateOlderThan(age time.Duration) {
+	d.mu.Lock()
+	if time.Since(d.loadedAt) >= age {
+		d.loadedAt = time.Time{}
+		d.version++
+	}
+	d.mu.Unlock()
+}
+
+// Invalidate はキャッシュを破棄し、次の参照で読み込み直すようにします
+// ユーザーを追加・更新・削除したときに呼び出します
+func (d *UserDirectory) Invalidate() {
+	d.mu.Lock()
+	d.loadedAt = time.Time{}
+	d.version++
+	d.mu.Unlock()
+}
+
+// ensureLoaded はキャッシュが空または古い場合に DB からユーザー一覧を読み込み直します
+func (d *UserDirectory) ensureLoaded() error {
+	d.mu.RLock()
+	fresh := !d.loadedAt.IsZero() && time.Since(d.loadedAt) < userDirectoryTTL
+	version := d.version
+	d.mu.RUnlock()
+	if fresh {
+		return nil
+	}
+
+	users, err := d.repo.GetAllUsers()
+	if err != nil {
+		return fmt.Errorf("failed to load user directory: %w", err)
+	}
+	byKey := make(map[string]repository.User, len(users))
+	var byPseudonym map[string]repository.User
+	if d.privacy.Pseudonymized() {
+		byPseudonym = make(map[string]repository.User, len(users))
+	}
+	for _, user := range users {
+		byKey[user.UserKey] = user
+		if byPseudonym != nil {
+			byPseudonym[d.privacy.Pseudonym(user.UserKey)] = user
+		}
+	}
+
+	d.mu.Lock()
+	d.byKey = byKey
+	d.byPseudonym = byPseudonym
+	// 読み込み中に破棄された場合は、読み込んだ内容が古い可能性があるので次の参照でもう一度読み込む
+	if d.version == version {
+		d.loadedAt = time.Now()
+	}
+	d.mu.Unlock()
+	return nil
+}
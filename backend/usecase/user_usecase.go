@@ -0,0 +1,195 @@
+// backend/usecase/user_usecase.go
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"backend/repository"
+)
+
+// グレードの有効範囲
+// グレードは組織で決めた段階（学年や等級など）を表す 1 から 6 までの整数で、集計をグレードごとに分けるのに使います
+// 取り込んだユーザーは MinGrade になります
+const (
+	MinGrade = 1
+	MaxGrade = 6
+)
+
+// UserPatch はユーザーの部分更新の内容です。nil のフィールドは変更しません
+// user_key は Slack のユーザーIDなので更新できません
+type UserPatch struct {
+	UserName *string `json:"user_name"`
+	Grade    *int    `json:"grade"`
+	TeamKey  *int    `json:"team_key"`
+	Role     *string `json:"role"`
+}
+
+// GetUser は指定されたIDのユーザー情報を取得します
+// admin 以外は自分と、lead の場合は自分のチームのユーザーだけを取得できます
+// 仮名にする場合は、本人以外の user_key とユーザー名を仮名に置き換えます
+func (u *SlackUsecase) GetUser(actor Principal, workspaceID int, id int) (repository.User, error) {
+	user, err := u.getUser(workspaceID, id)
+	if err != nil {
+		return repository.User{}, fmt.Errorf("GetUser: failed to get user from repository: %w", err)
+	}
+	if err := authorizeUser(actor, user); err != nil {
+		return repository.User{}, fmt.Errorf("GetUser: %w", err)
+	}
+	return u.privacy.maskUser(actor, user), nil
+}
+
+// UpdateUser は指定されたIDのユーザー名・グレード・チームをまとめて更新し、更新後のユーザー情報を返します（admin のみ）
+func (u *SlackUsecase) UpdateUser(actor Principal, workspaceID int, id int, userName string, grade int, teamKey int) (repository.User, error) {
+	return u.PatchUser(actor, workspaceID, id, UserPatch{UserName: &userName, Grade: &grade, TeamKey: &teamKey})
+}
+
+// SetUserRole は user_key のユーザーの権限を変更します（admin のみ）
+// 最初の admin を決めるときはコマンドから SystemPrincipal で呼び出します
+func (u *SlackUsecase) SetUserRole(actor Principal, workspaceID int, userKey string, role string) (repository.User, error) {
+	users, _, err := u.repo.ListUsers(repository.UserFilter{WorkspaceID: workspaceID, UserKey: userKey, IncludeBots: true, IncludeDeleted: true})
+	if err != nil {
+		return repository.User{}, fmt.Errorf("SetUserRole: failed to get user from repository: %w", err)
+	}
+	if len(users) == 0 {
+		return repository.User{}, fmt.Errorf("SetUserRole: %w: no user found with user_key %s", repository.ErrNotFound, userKey)
+	}
+	return u.PatchUser(actor, workspaceID, users[0].ID, UserPatch{Role: &role})
+}
+
+// PatchUser はユーザー情報を部分的に更新し、更新後のユーザー情報を返します（admin のみ）
+func (u *SlackUsecase) PatchUser(actor Principal, workspaceID int, id int, patch UserPatch) (repository.User, error) {
+	if err := authorizeAdmin(actor, "update users"); err != nil {
+		return repository.User{}, fmt.Errorf("PatchUser: %w", err)
+	}
+
+	user, err := u.getUser(workspaceID, id)
+	if err != nil {
+		return repository.User{}, fmt.Errorf("PatchUser: failed to get user from repository: %w", err)
+	}
+
+	if patch.UserName != nil {
+		trimmed := strings.TrimSpace(*patch.UserName)
+		patch.UserName = &trimmed
+		// 仮名で返したユーザー名をそのまま送り返された場合は、ユーザー名を変更しない
+		if u.privacy.Pseudonymized() && trimmed == u.privacy.Pseudonym(user.UserKey) {
+			patch.UserName = nil
+		}
+	}
+	if err := u.validatePatch(user.WorkspaceID, patch); err != nil {
+		return repository.User{}, fmt.Errorf("PatchUser: %w", err)
+	}
+
+	if patch.UserName != nil {
+		user.UserName = *patch.UserName
+	}
+	if patch.Grade != nil {
+		user.Grade = *patch.Grade
+	}
+	if patch.TeamKey != nil {
+		user.TeamKey = *patch.TeamKey
+	}
+	if patch.Role != nil {
+		user.Role = *patch.Role
+	}
+
+	// RepositoryのUpdateUserメソッドを呼び出す
+	if err := u.repo.UpdateUser(id, user); err != nil {
+		// エラーをラップして返す
+		return repository.User{}, fmt.Errorf("failed to update user in repository (id: %d): %w", id, err)
+	}
+	u.users.Invalidate()
+	return u.privacy.maskUser(actor, user), nil
+}
+
+// DeleteUser は指定されたIDのユーザーを削除します（admin のみ）
+// 追跡から除外したユーザー（個人データを消去したユーザーを含む）は削除できません（ErrConflict）
+func (u *SlackUsecase) DeleteUser(actor Principal, workspaceID int, id int) error {
+	if err := authorizeAdmin(actor, "delete users"); err != nil {
+		return fmt.Errorf("DeleteUser: %w", err)
+	}
+	user, err := u.getUser(workspaceID, id)
+	if err != nil {
+		return fmt.Errorf("DeleteUser: %w", err)
+	}
+	if err := checkDeletable(user); err != nil {
+		return fmt.Errorf("DeleteUser: %w", err)
+	}
+	if err := u.repo.DeleteUser(id); err != nil {
+		return fmt.Errorf("DeleteUser: failed to delete user in repository (id: %d): %w", id, err)
+	}
+	u.users.Invalidate()
+	return nil
+}
+
+// checkDeletable はユーザーを削除してよいかどうかを確認します
+// ユーザーの行は追跡からの除外と個人データの消去の唯一の記録なので、削除すると次の同期で取り込み直してしまいます
+func checkDeletable(user repository.User) error {
+	if user.OptedOut {
+		return fmt.Errorf("%w: user %d is opted out; delete would re-enable tracking on the next sync", repository.ErrConflict, user.ID)
+	}
+	return nil
+}
+
+// SetOptedOut は指定されたIDのユーザーを追跡から除外する、または除外を取り消します（本人と admin のみ）
+// 除外すると保存済みのメッセージ・リアクション・在席状況を削除し、以降の同期やイベントでも取り込みません
+// 除外を取り消しても削除したデータは戻らず、その後の活動から取り込みます
+func (u *SlackUsecase) SetOptedOut(actor Principal, workspaceID int, id int, optedOut bool) (repository.OptOutReport, error) {
+	user, err := u.getUser(workspaceID, id)
+	if err != nil {
+		return repository.OptOutReport{}, fmt.Errorf("SetOptedOut: failed to get user from repository: %w", err)
+	}
+	if !actor.IsAdmin() && !actor.IsSelf(user.UserKey) {
+		return repository.OptOutReport{}, fmt.Errorf("SetOptedOut: %w", forbidden(actor, "change opt-out of user "+user.UserKey))
+	}
+
+	report, err := u.repo.SetUserOptedOut(id, optedOut)
+	if err != nil {
+		return repository.OptOutReport{}, fmt.Errorf("SetOptedOut: failed to update user in repository (id: %d): %w", id, err)
+	}
+	u.users.Invalidate()
+	if optedOut {
+		log.Printf("ユーザー %d を追跡から除外しました（メッセージ %d 件、リアクション %d 件、在席状況 %d 件を削除）", id, report.Messages, report.Reactions, report.PresenceSamples)
+	}
+	report.UserKey = u.privacy.userKey(actor, report.UserKey)
+	return report, nil
+}
+
+// getUser は指定されたIDのユーザーを取得します。他のワークスペースのユーザーの場合は ErrNotFound を返します
+func (u *SlackUsecase) getUser(workspaceID int, id int) (repository.User, error) {
+	user, err := u.repo.GetUserByID(id)
+	if err != nil {
+		return repository.User{}, err
+	}
+	if err := checkWorkspace(workspaceID, user.WorkspaceID, fmt.Sprintf("user %d", id)); err != nil {
+		return repository.User{}, err
+	}
+	return user, nil
+}
+
+// validatePatch は部分更新で変更するフィールドだけを検証します
+// 変更しないフィールドは保存済みの値のままにするので、検証しません（保存済みのチームが削除されていてもグレードだけを変更できます）
+// チームはユーザーと同じワークスペースのものである必要があります
+// 不正な場合は repository.ErrInvalid をラップしたエラーを返します
+func (u *SlackUsecase) validatePatch(workspaceID int, patch UserPatch) error {
+	if patch.UserName != nil && *patch.UserName == "" {
+		return fmt.Errorf("%w: user_name must not be empty", repository.ErrInvalid)
+	}
+	if patch.Grade != nil && (*patch.Grade < MinGrade || *patch.Grade > MaxGrade) {
+		return fmt.Errorf("%w: grade must be between %d and %d", repository.ErrInvalid, MinGrade, MaxGrade)
+	}
+	if patch.Role != nil && !Roles[*patch.Role] {
+		return fmt.Errorf("%w: role must be one of admin, lead, member", repository.ErrInvalid)
+	}
+	if patch.TeamKey != nil {
+		if _, err := u.getTeam(workspaceID, *patch.TeamKey); err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return fmt.Errorf("%w: team_key %d does not exist", repository.ErrInvalid, *patch.TeamKey)
+			}
+			return fmt.Errorf("failed to check team_key %d: %w", *patch.TeamKey, err)
+		}
+	}
+	return nil
+}
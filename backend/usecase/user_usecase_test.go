@@ -0,0 +1,29 @@
+// backend/usecase/user_usecase_test.go
+package usecase
+
+import (
+	"errors"
+	"testing"
+
+	"backend/repository"
+)
+
+func TestCheckDeletable(t *testing.T) {
+	tests := []struct {
+		name    string
+		user    repository.User
+		wantErr error
+	}{
+		{"tracked user", repository.User{ID: 1, UserKey: "U1"}, nil},
+		{"opted-out user", repository.User{ID: 2, UserKey: "U2", OptedOut: true}, repository.ErrConflict},
+		{"erased user", repository.User{ID: 3, UserKey: "erased:ab12", UserName: "erased-3", OptedOut: true}, repository.ErrConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkDeletable(tt.user); !errors.Is(err, tt.wantErr) {
+				t.Errorf("checkDeletable() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
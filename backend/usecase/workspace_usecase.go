@@ -0,0 +1,265 @@
+// backend/usecase/workspace_usecase.go
+package usecase
+
+import (
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/repository"
+
+	"github.com/slack-go/slack"
+)
+
+// Slack アプリのインストール（OAuth v2）で要求するスコープの既定値
+const (
+	DefaultSlackBotScopes  = "channels:read,channels:history,channels:join,users:read,reactions:read,team:read"
+	DefaultSlackUserScopes = ""
+)
+
+// slackAuthorizeURL は Slack アプリのインストールの認可エンドポイントです
+const slackAuthorizeURL = "https://slack.com/oauth/v2/authorize"
+
+// installTTL はインストールを開始してから戻ってくるまでの有効期間です
+const installTTL = 10 * time.Minute
+
+// SlackOAuthConfig は Slack アプリのインストール（OAuth v2）の設定です
+type SlackOAuthConfig struct {
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string // 認可後に戻る URL（GET /slack/oauth/callback）
+	BotScopes    string // カンマ区切り
+	UserScopes   string // カンマ区切り。空の場合はユーザートークンを発行しない
+}
+
+// installState はインストール開始時にクッキーに保存し、戻ってきたときに照合する値です
+// Purpose で Slack でのログインの状態と区別します
+type installState struct {
+	Purpose   string `json:"purpose"`
+	State     string `json:"state"`
+	ExpiresAt int64  `json:"exp"` // Unix 秒
+}
+
+// installPurpose は installState.Purpose の値です
+const installPurpose = "slack_install"
+
+// WorkspaceUsecase は Slack ワークスペースのインストールと、リクエストで扱うワークスペースの選択を提供します
+// oauth.ClientID が空の場合、インストールは無効です
+type WorkspaceUsecase struct {
+	tokenSigner
+	repo       *repository.Repository
+	oauth      SlackOAuthConfig
+	httpClient *http.Client
+}
+
+func NewWorkspaceUsecase(repo *repository.Repository, oauth SlackOAuthConfig, sessionSecret []byte) *WorkspaceUsecase {
+	if oauth.BotScopes == "" {
+		oauth.BotScopes = DefaultSlackBotScopes
+	}
+	return &WorkspaceUsecase{
+		tokenSigner: tokenSigner{secret: sessionSecret},
+		repo:        repo,
+		oauth:       oauth,
+		httpClient:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// ListWorkspaces は主体が選べるワークスペースの一覧を返します
+// ワークスペースに属する主体（Slack でログインしたユーザーや API キー）は自分のワークスペースだけを見られます
+func (u *WorkspaceUsecase) ListWorkspaces(actor Principal) ([]repository.Workspace, error) {
+	workspaces, err := u.repo.ListWorkspaces()
+	if err != nil {
+		return nil, fmt.Errorf("ListWorkspaces: %w", err)
+	}
+	visible := []repository.Workspace{}
+	for _, w := range workspaces {
+		if canAccessWorkspace(actor, w.ID) {
+			visible = append(visible, w)
+		}
+	}
+	return visible, nil
+}
+
+// canAccessWorkspace は主体が workspaceID のワークスペースを扱えるかどうかを返します
+// ワークスペースに属する主体は自分のワークスペースだけ、属さない主体は admin だけがすべてのワークスペースを扱えます
+// ワークスペースがまだ登録されていない場合（ID が 0 のすべてのデータ）は、ワークスペースに属さない主体も扱えます
+func canAccessWorkspace(actor Principal, workspaceID int) bool {
+	switch {
+	case actor.WorkspaceID != nil:
+		return *actor.WorkspaceID == workspaceID
+	case workspaceID == 0:
+		return true
+	default:
+		return actor.IsAdmin()
+	}
+}
+
+// ResolveWorkspace はリクエストで扱うワークスペースを返します
+// selector はワークスペースのID、または Slack のワークスペースID（T から始まる）です
+// 省略した場合は主体のワークスペース、インストールされているワークスペースが 1 つだけならそのワークスペースを使います
+// 主体が扱えないワークスペース（canAccessWorkspace）の場合は ErrForbidden を返します
+// まだワークスペースが 1 つも登録されていない場合は ID が 0 のワークスペース（すべてのデータ）を返します
+func (u *WorkspaceUsecase) ResolveWorkspace(actor Principal, selector string) (repository.Workspace, error) {
+	selector = strings.TrimSpace(selector)
+
+	var workspace repository.Workspace
+	var err error
+	switch {
+	case selector != "":
+		if id, convErr := strconv.Atoi(selector); convErr == nil {
+			workspace, err = u.repo.GetWorkspaceByID(id)
+		} else {
+			workspace, err = u.repo.GetWorkspaceBySlackTeamID(selector)
+		}
+		if errors.Is(err, repository.ErrNotFound) {
+			return repository.Workspace{}, fmt.Errorf("%w: workspace %s is not installed", repository.ErrInvalid, selector)
+		}
+	case actor.WorkspaceID != nil:
+		workspace, err = u.repo.GetWorkspaceByID(*actor.WorkspaceID)
+	default:
+		var workspaces []repository.Workspace
+		if workspaces, err = u.repo.ListWorkspaces(); err != nil {
+			break
+		}
+		switch len(workspaces) {
+		case 0:
+			return repository.Workspace{}, nil
+		case 1:
+			workspace = workspaces[0]
+		default:
+			return repository.Workspace{}, fmt.Errorf("%w: workspace is required (X-Workspace header or workspace parameter)", repository.ErrInvalid)
+		}
+	}
+	if err != nil {
+		return repository.Workspace{}, fmt.Errorf("failed to get workspace: %w", err)
+	}
+
+	if !canAccessWorkspace(actor, workspace.ID) {
+		return repository.Workspace{}, forbidden(actor, "access workspace "+workspace.SlackTeamID)
+	}
+	return workspace, nil
+}
+
+// RegisterTokens はトークンのワークスペースを auth.test で調べて保存します
+// 環境変数のトークンで動かしていた環境の移行用で、ワークスペースが決まっていないユーザーとチームをこのワークスペースに結び付けます
+func (u *WorkspaceUsecase) RegisterTokens(botToken string, userToken string) (repository.Workspace, error) {
+	workspace, err := u.saveWorkspace(botToken, userToken)
+	if err != nil {
+		return repository.Workspace{}, fmt.Errorf("RegisterTokens: %w", err)
+	}
+	users, teams, err := u.repo.AdoptUnscopedRows(workspace.ID)
+	if err != nil {
+		return repository.Workspace{}, fmt.Errorf("RegisterTokens: failed to assign existing rows: %w", err)
+	}
+	if users > 0 || teams > 0 {
+		log.Printf("既存のユーザー %d 件とチーム %d 件をワークスペース %s (%s) に割り当てました", users, teams, workspace.Name, workspace.SlackTeamID)
+	}
+	return workspace, nil
+}
+
+// InstallEnabled は Slack アプリのインストールが設定されているかどうかを返します
+func (u *WorkspaceUsecase) InstallEnabled() bool {
+	return u.oauth.ClientID != ""
+}
+
+// BeginInstall は Slack アプリのワークスペースへのインストールを開始します（admin のみ）
+// ユーザーを送る認可 URL と、戻ってきたときに CompleteInstall に渡すインストール状態（署名済み）を返します
+func (u *WorkspaceUsecase) BeginInstall(actor Principal) (authURL string, state string, err error) {
+	if err := authorizeAdmin(actor, "install workspaces"); err != nil {
+		return "", "", fmt.Errorf("BeginInstall: %w", err)
+	}
+	if !u.InstallEnabled() {
+		return "", "", fmt.Errorf("%w: Slack app installation is not configured", repository.ErrNotFound)
+	}
+
+	expected := installState{Purpose: installPurpose, ExpiresAt: time.Now().Add(installTTL).Unix()}
+	if expected.State, err = randomToken(); err != nil {
+		return "", "", err
+	}
+	if state, err = u.signToken(expected); err != nil {
+		return "", "", err
+	}
+
+	query := url.Values{
+		"client_id":    {u.oauth.ClientID},
+		"scope":        {u.oauth.BotScopes},
+		"redirect_uri": {u.oauth.RedirectURL},
+		"state":        {expected.State},
+	}
+	if u.oauth.UserScopes != "" {
+		query.Set("user_scope", u.oauth.UserScopes)
+	}
+	return slackAuthorizeURL + "?" + query.Encode(), state, nil
+}
+
+// CompleteInstall は認可後に戻ってきたリクエストの state を検証し、code をトークンと交換してワークスペースを保存します
+// 同じワークスペースを再インストールした場合はトークンを更新します
+func (u *WorkspaceUsecase) CompleteInstall(savedState string, state string, code string) (repository.Workspace, error) {
+	if !u.InstallEnabled() {
+		return repository.Workspace{}, fmt.Errorf("%w: Slack app installation is not configured", repository.ErrNotFound)
+	}
+
+	var expected installState
+	if err := u.verifyToken(savedState, &expected); err != nil || expected.Purpose != installPurpose {
+		return repository.Workspace{}, fmt.Errorf("%w: installation session not found", repository.ErrUnauthorized)
+	}
+	if time.Now().Unix() >= expected.ExpiresAt {
+		return repository.Workspace{}, fmt.Errorf("%w: installation session expired", repository.ErrUnauthorized)
+	}
+	if state == "" || !hmac.Equal([]byte(state), []byte(expected.State)) {
+		return repository.Workspace{}, fmt.Errorf("%w: state mismatch", repository.ErrUnauthorized)
+	}
+	if code == "" {
+		return repository.Workspace{}, fmt.Errorf("%w: authorization code is missing", repository.ErrUnauthorized)
+	}
+
+	resp, err := slack.GetOAuthV2Response(u.httpClient, u.oauth.ClientID, u.oauth.ClientSecret, code, u.oauth.RedirectURL)
+	if err != nil {
+		return repository.Workspace{}, fmt.Errorf("%w: failed to exchange authorization code: %v", repository.ErrUnauthorized, err)
+	}
+	if resp.AccessToken == "" {
+		return repository.Workspace{}, fmt.Errorf("%w: no bot token was issued", repository.ErrInvalid)
+	}
+
+	workspace, err := u.saveWorkspace(resp.AccessToken, resp.AuthedUser.AccessToken)
+	if err != nil {
+		return repository.Workspace{}, fmt.Errorf("CompleteInstall: %w", err)
+	}
+	log.Printf("ワークスペース %s (%s) をインストールしました", workspace.Name, workspace.SlackTeamID)
+	return workspace, nil
+}
+
+// saveWorkspace はボットトークンのワークスペースを auth.test で調べ、トークンと一緒に保存します
+func (u *WorkspaceUsecase) saveWorkspace(botToken string, userToken string) (repository.Workspace, error) {
+	auth, err := slack.New(botToken, slack.OptionHTTPClient(u.httpClient)).AuthTest()
+	if err != nil {
+		return repository.Workspace{}, fmt.Errorf("failed to verify bot token: %w", err)
+	}
+	workspace, err := u.repo.SaveWorkspace(repository.Workspace{
+		SlackTeamID: auth.TeamID,
+		Name:        auth.Team,
+		URL:         auth.URL,
+		BotUserID:   auth.UserID,
+		BotToken:    botToken,
+		UserToken:   userToken,
+	})
+	if err != nil {
+		return repository.Workspace{}, fmt.Errorf("failed to save workspace: %w", err)
+	}
+	return workspace, nil
+}
+
+// checkWorkspace は対象（ユーザーやチーム）がリクエストで選んだワークスペースのものかどうかを確認します
+// 他のワークスペースのものは存在しないものとして ErrNotFound を返します。workspaceID が 0 の場合は確認しません
+func checkWorkspace(workspaceID int, targetWorkspaceID int, target string) error {
+	if workspaceID != 0 && targetWorkspaceID != workspaceID {
+		return fmt.Errorf("%w: %s is not in workspace %d", repository.ErrNotFound, target, workspaceID)
+	}
+	return nil
+}
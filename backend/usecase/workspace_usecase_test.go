@@ -0,0 +1,45 @@
+// backend/usecase/workspace_usecase_test.go
+package usecase
+
+import (
+	"errors"
+	"testing"
+
+	"backend/repository"
+)
+
+func TestCanAccessWorkspace(t *testing.T) {
+	tests := []struct {
+		name        string
+		actor       Principal
+		workspaceID int
+		want        bool
+	}{
+		{"workspace user in own workspace", Principal{Kind: PrincipalUser, ID: "U1", Role: RoleMember, WorkspaceID: intPtr(1)}, 1, true},
+		{"workspace user in other workspace", Principal{Kind: PrincipalUser, ID: "U1", Role: RoleMember, WorkspaceID: intPtr(1)}, 2, false},
+		{"workspace admin key in other workspace", Principal{Kind: PrincipalAPIKey, ID: "1", Role: RoleAdmin, WorkspaceID: intPtr(1)}, 2, false},
+		{"global admin key", Principal{Kind: PrincipalAPIKey, ID: "1", Role: RoleAdmin}, 2, true},
+		{"system", SystemPrincipal, 2, true},
+		{"member key without workspace", Principal{Kind: PrincipalAPIKey, ID: "2", Role: RoleMember}, 1, false},
+		{"lead key without workspace", Principal{Kind: PrincipalAPIKey, ID: "3", Role: RoleLead, TeamKey: intPtr(1)}, 1, false},
+		{"legacy user without workspace", Principal{Kind: PrincipalUser, ID: "U2", Role: RoleLead, TeamKey: intPtr(1)}, 1, false},
+		{"legacy user before any workspace is installed", Principal{Kind: PrincipalUser, ID: "U2", Role: RoleMember}, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := canAccessWorkspace(tt.actor, tt.workspaceID); got != tt.want {
+				t.Errorf("canAccessWorkspace() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateAPIKeyRequiresWorkspace(t *testing.T) {
+	u := &AuthUsecase{}
+	for _, role := range []string{RoleLead, RoleMember} {
+		if _, _, err := u.CreateAPIKey("key", role, nil, intPtr(1)); !errors.Is(err, repository.ErrInvalid) {
+			t.Errorf("CreateAPIKey(%s) without workspace error = %v, want %v", role, err, repository.ErrInvalid)
+		}
+	}
+}
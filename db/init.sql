@@ -1,26 +1,325 @@
 -- db/init.sql
+-- ワークスペーステーブル（OAuth でインストールした Slack ワークスペースとトークン）
+CREATE TABLE IF NOT EXISTS workspaces (
+    id SERIAL PRIMARY KEY,
+    slack_team_id VARCHAR(255) UNIQUE NOT NULL, -- SlackのワークスペースID（"T" で始まる）
+    name VARCHAR(255) NOT NULL,                 -- ワークスペース名
+    url VARCHAR(255) NOT NULL DEFAULT '',       -- ワークスペースのURL（パーマリンクに使う）
+    bot_user_id VARCHAR(255) NOT NULL DEFAULT '', -- インストールしたアプリのボットユーザーID
+    bot_token TEXT NOT NULL,                    -- ボットトークン（xoxb-。暗号化が有効な場合は "enc:v1:..." の暗号文）
+    user_token TEXT NOT NULL DEFAULT '',        -- ユーザートークン（xoxp-、users.list に使う。暗号化は bot_token と同じ）
+    installed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
 -- ユーザーテーブル
 CREATE TABLE IF NOT EXISTS users (
     id SERIAL PRIMARY KEY,
+    workspace_id INTEGER REFERENCES workspaces(id) ON DELETE CASCADE, -- 所属するワークスペース（NULL は複数ワークスペース対応前のユーザー）
     user_key VARCHAR(255) UNIQUE NOT NULL,  -- SlackのユーザーID
     user_name VARCHAR(255) NOT NULL,        -- ユーザー名（表示名または実名）
     grade INTEGER NOT NULL DEFAULT 1,       -- ユーザーのグレード
     team_key INTEGER NOT NULL DEFAULT 1,    -- チームキー
+    is_bot BOOLEAN NOT NULL DEFAULT FALSE,  -- Slack のボットユーザー（Slackbot を含む）
+    is_deleted BOOLEAN NOT NULL DEFAULT FALSE, -- Slack 上で削除（無効化）済み
+    role VARCHAR(16) NOT NULL DEFAULT 'member' CHECK (role IN ('admin', 'lead', 'member')), -- ダッシュボードでの権限
+    opted_out BOOLEAN NOT NULL DEFAULT FALSE, -- 追跡から除外（メッセージ・リアクション・在席状況を保存せず、集計にも含めない）
+    opted_out_at TIMESTAMP,                   -- 除外を設定した日時
+    erased_at TIMESTAMP,                      -- 個人データを消去した日時（ユーザー名を匿名化し、同期で戻さない）
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
+-- 既存のデータベースに後から追加した列を追加する
+ALTER TABLE users ADD COLUMN IF NOT EXISTS workspace_id INTEGER REFERENCES workspaces(id) ON DELETE CASCADE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_bot BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_deleted BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(16) NOT NULL DEFAULT 'member' CHECK (role IN ('admin', 'lead', 'member'));
+ALTER TABLE users ADD COLUMN IF NOT EXISTS opted_out BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS opted_out_at TIMESTAMP;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS erased_at TIMESTAMP;
+
 -- チームテーブル（Slackチャンネルとの対応）
 CREATE TABLE IF NOT EXISTS teams (
     id SERIAL PRIMARY KEY,                 -- team_keyとして使用
+    workspace_id INTEGER REFERENCES workspaces(id) ON DELETE CASCADE, -- チャンネルのワークスペース（NULL は複数ワークスペース対応前のチーム）
     channel_id VARCHAR(255) UNIQUE NOT NULL, -- SlackのチャンネルID
     channel_name VARCHAR(255) NOT NULL,      -- チャンネル名
+    is_tracked BOOLEAN NOT NULL DEFAULT TRUE, -- FALSE の場合は同期・集計の対象外
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
+-- 既存のデータベースに後から追加した列を追加する
+ALTER TABLE teams ADD COLUMN IF NOT EXISTS workspace_id INTEGER REFERENCES workspaces(id) ON DELETE CASCADE;
+ALTER TABLE teams ADD COLUMN IF NOT EXISTS is_tracked BOOLEAN NOT NULL DEFAULT TRUE;
+
 -- インデックス（パフォーマンス向上のため）
 CREATE INDEX IF NOT EXISTS idx_users_user_key ON users(user_key);
 CREATE INDEX IF NOT EXISTS idx_users_team_key ON users(team_key);
+CREATE INDEX IF NOT EXISTS idx_users_grade ON users(grade);
 CREATE INDEX IF NOT EXISTS idx_teams_channel_id ON teams(channel_id);
+CREATE INDEX IF NOT EXISTS idx_users_workspace_id ON users(workspace_id);
+CREATE INDEX IF NOT EXISTS idx_teams_workspace_id ON teams(workspace_id);
+
+-- 所属履歴テーブル（grade と team_key の変更履歴）
+-- valid_to が NULL の行が現在の所属。メッセージ等はその時点で有効だった行に結び付けて集計する
+CREATE TABLE IF NOT EXISTS user_assignments (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    grade INTEGER NOT NULL,
+    team_key INTEGER NOT NULL,
+    valid_from TIMESTAMP NOT NULL,  -- UTC。最初の所属は 'epoch'（それ以前の活動もこの所属として扱う）
+    valid_to TIMESTAMP,             -- UTC。NULL は現在も有効
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_assignments_user_id ON user_assignments(user_id, valid_from);
+
+-- 所属履歴を持たない既存ユーザーには現在の値を最初の所属として登録
+INSERT INTO user_assignments (user_id, grade, team_key, valid_from)
+SELECT u.id, u.grade, u.team_key, 'epoch'
+FROM users u
+WHERE NOT EXISTS (SELECT 1 FROM user_assignments a WHERE a.user_id = u.id);
+
+-- チームメンバーシップテーブル（ユーザーとチームの多対多）
+-- source = 'slack' は conversations.members から同期した行、'manual' は手動での上書き
+-- 同じ (team_id, user_id) に manual 行がある場合は slack 行より優先される
+CREATE TABLE IF NOT EXISTS team_memberships (
+    team_id INTEGER NOT NULL REFERENCES teams(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    source VARCHAR(16) NOT NULL DEFAULT 'slack',  -- 'slack' または 'manual'
+    is_excluded BOOLEAN NOT NULL DEFAULT FALSE,   -- manual 行でメンバーから除外する場合に TRUE
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (team_id, user_id, source)
+);
+
+CREATE INDEX IF NOT EXISTS idx_team_memberships_user_id ON team_memberships(user_id);
+
+-- メッセージテーブル（Slack から取り込んだ投稿）
+CREATE TABLE IF NOT EXISTS messages (
+    id BIGSERIAL PRIMARY KEY,
+    team_id INTEGER NOT NULL REFERENCES teams(id) ON DELETE CASCADE,
+    channel_id VARCHAR(255) NOT NULL,         -- SlackのチャンネルID
+    ts VARCHAR(32) NOT NULL,                  -- Slackのメッセージts（"秒.マイクロ秒" の固定長）
+    user_key VARCHAR(255) NOT NULL DEFAULT '', -- 投稿者のSlackユーザーID
+    workspace_id VARCHAR(255) NOT NULL DEFAULT '',
+    text TEXT NOT NULL DEFAULT '',            -- 本文（暗号化が有効な場合は暗号文、MESSAGE_TEXT_MODE=metadata の場合は空）
+    thread_ts VARCHAR(32),                    -- スレッドの親メッセージのts
+    subtype VARCHAR(64) NOT NULL DEFAULT '',  -- Slackのメッセージのsubtype（通常の投稿は空。'channel_join', 'bot_message' など）
+    bot_id VARCHAR(64) NOT NULL DEFAULT '',   -- ボット・アプリによる投稿の場合のボットID
+    reply_count INTEGER NOT NULL DEFAULT 0,   -- スレッドの返信数（スレッドの親メッセージのみ）
+    latest_reply VARCHAR(32),                 -- スレッドの最新の返信のts
+    posted_at TIMESTAMP NOT NULL,             -- 投稿日時（UTC）
+    edited_at TIMESTAMP,                      -- 最後に編集された日時（UTC、未編集なら NULL）
+    deleted_at TIMESTAMP,                     -- Slack で削除された日時（UTC、論理削除）
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (channel_id, ts)
+);
+
+-- 既存のデータベースに後から追加した列を追加する
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS subtype VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS bot_id VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS reply_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS latest_reply VARCHAR(32);
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS edited_at TIMESTAMP;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_messages_team_id ON messages(team_id);
+CREATE INDEX IF NOT EXISTS idx_messages_user_key ON messages(user_key, posted_at);
+CREATE INDEX IF NOT EXISTS idx_messages_posted_at ON messages(posted_at);
+
+-- メッセージの編集履歴（編集回数の集計に使う。本文は保持しない）
+CREATE TABLE IF NOT EXISTS message_edits (
+    id BIGSERIAL PRIMARY KEY,
+    message_id BIGINT NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    user_key VARCHAR(255) NOT NULL DEFAULT '', -- 編集したユーザーのSlackユーザーID
+    edited_at TIMESTAMP NOT NULL,              -- 編集日時（UTC）
+    UNIQUE (message_id, edited_at)
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_edits_edited_at ON message_edits(edited_at);
+
+-- メッセージへのリアクション（絵文字とリアクションしたユーザーごとに 1 行）
+CREATE TABLE IF NOT EXISTS message_reactions (
+    id BIGSERIAL PRIMARY KEY,
+    message_id BIGINT NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    emoji VARCHAR(255) NOT NULL,               -- 絵文字の名前（コロンなし。スキントーンは "thumbsup::skin-tone-2" のまま）
+    user_key VARCHAR(255) NOT NULL,            -- リアクションしたユーザーのSlackユーザーID
+    reacted_at TIMESTAMP NOT NULL,             -- リアクションした日時（UTC。履歴の取り込みでは分からないので投稿日時）
+    UNIQUE (message_id, emoji, user_key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_reactions_user_key ON message_reactions(user_key, reacted_at);
+CREATE INDEX IF NOT EXISTS idx_message_reactions_reacted_at ON message_reactions(reacted_at);
+
+-- メッセージで共有されたファイルのメタデータ（ファイル名・タイトル・中身は保持しない）
+CREATE TABLE IF NOT EXISTS message_files (
+    id BIGSERIAL PRIMARY KEY,
+    message_id BIGINT NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    file_id VARCHAR(64) NOT NULL,              -- SlackのファイルID
+    user_key VARCHAR(255) NOT NULL DEFAULT '', -- アップロードしたユーザーのSlackユーザーID
+    filetype VARCHAR(64) NOT NULL DEFAULT '',  -- Slackのファイルの種類（'pdf', 'python', 'gdoc' など）
+    mimetype VARCHAR(255) NOT NULL DEFAULT '',
+    category VARCHAR(32) NOT NULL,             -- 集計用の分類（'document', 'snippet', 'image' など）
+    size BIGINT NOT NULL DEFAULT 0,            -- バイト数
+    is_external BOOLEAN NOT NULL DEFAULT FALSE, -- Google ドライブなどの外部ファイル
+    external_type VARCHAR(64) NOT NULL DEFAULT '',
+    UNIQUE (message_id, file_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_files_category ON message_files(category);
+
+-- メッセージに含まれるリンクのドメインごとの数（本文のリンクとリンクの展開）
+-- URL は本文の一部なのでドメインだけを保存する
+CREATE TABLE IF NOT EXISTS message_links (
+    id BIGSERIAL PRIMARY KEY,
+    message_id BIGINT NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    domain VARCHAR(255) NOT NULL,              -- 小文字のホスト名（先頭の 'www.' は除く）
+    links INTEGER NOT NULL DEFAULT 1           -- このドメインの（重複を除いた）リンクの数
+);
+
+-- 既存のデータベースに後から追加した列を追加し、URL を保存していた列を削除する
+ALTER TABLE message_links ADD COLUMN IF NOT EXISTS links INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE message_links DROP COLUMN IF EXISTS url;
+-- URL ごとに保存していた行を、メッセージとドメインごとの 1 行にまとめる
+UPDATE message_links l
+SET links = d.links
+FROM (
+    SELECT MIN(id) AS id, COUNT(*) AS links
+    FROM message_links
+    GROUP BY message_id, domain
+    HAVING COUNT(*) > 1
+) d
+WHERE l.id = d.id;
+DELETE FROM message_links l
+USING message_links k
+WHERE k.message_id = l.message_id AND k.domain = l.domain AND k.id < l.id;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_message_links_message_domain ON message_links(message_id, domain);
+CREATE INDEX IF NOT EXISTS idx_message_links_domain ON message_links(domain);
+
+-- チャンネルごとの差分取り込みの位置
+-- 期間指定の取り込み（バックフィル）で古い期間を埋めても差分取り込みの位置が動かないよう、messages とは別に持つ
+CREATE TABLE IF NOT EXISTS channel_sync_states (
+    channel_id VARCHAR(255) PRIMARY KEY,      -- SlackのチャンネルID
+    latest_ts VARCHAR(32) NOT NULL,           -- 差分取り込みで保存済みの最新のts
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- 既存のメッセージから差分取り込みの位置を移行
+INSERT INTO channel_sync_states (channel_id, latest_ts)
+SELECT channel_id, MAX(ts) FROM messages GROUP BY channel_id
+ON CONFLICT (channel_id) DO NOTHING;
+
+-- 同期ジョブテーブル（/users/init などの非同期処理の状態と進捗）
+CREATE TABLE IF NOT EXISTS sync_jobs (
+    id BIGSERIAL PRIMARY KEY,
+    kind VARCHAR(64) NOT NULL,                  -- 'users_init', 'channels_init', 'channel_sync' など
+    resource VARCHAR(255) NOT NULL,             -- 対象リソース（例: 'users', 'channel:3'）
+    status VARCHAR(16) NOT NULL DEFAULT 'queued', -- 'queued', 'running', 'succeeded', 'failed'
+    processed INTEGER NOT NULL DEFAULT 0,       -- 処理済み件数
+    total INTEGER NOT NULL DEFAULT 0,           -- 全体の件数（不明な場合は 0）
+    error TEXT NOT NULL DEFAULT '',
+    window_oldest VARCHAR(32) NOT NULL DEFAULT '', -- 取り込む期間の始まり（Slack ts、空なら指定なし）
+    window_latest VARCHAR(32) NOT NULL DEFAULT '', -- 取り込む期間の終わり（Slack ts、空なら指定なし）
+    checkpoint VARCHAR(32) NOT NULL DEFAULT '',    -- 期間指定の取り込みで保存済みの最も古い ts（再開時はここから続ける）
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    started_at TIMESTAMP,
+    finished_at TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP -- 実行中は定期的に更新される（ハートビート）
+);
+
+-- 既存のデータベースに後から追加した列を追加する
+ALTER TABLE sync_jobs ADD COLUMN IF NOT EXISTS window_oldest VARCHAR(32) NOT NULL DEFAULT '';
+ALTER TABLE sync_jobs ADD COLUMN IF NOT EXISTS window_latest VARCHAR(32) NOT NULL DEFAULT '';
+ALTER TABLE sync_jobs ADD COLUMN IF NOT EXISTS checkpoint VARCHAR(32) NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_sync_jobs_resource ON sync_jobs(resource, status);
+
+-- 未完了のジョブはリソースごとに 1 件まで（重複の検出に使う）
+-- 索引を作る前に、既存のデータベースに残っている重複した未完了のジョブを最新の 1 件を残して failed にする
+UPDATE sync_jobs j
+SET status = 'failed', error = 'interrupted: superseded by a newer job', finished_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+WHERE j.status IN ('queued', 'running')
+  AND EXISTS (
+      SELECT 1 FROM sync_jobs n
+      WHERE n.resource = j.resource AND n.status IN ('queued', 'running') AND n.id > j.id
+  );
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sync_jobs_active_resource ON sync_jobs(resource) WHERE status IN ('queued', 'running');
+
+-- 複数チャンネルの同期ジョブにおけるチャンネルごとの進捗
+-- 再開時は succeeded 以外のチャンネルだけを同期し直す
+CREATE TABLE IF NOT EXISTS sync_job_channels (
+    job_id BIGINT NOT NULL REFERENCES sync_jobs(id) ON DELETE CASCADE,
+    team_id INTEGER NOT NULL REFERENCES teams(id) ON DELETE CASCADE,
+    status VARCHAR(16) NOT NULL DEFAULT 'queued', -- 'queued', 'running', 'succeeded', 'failed'
+    synced INTEGER NOT NULL DEFAULT 0,            -- 取り込んだメッセージ数
+    error TEXT NOT NULL DEFAULT '',
+    checkpoint VARCHAR(32) NOT NULL DEFAULT '',   -- 期間指定の取り込みで保存済みの最も古い ts
+    started_at TIMESTAMP,
+    finished_at TIMESTAMP,
+    PRIMARY KEY (job_id, team_id)
+);
+
+-- 既存のデータベースに後から追加した列を追加する
+ALTER TABLE sync_job_channels ADD COLUMN IF NOT EXISTS checkpoint VARCHAR(32) NOT NULL DEFAULT '';
+
+-- 保持期限を過ぎたデータの削除の実行結果（実行ごとに 1 行。*_before が NULL の種類は無期限）
+CREATE TABLE IF NOT EXISTS retention_runs (
+    id BIGSERIAL PRIMARY KEY,
+    job_id BIGINT REFERENCES sync_jobs(id) ON DELETE SET NULL, -- 削除を実行したジョブ
+    text_before TIMESTAMP,                     -- これより前に投稿されたメッセージの本文を消去
+    metadata_before TIMESTAMP,                 -- これより前に投稿されたメッセージを削除
+    presence_before TIMESTAMP,                 -- これより前の在席状況（activity_logs）を削除
+    aggregates_before TIMESTAMP,               -- 集計 API でこれより前の期間を返さない
+    texts_cleared BIGINT NOT NULL DEFAULT 0,
+    messages_deleted BIGINT NOT NULL DEFAULT 0,
+    presence_deleted BIGINT NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',            -- 途中で失敗した場合のエラー
+    started_at TIMESTAMP NOT NULL,
+    finished_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_retention_runs_started_at ON retention_runs(started_at);
+
+-- 個人データの消去の記録（消去した件数だけを持ち、消去したユーザーの情報は持たない）
+CREATE TABLE IF NOT EXISTS data_erasures (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL, -- 消去したユーザー（匿名化した行）
+    requested_by VARCHAR(255) NOT NULL,        -- 消去した主体（"self" は本人、それ以外は "種類:ID"）
+    messages BIGINT NOT NULL DEFAULT 0,
+    reactions BIGINT NOT NULL DEFAULT 0,
+    edits BIGINT NOT NULL DEFAULT 0,
+    files BIGINT NOT NULL DEFAULT 0,
+    presence_samples BIGINT NOT NULL DEFAULT 0,
+    memberships BIGINT NOT NULL DEFAULT 0,
+    assignments BIGINT NOT NULL DEFAULT 0,
+    erased_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- API キー（バックエンド API の認証に使う。キーそのものは保持せず SHA-256 のハッシュだけを持つ）
+CREATE TABLE IF NOT EXISTS api_keys (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,                -- 用途が分かる名前
+    role VARCHAR(16) NOT NULL DEFAULT 'admin' CHECK (role IN ('admin', 'lead', 'member')), -- このキーでの権限
+    team_key INTEGER REFERENCES teams(id) ON DELETE SET NULL, -- role が lead / member の場合に見られるチーム
+    workspace_id INTEGER REFERENCES workspaces(id) ON DELETE CASCADE, -- キーで扱えるワークスペース（NULL はすべてのワークスペースを扱う admin のキー）
+    prefix VARCHAR(16) NOT NULL,               -- キーの先頭（一覧でどのキーか見分けるため）
+    key_hash CHAR(64) UNIQUE NOT NULL,         -- キーの SHA-256（16進）
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMP,
+    revoked_at TIMESTAMP                       -- 無効化した日時（無効化したキーでは認証しない）
+);
+
+-- 既存のデータベースに後から追加した列を追加する
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS role VARCHAR(16) NOT NULL DEFAULT 'admin' CHECK (role IN ('admin', 'lead', 'member'));
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS team_key INTEGER REFERENCES teams(id) ON DELETE SET NULL;
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS workspace_id INTEGER REFERENCES workspaces(id) ON DELETE CASCADE;
+
+-- ワークスペースの列を追加する前のキーは、チームのワークスペースに結び付ける
+UPDATE api_keys k SET workspace_id = t.workspace_id
+FROM teams t
+WHERE t.id = k.team_key AND k.workspace_id IS NULL AND t.workspace_id IS NOT NULL;
 
 -- 元のactivity_logsテーブルを残す場合（必要に応じて）
 CREATE TABLE IF NOT EXISTS activity_logs (
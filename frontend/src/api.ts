@@ -0,0 +1,20 @@
+import { API_BASE_URL } from "@/constants"
+
+// 選んだワークスペース（X-Workspace ヘッダーで送る）を保存する localStorage のキー
+export const WORKSPACE_STORAGE_KEY = "workspace"
+
+// バックエンド API を呼び出す。セッションクッキーを送るため credentials: "include" を付ける
+// ワークスペースを選んでいる場合は X-Workspace ヘッダーを付ける
+// 認証されていない（401）場合はログイン画面に移動する
+export async function apiFetch(path: string, init?: RequestInit): Promise<Response> {
+  const headers = new Headers(init?.headers)
+  const workspace = typeof window !== "undefined" ? window.localStorage.getItem(WORKSPACE_STORAGE_KEY) : null
+  if (workspace && !headers.has("X-Workspace")) {
+    headers.set("X-Workspace", workspace)
+  }
+  const response = await fetch(`${API_BASE_URL}${path}`, { ...init, headers, credentials: "include" })
+  if (response.status === 401 && typeof window !== "undefined" && window.location.pathname !== "/login") {
+    window.location.href = "/login"
+  }
+  return response
+}
@@ -20,8 +20,8 @@ import {
 } from "@mui/material"
 import dayjs from "dayjs"
 import isBetween from "dayjs/plugin/isBetween"
-import { Channel, History, User } from "@/type"
-import { API_BASE_URL } from "@/constants"
+import { Channel, History } from "@/type"
+import { apiFetch } from "@/api"
 
 dayjs.extend(isBetween)
 import { SelectChangeEvent } from "@mui/material/Select"
@@ -38,7 +38,6 @@ import {
 type ActivityScale = "day" | "week" | "month"
 
 export default function DashboardPage() {
-  const [users, setUsers] = useState<User[]>([])
   const [channels, setChannels] = useState<Channel[]>([])
   const [selectedChannel, setSelectedChannel] = useState<string>("")
   const [filteredHistory, setFilteredHistory] = useState<History[]>([])
@@ -47,18 +46,12 @@ export default function DashboardPage() {
   const [activityData, setActivityData] = useState<{ time: string; count: number }[]>([])
   const [scale, setScale] = useState<ActivityScale>("day")
 
-  // ユーザー情報とチャンネル情報を取得
+  // チャンネル情報を取得
   useEffect(() => {
     const fetchInitialData = async () => {
       try {
-        // ユーザー情報を取得
-        const usersResponse = await fetch(`${API_BASE_URL}/users`)
-        if (!usersResponse.ok) throw new Error("Failed to fetch users")
-        const usersData = await usersResponse.json()
-        setUsers(usersData.users)
-
         // チャンネル情報を取得
-        const channelsResponse = await fetch(`${API_BASE_URL}/channels`)
+        const channelsResponse = await apiFetch(`/channels?tracked=true`)
         if (!channelsResponse.ok) throw new Error("Failed to fetch channels")
         const channelsData = await channelsResponse.json()
         const channelsArray = Array.isArray(channelsData.channels) ? channelsData.channels : []
@@ -66,7 +59,7 @@ export default function DashboardPage() {
 
         // デフォルトで最初のチャンネルを選択
         if (channelsArray.length > 0) {
-          setSelectedChannel(channelsArray[0].channel_id)
+          setSelectedChannel(String(channelsArray[0].id))
         }
       } catch (error) {
         console.error("データの取得に失敗しました:", error)
@@ -82,10 +75,20 @@ export default function DashboardPage() {
 
     const fetchChannelHistory = async () => {
       try {
-        const historyResponse = await fetch(`${API_BASE_URL}/history/${selectedChannel}`)
-        if (!historyResponse.ok) throw new Error(`Failed to fetch history for channel ${selectedChannel}`)
-        const channelHistory = await historyResponse.json()
-        setFilteredHistory(channelHistory.messages)
+        // 保存済みメッセージをカーソルで最後のページまで取得
+        // 参加通知やボットの投稿などはアクティビティに含めない（バックエンドの集計と同じ方針）
+        const messages: History[] = []
+        let cursor = ""
+        do {
+          const params = new URLSearchParams({ limit: "1000", human_only: "true" })
+          if (cursor) params.set("cursor", cursor)
+          const historyResponse = await apiFetch(`/channels/${selectedChannel}/messages?${params}`)
+          if (!historyResponse.ok) throw new Error(`Failed to fetch history for channel ${selectedChannel}`)
+          const channelHistory = await historyResponse.json()
+          messages.push(...channelHistory.messages)
+          cursor = channelHistory.next_cursor
+        } while (cursor)
+        setFilteredHistory(messages)
       } catch (error) {
         console.error("履歴の取得に失敗しました:", error)
       }
@@ -94,10 +97,10 @@ export default function DashboardPage() {
     fetchChannelHistory()
   }, [selectedChannel])
 
-  // ユーザーIDをユーザー名に変換
+  // ユーザーIDをユーザー名に変換（ユーザー名はメッセージにサーバー側で付与されている）
   const getUserName = (userId: string) => {
-    const user = users.find((user) => user.user_key === userId)
-    return user ? user.user_name : "不明なユーザー"
+    const entry = filteredHistory.find((entry) => entry.user_id === userId && entry.user_name)
+    return entry ? entry.user_name : userId
   }
 
   // チャンネル変更時の処理
@@ -108,8 +111,11 @@ export default function DashboardPage() {
 
   // 投稿履歴を基にチャンネル参加ユーザーを取得
   const getChannelUsers = () => {
-    const userIds = new Set(filteredHistory.map((entry) => entry.user_id))
-    return users.filter((user) => userIds.has(user.user_key))
+    const userNames = new Map<string, string>()
+    filteredHistory.forEach((entry) => {
+      if (!userNames.has(entry.user_id)) userNames.set(entry.user_id, entry.user_name || entry.user_id)
+    })
+    return Array.from(userNames, ([user_key, user_name]) => ({ user_key, user_name }))
   }
 
   // ユーザー選択時の処理
@@ -218,7 +224,7 @@ export default function DashboardPage() {
                 input={<OutlinedInput label="チャンネル" />}
               >
                 {channels.map((channel) => (
-                  <MenuItem key={channel.channel_id} value={channel.channel_id}>
+                  <MenuItem key={channel.channel_id} value={String(channel.id)}>
                     {channel.channel_name}
                   </MenuItem>
                 ))}
@@ -322,8 +328,8 @@ export default function DashboardPage() {
               {filteredHistory.slice(0, 10).map((entry, index) => (
                 <ListItem key={index} disablePadding>
                   <ListItemText
-                    primary={`${entry.text}`}
-                    secondary={`ユーザー: ${getUserName(entry.user_id)}, 時刻: ${entry.timestamp}`}
+                    primary={entry.permalink ? <a href={entry.permalink} target="_blank" rel="noreferrer">{entry.plain_text}</a> : entry.plain_text}
+                    secondary={`ユーザー: ${entry.user_name || entry.user_id}, 時刻: ${entry.timestamp}${entry.reply_count > 0 ? `, 返信: ${entry.reply_count}件` : ""}`}
                   />
                 </ListItem>
               ))}
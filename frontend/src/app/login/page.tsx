@@ -0,0 +1,63 @@
+'use client'
+
+import { Box, Typography, TextField, Button, Stack, Alert, Divider } from "@mui/material"
+import { useState, useEffect } from "react"
+import { useRouter } from "next/navigation"
+import { apiFetch } from "@/api"
+import { API_BASE_URL } from "@/constants"
+
+export default function LoginPage() {
+  const router = useRouter()
+  const [apiKey, setApiKey] = useState<string>("")
+  const [error, setError] = useState<string>("")
+
+  // Slack でのログインに失敗した場合は ?error= 付きで戻ってくる
+  useEffect(() => {
+    const slackError = new URLSearchParams(window.location.search).get("error")
+    if (slackError) setError(slackError)
+  }, [])
+
+  // API キーでログインし、セッションクッキーを受け取る
+  const login = async () => {
+    setError("")
+    try {
+      const response = await apiFetch("/auth/login", {
+        method: "POST",
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify({ api_key: apiKey }),
+      })
+      if (!response.ok) {
+        const body = await response.json()
+        throw new Error(body.error ?? "ログインに失敗しました")
+      }
+      router.push("/dashboard")
+    } catch (error) {
+      setError(error instanceof Error ? error.message : String(error))
+    }
+  }
+
+  return (
+    <Box sx={{ p: 4, maxWidth: 480 }}>
+      <Typography variant="h5" gutterBottom>
+        ログイン
+      </Typography>
+      <Stack spacing={2}>
+        {error && <Alert severity="error">{error}</Alert>}
+        <Button variant="contained" href={`${API_BASE_URL}/auth/slack/login`}>
+          Slack でログイン
+        </Button>
+        <Divider>または</Divider>
+        <TextField
+          label="API キー"
+          type="password"
+          value={apiKey}
+          onChange={(e) => setApiKey(e.target.value)}
+          helperText="backend apikey create -name 名前 で発行したキー"
+        />
+        <Button variant="contained" onClick={login} disabled={!apiKey}>
+          ログイン
+        </Button>
+      </Stack>
+    </Box>
+  )
+}
@@ -2,27 +2,21 @@
 
 import { Box, Typography, List, ListItem, ListItemText, FormControl, InputLabel, Select, MenuItem, SelectChangeEvent, Divider, Stack, Button } from "@mui/material"
 import { useState, useEffect } from "react"
-import { Channel, History, User } from "@/type"
-import { API_BASE_URL } from "@/constants"
+import { Channel, TeamMember } from "@/type"
+import { apiFetch } from "@/api"
+import { runJob } from "@/jobs"
 
 export default function UsersPage() {
-  const [users, setUsers] = useState<User[]>([])
   const [channels, setChannels] = useState<Channel[]>([])
   const [selectedChannel, setSelectedChannel] = useState<string>("")
   const [channelUsers, setChannelUsers] = useState<string[]>([])
 
-  // ユーザー情報とチャンネル情報を取得
+  // チャンネル情報を取得
   useEffect(() => {
     const fetchInitialData = async () => {
       try {
-        // ユーザー情報を取得
-        const usersResponse = await fetch(`${API_BASE_URL}/users`)
-        if (!usersResponse.ok) throw new Error("Failed to fetch users")
-        const usersData = await usersResponse.json()
-        setUsers(usersData.users)
-
         // チャンネル情報を取得
-        const channelsResponse = await fetch(`${API_BASE_URL}/channels`)
+        const channelsResponse = await apiFetch(`/channels?tracked=true`)
         if (!channelsResponse.ok) throw new Error("Failed to fetch channels")
         const channelsData = await channelsResponse.json()
         const channelsArray = Array.isArray(channelsData.channels) ? channelsData.channels : []
@@ -30,7 +24,7 @@ export default function UsersPage() {
 
         // デフォルトで最初のチャンネルを選択
         if (channelsArray.length > 0) {
-          setSelectedChannel(channelsArray[0].channel_id)
+          setSelectedChannel(String(channelsArray[0].id))
         }
       } catch (error) {
         console.error("データの取得に失敗しました:", error)
@@ -40,30 +34,37 @@ export default function UsersPage() {
     fetchInitialData()
   }, [])
 
-  // 選択されたチャンネルの履歴を取得
+  // 選択されたチャンネルのメンバーを取得
   useEffect(() => {
     if (!selectedChannel) return
 
-    const fetchChannelHistory = async () => {
+    const fetchChannelMembers = async () => {
       try {
-        const historyResponse = await fetch(`${API_BASE_URL}/history/${selectedChannel}`)
-        if (!historyResponse.ok) throw new Error(`Failed to fetch history for channel ${selectedChannel}`)
-        const channelHistory = await historyResponse.json()
+        const membersResponse = await apiFetch(`/channels/${selectedChannel}/members`)
+        if (!membersResponse.ok) throw new Error(`Failed to fetch members for channel ${selectedChannel}`)
+        const membersData = await membersResponse.json()
 
         // チャンネルのメンバー一覧を生成
-        const usersInChannel = channelHistory.messages.map((historyItem: History) => {
-          const user = users.find((u) => u.user_key === historyItem.user_id)
-          return user ? user.user_name : "不明なユーザー"
-        }).filter((userName: string | null): userName is string => userName !== null)
-
-        setChannelUsers(Array.from(new Set(usersInChannel))) // 重複を排除
+        setChannelUsers(membersData.members.map((member: TeamMember) => member.user_name))
       } catch (error) {
-        console.error("履歴の取得に失敗しました:", error)
+        console.error("メンバーの取得に失敗しました:", error)
       }
     }
 
-    fetchChannelHistory()
-  }, [selectedChannel, users])
+    fetchChannelMembers()
+  }, [selectedChannel])
+
+  // 選択されたチャンネルの会話履歴を Slack から取り込む
+  const syncChannel = async () => {
+    if (!selectedChannel) return
+    try {
+      const job = await runJob(`/channels/${selectedChannel}/sync`)
+      alert(`会話履歴の取り込みが成功しました（${job.processed}件）`)
+    } catch (error) {
+      console.error("会話履歴の取り込みに失敗しました:", error)
+      alert("会話履歴の取り込みに失敗しました")
+    }
+  }
 
   // チャンネル選択時の処理
   const handleChannelChange = (event: SelectChangeEvent<string>) => {
@@ -73,8 +74,7 @@ export default function UsersPage() {
   // ユーザー初期化
   const initializeUsers = async () => {
     try {
-      const response = await fetch(`${API_BASE_URL}/users/init`, { method: "POST" })
-      if (!response.ok) throw new Error("Failed to initialize users")
+      await runJob("/users/init")
       alert("ユーザーの初期化が成功しました")
       window.location.reload() // ページを再読み込み
     } catch (error) {
@@ -86,8 +86,7 @@ export default function UsersPage() {
   // チャンネル初期化
   const initializeChannels = async () => {
     try {
-      const response = await fetch(`${API_BASE_URL}/channels/init`, { method: "POST" })
-      if (!response.ok) throw new Error("Failed to initialize channels")
+      await runJob("/channels/init")
       alert("チャンネルの初期化が成功しました")
       window.location.reload() // ページを再読み込み
     } catch (error) {
@@ -110,6 +109,9 @@ export default function UsersPage() {
         <Button variant="contained" color="secondary" onClick={initializeChannels}>
           チャンネル初期化
         </Button>
+        <Button variant="outlined" onClick={syncChannel} disabled={!selectedChannel}>
+          会話履歴を取り込む
+        </Button>
       </Stack>
 
       {/* チャンネル選択セレクタ */}
@@ -117,7 +119,7 @@ export default function UsersPage() {
         <InputLabel>チャンネルを選択</InputLabel>
         <Select value={selectedChannel} onChange={handleChannelChange}>
           {channels.map((channel) => (
-            <MenuItem key={channel.channel_id} value={channel.channel_id}>
+            <MenuItem key={channel.channel_id} value={String(channel.id)}>
               {channel.channel_name}
             </MenuItem>
           ))}
@@ -0,0 +1,26 @@
+import { apiFetch } from "@/api"
+import { SyncJob } from "@/type"
+
+// 同期ジョブが終了するまで状態を確認し、終了したジョブを返す
+export async function waitForJob(jobId: number, intervalMs = 1000): Promise<SyncJob> {
+  for (;;) {
+    const response = await apiFetch(`/jobs/${jobId}`)
+    if (!response.ok) throw new Error(`Failed to fetch job ${jobId}`)
+    const { job } = (await response.json()) as { job: SyncJob }
+    if (job.status === "succeeded" || job.status === "failed") return job
+    await new Promise((resolve) => setTimeout(resolve, intervalMs))
+  }
+}
+
+// 同期ジョブを開始し、終了するまで待つ。失敗した場合は例外を投げる
+// 同じ同期が既に実行中（409）の場合は、実行中のジョブの終了を待つ
+export async function runJob(path: string): Promise<SyncJob> {
+  const response = await apiFetch(`${path}`, { method: "POST" })
+  const body = await response.json()
+  if (!response.ok && !(response.status === 409 && body.job_id)) {
+    throw new Error(body.error ?? `Failed to start job: ${path}`)
+  }
+  const job = await waitForJob(body.job_id)
+  if (job.status === "failed") throw new Error(job.error)
+  return job
+}
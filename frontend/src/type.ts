@@ -5,12 +5,37 @@ export interface User {
   user_name: string; // ユーザー名（表示名または実名）
   grade: number; // ユーザーのグレード
   team_key: number; // チームキー
+  is_bot: boolean; // Slack のボットユーザー
+  is_deleted: boolean; // Slack 上で削除済み
+  role: "admin" | "lead" | "member"; // ダッシュボードでの権限
+  workspace_id: number; // ワークスペースのID
+  opted_out: boolean; // 追跡から除外されている
+}
+
+// チームメンバーの型
+export interface TeamMember extends User {
+  source: "slack" | "manual"; // 所属の由来
 }
 
 // チャンネルの型
 export interface Channel {
+  id: number; // team_key として使用
   channel_id: string; // SlackのチャンネルID
   channel_name: string; // チャンネル名
+  is_tracked: boolean; // false の場合は同期・集計の対象外
+  workspace_id: number; // ワークスペースのID
+  opted_out: boolean; // 追跡から除外されている
+}
+
+// Slack アプリをインストールしたワークスペースの型
+export interface Workspace {
+  id: number;
+  slack_team_id: string; // Slack のワークスペースID
+  name: string;
+  url: string;
+  bot_user_id: string;
+  installed_at: string;
+  updated_at: string;
 }
 
 // 投稿履歴の型
@@ -18,6 +43,45 @@ export interface History {
   channel_id: string;
   text?: string;
   timestamp: string;
+  ts: string; // Slack のメッセージID
+  thread_ts?: string;
+  subtype: string; // 通常の投稿は空。"channel_join", "bot_message" など
+  bot_id?: string;
   user_id: string;
   workspace_id: string;
-}
\ No newline at end of file
+  grade: number | null; // 投稿時点のグレード
+  team_key: number | null; // 投稿時点のチームキー
+  is_thread_reply: boolean;
+  reply_count: number; // スレッドの返信数（スレッドの親メッセージのみ）
+  latest_reply?: string;
+  user_name: string; // 投稿者の表示名（不明な場合は空）
+  channel_name: string;
+  permalink?: string; // Slack のメッセージへのリンク
+  plain_text: string; // 本文から書式を除き、メンションを名前にしたもの
+  html: string; // 本文を表示用の安全な HTML にしたもの
+  reactions: Reaction[];
+  edited_at: string | null; // 最後に編集された日時
+  deleted_at?: string; // Slack で削除された日時（include_deleted=true の場合のみ）
+}
+// メッセージに付いた絵文字ごとのリアクション
+export interface Reaction {
+  emoji: string; // 絵文字の名前（コロンなし）
+  users: string[]; // リアクションしたユーザーの Slack ユーザーID
+  count: number;
+}
+// 同期ジョブの型
+export interface SyncJob {
+  id: number;
+  kind: string;
+  resource: string;
+  status: "queued" | "running" | "succeeded" | "failed";
+  processed: number; // 処理済み件数
+  total: number; // 全体の件数（不明な場合は 0）
+  error?: string;
+  window: { oldest?: string; latest?: string }; // 期間指定の取り込みの期間（Slack ts）
+  checkpoint?: string; // 期間指定の取り込みで保存済みの最も古い ts
+  created_at: string;
+  started_at: string | null;
+  finished_at: string | null;
+  updated_at: string;
+}